@@ -0,0 +1,264 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/openvpn/pki"
+	"openvpn-admin-go/services"
+
+	"github.com/spf13/cobra"
+)
+
+// caCmd 签发 CA 管理：离线根 CA + 在线中间 CA，以及 CA 轮换。
+//
+// 离线根 CA 的典型流程：
+//  1. 离线机器：  openvpn-go ca init-root --out /media/usb
+//  2. VPN 服务器：openvpn-go ca csr --out intermediate.csr
+//  3. 离线机器：  openvpn-go ca sign --root-dir /media/usb --csr intermediate.csr --out intermediate.crt
+//  4. VPN 服务器：openvpn-go ca rotate --cert intermediate.crt --chain root-ca.crt --root-crl root-crl.pem
+//
+// 之后 Web 服务在后台为所有用户换发新证书，全员用新证书重连后自动退役旧 CA。
+var caCmd = &cobra.Command{
+	Use:   "ca",
+	Short: "签发 CA 管理（离线根 CA / 中间 CA / CA 轮换）",
+}
+
+// offlineCACommands 在离线根 CA 机器上运行的子命令：不需要 OpenVPN 环境和数据库，跳过核心初始化
+var offlineCACommands = map[string]bool{"init-root": true, "sign": true}
+
+// NeedsCoreInit 命令行参数对应的命令是否需要核心初始化（环境检查、数据库）。
+// vpn-auth 由 OpenVPN 以 nobody 身份在每次连接时调用，只自行连接数据库。
+func NeedsCoreInit(args []string) bool {
+	if len(args) >= 1 && args[0] == vpnAuthCmd.Name() {
+		return false
+	}
+	return !(len(args) >= 2 && args[0] == caCmd.Name() && offlineCACommands[args[1]])
+}
+
+const (
+	rootCACertFile = "root-ca.crt"
+	rootCAKeyFile  = "root-ca.key"
+	rootCRLFile    = "root-crl.pem"
+)
+
+var caInitRootCmd = &cobra.Command{
+	Use:   "init-root",
+	Short: "生成离线根 CA（在离线机器上运行）",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		cn, _ := cmd.Flags().GetString("cn")
+		days, _ := cmd.Flags().GetInt("days")
+		alg := flagKeyAlgorithm(cmd)
+
+		if _, err := os.Stat(filepath.Join(out, rootCAKeyFile)); err == nil {
+			cliFail("%s 下已有根 CA 私钥，拒绝覆盖", out)
+		}
+		root, files, err := pki.NewCA(cn, time.Duration(days)*24*time.Hour, alg)
+		if err != nil {
+			cliFail("生成根CA失败: %v", err)
+		}
+		crl, err := pki.RootCRL(root, pki.DefaultCRLValidity)
+		if err != nil {
+			cliFail("生成根CA CRL失败: %v", err)
+		}
+		if err := os.MkdirAll(out, 0700); err != nil {
+			cliFail("创建目录失败: %v", err)
+		}
+		writeCAFile(filepath.Join(out, rootCAKeyFile), files.KeyPEM, 0600)
+		writeCAFile(filepath.Join(out, rootCACertFile), files.CertPEM, 0644)
+		writeCAFile(filepath.Join(out, rootCRLFile), crl, 0644)
+		fmt.Printf("根 CA 已生成到 %s（ID %s）。请妥善离线保存 %s。\n", out, pki.CAID(root.Cert), rootCAKeyFile)
+	},
+}
+
+var caCSRCmd = &cobra.Command{
+	Use:   "csr",
+	Short: "生成中间 CA 私钥与 CSR（私钥留在服务器上）",
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		cn, _ := cmd.Flags().GetString("cn")
+		csr, err := openvpn.NewIntermediateCSR(cn, flagKeyAlgorithm(cmd))
+		if err != nil {
+			cliFail("生成CSR失败: %v", err)
+		}
+		writeCAFile(out, csr, 0644)
+		fmt.Printf("CSR 已写入 %s，请在离线机器上用根 CA 签名（openvpn-go ca sign）\n", out)
+	},
+}
+
+var caSignCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "用离线根 CA 签发中间 CA 证书（在离线机器上运行）",
+	Run: func(cmd *cobra.Command, args []string) {
+		rootDir, _ := cmd.Flags().GetString("root-dir")
+		csrPath, _ := cmd.Flags().GetString("csr")
+		out, _ := cmd.Flags().GetString("out")
+		days, _ := cmd.Flags().GetInt("days")
+
+		root, err := pki.LoadCA(filepath.Join(rootDir, rootCACertFile), filepath.Join(rootDir, rootCAKeyFile))
+		if err != nil {
+			cliFail("加载根CA失败: %v", err)
+		}
+		csr, err := os.ReadFile(csrPath)
+		if err != nil {
+			cliFail("读取CSR失败: %v", err)
+		}
+		cert, err := pki.SignIntermediate(root, csr, time.Duration(days)*24*time.Hour)
+		if err != nil {
+			cliFail("签发中间CA失败: %v", err)
+		}
+		// 顺带刷新根 CA 的 CRL（有效期从现在重新计算）
+		crl, err := pki.RootCRL(root, pki.DefaultCRLValidity)
+		if err != nil {
+			cliFail("生成根CA CRL失败: %v", err)
+		}
+		writeCAFile(out, pki.EncodeCertificatePEM(cert), 0644)
+		writeCAFile(filepath.Join(rootDir, rootCRLFile), crl, 0644)
+		fmt.Printf("中间 CA %q 已签发到 %s，有效期至 %s。\n", cert.Subject.CommonName, out, cert.NotAfter.Format("2006-01-02"))
+		fmt.Printf("请把 %s、%s、%s 带回 VPN 服务器执行 openvpn-go ca rotate。\n", out,
+			filepath.Join(rootDir, rootCACertFile), filepath.Join(rootDir, rootCRLFile))
+	},
+}
+
+var caRotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "开始 CA 轮换（不带 --cert 时生成新的自签 CA）",
+	Run: func(cmd *cobra.Command, args []string) {
+		certPath, _ := cmd.Flags().GetString("cert")
+		if certPath == "" {
+			if err := openvpn.StartCARotation(flagKeyAlgorithm(cmd)); err != nil {
+				cliFail("开始CA轮换失败: %v", err)
+			}
+		} else {
+			chainPath, _ := cmd.Flags().GetString("chain")
+			crlPath, _ := cmd.Flags().GetString("root-crl")
+			certPEM := readCAFile(certPath)
+			chainPEM := readCAFile(chainPath)
+			crlPEM := readCAFile(crlPath)
+			if err := openvpn.StartCARotationWithIntermediate(certPEM, chainPEM, crlPEM); err != nil {
+				cliFail("开始CA轮换失败: %v", err)
+			}
+		}
+		fmt.Println("CA 轮换已开始：OpenVPN 同时信任新旧 CA，Web 服务会在后台为用户换发证书。")
+	},
+}
+
+var caStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "查看签发 CA 与轮换进度",
+	Run: func(cmd *cobra.Command, args []string) {
+		status, err := openvpn.GetCAStatus()
+		if err != nil {
+			cliFail("读取CA失败: %v", err)
+		}
+		printCAInfo("当前签发 CA", &status.Current)
+		if !status.Rotating {
+			fmt.Println("没有进行中的 CA 轮换")
+			return
+		}
+		printCAInfo("待退役 CA", status.Retiring)
+		if status.StartedAt != nil {
+			fmt.Printf("轮换开始于: %s\n", status.StartedAt.Format("2006-01-02 15:04:05"))
+		}
+		progress, err := services.GetCARotationProgress(database.DB, status.Current.ID)
+		if err != nil {
+			cliFail("统计轮换进度失败: %v", err)
+		}
+		fmt.Printf("需换证用户: %d，已签发新证书: %d，已用新证书连接: %d\n", progress.Users, progress.Reissued, progress.Reconnected)
+	},
+}
+
+var caRetireCmd = &cobra.Command{
+	Use:   "retire",
+	Short: "退役旧 CA，结束轮换",
+	Run: func(cmd *cobra.Command, args []string) {
+		force, _ := cmd.Flags().GetBool("force")
+		status, err := openvpn.GetCAStatus()
+		if err != nil {
+			cliFail("读取CA失败: %v", err)
+		}
+		if !status.Rotating {
+			fmt.Println("没有进行中的 CA 轮换")
+			return
+		}
+		progress, err := services.GetCARotationProgress(database.DB, status.Current.ID)
+		if err != nil {
+			cliFail("统计轮换进度失败: %v", err)
+		}
+		if !progress.Done() && !force {
+			cliFail("已用新证书连接的用户 %d/%d，确认要退役请加 --force", progress.Reconnected, progress.Users)
+		}
+		if err := services.RetireCA(database.DB); err != nil {
+			cliFail("退役旧CA失败: %v", err)
+		}
+		fmt.Println("旧 CA 已退役")
+	},
+}
+
+func printCAInfo(title string, info *openvpn.CAInfo) {
+	fmt.Printf("%s: %s（ID %s，%s）\n", title, info.Subject, info.ID, info.KeyAlgorithm)
+	fmt.Printf("  有效期: %s ~ %s\n", info.NotBefore.Format("2006-01-02"), info.NotAfter.Format("2006-01-02"))
+	if info.Intermediate {
+		fmt.Printf("  中间 CA，根 CA: %s\n", info.Root)
+	}
+}
+
+func flagKeyAlgorithm(cmd *cobra.Command) pki.KeyAlgorithm {
+	v, _ := cmd.Flags().GetString("alg")
+	if v == "" {
+		return keyAlgorithm()
+	}
+	alg, err := pki.ParseKeyAlgorithm(v)
+	if err != nil {
+		cliFail("%v", err)
+	}
+	return alg
+}
+
+func readCAFile(path string) []byte {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		cliFail("读取 %s 失败: %v", path, err)
+	}
+	return data
+}
+
+func writeCAFile(path string, data []byte, perm os.FileMode) {
+	if err := pki.WriteFileAtomic(path, data, perm); err != nil {
+		cliFail("写入 %s 失败: %v", path, err)
+	}
+}
+
+func init() {
+	caInitRootCmd.Flags().String("out", ".", "根 CA 输出目录")
+	caInitRootCmd.Flags().String("cn", "OpenVPN-Root-CA", "根 CA 名称")
+	caInitRootCmd.Flags().Int("days", int(pki.DefaultCAValidity/(24*time.Hour)), "根 CA 有效期（天）")
+	caInitRootCmd.Flags().String("alg", "", "密钥算法（默认跟随 OpenVPN 配置）")
+
+	caCSRCmd.Flags().String("out", "intermediate.csr", "CSR 输出文件")
+	caCSRCmd.Flags().String("cn", "", "中间 CA 名称（默认 OpenVPN-Intermediate-CA-<日期>）")
+	caCSRCmd.Flags().String("alg", "", "密钥算法（默认跟随 OpenVPN 配置）")
+
+	caSignCmd.Flags().String("root-dir", ".", "根 CA 所在目录（init-root 的输出）")
+	caSignCmd.Flags().String("csr", "intermediate.csr", "中间 CA 的 CSR")
+	caSignCmd.Flags().String("out", "intermediate.crt", "中间 CA 证书输出文件")
+	caSignCmd.Flags().Int("days", int(pki.DefaultIntermediateValidity/(24*time.Hour)), "中间 CA 有效期（天）")
+
+	caRotateCmd.Flags().String("cert", "", "离线根 CA 签好的中间 CA 证书")
+	caRotateCmd.Flags().String("chain", "", "中间 CA 之上的证书（根 CA 证书）")
+	caRotateCmd.Flags().String("root-crl", "", "根 CA 签发的 CRL")
+	caRotateCmd.Flags().String("alg", "", "新自签 CA 的密钥算法（默认跟随 OpenVPN 配置）")
+
+	caRetireCmd.Flags().Bool("force", false, "不等所有用户用新证书重连就退役")
+
+	caCmd.AddCommand(caInitRootCmd, caCSRCmd, caSignCmd, caRotateCmd, caStatusCmd, caRetireCmd)
+	rootCmd.AddCommand(caCmd)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
+
+	"github.com/spf13/cobra"
+)
+
+// ccdCmd 管理用户的客户端专属网络设置（CCD）：固定 IP、子网、推送的路由与 DNS 等。
+// 设置保存在数据库中，CCD 文件由程序整体生成，不要手工编辑。
+var ccdCmd = &cobra.Command{
+	Use:   "ccd",
+	Short: "客户端专属网络设置（推送的路由、DNS 等）",
+}
+
+var ccdShowCmd = &cobra.Command{
+	Use:   "show <用户名>",
+	Short: "查看用户生成的 CCD 文件内容（含继承的部门网络策略）",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		user := ccdUser(args[0])
+		spec, _, err := services.EffectiveClientCCD(database.DB, user)
+		if err != nil {
+			cliFail("读取CCD设置失败: %v", err)
+		}
+		if spec.Empty() {
+			fmt.Printf("用户 %s 没有专属网络设置，部门也没有网络策略，使用服务端的全局推送\n", user.Name)
+			return
+		}
+		cfg, err := openvpn.LoadConfig()
+		if err != nil {
+			cliFail("加载配置失败: %v", err)
+		}
+		content, err := openvpn.RenderClientCCD(spec, cfg)
+		if err != nil {
+			cliFail("生成CCD失败: %v", err)
+		}
+		fmt.Print(content)
+	},
+}
+
+var ccdSetCmd = &cobra.Command{
+	Use:   "set <用户名>",
+	Short: "修改用户自己的 CCD 设置（只修改指定的选项，列表选项传空值清空并沿用部门策略）",
+	Example: `  openvpn-go ccd set alice --route 10.20.0.0/16 --route 10.30.1.0/24 --dns 10.20.0.53 --search-domain corp.example
+  openvpn-go ccd set alice --push-reset --redirect-gateway "def1 bypass-dhcp"
+  openvpn-go ccd set alice --route "" --directive 'push "block-outside-dns"'`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		user := ccdUser(args[0])
+		spec, err := services.GetClientCCD(database.DB, user)
+		if err != nil {
+			cliFail("读取CCD设置失败: %v", err)
+		}
+		flags := cmd.Flags()
+		if flags.Changed("fixed-ip") {
+			spec.FixedIP, _ = flags.GetString("fixed-ip")
+		}
+		if flags.Changed("fixed-ipv6") {
+			spec.FixedIPv6, _ = flags.GetString("fixed-ipv6")
+		}
+		if flags.Changed("subnet") {
+			spec.Subnet, _ = flags.GetString("subnet")
+		}
+		if flags.Changed("push-reset") {
+			spec.PushReset, _ = flags.GetBool("push-reset")
+		}
+		if flags.Changed("route") {
+			spec.Routes, _ = flags.GetStringSlice("route")
+		}
+		if flags.Changed("dns") {
+			spec.DNSServers, _ = flags.GetStringSlice("dns")
+		}
+		if flags.Changed("search-domain") {
+			spec.SearchDomains, _ = flags.GetStringSlice("search-domain")
+		}
+		if flags.Changed("redirect-gateway") {
+			spec.RedirectGateway, _ = flags.GetString("redirect-gateway")
+		}
+		if flags.Changed("directive") {
+			spec.Directives, _ = flags.GetStringArray("directive")
+		}
+		if err := services.SaveClientCCD(database.DB, user, spec); err != nil {
+			cliFail("保存CCD设置失败: %v", err)
+		}
+		fmt.Printf("用户 %s 的CCD设置已保存，客户端下次连接时生效\n", user.Name)
+	},
+}
+
+func ccdUser(name string) *model.User {
+	var user model.User
+	if err := database.DB.Where("name = ?", strings.TrimSpace(name)).First(&user).Error; err != nil {
+		cliFail("用户 %s 不存在", name)
+	}
+	return &user
+}
+
+func init() {
+	ccdSetCmd.Flags().String("fixed-ip", "", "固定隧道地址，auto 自动分配（空值取消）")
+	ccdSetCmd.Flags().String("fixed-ipv6", "", "固定 IPv6 隧道地址，需服务端配置 IPv6 前缀（空值取消）")
+	ccdSetCmd.Flags().String("subnet", "", "客户端背后的网络（CIDR，空值取消）")
+	ccdSetCmd.Flags().Bool("push-reset", false, "不继承服务端的全局推送")
+	ccdSetCmd.Flags().StringSlice("route", nil, "推送的路由（IPv4 或 IPv6 CIDR，可重复）")
+	ccdSetCmd.Flags().StringSlice("dns", nil, "推送的 DNS 服务器（可重复）")
+	ccdSetCmd.Flags().StringSlice("search-domain", nil, "推送的搜索域（可重复，第一个同时作为 DOMAIN）")
+	ccdSetCmd.Flags().String("redirect-gateway", "", `全部流量走 VPN，如 "def1 bypass-dhcp"（空值取消）`)
+	ccdSetCmd.Flags().StringArray("directive", nil, `其他指令，如 'push "block-outside-dns"'（可重复）`)
+
+	ccdCmd.AddCommand(ccdShowCmd, ccdSetCmd)
+	rootCmd.AddCommand(ccdCmd)
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -13,6 +14,7 @@ import (
 	"openvpn-admin-go/logging"
 	"openvpn-admin-go/model"
 	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
 
 	"github.com/manifoldco/promptui"
 )
@@ -28,8 +30,9 @@ func ClientMenu() {
 		fmt.Println("4. 恢复客户端")
 		fmt.Println("5. 查看客户端状态")
 		fmt.Println("6. 查看所有客户端")
+		fmt.Println("7. 续签客户端证书")
 		fmt.Println("0. 返回主菜单")
-		fmt.Print("请选择操作 (0-6): ")
+		fmt.Print("请选择操作 (0-7): ")
 
 		reader := bufio.NewReader(os.Stdin)
 		input, err := reader.ReadString('\n')
@@ -73,8 +76,10 @@ func ClientMenu() {
 			ViewClientStatus()
 		case 6:
 			ListClients()
+		case 7:
+			RenewClient()
 		default:
-			fmt.Println("无效的选择，请输入0-6之间的数字")
+			fmt.Println("无效的选择，请输入0-7之间的数字")
 		}
 	}
 }
@@ -86,6 +91,18 @@ func CreateClient() error {
 		return err
 	}
 
+	// 数据库中已有该用户时按其部门/角色的有效期签发并登记证书，否则使用默认有效期
+	var user model.User
+	if err := database.DB.Where("name = ?", username).First(&user).Error; err == nil {
+		if err := services.IssueUserCertificate(database.DB, &user); errors.Is(err, services.ErrCSRRequired) {
+			fmt.Printf("用户 %s 所在部门要求 CSR 自助签发，请让用户通过 Web 接口上传 CSR（POST /api/client/enroll）\n", username)
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("创建客户端失败: %v", err)
+		}
+		return nil
+	}
+
 	// 调用openvpn包中的函数创建客户端
 	if err := openvpn.CreateClient(username); err != nil {
 		return fmt.Errorf("创建客户端失败: %v", err)
@@ -94,6 +111,36 @@ func CreateClient() error {
 	return nil
 }
 
+// RenewClient 续签客户端证书：吊销旧证书并重新生成 .ovpn
+func RenewClient() {
+	// 先显示所有客户端列表
+	fmt.Println("=== 当前客户端列表 ===")
+	showClientList()
+
+	username, err := getUsername()
+	if err != nil {
+		logging.Error("获取用户名失败: %v", err)
+		return
+	}
+
+	var user model.User
+	if err := database.DB.Where("name = ?", username).First(&user).Error; err != nil {
+		fmt.Printf("数据库中未找到用户 %s: %v\n", username, err)
+		return
+	}
+
+	cert, err := services.RenewUserCertificate(database.DB, &user)
+	if cert == nil {
+		logging.Error("续签证书失败: %v", err)
+		return
+	}
+	if err != nil {
+		fmt.Printf("新证书已生效，但吊销旧证书失败: %v\n", err)
+	}
+	fmt.Printf("客户端 %s 证书已续签，序列号: %s，有效期至: %s\n", username, cert.Serial, cert.NotAfter.Format("2006-01-02 15:04:05"))
+	fmt.Println("请重新下载 .ovpn 配置文件")
+}
+
 func DeleteClient() {
 	// 先显示所有客户端列表
 	fmt.Println("=== 当前客户端列表 ===")
@@ -208,6 +255,9 @@ func ViewClientStatus() {
 	fmt.Printf("角色: %s\n", user.Role)
 	fmt.Printf("部门ID: %s\n", user.DepartmentID)
 	fmt.Printf("固定IP: %s\n", user.FixedIP)
+	if user.FixedIPv6 != "" {
+		fmt.Printf("固定IPv6: %s\n", user.FixedIPv6)
+	}
 	fmt.Printf("子网: %s\n", user.Subnet)
 	fmt.Printf("是否暂停: %t\n", user.IsPaused)
 	fmt.Printf("创建时间: %s\n", user.CreatedAt.Format("2006-01-02 15:04:05"))
@@ -231,6 +281,9 @@ func ViewClientStatus() {
 	fmt.Printf("接收字节: %d\n", status.BytesReceived)
 	fmt.Printf("发送字节: %d\n", status.BytesSent)
 	fmt.Printf("虚拟地址: %s\n", status.VirtualAddress)
+	if status.VirtualIPv6Address != "" {
+		fmt.Printf("虚拟IPv6地址: %s\n", status.VirtualIPv6Address)
+	}
 	fmt.Printf("真实地址: %s\n", status.RealAddress)
 }
 
@@ -9,12 +9,22 @@ import (
 
 	"openvpn-admin-go/constants"
 	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/openvpn/pki"
 	"openvpn-admin-go/utils"
 )
 
 // ErrRootRequired 表示自动安装环境需要 root 权限
 var ErrRootRequired = errors.New("自动安装需要 root 权限")
 
+// keyAlgorithm 读取配置中的密钥算法（配置不可用时用默认 RSA-2048）
+func keyAlgorithm() pki.KeyAlgorithm {
+	cfg, err := openvpn.LoadConfig()
+	if err != nil {
+		return pki.DefaultKeyAlgorithm
+	}
+	return cfg.KeyAlgorithm()
+}
+
 func CheckCertFiles() error {
 	// 定义需要检查的证书文件
 	certFiles := []string{
@@ -22,7 +32,10 @@ func CheckCertFiles() error {
 		"ca.key",
 		"server.crt",
 		"server.key",
-		"dh.pem",
+	}
+	// 椭圆曲线算法使用 `dh none`，不需要 dh.pem
+	if !keyAlgorithm().IsEC() {
+		certFiles = append(certFiles, "dh.pem")
 	}
 
 	// 检查服务器目录下的证书文件
@@ -60,9 +73,11 @@ func checkCertificates() error {
 		constants.ServerCAKeyPath,
 		constants.ServerCertPath,
 		constants.ServerKeyPath,
-		constants.ServerDHPath,
 		constants.ServerTLSKeyPath,
 	}
+	if !keyAlgorithm().IsEC() {
+		requiredFiles = append(requiredFiles, constants.ServerDHPath)
+	}
 
 	for _, file := range requiredFiles {
 		if _, err := os.Stat(file); os.IsNotExist(err) {
@@ -119,35 +134,49 @@ func generateCertificates() error {
 		return fmt.Errorf("设置 ccd 目录权限失败: %v", err)
 	}
 
-	// 生成DH参数
-	if err := utils.ExecCommand(fmt.Sprintf("openssl dhparam -out %s 2048", constants.ServerDHPath)); err != nil {
-		return fmt.Errorf("生成DH参数失败: %v", err)
+	alg := keyAlgorithm()
+	fmt.Printf("证书密钥算法: %s\n", alg)
+
+	// 生成DH参数：仅 RSA 需要；椭圆曲线算法在 server.conf 中使用 `dh none` + ecdh-curve
+	if !alg.IsEC() {
+		if err := utils.ExecCommand(fmt.Sprintf("openssl dhparam -out %s 2048", constants.ServerDHPath)); err != nil {
+			return fmt.Errorf("生成DH参数失败: %v", err)
+		}
 	}
 
 	// 生成CA证书
-	if err := utils.ExecCommand(fmt.Sprintf("openssl req -x509 -newkey rsa:2048 -keyout %s -out %s -days 3650 -nodes -subj '/CN=OpenVPN-CA'", constants.ServerCAKeyPath, constants.ServerCACertPath)); err != nil {
+	ca, caFiles, err := pki.NewCA("OpenVPN-CA", pki.DefaultCAValidity, alg)
+	if err != nil {
 		return fmt.Errorf("生成CA证书失败: %v", err)
 	}
-
-	// 生成服务器证书
-	if err := utils.ExecCommand(fmt.Sprintf("openssl req -newkey rsa:2048 -keyout %s -out %s -nodes -subj '/CN=OpenVPN-Server'", constants.ServerKeyPath, filepath.Join(serverDir, "server.csr"))); err != nil {
-		return fmt.Errorf("生成服务器证书请求失败: %v", err)
+	if err := os.WriteFile(constants.ServerCAKeyPath, caFiles.KeyPEM, 0600); err != nil {
+		return fmt.Errorf("写入CA密钥失败: %v", err)
+	}
+	if err := os.WriteFile(constants.ServerCACertPath, caFiles.CertPEM, 0644); err != nil {
+		return fmt.Errorf("写入CA证书失败: %v", err)
 	}
 
-	// 签名服务器证书
-	if err := utils.ExecCommand(fmt.Sprintf("openssl x509 -req -in %s -CA %s -CAkey %s -CAcreateserial -out %s -days 3650 -extfile %s", filepath.Join(serverDir, "server.csr"), constants.ServerCACertPath, constants.ServerCAKeyPath, constants.ServerCertPath, filepath.Join(serverDir, "openssl-server.ext"))); err != nil {
+	// 生成并签名服务器证书
+	store, err := pki.OpenStore(constants.ServerPKIDBPath)
+	if err != nil {
+		return fmt.Errorf("打开证书数据库失败: %v", err)
+	}
+	server, err := pki.New(ca, store).IssueServer("OpenVPN-Server", pki.DefaultClientValidity, alg)
+	if err != nil {
 		return fmt.Errorf("签名服务器证书失败: %v", err)
 	}
+	if err := os.WriteFile(constants.ServerKeyPath, server.KeyPEM, 0600); err != nil {
+		return fmt.Errorf("写入服务器密钥失败: %v", err)
+	}
+	if err := os.WriteFile(constants.ServerCertPath, server.CertPEM, 0644); err != nil {
+		return fmt.Errorf("写入服务器证书失败: %v", err)
+	}
 
 	// 生成TLS密钥
 	if err := utils.ExecCommand(fmt.Sprintf("openvpn --genkey secret %s", constants.ServerTLSKeyPath)); err != nil {
 		return fmt.Errorf("生成TLS密钥失败: %v", err)
 	}
 
-	// 清理临时文件
-	os.Remove(filepath.Join(serverDir, "server.csr"))
-	os.Remove(filepath.Join(serverDir, "ca.srl"))
-
 	return nil
 }
 
@@ -103,6 +103,9 @@ func ShowConfig(cfg *openvpn.Config) {
 	fmt.Printf("协议: %s\n", cfg.OpenVPNProto)
 	fmt.Printf("服务器网络: %s\n", cfg.OpenVPNServerNetwork)
 	fmt.Printf("子网掩码: %s\n", cfg.OpenVPNServerNetmask)
+	if cfg.IPv6Enabled() {
+		fmt.Printf("IPv6网络: %s\n", cfg.OpenVPNServerIPv6)
+	}
 	fmt.Printf("客户端配置目录: %s\n", cfg.OpenVPNClientConfigDir)
 	fmt.Printf("TLS版本: %s\n", cfg.OpenVPNTLSVersion)
 	fmt.Printf("状态日志路径: %s\n", cfg.OpenVPNStatusLogPath)
@@ -111,6 +114,12 @@ func ShowConfig(cfg *openvpn.Config) {
 	fmt.Scanln()
 }
 
+// cliFail 打印错误并退出。离线子命令（ca、ccd 等）不初始化日志系统，不能用 logging.Fatal。
+func cliFail(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, format+"\n", args...)
+	os.Exit(1)
+}
+
 func Execute() {
 	// webCmd is added to rootCmd in cmd/web.go's init()
 	rootCmd.AddCommand(logCmd)
@@ -0,0 +1,107 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
+
+	"github.com/spf13/cobra"
+)
+
+// vpnAuthCmd OpenVPN auth-user-pass-verify 调用的校验命令（不是给人用的）：
+//
+//	auth-user-pass-verify "/app/openvpn-go vpn-auth --mode otp --env /etc/openvpn/server/vpn-auth.env" via-file
+//
+// OpenVPN 在参数末尾追加临时文件路径（首行用户名、次行密码），证书 CN 由环境变量 common_name 传入。
+// 退出码 0 放行，非 0 拒绝。
+var vpnAuthCmd = &cobra.Command{
+	Use:    "vpn-auth <credentials-file>",
+	Short:  "校验 VPN 连接的动态口令（由 OpenVPN auth-user-pass-verify 调用）",
+	Hidden: true,
+	Args:   cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modeStr, _ := cmd.Flags().GetString("mode")
+		envFile, _ := cmd.Flags().GetString("env")
+
+		mode, err := openvpn.ParseVPNAuthMode(modeStr)
+		if err != nil {
+			vpnAuthReject("%v", err)
+		}
+		if envFile != "" {
+			if err := loadEnvFile(envFile); err != nil {
+				vpnAuthReject("读取数据库配置失败: %v", err)
+			}
+		}
+		username, password, err := readVPNCredentials(args[0])
+		if err != nil {
+			vpnAuthReject("读取用户名/密码失败: %v", err)
+		}
+		commonName := os.Getenv("common_name")
+		if commonName == "" {
+			vpnAuthReject("缺少证书 CN")
+		}
+
+		if err := database.Init(); err != nil {
+			vpnAuthReject("%v", err)
+		}
+		if err := services.VerifyVPNLogin(database.DB, mode, commonName, username, password, time.Now()); err != nil {
+			vpnAuthReject("拒绝 %s: %v", commonName, err)
+		}
+		os.Exit(0)
+	},
+}
+
+// vpnAuthReject 写一行原因到 OpenVPN 日志并以非 0 退出（拒绝连接）
+func vpnAuthReject(format string, args ...interface{}) {
+	fmt.Fprintf(os.Stderr, "vpn-auth: "+format+"\n", args...)
+	os.Exit(1)
+}
+
+// readVPNCredentials 读取 via-file 临时文件：首行用户名，次行密码
+func readVPNCredentials(path string) (username, password string, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	lines := strings.SplitN(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n", 3)
+	if len(lines) < 2 {
+		return "", "", fmt.Errorf("malformed credentials file")
+	}
+	return lines[0], lines[1], nil
+}
+
+// loadEnvFile 把 KEY=VALUE 文件（vpn-auth.env）载入当前进程环境；空行与 # 注释忽略
+func loadEnvFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("invalid line %q", line)
+		}
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func init() {
+	vpnAuthCmd.Flags().String("mode", string(openvpn.VPNAuthOTP), "二次验证方式（otp / password+otp）")
+	vpnAuthCmd.Flags().String("env", "", "数据库连接参数文件（KEY=VALUE）")
+	rootCmd.AddCommand(vpnAuthCmd)
+}
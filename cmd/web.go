@@ -9,13 +9,19 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"openvpn-admin-go/constants"
 	"openvpn-admin-go/database"
+	"openvpn-admin-go/directory"
 	"openvpn-admin-go/logging"
+	"openvpn-admin-go/mailer"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
 	"openvpn-admin-go/openvpn"
 	"openvpn-admin-go/router"
 	"openvpn-admin-go/services"
+	"openvpn-admin-go/sso"
 	"openvpn-admin-go/utils"
 
 	"github.com/gin-gonic/gin"
@@ -233,7 +239,26 @@ func runWebServer(port int) error {
 
 	ctx, cancel := context.WithCancel(context.Background())
 	var wg sync.WaitGroup
-	services.StartOpenVPNSyncService(ctx, &wg, database.DB, statusLogPath, syncInterval)
+	// 管理接口长连接：断线自动重连，暂停/删除用户时的 kill 复用同一连接；
+	// 连接可用时每个同步周期经管理接口 "status 2" 对账，断开期间回退为轮询 status.log
+	mc := openvpn.Management()
+	services.StartOpenVPNSyncService(ctx, &wg, database.DB, mc, statusLogPath, syncInterval)
+	services.StartQuotaService(ctx, &wg, database.DB)
+	services.StartCertExpiryService(ctx, &wg, database.DB, time.Duration(utils.GetCertExpiryWarnDays())*24*time.Hour)
+	services.StartCARotationService(ctx, &wg, database.DB)
+	// LDAP / Active Directory（config/ldap.json 存在时启用）
+	if err := directory.Init(); err != nil {
+		logging.Error("LDAP 配置无效，目录登录与同步未启用: %v", err)
+	} else if dirCfg := directory.Current(); dirCfg != nil {
+		services.StartDirectorySyncService(ctx, &wg, database.DB, dirCfg)
+	}
+	// OIDC 单点登录（config/oidc.json 存在时启用）
+	if err := sso.Init(); err != nil {
+		logging.Error("OIDC 配置无效，单点登录未启用: %v", err)
+	}
+	mc.Start(ctx)
+	// 验证邮件 / 重置密码邮件的传输（SMTP_*）
+	mailer.Init()
 
 	// 监听系统信号，优雅退出
 	go func() {
@@ -247,6 +272,31 @@ func runWebServer(port int) error {
 		os.Exit(0)
 	}()
 
+	// 每个请求校验访问令牌的登录会话未被吊销
+	middleware.SessionActive = func(sessionID, userID string) bool {
+		return services.LoginSessionActive(database.DB, sessionID, userID)
+	}
+	// 角色权限：新增的权限按默认值授予一次，之后以数据库（superadmin 的编辑）为准
+	if err := services.SyncPermissionRegistry(database.DB); err != nil {
+		return fmt.Errorf("加载角色权限失败: %v", err)
+	}
+	middleware.RoleHasPermission = services.RoleHasPermission
+
+	// Authorization: Bearer pat_... 的个人 API 令牌
+	middleware.APITokenAuth = func(token, clientIP string) (*middleware.Claims, []string, error) {
+		return services.APITokenClaims(database.DB, token, clientIP)
+	}
+
+	// 限流计数：database 时多副本共享、重启保留
+	if utils.GetRateLimitBackend() == "database" {
+		middleware.RateLimitBackend = services.NewDBRateLimitStore(database.DB)
+	}
+
+	// 写操作审计事件保存到 audit_events
+	middleware.AuditRecorder = func(ev *model.AuditEvent) {
+		services.RecordAuditEvent(database.DB, ev)
+	}
+
 	// Setup Gin router
 	r := gin.Default()
 
@@ -254,15 +304,8 @@ func runWebServer(port int) error {
 	r.Use(logging.GinLoggingMiddleware())
 
 	api := r.Group("/api")
-	{
-		router.SetupHealthRoutes(api)
-		router.SetupUserRoutes(api)
-		router.SetupManageRoutes(api)
-		router.SetupServerRoutes(api)
-		router.SetupClientRoutes(api)
-		router.SetupLogRoutes(api)
-		router.SetupNotificationRoutes(api)
-	}
+	api.Use(middleware.AuditTrail())
+	router.SetupAPIRoutes(api)
 
 	serverAddr := fmt.Sprintf(":%d", port)
 	logging.Info("Web 服务器正在监听 %s...", serverAddr)
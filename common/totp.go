@@ -0,0 +1,108 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP 参数（RFC 6238）：30 秒一步、6 位、HMAC-SHA1，与常见验证器 App 的默认值一致
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew 允许前后各偏差一个时间步（客户端时钟误差）
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret 生成 160 位随机 TOTP 密钥（base32，无填充）
+func GenerateTOTPSecret() (string, error) {
+	raw := make([]byte, 20)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(raw), nil
+}
+
+// TOTPProvisioningURI 验证器 App 扫码用的 otpauth:// URI（前端渲染为二维码）
+func TOTPProvisioningURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// ValidateTOTP 校验 t 时刻的验证码，返回匹配的时间步。步数 <= lastStep 的验证码视为重放，拒绝。
+func ValidateTOTP(secret, code string, t time.Time, lastStep int64) (int64, bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != totpDigits {
+		return 0, false
+	}
+	key, err := totpEncoding.DecodeString(strings.ToUpper(strings.TrimRight(secret, "=")))
+	if err != nil {
+		return 0, false
+	}
+	now := t.Unix() / totpPeriod
+	for step := now - totpSkew; step <= now+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode HOTP(key, step)（RFC 4226 动态截断）
+func totpCode(key []byte, step int64) string {
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	v := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	mod := uint32(1)
+	for i := 0; i < totpDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", totpDigits, v%mod)
+}
+
+// GenerateRecoveryCodes 生成 n 个一次性恢复码（形如 xxxxx-xxxxx），返回明文（只展示一次）与哈希
+func GenerateRecoveryCodes(n int) (codes, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, nil, err
+		}
+		s := hex.EncodeToString(raw)
+		code := s[:5] + "-" + s[5:]
+		codes = append(codes, code)
+		hashes = append(hashes, HashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode 恢复码的存储形式（忽略大小写、空格与连字符）。恢复码本身有 40 位随机熵，
+// 用 SHA-256 即可，不必 bcrypt。
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer(" ", "", "-", "").Replace(strings.TrimSpace(code)))
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
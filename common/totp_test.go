@@ -0,0 +1,77 @@
+package common
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 附录 B 的 SHA1 测试向量（取后 6 位）
+func TestTOTPRFC6238Vectors(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for ts, code := range vectors {
+		step, ok := ValidateTOTP(secret, code, time.Unix(ts, 0), 0)
+		if !ok || step != ts/30 {
+			t.Errorf("t=%d code %s: step=%d ok=%v", ts, code, step, ok)
+		}
+	}
+}
+
+func TestTOTPSkewAndReplay(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := totpEncoding.DecodeString(secret)
+	now := time.Unix(1700000000, 0)
+	step := now.Unix() / 30
+
+	if _, ok := ValidateTOTP(secret, totpCode(key, step-1), now, 0); !ok {
+		t.Error("code from the previous step must be accepted")
+	}
+	if _, ok := ValidateTOTP(secret, totpCode(key, step-2), now, 0); ok {
+		t.Error("code two steps old must be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, totpCode(key, step), now, step); ok {
+		t.Error("already used step must be rejected")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Error("short code must be rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := TOTPProvisioningURI("Aegis", "admin@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/Aegis:admin@example.com?") || !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=Aegis") {
+		t.Errorf("unexpected URI %s", uri)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes, %d hashes", len(codes), len(hashes))
+	}
+	seen := map[string]bool{}
+	for i, c := range codes {
+		if seen[c] {
+			t.Errorf("duplicate code %s", c)
+		}
+		seen[c] = true
+		if HashRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(c, "-", ""))+" ") != hashes[i] {
+			t.Errorf("code %s must match regardless of case, spaces and dashes", c)
+		}
+	}
+}
@@ -31,11 +31,29 @@ const (
 	ServerDHPath     = "/etc/openvpn/server/dh.pem"
 	ServerTLSKeyPath = "/etc/openvpn/server/tls-auth.key"
 
+	// tls-crypt-v2：服务端密钥（包装每个用户的客户端密钥）与已吊销客户端密钥的 metadata 列表
+	ServerTLSCryptV2KeyPath     = "/etc/openvpn/server/tls-crypt-v2-server.key"
+	ServerTLSCryptV2RevokedPath = "/etc/openvpn/server/tls-crypt-v2-revoked.txt"
+
+	// vpn-auth 校验子命令的数据库连接参数（KEY=VALUE）。OpenVPN 以全新环境（且已降权为 nobody）
+	// 运行 auth-user-pass-verify，读不到 Web 进程的环境变量，只能从这里读取。
+	ServerVPNAuthEnvPath = "/etc/openvpn/server/vpn-auth.env"
+
 	// management 接口的密码文件：让 `management 127.0.0.1 7505 <file>` 带口令，
 	// 消除 "Using --management on a TCP port WITHOUT passwords" 警告。
 	// 文件首行即口令，OpenVPN 启动时(降权前,root)读取；PauseClient/auth 脚本连接后先发同一口令。
 	ServerMgmtPasswordPath = "/etc/openvpn/server/mgmt-pw.txt"
 
+	// session-event.sh 在 client-connect / client-disconnect 时各追加一行，状态同步读取：
+	// 连接记录带证书序列号（status 日志里没有），用于统计 CA 轮换中谁已用新证书连接；
+	// 断开记录带最终流量与时长，用于补记两次轮询之间开始又结束的会话。
+	// OpenVPN 降权后才运行脚本，文件由 EnsureServerHelperFiles 预先创建，属组 OpenVPNRuntimeGroup、权限 0660。
+	ServerSessionLogPath = "/etc/openvpn/server/session-events.log"
+
+	// OpenVPN 降权后使用的组（server.conf 的 group），由 EnsureRuntimeGroup 创建。
+	// 用专用组而不是 nogroup：其他以 nobody/nogroup 运行的服务读不到 vpn-auth.env 里的数据库口令、写不了会话记录。
+	OpenVPNRuntimeGroup = "openvpn"
+
 	// Default log paths
 	DefaultOpenVPNStatusLogPath = "/etc/openvpn/status.log"
 	DefaultOpenVPNLogPath       = "/etc/openvpn/openvpn.log"
@@ -44,11 +62,23 @@ const (
 	ServerIPPPath = "/etc/openvpn/server/ipp.txt"
 
 	// CRL（证书吊销列表）路径：删除用户时吊销其证书并重生成此文件，
-	// server.conf 通过 crl-verify 引用它。crl.cnf 是配套的 openssl CA 配置，
-	// ca-db/ 是 openssl ca 所需的最小数据库目录（index.txt / crlnumber / newcerts）。
-	ServerCRLPath    = "/etc/openvpn/server/crl.pem"
-	ServerCRLConfig  = "/etc/openvpn/server/crl.cnf"
-	ServerCRLDBDir   = "/etc/openvpn/server/ca-db"
+	// server.conf 通过 crl-verify 引用它。ServerPKIDBPath 是 openvpn/pki 的签发记录
+	// （序列号、有效期、吊销状态、CRL 序号）；ca-db/ 是旧版 openssl ca 的数据库目录，
+	// 仅在首次创建签发记录时导入一次。
+	ServerCRLPath   = "/etc/openvpn/server/crl.pem"
+	ServerCRLDBDir  = "/etc/openvpn/server/ca-db"
+	ServerPKIDBPath = "/etc/openvpn/server/ca-db/issued.json"
+
+	// 离线根 CA / CA 轮换：ca.crt + ca.key 始终是在线签发 CA（自签根或中间 CA）；
+	// ca-chain.crt 是签发 CA 之上的各级证书（中间 CA 时即根 CA），root-crl.pem 是离线根 CA
+	// 签发的 CRL；ca-bundle.crt 是 server.conf `ca` 与客户端 <ca> 使用的信任集合，轮换期间
+	// 同时包含新旧 CA。ca-retiring/ 存放轮换中的旧 CA（同样的文件名 + ca-db/），退役后改名归档。
+	// ca-pending.key 是已生成 CSR、等待离线根 CA 签名的中间 CA 私钥。
+	ServerCAChainPath      = "/etc/openvpn/server/ca-chain.crt"
+	ServerCABundlePath     = "/etc/openvpn/server/ca-bundle.crt"
+	ServerRootCRLPath      = "/etc/openvpn/server/root-crl.pem"
+	ServerCARetiringDir    = "/etc/openvpn/server/ca-retiring"
+	ServerCAPendingKeyPath = "/etc/openvpn/server/ca-pending.key"
 
 	// 客户端配置目录
 	ClientConfigDir = "/etc/openvpn/client"
@@ -80,6 +110,9 @@ const (
 	DefaultOpenVPNClientToClient   = false
 	DefaultOpenVPNClientConfigDir  = "/etc/openvpn/client"
 	DefaultOpenVPNTLSKeyPath       = "/etc/openvpn/server/tls-auth.key"
+	DefaultOpenVPNKeyAlgorithm     = "rsa2048"
+	DefaultOpenVPNTLSMode          = "tls-auth"
+	DefaultOpenVPNAuthMode         = "off"
 )
 
 // 默认路由配置
@@ -98,10 +131,12 @@ var OpenSSLExtFiles = []string{
 // 这些文件在初始化时从 <cwd>/file/ 复制到 /etc/openvpn/server/ 并 chmod 755
 // （见 cmd/environment.go generateCertificates）。
 // tls-verify.sh：按 CN 拉黑的脚本（替代旧的 auth-blacklist.sh）。
-// crl.cnf：证书吊销用的 openssl CA 配置。
+// tls-crypt-v2-verify.sh：按吊销列表拒绝已删除用户的 tls-crypt-v2 密钥。
+// session-event.sh：记录连接（证书序列号）与断开（最终流量与时长）事件。
 var BlacklistFile = []string{
 	"tls-verify.sh",
-	"crl.cnf",
+	"tls-crypt-v2-verify.sh",
+	"session-event.sh",
 	"blacklist.txt",
 }
 
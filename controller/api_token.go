@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func apiTokenResponse(t *model.APIToken) gin.H {
+	return gin.H{
+		"id":         t.ID,
+		"name":       t.Name,
+		"prefix":     t.Prefix,
+		"scopes":     strings.Split(t.Scopes, ","),
+		"expiresAt":  t.ExpiresAt,
+		"expired":    time.Now().After(t.ExpiresAt),
+		"lastUsedAt": t.LastUsedAt,
+		"lastUsedIp": t.LastUsedIP,
+		"createdAt":  t.CreatedAt,
+	}
+}
+
+// ListAPITokens 当前用户的 API 令牌（不含明文）
+func ListAPITokens(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	tokens, err := services.ListAPITokens(database.DB, claims.UserID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	items := make([]gin.H, 0, len(tokens))
+	for i := range tokens {
+		items = append(items, apiTokenResponse(&tokens[i]))
+	}
+	common.OK(c, gin.H{"tokens": items, "scopes": middleware.APITokenScopes})
+}
+
+type createAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expiresInDays" binding:"omitempty,min=1"`
+}
+
+// CreateAPIToken 创建 API 令牌；明文只在本次响应中返回
+func CreateAPIToken(c *gin.Context) {
+	var req createAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	for _, s := range req.Scopes {
+		if !middleware.ValidAPITokenScope(s) {
+			common.BadRequest(c, "unknown scope: "+s)
+			return
+		}
+	}
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = services.DefaultAPITokenDays
+	}
+	if days > services.MaxAPITokenDays {
+		common.BadRequest(c, "expiresInDays must not exceed 365")
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	row, token, err := services.CreateAPIToken(database.DB, user, strings.TrimSpace(req.Name), req.Scopes, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	middleware.SetAudit(c, middleware.AuditInfo{TargetID: row.ID, TargetName: row.Name, After: gin.H{"name": row.Name, "scopes": req.Scopes, "expiresAt": row.ExpiresAt}})
+	resp := apiTokenResponse(row)
+	resp["token"] = token
+	common.OK(c, resp)
+}
+
+// DeleteAPIToken 吊销当前用户的一个 API 令牌
+func DeleteAPIToken(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	err := services.DeleteAPIToken(database.DB, claims.UserID, c.Param("id"))
+	if errors.Is(err, services.ErrAPITokenNotFound) {
+		common.NotFound(c, err.Error())
+		return
+	} else if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	common.OKMsg(c, "token revoked")
+}
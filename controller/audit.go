@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditController 审计日志查询（路由要求 audit.read）
+type AuditController struct{}
+
+// auditFilter 解析查询参数：actor、action、targetType、targetId、result、from、to（RFC3339 或 YYYY-MM-DD）
+func auditFilter(ctx *gin.Context) (services.AuditFilter, bool) {
+	f := services.AuditFilter{
+		Actor:      ctx.Query("actor"),
+		Action:     ctx.Query("action"),
+		TargetType: ctx.Query("targetType"),
+		TargetID:   ctx.Query("targetId"),
+		Result:     ctx.Query("result"),
+	}
+	if f.Result != "" && f.Result != model.AuditResultSuccess && f.Result != model.AuditResultFailure {
+		common.BadRequest(ctx, "invalid result parameter")
+		return f, false
+	}
+	for _, p := range []struct {
+		name     string
+		dst      *time.Time
+		endOfDay bool
+	}{{"from", &f.From, false}, {"to", &f.To, true}} {
+		if v := ctx.Query(p.name); v != "" {
+			t, ok := parseSessionTime(v, p.endOfDay)
+			if !ok {
+				common.BadRequest(ctx, "invalid "+p.name+" parameter")
+				return f, false
+			}
+			*p.dst = t
+		}
+	}
+	return f, true
+}
+
+// List 分页查询审计事件，新的在前
+func (c *AuditController) List(ctx *gin.Context) {
+	f, ok := auditFilter(ctx)
+	if !ok {
+		return
+	}
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		common.BadRequest(ctx, "invalid offset parameter")
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		common.BadRequest(ctx, "invalid limit parameter")
+		return
+	}
+	f.Offset, f.Limit = offset, limit
+
+	events, total, err := services.ListAuditEvents(database.DB, f)
+	if err != nil {
+		common.InternalError(ctx, "Failed to list audit events: "+err.Error())
+		return
+	}
+	common.OK(ctx, gin.H{
+		"events":  events,
+		"total":   total,
+		"offset":  offset,
+		"limit":   limit,
+		"hasMore": int64(offset+len(events)) < total,
+	})
+}
+
+// Export 以 CSV 导出符合条件的全部审计事件（与 List 相同的过滤参数，不分页）
+func (c *AuditController) Export(ctx *gin.Context) {
+	f, ok := auditFilter(ctx)
+	if !ok {
+		return
+	}
+	name := "audit-" + time.Now().Format("20060102-150405") + ".csv"
+	ctx.Header("Content-Type", "text/csv; charset=utf-8")
+	ctx.Header("Content-Disposition", `attachment; filename="`+name+`"`)
+	if err := services.ExportAuditCSV(database.DB, f, ctx.Writer); err != nil {
+		// 响应头已发出，只能记日志
+		logging.Error("Failed to export audit events: %v", err)
+	}
+}
@@ -1,12 +1,19 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
+	"strconv"
+	"time"
 
 	"openvpn-admin-go/common"
 	"openvpn-admin-go/database"
+	"openvpn-admin-go/directory"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/mailer"
 	"openvpn-admin-go/middleware"
 	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -28,6 +35,7 @@ func Register(c *gin.Context) {
 		common.BadRequest(c, err.Error())
 		return
 	}
+	middleware.SetAudit(c, middleware.AuditInfo{TargetName: req.Name})
 
 	// 校验部门存在
 	var dept model.Department
@@ -65,6 +73,9 @@ func Register(c *gin.Context) {
 		// Log this error, but don't fail the registration because of it
 	}
 
+	middleware.SetAudit(c, middleware.AuditInfo{ActorID: user.ID, TargetID: user.ID, After: userAuditState(&user)})
+	sendVerificationEmailAsync(user, requestLang(c))
+
 	c.JSON(http.StatusOK, gin.H{
 		"success":        true,
 		"message":        "register success, pending approval",
@@ -85,15 +96,104 @@ func Login(c *gin.Context) {
 		common.BadRequest(c, err.Error())
 		return
 	}
+	middleware.SetAudit(c, middleware.AuditInfo{TargetName: req.Email})
 	var user model.User
-	if err := database.DB.Where("email = ?", req.Email).First(&user).Error; err != nil {
-		common.Unauthorized(c, "invalid credentials")
+	err := database.DB.Where("email = ?", req.Email).First(&user).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		common.InternalError(c, err.Error())
+		return
+	}
+	// 锁定期间不校验密码；不存在的邮箱同样计数、同样锁定，响应与真实账号一致
+	if err == nil && rejectLocked(c, &user) {
+		return
+	}
+	if err != nil && rejectUnknownLocked(c, req.Email) {
+		return
+	}
+	// 目录用户（以及启用 LDAP 时的新用户）由目录校验密码，首次登录时按映射组开通账号
+	if (err == nil && user.AuthSource == model.AuthSourceLDAP) || (err != nil && directory.Enabled()) {
+		u, dirErr := services.AuthenticateDirectoryUser(database.DB, req.Email, req.Password)
+		if errors.Is(dirErr, directory.ErrInvalidCredentials) || errors.Is(dirErr, services.ErrDirectoryConflict) {
+			if err == nil {
+				loginFailed(c, &user, "invalid credentials")
+				return
+			}
+			unknownLoginFailed(c, req.Email)
+			return
+		} else if dirErr != nil {
+			logging.Error("目录登录 %s 失败: %v", req.Email, dirErr)
+			common.InternalError(c, "directory unavailable")
+			return
+		}
+		if err != nil {
+			services.ForgetUnknownLoginFailures(req.Email)
+		}
+		user = *u
+	} else if err != nil {
+		unknownLoginFailed(c, req.Email)
+		return
+	} else if !common.CheckPasswordHash(req.Password, user.PasswordHash) {
+		loginFailed(c, &user, "invalid credentials")
+		return
+	}
+	completeLogin(c, &user)
+}
+
+// respondLocked 账号锁定中：429，附带解锁时间
+func respondLocked(c *gin.Context, until time.Time) {
+	c.Header("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"success":     false,
+		"error":       services.ErrAccountLocked.Error(),
+		"lockedUntil": until,
+	})
+}
+
+// rejectLocked 账号锁定中时写好响应并返回 true
+func rejectLocked(c *gin.Context, user *model.User) bool {
+	auditLoginUser(c, user)
+	until, locked := services.AccountLockedUntil(user, time.Now())
+	if locked {
+		respondLocked(c, until)
+	}
+	return locked
+}
+
+// loginFailed 记录一次失败的密码 / 验证码；本次触发锁定时返回锁定信息，否则 401
+func loginFailed(c *gin.Context, user *model.User, msg string) {
+	auditLoginUser(c, user)
+	until, err := services.RecordLoginFailure(database.DB, user, c.ClientIP())
+	if err != nil {
+		logging.Error("记录 %s 登录失败次数出错: %v", user.Name, err)
+	}
+	if until != nil {
+		respondLocked(c, *until)
 		return
 	}
-	if !common.CheckPasswordHash(req.Password, user.PasswordHash) {
-		common.Unauthorized(c, "invalid credentials")
+	common.Unauthorized(c, msg)
+}
+
+// rejectUnknownLocked 不存在的邮箱锁定中时写好与 rejectLocked 相同的响应并返回 true
+func rejectUnknownLocked(c *gin.Context, email string) bool {
+	until, locked := services.UnknownLoginLockedUntil(email, time.Now())
+	if locked {
+		respondLocked(c, until)
+	}
+	return locked
+}
+
+// unknownLoginFailed 不存在的邮箱登录失败：与 loginFailed 一样计数，达到阈值时同样返回锁定信息
+func unknownLoginFailed(c *gin.Context, email string) {
+	if until := services.RecordUnknownLoginFailure(email, time.Now()); until != nil {
+		respondLocked(c, *until)
 		return
 	}
+	common.Unauthorized(c, "invalid credentials")
+}
+
+// completeLogin 身份已确认（密码或单点登录）之后的公共步骤：审批门控、两步验证，最后签发 JWT
+func completeLogin(c *gin.Context, user *model.User) {
+	auditLoginUser(c, user)
 	// 审批门控：未批准的用户不能登录
 	if user.ApprovalStatus != model.ApprovalApproved {
 		msg := "account pending approval"
@@ -107,31 +207,168 @@ func Login(c *gin.Context) {
 		})
 		return
 	}
-	token, err := middleware.GenerateToken(user.ID, string(user.Role), user.DepartmentID)
-	if err != nil {
-		common.InternalError(c, "generate token failed")
+	// 两步验证：已启用或角色要求启用时，密码这一步只返回短期挑战令牌，
+	// 由 LoginMFA（尚未启用时先 LoginMFASetup）换取真正的 JWT
+	if user.MFAEnabled || mfaRequired(user.Role) {
+		challenge, err := newMFAChallenge(user)
+		if err != nil {
+			common.InternalError(c, "generate challenge token failed")
+			return
+		}
+		common.OK(c, gin.H{
+			"mfaRequired":      true,
+			"mfaSetupRequired": !user.MFAEnabled,
+			"challengeToken":   challenge,
+			"expiresIn":        int(middleware.MFAChallengeTTL.Seconds()),
+		})
 		return
 	}
-	common.OK(c, gin.H{"user": gin.H{
-		"id":    user.ID,
-		"name":  user.Name,
-		"email": user.Email,
-		"role":  user.Role,
-	}, "token": token})
+	issueLoginToken(c, user, nil)
+}
+
+// auditLoginUser 登录类请求的审计对象是登录的用户（请求尚未携带令牌）
+func auditLoginUser(c *gin.Context, user *model.User) {
+	middleware.SetAudit(c, middleware.AuditInfo{TargetID: user.ID, TargetName: user.Name})
+}
+
+// requestLang 邮件语言：优先 ?lang=，其次 Accept-Language
+func requestLang(c *gin.Context) string {
+	return mailer.NormalizeLang(c.DefaultQuery("lang", c.GetHeader("Accept-Language")))
+}
+
+// sendVerificationEmailAsync 后台发送验证邮件，失败只记日志（不影响注册 / 修改资料）
+func sendVerificationEmailAsync(user model.User, lang string) {
+	go func() {
+		if err := services.SendVerificationEmail(database.DB, &user, lang); err != nil {
+			logging.Error("发送验证邮件给 %s 失败: %v", user.Email, err)
+		}
+	}()
 }
 
-// VerifyEmail 邮箱验证 (暂未实现)
+// VerifyEmail 邮箱验证：令牌一次性有效，且只对签发时的邮箱有效
 func VerifyEmail(c *gin.Context) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := services.ConsumeUserToken(tx, c.Param("token"), model.UserTokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+		res := tx.Model(&model.User{}).
+			Where("id = ? AND email = ?", token.UserID, token.Email).
+			Update("email_verified", true)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return services.ErrUserTokenInvalid
+		}
+		return nil
+	})
+	if errors.Is(err, services.ErrUserTokenInvalid) {
+		common.BadRequest(c, err.Error())
+		return
+	} else if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
 	common.OKMsg(c, "email verified")
 }
 
-// ForgotPassword 忘记密码 (暂未实现)
+// ResendVerificationEmail 重新发送当前用户的验证邮件
+func ResendVerificationEmail(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.EmailVerified {
+		common.BadRequest(c, "email already verified")
+		return
+	}
+	if err := services.SendVerificationEmail(database.DB, user, requestLang(c)); err != nil {
+		logging.Error("发送验证邮件给 %s 失败: %v", user.Email, err)
+		common.InternalError(c, "send verification email failed")
+		return
+	}
+	common.OKMsg(c, "verification email sent")
+}
+
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ForgotPassword 忘记密码：无论邮箱是否注册都返回同样的结果（不泄露账号是否存在），
+// 邮件在后台发送，响应时间也不随之变化
 func ForgotPassword(c *gin.Context) {
-	common.OKMsg(c, "reset link sent")
+	var req forgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	middleware.SetAudit(c, middleware.AuditInfo{TargetName: req.Email})
+	lang := requestLang(c)
+	go func() {
+		var user model.User
+		// 目录用户的密码在目录中修改
+		if err := database.DB.Where("email = ? AND auth_source = ?", req.Email, model.AuthSourceLocal).First(&user).Error; err != nil {
+			return
+		}
+		if err := services.SendPasswordResetEmail(database.DB, &user, lang); err != nil {
+			logging.Error("发送重置密码邮件给 %s 失败: %v", user.Email, err)
+		}
+	}()
+	common.OKMsg(c, "if the email is registered, a reset link has been sent")
+}
+
+type resetPasswordRequest struct {
+	Password        string `json:"password" binding:"required,min=6"`
+	ConfirmPassword string `json:"confirmPassword" binding:"required,eqfield=Password"`
 }
 
-// ResetPassword 重置密码 (暂未实现)
+// ResetPassword 用邮件中的令牌设置新密码。能收到邮件即证明邮箱属于本人，一并标记为已验证；
+// 签发后改过邮箱的，发往旧邮箱的链接作废。
 func ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	hash, err := common.HashPassword(req.Password)
+	if err != nil {
+		common.InternalError(c, "hash password failed")
+		return
+	}
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		token, err := services.ConsumeUserToken(tx, c.Param("token"), model.UserTokenResetPassword)
+		if err != nil {
+			return err
+		}
+		var user model.User
+		if err := tx.First(&user, "id = ? AND auth_source = ?", token.UserID, model.AuthSourceLocal).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return services.ErrUserTokenInvalid
+			}
+			return err
+		}
+		if user.Email != token.Email {
+			return services.ErrUserTokenInvalid
+		}
+		middleware.SetAudit(c, middleware.AuditInfo{ActorID: user.ID, TargetID: user.ID, TargetName: user.Name})
+		updates := map[string]interface{}{"password_hash": hash, "email_verified": true}
+		// 通过邮件重置密码即证明了账号所有权，同时解除登录锁定
+		updates["failed_login_count"] = 0
+		updates["last_failed_login_at"] = nil
+		updates["locked_until"] = nil
+		if err := tx.Model(&user).Updates(updates).Error; err != nil {
+			return err
+		}
+		return services.RevokeUserSessions(tx, user.ID, "", services.SessionRevokedPasswordChanged)
+	})
+	if errors.Is(err, services.ErrUserTokenInvalid) {
+		common.BadRequest(c, err.Error())
+		return
+	} else if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
 	common.OKMsg(c, "password reset")
 }
 
@@ -145,13 +382,16 @@ func GetMe(c *gin.Context) {
 	}
 
 	responseData := gin.H{
-		"id":           user.ID,
-		"name":         user.Name,
-		"email":        user.Email,
-		"role":         user.Role,
-		"departmentId": user.DepartmentID,
-		"isOnline":     user.IsOnline,
-		"creatorId":    user.CreatorID,
+		"id":            user.ID,
+		"name":          user.Name,
+		"email":         user.Email,
+		"role":          user.Role,
+		"departmentId":  user.DepartmentID,
+		"isOnline":      user.IsOnline,
+		"creatorId":     user.CreatorID,
+		"mfaEnabled":    user.MFAEnabled,
+		"emailVerified": user.EmailVerified,
+		"authSource":    user.AuthSource,
 	}
 
 	if user.LastConnectionTime != nil {
@@ -177,12 +417,24 @@ func UpdateMe(c *gin.Context) {
 		common.BadRequest(c, err.Error())
 		return
 	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.AuthSource != model.AuthSourceLocal &&
+		((req.Name != nil && *req.Name != user.Name) || (req.Email != nil && *req.Email != user.Email) || req.Password != nil) {
+		common.Forbidden(c, "name, email and password are managed by the directory")
+		return
+	}
 	updates := map[string]interface{}{}
 	if req.Name != nil {
 		updates["name"] = *req.Name
 	}
-	if req.Email != nil {
+	emailChanged := req.Email != nil && *req.Email != user.Email
+	if emailChanged {
+		// 新邮箱需要重新验证
 		updates["email"] = *req.Email
+		updates["email_verified"] = false
 	}
 	if req.Password != nil {
 		hashed, err := common.HashPassword(*req.Password)
@@ -196,27 +448,72 @@ func UpdateMe(c *gin.Context) {
 		common.BadRequest(c, "no data to update")
 		return
 	}
+	before := userAuditState(user)
+	middleware.SetAudit(c, middleware.AuditInfo{TargetName: user.Name, Before: before})
 	if err := database.DB.Model(&model.User{}).Where("id = ?", claims.UserID).Updates(updates).Error; err != nil {
 		common.InternalError(c, err.Error())
 		return
 	}
+	after := userAuditState(user)
+	for k, v := range map[string]string{"name": "name", "email": "email", "password_hash": "passwordHash"} {
+		if nv, ok := updates[k]; ok {
+			after[v] = nv
+		}
+	}
+	middleware.SetAudit(c, middleware.AuditInfo{After: after})
+	if req.Password != nil {
+		// 改密码后其他设备上的会话全部下线，当前会话保留
+		services.RevokeUserSessions(database.DB, claims.UserID, claims.ID, services.SessionRevokedPasswordChanged)
+	}
+	if emailChanged {
+		user.Email = *req.Email
+		sendVerificationEmailAsync(*user, requestLang(c))
+	}
 	common.OKMsg(c, "update success")
 }
 
-// Logout 用户登出
+// Logout 用户登出：吊销当前会话，访问令牌与刷新令牌随即失效
 func Logout(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	middleware.SetAudit(c, middleware.AuditInfo{TargetID: claims.ID})
+	if err := services.RevokeLoginSession(database.DB, claims.UserID, claims.ID, services.SessionRevokedLogout); err != nil &&
+		!errors.Is(err, services.ErrLoginSessionNotFound) {
+		common.InternalError(c, err.Error())
+		return
+	}
 	common.OK(c, nil)
 }
 
-// RefreshToken 刷新 JWT
+type refreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// RefreshToken 用刷新令牌换取新的访问令牌与刷新令牌（刷新令牌只能用一次）。
+// 角色与部门按数据库当前值签发；用户已删除或不再是已批准状态时会话被吊销。
 func RefreshToken(c *gin.Context) {
-	claims := c.MustGet("claims").(*middleware.Claims)
-	token, err := middleware.GenerateToken(claims.UserID, claims.Role, claims.DeptID)
+	var req refreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	session, user, refreshToken, err := services.RotateLoginSession(database.DB, req.RefreshToken)
+	if errors.Is(err, services.ErrRefreshTokenInvalid) {
+		common.Unauthorized(c, err.Error())
+		return
+	} else if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	token, err := middleware.GenerateToken(session.ID, user.ID, string(user.Role), user.DepartmentID)
 	if err != nil {
 		common.InternalError(c, "generate token failed")
 		return
 	}
-	common.OK(c, gin.H{"token": token})
+	common.OK(c, gin.H{
+		"token":        token,
+		"refreshToken": refreshToken,
+		"expiresIn":    int(middleware.AccessTokenTTL.Seconds()),
+	})
 }
 
 // GetRoles 获取角色列表
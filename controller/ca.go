@@ -0,0 +1,145 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/openvpn/pki"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CAController 签发 CA 与 CA 轮换（superadmin）
+type CAController struct{}
+
+// GetStatus 当前签发 CA、轮换状态与进度
+func (c *CAController) GetStatus(ctx *gin.Context) {
+	status, err := openvpn.GetCAStatus()
+	if err != nil {
+		common.InternalError(ctx, "Failed to read CA: "+err.Error())
+		return
+	}
+	resp := gin.H{
+		"current":   status.Current,
+		"rotating":  status.Rotating,
+		"retiring":  status.Retiring,
+		"startedAt": status.StartedAt,
+	}
+	if status.Rotating {
+		progress, err := services.GetCARotationProgress(database.DB, status.Current.ID)
+		if err != nil {
+			common.InternalError(ctx, "Failed to compute rotation progress: "+err.Error())
+			return
+		}
+		resp["progress"] = progress
+	}
+	common.OK(ctx, resp)
+}
+
+type intermediateCSRRequest struct {
+	CommonName   string `json:"commonName"`
+	KeyAlgorithm string `json:"keyAlgorithm"`
+}
+
+// CreateIntermediateCSR 生成中间 CA 私钥（留在服务器上）与 CSR，CSR 交给离线根 CA 签名
+func (c *CAController) CreateIntermediateCSR(ctx *gin.Context) {
+	var req intermediateCSRRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.BadRequest(ctx, "Invalid request: "+err.Error())
+		return
+	}
+	alg, err := pki.ParseKeyAlgorithm(req.KeyAlgorithm)
+	if err != nil {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: req.CommonName, After: gin.H{"commonName": req.CommonName, "keyAlgorithm": req.KeyAlgorithm}})
+	csr, err := openvpn.NewIntermediateCSR(req.CommonName, alg)
+	if err != nil {
+		common.InternalError(ctx, "Failed to create CSR: "+err.Error())
+		return
+	}
+	common.OK(ctx, gin.H{"csr": string(csr)})
+}
+
+// rotateCARequest 不带 certificate 时生成新的自签 CA；带 certificate 时导入离线根 CA 签好的
+// 中间 CA（私钥为 CreateIntermediateCSR 生成的那把），chain 至少含根 CA，rootCrl 为根 CA 签发的 CRL
+type rotateCARequest struct {
+	KeyAlgorithm string `json:"keyAlgorithm"`
+	Certificate  string `json:"certificate"`
+	Chain        string `json:"chain"`
+	RootCRL      string `json:"rootCrl"`
+}
+
+// Rotate 开始 CA 轮换：新 CA 立即用于签发，OpenVPN 同时信任新旧 CA，后台为所有用户换发证书
+func (c *CAController) Rotate(ctx *gin.Context) {
+	var req rotateCARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.BadRequest(ctx, "Invalid request: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"keyAlgorithm": req.KeyAlgorithm, "intermediate": req.Certificate != ""}})
+	if req.Certificate != "" {
+		if err := openvpn.StartCARotationWithIntermediate([]byte(req.Certificate), []byte(req.Chain), []byte(req.RootCRL)); err != nil {
+			common.BadRequest(ctx, "Failed to start CA rotation: "+err.Error())
+			return
+		}
+	} else {
+		alg, err := pki.ParseKeyAlgorithm(req.KeyAlgorithm)
+		if err != nil {
+			common.BadRequest(ctx, err.Error())
+			return
+		}
+		if err := openvpn.StartCARotation(alg); err != nil {
+			common.BadRequest(ctx, "Failed to start CA rotation: "+err.Error())
+			return
+		}
+	}
+	common.OKMsg(ctx, "CA rotation started, certificates are being reissued in the background")
+}
+
+type retireCARequest struct {
+	// Force 不等所有用户用新证书重连就退役旧 CA（仍用旧证书的客户端将无法连接）
+	Force bool `json:"force"`
+}
+
+// Retire 退役旧 CA。默认要求所有用户都已用新证书连接过，force 跳过该检查。
+func (c *CAController) Retire(ctx *gin.Context) {
+	var req retireCARequest
+	if err := ctx.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		common.BadRequest(ctx, "Invalid request: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"force": req.Force}})
+	status, err := openvpn.GetCAStatus()
+	if err != nil {
+		common.InternalError(ctx, "Failed to read CA: "+err.Error())
+		return
+	}
+	if !status.Rotating {
+		common.BadRequest(ctx, "No CA rotation in progress")
+		return
+	}
+	if !req.Force {
+		progress, err := services.GetCARotationProgress(database.DB, status.Current.ID)
+		if err != nil {
+			common.InternalError(ctx, "Failed to compute rotation progress: "+err.Error())
+			return
+		}
+		if !progress.Done() {
+			common.BadRequest(ctx, fmt.Sprintf("%d of %d user(s) have reconnected with the new certificate, use force to retire anyway", progress.Reconnected, progress.Users))
+			return
+		}
+	}
+	if err := services.RetireCA(database.DB); err != nil {
+		common.InternalError(ctx, "Failed to retire old CA: "+err.Error())
+		return
+	}
+	common.OKMsg(ctx, "Old CA retired")
+}
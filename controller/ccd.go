@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"errors"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ccdTarget 加载要查看或修改 CCD 的用户并检查部门范围
+func ccdTarget(ctx *gin.Context) (*model.User, bool) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var u model.User
+	if err := database.DB.First(&u, "id = ?", ctx.Param("id")).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return nil, false
+	}
+	if !managesDepartment(claims, u.DepartmentID) {
+		common.Forbidden(ctx, "you can only manage users in own department or sub-departments")
+		return nil, false
+	}
+	if u.Role == model.RoleSuperAdmin && claims.Role != string(model.RoleSuperAdmin) {
+		common.Forbidden(ctx, "only superadmin can update superadmin user")
+		return nil, false
+	}
+	return &u, true
+}
+
+// ccdResponse 用户自己的设置、所在部门生效的网络策略，以及两者合并后实际生成到 CCD 的设置
+func ccdResponse(ctx *gin.Context, u *model.User, own *openvpn.ClientCCD) {
+	effective, policy, err := services.EffectiveClientCCD(database.DB, u)
+	if err != nil {
+		common.InternalError(ctx, "failed to load department network policy: "+err.Error())
+		return
+	}
+	common.OK(ctx, gin.H{"options": own, "department": policy, "effective": effective})
+}
+
+// GetCCD 查看用户的客户端专属网络设置（固定 IP、子网、推送的路由与 DNS 等）
+func (c *ClientController) GetCCD(ctx *gin.Context) {
+	u, ok := ccdTarget(ctx)
+	if !ok {
+		return
+	}
+	spec, err := services.GetClientCCD(database.DB, u)
+	if err != nil {
+		common.InternalError(ctx, "failed to load client config: "+err.Error())
+		return
+	}
+	ccdResponse(ctx, u, spec)
+}
+
+// UpdateCCD 整体替换用户的客户端专属网络设置并重写其 CCD 文件，客户端下次连接时生效。
+// 路由、DNS 与搜索域留空时沿用部门网络策略。
+func (c *ClientController) UpdateCCD(ctx *gin.Context) {
+	u, ok := ccdTarget(ctx)
+	if !ok {
+		return
+	}
+	var req openvpn.ClientCCD
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	before, err := services.GetClientCCD(database.DB, u)
+	if err != nil {
+		common.InternalError(ctx, "failed to load client config: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: u.Name, Before: before})
+
+	if err := services.SaveClientCCD(database.DB, u, &req); errors.Is(err, services.ErrInvalidClientCCD) {
+		common.BadRequest(ctx, err.Error())
+		return
+	} else if errors.Is(err, services.ErrIPConflict) || errors.Is(err, services.ErrIPPoolExhausted) {
+		fixedIPError(ctx, err)
+		return
+	} else if err != nil {
+		common.InternalError(ctx, "failed to save client config: "+err.Error())
+		return
+	}
+	after, err := services.GetClientCCD(database.DB, u)
+	if err != nil {
+		common.InternalError(ctx, "failed to load client config: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: after})
+	ccdResponse(ctx, u, after)
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"errors"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func certificateResponse(c *model.Certificate) gin.H {
+	return gin.H{
+		"id":        c.ID,
+		"userId":    c.UserID,
+		"userName":  c.UserName,
+		"serial":    c.Serial,
+		"notBefore": c.NotBefore,
+		"notAfter":  c.NotAfter,
+		"status":    c.Status,
+		"fromCsr":   c.FromCSR,
+		"revokedAt": c.RevokedAt,
+		"createdAt": c.CreatedAt,
+	}
+}
+
+// ListCertificates 列出用户签发过的客户端证书（最新在前）。可见范围见 viewsUser。
+func (c *ClientController) ListCertificates(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var u model.User
+	if err := database.DB.First(&u, "id = ?", ctx.Param("id")).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return
+	}
+	if !viewsUser(claims, &u) {
+		common.Forbidden(ctx, "you can only view yourself or users of own department (and sub-departments)")
+		return
+	}
+
+	var certs []model.Certificate
+	if err := database.DB.Where("user_name = ?", u.Name).Order("not_before desc").Find(&certs).Error; err != nil {
+		common.InternalError(ctx, "Failed to list certificates: "+err.Error())
+		return
+	}
+	resp := make([]gin.H, 0, len(certs))
+	for i := range certs {
+		resp = append(resp, certificateResponse(&certs[i]))
+	}
+	common.OK(ctx, resp)
+}
+
+// RenewCertificate 续签用户证书：吊销旧证书并重新生成 .ovpn，用户需重新下载配置。
+// manager 仅本部门及下级部门。
+func (c *ClientController) RenewCertificate(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var user model.User
+	if err := database.DB.Where("name = ?", ctx.Param("username")).First(&user).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: user.ID})
+	if !managesDepartment(claims, user.DepartmentID) {
+		common.Forbidden(ctx, "you can only renew certificates of users in own department or sub-departments")
+		return
+	}
+
+	cert, err := services.RenewUserCertificate(database.DB, &user)
+	if errors.Is(err, services.ErrCSRRequired) {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	if cert == nil {
+		common.InternalError(ctx, "Failed to renew certificate: "+err.Error())
+		return
+	}
+	if err != nil {
+		common.InternalError(ctx, "Certificate renewed but the old one could not be revoked: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"certificateSerial": cert.Serial, "notAfter": cert.NotAfter}})
+	common.OK(ctx, certificateResponse(cert))
+}
+
+type enrollRequest struct {
+	// CSR PKCS#10 证书请求（PEM），CN 必须是当前用户名
+	CSR string `json:"csr" binding:"required"`
+}
+
+// Enroll 当前用户上传 CSR 自助签发证书：私钥只在用户设备上，返回的 .ovpn 不含 <key>，
+// 由客户端在本地合并。已有证书时吊销旧证书。仅已批准的用户可用。
+func (c *ClientController) Enroll(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var req enrollRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(ctx, "Invalid request: "+err.Error())
+		return
+	}
+	var user model.User
+	if err := database.DB.First(&user, "id = ?", claims.UserID).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: user.ID, TargetName: user.Name})
+	if user.ApprovalStatus != model.ApprovalApproved {
+		common.Forbidden(ctx, "account is not approved")
+		return
+	}
+
+	cert, err := services.EnrollUserCertificate(database.DB, &user, []byte(req.CSR))
+	if cert == nil {
+		if errors.Is(err, openvpn.ErrInvalidCSR) {
+			common.BadRequest(ctx, "Invalid CSR: "+err.Error())
+			return
+		}
+		common.InternalError(ctx, "Failed to enroll certificate: "+err.Error())
+		return
+	}
+	if err != nil {
+		common.InternalError(ctx, "Certificate issued but the old one could not be revoked: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"certificateSerial": cert.Serial, "notAfter": cert.NotAfter}})
+	cfg, err := openvpn.LoadConfig()
+	if err != nil {
+		common.InternalError(ctx, err.Error())
+		return
+	}
+	config, err := openvpn.GenerateClientConfig(user.Name, cfg)
+	if err != nil {
+		common.InternalError(ctx, err.Error())
+		return
+	}
+	common.OK(ctx, gin.H{
+		"config":   config,
+		"serial":   cert.Serial,
+		"notAfter": cert.NotAfter,
+	})
+}
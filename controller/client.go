@@ -1,10 +1,12 @@
 package controller
 
 import (
+	"errors"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"openvpn-admin-go/common"
 	"openvpn-admin-go/constants"
@@ -13,6 +15,7 @@ import (
 	"openvpn-admin-go/middleware"
 	"openvpn-admin-go/model"
 	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -20,7 +23,40 @@ import (
 
 type ClientController struct{}
 
-// CreateUser 创建用户 (superadmin/admin 全量，manager 仅限本部门、仅 user 角色)
+// departmentScoped superadmin / admin 之外的角色即使被授予管理权限，也只能管理本部门及下级部门的用户
+func departmentScoped(claims *middleware.Claims) bool {
+	return claims.Role != string(model.RoleSuperAdmin) && claims.Role != string(model.RoleAdmin)
+}
+
+// managesDepartment 当前用户能否管理该部门的用户：superadmin / admin 不限，
+// 其他角色只能管理本部门及其全部下级部门
+func managesDepartment(claims *middleware.Claims, deptID string) bool {
+	return !departmentScoped(claims) || services.DepartmentInSubtree(database.DB, claims.DeptID, deptID)
+}
+
+// viewsUser 当前用户能否查看该用户：自己总可以；查看他人还需要 user.read，
+// 且 superadmin / admin 之外的角色只能查看本部门及下级部门的用户
+func viewsUser(claims *middleware.Claims, u *model.User) bool {
+	if u.ID == claims.UserID {
+		return true
+	}
+	return middleware.HasPermission(claims, model.PermUserRead) && managesDepartment(claims, u.DepartmentID)
+}
+
+// roleAssignable 能否授予该角色：user 角色无需额外权限，其他角色需要 client.role.assign，
+// superadmin 只能由 superadmin 授予
+func roleAssignable(claims *middleware.Claims, role string) bool {
+	switch role {
+	case string(model.RoleUser):
+		return true
+	case string(model.RoleSuperAdmin):
+		return claims.Role == string(model.RoleSuperAdmin)
+	default:
+		return middleware.HasPermission(claims, model.PermClientRoleAssign)
+	}
+}
+
+// CreateUser 创建用户 (manager 等部门内角色仅限本部门及下级部门；非 user 角色需要 client.role.assign)
 func (c *ClientController) CreateUser(ctx *gin.Context) {
 	claims := ctx.MustGet("claims").(*middleware.Claims)
 	var req struct {
@@ -29,7 +65,8 @@ func (c *ClientController) CreateUser(ctx *gin.Context) {
 		Password     string  `json:"password" binding:"required,min=6"`
 		Role         string  `json:"role" binding:"required,oneof=superadmin admin manager user"`
 		DepartmentID string  `json:"departmentId"`
-		FixedIP      *string `json:"fixedIp" binding:"omitempty,ip|cidrv4|cidrv6"`
+		FixedIP      *string `json:"fixedIp" binding:"omitempty,eq=auto|ip|cidrv4|cidrv6"`
+		FixedIPv6    *string `json:"fixedIpv6" binding:"omitempty,ipv6"`
 		Subnet       *string `json:"subnet" binding:"omitempty,cidrv4"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -37,24 +74,16 @@ func (c *ClientController) CreateUser(ctx *gin.Context) {
 		return
 	}
 
-	// manager 权限限制
-	if claims.Role == string(model.RoleManager) {
-		if req.DepartmentID != claims.DeptID {
-			common.Forbidden(ctx, "manager can only create users in own department")
-			return
-		}
-		if req.Role != string(model.RoleUser) {
-			common.Forbidden(ctx, "manager can only assign user role")
-			return
-		}
-		if req.FixedIP != nil && strings.TrimSpace(*req.FixedIP) != "" {
-			common.Forbidden(ctx, "manager cannot set fixed IP")
-			return
-		}
-		if req.Subnet != nil && strings.TrimSpace(*req.Subnet) != "" {
-			common.Forbidden(ctx, "manager cannot set subnet")
-			return
-		}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: req.Name})
+
+	// 部门与角色限制
+	if !managesDepartment(claims, req.DepartmentID) {
+		common.Forbidden(ctx, "you can only create users in own department or sub-departments")
+		return
+	}
+	if !roleAssignable(claims, req.Role) {
+		common.Forbidden(ctx, "you are not allowed to assign role "+req.Role)
+		return
 	}
 
 	hash, err := common.HashPassword(req.Password)
@@ -77,26 +106,60 @@ func (c *ClientController) CreateUser(ctx *gin.Context) {
 	if req.FixedIP != nil {
 		trimmedFixedIP := strings.TrimSpace(*req.FixedIP)
 		if trimmedFixedIP != "" {
-			if !(claims.Role == string(model.RoleSuperAdmin) || claims.Role == string(model.RoleAdmin)) {
-				common.Forbidden(ctx, "only superadmin or admin can set fixed IP during creation")
+			if !middleware.HasPermission(claims, model.PermClientNetwork) {
+				common.Forbidden(ctx, "client.network permission is required to set fixed IP")
 				return
 			}
 			user.FixedIP = trimmedFixedIP
 		}
 	}
 
+	if req.FixedIPv6 != nil {
+		if fixedIPv6 := strings.TrimSpace(*req.FixedIPv6); fixedIPv6 != "" {
+			if !middleware.HasPermission(claims, model.PermClientNetwork) {
+				common.Forbidden(ctx, "client.network permission is required to set fixed IPv6")
+				return
+			}
+			user.FixedIPv6 = fixedIPv6
+		}
+	}
+
 	// Handle Subnet assignment on creation
 	if req.Subnet != nil {
 		trimmedSubnet := strings.TrimSpace(*req.Subnet)
 		if trimmedSubnet != "" {
-			if !(claims.Role == string(model.RoleSuperAdmin) || claims.Role == string(model.RoleAdmin)) {
-				common.Forbidden(ctx, "only superadmin or admin can set subnet during creation")
+			if !middleware.HasPermission(claims, model.PermClientNetwork) {
+				common.Forbidden(ctx, "client.network permission is required to set subnet")
 				return
 			}
 			user.Subnet = trimmedSubnet
 		}
 	}
 
+	// 固定 IP 查重；"auto" 时分配部门 IP 范围内下一个空闲地址。持锁到用户写入数据库
+	if user.FixedIP != "" || user.FixedIPv6 != "" {
+		unlock := services.LockIPAM()
+		defer unlock()
+	}
+	if user.FixedIP != "" {
+		requested := user.FixedIP
+		user.FixedIP = ""
+		ip, err := services.ResolveFixedIP(database.DB, &user, requested)
+		if err != nil {
+			fixedIPError(ctx, err)
+			return
+		}
+		user.FixedIP = ip
+	}
+	if user.FixedIPv6 != "" {
+		ip, err := services.ResolveFixedIPv6(database.DB, &user, user.FixedIPv6)
+		if err != nil {
+			fixedIPError(ctx, err)
+			return
+		}
+		user.FixedIPv6 = ip
+	}
+
 	// Check for existing client configuration before any DB write
 	clientOvpnFile := filepath.Join(constants.ClientConfigDir, user.Name+".ovpn")
 	if _, err := os.Stat(clientOvpnFile); err == nil {
@@ -111,37 +174,31 @@ func (c *ClientController) CreateUser(ctx *gin.Context) {
 	var createdUser model.User
 	if err := database.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&user).Error; err != nil {
-			return err
+			return services.FixedIPConflict(tx, err)
 		}
 		createdUser = user
 
-		// Create OpenVPN client certs
-		if err := openvpn.CreateClient(user.Name); err != nil {
+		// Create OpenVPN client certs (validity per department / role) and record them.
+		// CSR-only departments: the user enrolls later with their own CSR.
+		if err := services.IssueUserCertificate(tx, &user); err != nil && !errors.Is(err, services.ErrCSRRequired) {
 			return err
 		}
 
-		// Set fixed IP in CCD (after cert exists)
-		if user.FixedIP != "" {
-			if err := openvpn.SetClientFixedIP(user.Name, user.FixedIP); err != nil {
-				openvpn.DeleteClient(user.Name) // best-effort cleanup
-				return err
-			}
-		}
-
-		// Set subnet in CCD (after cert exists)
-		if user.Subnet != "" {
-			if err := openvpn.SetClientSubnet(user.Name, user.Subnet); err != nil {
-				openvpn.RemoveClientFixedIP(user.Name)
-				openvpn.DeleteClient(user.Name)
-				return err
-			}
+		// 证书签发后生成 CCD（固定 IP、子网）
+		if err := services.ApplyClientCCD(tx, &user); err != nil {
+			openvpn.DeleteClient(user.Name) // best-effort cleanup
+			return err
 		}
 
 		return nil
-	}); err != nil {
+	}); errors.Is(err, services.ErrIPConflict) {
+		fixedIPError(ctx, err)
+		return
+	} else if err != nil {
 		common.InternalError(ctx, "failed to create user: "+err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: createdUser.ID, After: userAuditState(&createdUser)})
 
 	common.OK(ctx, gin.H{
 		"id":           createdUser.ID,
@@ -150,19 +207,26 @@ func (c *ClientController) CreateUser(ctx *gin.Context) {
 		"role":         createdUser.Role,
 		"departmentId": createdUser.DepartmentID,
 		"fixedIp":      createdUser.FixedIP,
+		"fixedIpv6":    createdUser.FixedIPv6,
 		"subnet":       createdUser.Subnet,
 	})
 }
 
-// ListUsers 列出用户列表 (manager 仅本部门)
+// ListUsers 列出用户列表（可见范围见 viewsUser）
 func (c *ClientController) ListUsers(ctx *gin.Context) {
 	claims := ctx.MustGet("claims").(*middleware.Claims)
 	var users []model.User
 	db := database.DB
-	if claims.Role == string(model.RoleManager) {
-		db = db.Where("department_id = ?", claims.DeptID)
-	} else if claims.Role == string(model.RoleUser) {
+	// 可见范围与 viewsUser 一致
+	if !middleware.HasPermission(claims, model.PermUserRead) {
 		db = db.Where("id = ?", claims.UserID)
+	} else if departmentScoped(claims) {
+		deptIDs, err := services.DepartmentSubtree(database.DB, claims.DeptID)
+		if err != nil {
+			common.InternalError(ctx, "Failed to list users: "+err.Error())
+			return
+		}
+		db = db.Where("department_id IN ? OR id = ?", deptIDs, claims.UserID)
 	}
 
 	if err := db.Order("created_at desc").Find(&users).Error; err != nil {
@@ -182,24 +246,27 @@ func (c *ClientController) ListUsers(ctx *gin.Context) {
 			"creatorId":          u.CreatorID,
 			"lastConnectionTime": u.LastConnectionTime,
 			"fixedIp":            u.FixedIP,
+			"fixedIpv6":          u.FixedIPv6,
 			"subnet":             u.Subnet,
 			"createdAt":          u.CreatedAt,
 			"updatedAt":          u.UpdatedAt,
 			"isOnline":           u.IsOnline,
 			"connectionIp":       u.RealAddress,
 			"allocatedVpnIp":     u.VirtualAddress,
+			"allocatedVpnIpv6":   u.VirtualIPv6Address,
 			"bytesReceived":      u.BytesReceived,
 			"bytesSent":          u.BytesSent,
 			"onlineDuration":     u.OnlineDuration,
 			"connectedSince":     u.ConnectedSince,
 			"lastRef":            u.LastRef,
 			"isPaused":           u.IsPaused,
+			"lockedUntil":        activeLock(&u),
 		})
 	}
 	common.OK(ctx, resp)
 }
 
-// GetUser 获取单个用户 (manager 仅本部门)
+// GetUser 获取单个用户（可见范围见 viewsUser）
 func (c *ClientController) GetUser(ctx *gin.Context) {
 	claims := ctx.MustGet("claims").(*middleware.Claims)
 	id := ctx.Param("id")
@@ -208,24 +275,24 @@ func (c *ClientController) GetUser(ctx *gin.Context) {
 		common.NotFound(ctx, "user not found")
 		return
 	}
-	if claims.Role == string(model.RoleManager) && u.DepartmentID != claims.DeptID && u.ID != claims.UserID {
-		common.Forbidden(ctx, "manager can only view own department users or self")
-		return
-	}
-	if claims.Role == string(model.RoleUser) && u.ID != claims.UserID {
-		common.Forbidden(ctx, "user can only view self")
+	if !viewsUser(claims, &u) {
+		common.Forbidden(ctx, "you can only view yourself or users of own department (and sub-departments)")
 		return
 	}
 
 	isOnline := false
 	var connectionIp interface{} = nil
 	var allocatedVpnIp interface{} = nil
+	var allocatedVpnIpv6 interface{} = nil
 
 	liveStatus, err := openvpn.GetClientStatus(u.Name)
 	if err == nil && liveStatus != nil {
 		isOnline = true
 		connectionIp = liveStatus.RealAddress
 		allocatedVpnIp = liveStatus.VirtualAddress
+		if liveStatus.VirtualIPv6Address != "" {
+			allocatedVpnIpv6 = liveStatus.VirtualIPv6Address
+		}
 	} else if err != nil {
 		logging.Warn("Failed to get live status for user %s: %v", u.ID, err)
 	}
@@ -238,15 +305,18 @@ func (c *ClientController) GetUser(ctx *gin.Context) {
 		"approvalStatus":     u.ApprovalStatus,
 		"departmentId":       u.DepartmentID,
 		"fixedIp":            u.FixedIP,
+		"fixedIpv6":          u.FixedIPv6,
 		"subnet":             u.Subnet,
 		"isOnline":           isOnline,
 		"connectionIp":       connectionIp,
 		"allocatedVpnIp":     allocatedVpnIp,
+		"allocatedVpnIpv6":   allocatedVpnIpv6,
 		"lastConnectionTime": u.LastConnectionTime,
 		"creatorId":          u.CreatorID,
 		"createdAt":          u.CreatedAt,
 		"updatedAt":          u.UpdatedAt,
 		"isPaused":           u.IsPaused,
+		"lockedUntil":        activeLock(&u),
 	})
 }
 
@@ -260,7 +330,8 @@ func (c *ClientController) UpdateUser(ctx *gin.Context) {
 		Password     string  `json:"password" binding:"omitempty,min=6"`
 		Role         string  `json:"role" binding:"omitempty,oneof=superadmin admin manager user"`
 		DepartmentID string  `json:"departmentId"`
-		FixedIP      *string `json:"fixedIp" binding:"omitempty,ip|cidrv4|cidrv6"`
+		FixedIP      *string `json:"fixedIp" binding:"omitempty,eq=auto|ip|cidrv4|cidrv6"`
+		FixedIPv6    *string `json:"fixedIpv6" binding:"omitempty,ipv6"`
 		Subnet       *string `json:"subnet" binding:"omitempty,cidrv4"`
 	}
 	if err := ctx.ShouldBindJSON(&req); err != nil {
@@ -273,33 +344,39 @@ func (c *ClientController) UpdateUser(ctx *gin.Context) {
 		common.NotFound(ctx, "user not found")
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: user.Name, Before: userAuditState(&user)})
 
 	// 权限检查
-	if claims.Role == string(model.RoleManager) {
-		if user.DepartmentID != claims.DeptID {
-			common.Forbidden(ctx, "manager can only update users in own department")
-			return
-		}
-		if req.Role != "" && req.Role != string(model.RoleUser) {
-			common.Forbidden(ctx, "manager can only assign user role")
-			return
-		}
-		if req.FixedIP != nil && strings.TrimSpace(*req.FixedIP) != "" {
-			common.Forbidden(ctx, "manager cannot set fixed IP")
-			return
-		}
-		if req.Subnet != nil && strings.TrimSpace(*req.Subnet) != "" {
-			common.Forbidden(ctx, "manager cannot set subnet")
-			return
-		}
+	if !managesDepartment(claims, user.DepartmentID) {
+		common.Forbidden(ctx, "you can only update users in own department or sub-departments")
+		return
+	}
+	if user.Role == model.RoleSuperAdmin && claims.Role != string(model.RoleSuperAdmin) {
+		common.Forbidden(ctx, "only superadmin can update superadmin user")
+		return
+	}
+	if req.Role != "" && req.Role != string(user.Role) && !roleAssignable(claims, req.Role) {
+		common.Forbidden(ctx, "you are not allowed to assign role "+req.Role)
+		return
+	}
+	if req.DepartmentID != "" && !managesDepartment(claims, req.DepartmentID) {
+		common.Forbidden(ctx, "you can only move users within own department and sub-departments")
+		return
+	}
+
+	// 目录用户的用户名、邮箱与密码以目录为准
+	if user.AuthSource != model.AuthSourceLocal && ((req.Name != "" && req.Name != user.Name) || (req.Email != "" && req.Email != user.Email) || req.Password != "") {
+		common.Forbidden(ctx, "name, email and password of directory users are managed by the directory")
+		return
 	}
 
 	updates := make(map[string]interface{})
 	if req.Name != "" {
 		updates["name"] = req.Name
 	}
-	if req.Email != "" {
+	if req.Email != "" && req.Email != user.Email {
 		updates["email"] = req.Email
+		updates["email_verified"] = false
 	}
 	if req.Password != "" {
 		hash, err := common.HashPassword(req.Password)
@@ -316,54 +393,104 @@ func (c *ClientController) UpdateUser(ctx *gin.Context) {
 		updates["department_id"] = req.DepartmentID
 	}
 
-	// 处理固定IP更新
+	// 处理固定IP、子网与部门更新：先按新值（及新部门的网络策略）重写 CCD，校验失败时不修改数据库
+	candidate := user
+	if req.DepartmentID != "" {
+		candidate.DepartmentID = req.DepartmentID
+	}
 	if req.FixedIP != nil {
-		trimmedFixedIP := strings.TrimSpace(*req.FixedIP)
-		if trimmedFixedIP != "" {
-			if !(claims.Role == string(model.RoleSuperAdmin) || claims.Role == string(model.RoleAdmin)) {
-				common.Forbidden(ctx, "only superadmin or admin can set fixed IP")
-				return
-			}
-			updates["fixed_ip"] = trimmedFixedIP
-			if err := openvpn.SetClientFixedIP(user.Name, trimmedFixedIP); err != nil {
-				common.InternalError(ctx, "failed to set fixed IP in OpenVPN config: "+err.Error())
-				return
-			}
-		} else {
-			updates["fixed_ip"] = ""
-			if err := openvpn.RemoveClientFixedIP(user.Name); err != nil {
-				common.InternalError(ctx, "failed to remove fixed IP in OpenVPN config: "+err.Error())
-				return
-			}
+		candidate.FixedIP = strings.TrimSpace(*req.FixedIP)
+		if candidate.FixedIP != "" && !middleware.HasPermission(claims, model.PermClientNetwork) {
+			common.Forbidden(ctx, "client.network permission is required to set fixed IP")
+			return
 		}
 	}
-
-	// 处理子网更新
+	if req.FixedIPv6 != nil {
+		candidate.FixedIPv6 = strings.TrimSpace(*req.FixedIPv6)
+		if candidate.FixedIPv6 != "" && !middleware.HasPermission(claims, model.PermClientNetwork) {
+			common.Forbidden(ctx, "client.network permission is required to set fixed IPv6")
+			return
+		}
+	}
+	// 新地址查重或自动分配，持锁到写入数据库
+	ipv4Changed := candidate.FixedIP != "" && candidate.FixedIP != user.FixedIP
+	ipv6Changed := candidate.FixedIPv6 != "" && candidate.FixedIPv6 != user.FixedIPv6
+	if ipv4Changed || ipv6Changed {
+		unlock := services.LockIPAM()
+		defer unlock()
+	}
+	if ipv4Changed {
+		requested := candidate.FixedIP
+		candidate.FixedIP = user.FixedIP // "auto" 时当前地址仍可用则沿用
+		ip, err := services.ResolveFixedIP(database.DB, &candidate, requested)
+		if err != nil {
+			fixedIPError(ctx, err)
+			return
+		}
+		candidate.FixedIP = ip
+	}
+	if ipv6Changed {
+		ip, err := services.ResolveFixedIPv6(database.DB, &candidate, candidate.FixedIPv6)
+		if err != nil {
+			fixedIPError(ctx, err)
+			return
+		}
+		candidate.FixedIPv6 = ip
+	}
 	if req.Subnet != nil {
-		trimmedSubnet := strings.TrimSpace(*req.Subnet)
-		if trimmedSubnet != "" {
-			if !(claims.Role == string(model.RoleSuperAdmin) || claims.Role == string(model.RoleAdmin)) {
-				common.Forbidden(ctx, "only superadmin or admin can set subnet")
-				return
-			}
-			updates["subnet"] = trimmedSubnet
-			if err := openvpn.SetClientSubnet(user.Name, trimmedSubnet); err != nil {
-				common.InternalError(ctx, "failed to set subnet in OpenVPN config: "+err.Error())
-				return
-			}
-		} else {
-			updates["subnet"] = ""
-			if err := openvpn.RemoveClientSubnet(user.Name); err != nil {
-				common.InternalError(ctx, "failed to remove subnet in OpenVPN config: "+err.Error())
-				return
-			}
+		candidate.Subnet = strings.TrimSpace(*req.Subnet)
+		if candidate.Subnet != "" && !middleware.HasPermission(claims, model.PermClientNetwork) {
+			common.Forbidden(ctx, "client.network permission is required to set subnet")
+			return
+		}
+	}
+	if candidate.FixedIP != user.FixedIP || candidate.FixedIPv6 != user.FixedIPv6 || candidate.Subnet != user.Subnet ||
+		candidate.DepartmentID != user.DepartmentID {
+		if err := services.ApplyClientCCD(database.DB, &candidate); errors.Is(err, services.ErrInvalidClientCCD) {
+			common.BadRequest(ctx, err.Error())
+			return
+		} else if err != nil {
+			common.InternalError(ctx, "failed to update OpenVPN client config: "+err.Error())
+			return
 		}
+		updates["fixed_ip"] = candidate.FixedIP
+		updates["fixed_ipv6"] = candidate.FixedIPv6
+		updates["subnet"] = candidate.Subnet
 	}
 
+	oldDepartmentID := user.DepartmentID
+	oldRole := user.Role
 	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		if err = services.FixedIPConflict(database.DB, err); errors.Is(err, services.ErrIPConflict) {
+			// CCD 文件已按新地址写好，按数据库里的旧地址恢复
+			var current model.User
+			ccdErr := database.DB.First(&current, "id = ?", user.ID).Error
+			if ccdErr == nil {
+				ccdErr = services.ApplyClientCCD(database.DB, &current)
+			}
+			if ccdErr != nil {
+				logging.Error("failed to restore CCD of user %s: %v", user.Name, ccdErr)
+			}
+			fixedIPError(ctx, err)
+			return
+		}
 		common.InternalError(ctx, "failed to update user: "+err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: userAuditState(&user)})
+	// 令牌里带着角色与部门：这些变化以及改密码都让该用户的全部会话失效
+	switch {
+	case req.Password != "":
+		services.RevokeUserSessions(database.DB, user.ID, "", services.SessionRevokedPasswordChanged)
+	case (req.Role != "" && model.Role(req.Role) != oldRole) || (req.DepartmentID != "" && req.DepartmentID != oldDepartmentID):
+		services.RevokeUserSessions(database.DB, user.ID, "", services.SessionRevokedRoleChanged)
+	}
+	// 换部门可能改变是否需要动态口令，.ovpn 的 auth-user-pass 随之增删
+	if req.DepartmentID != "" && req.DepartmentID != oldDepartmentID {
+		if err := openvpn.RegenerateClientConfig(user.Name); err != nil {
+			logging.Warn("重新生成用户 %s 客户端配置失败: %v", user.Name, err)
+		}
+	}
 
 	common.OK(ctx, gin.H{
 		"id":           user.ID,
@@ -372,12 +499,13 @@ func (c *ClientController) UpdateUser(ctx *gin.Context) {
 		"role":         user.Role,
 		"departmentId": user.DepartmentID,
 		"fixedIp":      user.FixedIP,
+		"fixedIpv6":    user.FixedIPv6,
 		"subnet":       user.Subnet,
 		"updatedAt":    user.UpdatedAt,
 	})
 }
 
-// DeleteUser 删除用户 (manager 仅本部门)
+// DeleteUser 删除用户 (manager 仅本部门及下级部门)
 func (c *ClientController) DeleteUser(ctx *gin.Context) {
 	claims := ctx.MustGet("claims").(*middleware.Claims)
 	id := ctx.Param("id")
@@ -386,8 +514,9 @@ func (c *ClientController) DeleteUser(ctx *gin.Context) {
 		common.NotFound(ctx, "user not found")
 		return
 	}
-	if claims.Role == string(model.RoleManager) && (u.DepartmentID != claims.DeptID || u.ID == claims.UserID) {
-		common.Forbidden(ctx, "manager can only delete users in own department and cannot delete self")
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: u.Name, Before: userAuditState(&u)})
+	if departmentScoped(claims) && (!managesDepartment(claims, u.DepartmentID) || u.ID == claims.UserID) {
+		common.Forbidden(ctx, "you can only delete users in own department or sub-departments and cannot delete self")
 		return
 	}
 	if u.Role == model.RoleSuperAdmin && claims.Role != string(model.RoleSuperAdmin) {
@@ -399,16 +528,7 @@ func (c *ClientController) DeleteUser(ctx *gin.Context) {
 		return
 	}
 
-	if u.FixedIP != "" {
-		if err := openvpn.RemoveClientFixedIP(u.Name); err != nil {
-			logging.Warn("failed to remove fixed IP for user %s during deletion: %v", u.Name, err)
-		}
-	}
-	if err := openvpn.DeleteClient(u.Name); err != nil {
-		logging.Warn("failed to delete OpenVPN client data for user %s during deletion: %v", u.Name, err)
-	}
-
-	if err := database.DB.Delete(&model.User{}, "id = ?", id).Error; err != nil {
+	if err := services.DeleteUserAccount(database.DB, &u); err != nil {
 		common.InternalError(ctx, "failed to delete user from database: "+err.Error())
 		return
 	}
@@ -417,6 +537,7 @@ func (c *ClientController) DeleteUser(ctx *gin.Context) {
 
 // PauseClient 暂停 VPN 客户端（事务保证一致性）
 func (c *ClientController) PauseClient(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
 	username := ctx.Param("username")
 	if username == "" {
 		common.BadRequest(ctx, "username is required")
@@ -428,6 +549,11 @@ func (c *ClientController) PauseClient(ctx *gin.Context) {
 		common.NotFound(ctx, "user not found")
 		return
 	}
+	if !managesDepartment(claims, user.DepartmentID) {
+		common.Forbidden(ctx, "you can only pause users in own department or sub-departments")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: user.ID, Before: gin.H{"isPaused": user.IsPaused, "quotaPaused": user.QuotaPaused}})
 
 	if err := openvpn.PauseClient(username); err != nil {
 		common.InternalError(ctx, "Failed to pause client in OpenVPN: "+err.Error())
@@ -435,6 +561,7 @@ func (c *ClientController) PauseClient(ctx *gin.Context) {
 	}
 
 	user.IsPaused = true
+	user.QuotaPaused = false // 手动暂停不随配额周期自动恢复
 	if err := database.DB.Save(&user).Error; err != nil {
 		// 回滚 OpenVPN 状态
 		if resumeErr := openvpn.ResumeClient(username); resumeErr != nil {
@@ -444,11 +571,13 @@ func (c *ClientController) PauseClient(ctx *gin.Context) {
 		return
 	}
 
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"isPaused": true, "quotaPaused": false}})
 	common.OKMsg(ctx, "Client paused successfully")
 }
 
 // ResumeClient 恢复 VPN 客户端（事务保证一致性）
 func (c *ClientController) ResumeClient(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
 	username := ctx.Param("username")
 	if username == "" {
 		common.BadRequest(ctx, "username is required")
@@ -460,6 +589,11 @@ func (c *ClientController) ResumeClient(ctx *gin.Context) {
 		common.NotFound(ctx, "user not found")
 		return
 	}
+	if !managesDepartment(claims, user.DepartmentID) {
+		common.Forbidden(ctx, "you can only resume users in own department or sub-departments")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: user.ID, Before: gin.H{"isPaused": user.IsPaused, "quotaPaused": user.QuotaPaused}})
 
 	if err := openvpn.ResumeClient(username); err != nil {
 		common.InternalError(ctx, "Failed to resume client in OpenVPN: "+err.Error())
@@ -467,6 +601,7 @@ func (c *ClientController) ResumeClient(ctx *gin.Context) {
 	}
 
 	user.IsPaused = false
+	user.QuotaPaused = false
 	if err := database.DB.Save(&user).Error; err != nil {
 		if pauseErr := openvpn.PauseClient(username); pauseErr != nil {
 			logging.Error("failed to rollback OpenVPN resume for user %s: %v", username, pauseErr)
@@ -475,9 +610,70 @@ func (c *ClientController) ResumeClient(ctx *gin.Context) {
 		return
 	}
 
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"isPaused": false, "quotaPaused": false}})
 	common.OKMsg(ctx, "Client resumed successfully")
 }
 
+// fixedIPError 固定 IP 冲突或没有空闲地址时返回 409，其余 500
+func fixedIPError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrIPConflict) || errors.Is(err, services.ErrIPPoolExhausted) {
+		common.Fail(ctx, http.StatusConflict, err.Error())
+		return
+	}
+	if errors.Is(err, services.ErrInvalidClientCCD) {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	common.InternalError(ctx, "failed to check fixed IP: "+err.Error())
+}
+
+// userAuditState 审计记录中用户的可修改字段（密码只记录是否修改）
+func userAuditState(u *model.User) gin.H {
+	return gin.H{
+		"name":           u.Name,
+		"email":          u.Email,
+		"passwordHash":   u.PasswordHash,
+		"role":           u.Role,
+		"departmentId":   u.DepartmentID,
+		"fixedIp":        u.FixedIP,
+		"fixedIpv6":      u.FixedIPv6,
+		"subnet":         u.Subnet,
+		"isPaused":       u.IsPaused,
+		"approvalStatus": u.ApprovalStatus,
+	}
+}
+
+// activeLock 账号仍在登录锁定中时返回解锁时间，否则为 nil
+func activeLock(u *model.User) *time.Time {
+	if until, locked := services.AccountLockedUntil(u, time.Now()); locked {
+		return &until
+	}
+	return nil
+}
+
+// UnlockUser 解除连续登录失败导致的账号锁定（manager 仅本部门及下级部门）
+func (c *ClientController) UnlockUser(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var user model.User
+	if err := database.DB.Where("name = ?", ctx.Param("username")).First(&user).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: user.ID, Before: gin.H{"failedLoginCount": user.FailedLoginCount, "lockedUntil": user.LockedUntil}})
+	if !managesDepartment(claims, user.DepartmentID) {
+		common.Forbidden(ctx, "you can only unlock users in own department or sub-departments")
+		return
+	}
+	var actor model.User
+	database.DB.Select("name").First(&actor, "id = ?", claims.UserID)
+	if err := services.UnlockAccount(database.DB, &user, actor.Name, ctx.ClientIP()); err != nil {
+		common.InternalError(ctx, "failed to unlock account: "+err.Error())
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"failedLoginCount": 0, "lockedUntil": nil}})
+	common.OKMsg(ctx, "account unlocked")
+}
+
 // ApproveUser 批准待审核用户
 func (c *ClientController) ApproveUser(ctx *gin.Context) {
 	c.setApprovalStatus(ctx, model.ApprovalApproved)
@@ -489,7 +685,7 @@ func (c *ClientController) RejectUser(ctx *gin.Context) {
 }
 
 // setApprovalStatus 设置用户审批状态（按用户名定位，与 pause/resume 一致）。
-// manager 仅能审批本部门用户。
+// manager 仅能审批本部门及下级部门用户。
 func (c *ClientController) setApprovalStatus(ctx *gin.Context, status model.ApprovalStatus) {
 	claims := ctx.MustGet("claims").(*middleware.Claims)
 	username := ctx.Param("username")
@@ -504,9 +700,11 @@ func (c *ClientController) setApprovalStatus(ctx *gin.Context, status model.Appr
 		return
 	}
 
-	// manager 仅能审批本部门用户
-	if claims.Role == string(model.RoleManager) && user.DepartmentID != claims.DeptID {
-		ctx.JSON(http.StatusForbidden, gin.H{"error": "manager can only approve users in own department"})
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: user.ID, Before: gin.H{"approvalStatus": user.ApprovalStatus}})
+
+	// manager 仅能审批本部门及下级部门用户
+	if !managesDepartment(claims, user.DepartmentID) {
+		ctx.JSON(http.StatusForbidden, gin.H{"error": "you can only approve users in own department or sub-departments"})
 		return
 	}
 
@@ -514,6 +712,13 @@ func (c *ClientController) setApprovalStatus(ctx *gin.Context, status model.Appr
 		ctx.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update approval status: " + err.Error()})
 		return
 	}
+	if status != model.ApprovalApproved {
+		services.RevokeUserSessions(database.DB, user.ID, "", services.SessionRevokedAccountDisabled)
+	} else if err := services.ApplyClientCCD(database.DB, &user); err != nil {
+		// 自助注册的用户在批准后按部门网络策略生成 CCD
+		logging.Warn("生成用户 %s 的CCD失败: %v", user.Name, err)
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"approvalStatus": status}})
 
 	ctx.JSON(http.StatusOK, gin.H{"message": "ok", "approvalStatus": string(status)})
 }
@@ -539,8 +744,8 @@ func (c *ClientController) GetClientConfig(ctx *gin.Context) {
 	}
 
 	claims := ctx.MustGet("claims").(*middleware.Claims)
-	if claims.Role == string(model.RoleUser) && claims.UserID != user.ID {
-		common.Forbidden(ctx, "forbidden")
+	if !viewsUser(claims, &user) {
+		common.Forbidden(ctx, "you can only download own configs or configs of users in own department or sub-departments")
 		return
 	}
 
@@ -1,9 +1,17 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
 	"openvpn-admin-go/common"
 	"openvpn-admin-go/database"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/middleware"
 	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -19,28 +27,53 @@ func (c *DepartmentController) CreateDepartment(ctx *gin.Context) {
 		common.BadRequest(ctx, err.Error())
 		return
 	}
+	if dep.CertValidityDays < 0 {
+		common.BadRequest(ctx, "certValidityDays must not be negative")
+		return
+	}
+	if !checkDepartmentNetwork(ctx, &dep) {
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: dep.Name})
+	if !checkDepartmentParent(ctx, "", dep.ParentID) {
+		return
+	}
 
 	if err := database.DB.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Create(&dep).Error; err != nil {
 			return err
 		}
 		if dep.HeadID != "" {
-			return tx.Model(&model.User{}).
+			if err := tx.Model(&model.User{}).
 				Where("id = ?", dep.HeadID).
-				Update("department_id", dep.ID).Error
+				Update("department_id", dep.ID).Error; err != nil {
+				return err
+			}
+			// 负责人加入新部门，按部门网络策略重新生成其 CCD
+			return services.RefreshDepartmentCCDs(tx, dep.ID)
 		}
 		return nil
 	}); err != nil {
-		common.InternalError(ctx, err.Error())
+		departmentWriteError(ctx, err)
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: dep.ID, After: dep})
+	refreshClientFirewall()
 
 	common.OK(ctx, dep)
 }
 
-// ListDepartments 列出所有部门
+// ListDepartments 列出所有部门；?view=tree 时按上下级返回树（children 逐级嵌套）
 func (c *DepartmentController) ListDepartments(ctx *gin.Context) {
 	var deps []model.Department
+	if ctx.Query("view") == "tree" {
+		if err := database.DB.Preload("Head").Order("name").Find(&deps).Error; err != nil {
+			common.InternalError(ctx, err.Error())
+			return
+		}
+		common.OK(ctx, services.BuildDepartmentTree(deps))
+		return
+	}
 	if err := database.DB.
 		Preload("Head").
 		Preload("Parent").
@@ -75,14 +108,26 @@ func (c *DepartmentController) UpdateDepartment(ctx *gin.Context) {
 		common.NotFound(ctx, "department not found")
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: existing.Name, Before: existing})
 	var req model.Department
 	if err := ctx.ShouldBindJSON(&req); err != nil {
 		common.BadRequest(ctx, err.Error())
 		return
 	}
+	if req.CertValidityDays < 0 {
+		common.BadRequest(ctx, "certValidityDays must not be negative")
+		return
+	}
+	if !checkDepartmentNetwork(ctx, &req) {
+		return
+	}
+	if req.ParentID != existing.ParentID && !checkDepartmentParent(ctx, id, req.ParentID) {
+		return
+	}
 
 	if err := database.DB.Transaction(func(tx *gorm.DB) error {
-		updates := map[string]interface{}{"name": req.Name, "head_id": req.HeadID, "parent_id": req.ParentID}
+		updates := map[string]interface{}{"name": req.Name, "head_id": req.HeadID, "parent_id": req.ParentID, "cert_validity_days": req.CertValidityDays, "csr_only": req.CSROnly, "vpn_otp_required": req.VPNOTPRequired,
+			"routes": req.Routes, "dns_servers": req.DNSServers, "search_domains": req.SearchDomains, "ip_pool_start": req.IPPoolStart, "ip_pool_end": req.IPPoolEnd, "client_to_client": req.ClientToClient}
 		if err := tx.Model(&model.Department{}).Where("id = ?", id).Updates(updates).Error; err != nil {
 			return err
 		}
@@ -102,22 +147,110 @@ func (c *DepartmentController) UpdateDepartment(ctx *gin.Context) {
 					return err
 				}
 			}
+			// 原负责人离开部门，不再继承部门网络策略
+			if existing.HeadID != "" {
+				var oldHead model.User
+				if err := tx.First(&oldHead, "id = ?", existing.HeadID).Error; err == nil {
+					if err := services.ApplyClientCCD(tx, &oldHead); err != nil {
+						return fmt.Errorf("former head %s: %w", oldHead.Name, err)
+					}
+				}
+			}
+		}
+		// 网络策略、上级部门或负责人变化：重新生成该部门及下级部门全部成员的 CCD，
+		// 有成员的固定 IP 不在新的 IP 范围内时整体回滚
+		if networkPolicyChanged(&existing, &req) || req.ParentID != existing.ParentID || req.HeadID != existing.HeadID {
+			return services.RefreshDepartmentCCDs(tx, id)
 		}
 		return nil
 	}); err != nil {
-		common.InternalError(ctx, err.Error())
+		departmentWriteError(ctx, err)
 		return
 	}
 
+	var updated model.Department
+	if err := database.DB.First(&updated, "id = ?", id).Error; err == nil {
+		middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: updated.Name, After: updated})
+	}
+
+	// 动态口令开关（或继承它的上级部门）变化：成员（含下级部门）的 .ovpn 增删 auth-user-pass
+	if req.VPNOTPRequired != existing.VPNOTPRequired || req.ParentID != existing.ParentID {
+		if err := services.RefreshVPNOTPProfiles(database.DB, id); err != nil {
+			logging.Warn("重新生成部门 %s 成员客户端配置失败: %v", id, err)
+		}
+	}
+
+	refreshClientFirewall()
 	common.OKMsg(ctx, "department updated")
 }
 
+// refreshClientFirewall 部门的客户端互访策略、上级部门或成员变化后立即更新放行名单，
+// 失败只记日志（下一个状态同步周期会重试）
+func refreshClientFirewall() {
+	if err := services.SyncClientToClientFirewall(database.DB); err != nil {
+		logging.Warn("更新客户端互访防火墙规则失败: %v", err)
+	}
+}
+
+// checkDepartmentNetwork 规范化并校验部门网络策略，失败时写入 400 响应
+func checkDepartmentNetwork(ctx *gin.Context, dep *model.Department) bool {
+	dep.Routes, dep.DNSServers, dep.SearchDomains = dep.Routes.Compact(), dep.DNSServers.Compact(), dep.SearchDomains.Compact()
+	dep.IPPoolStart, dep.IPPoolEnd = strings.TrimSpace(dep.IPPoolStart), strings.TrimSpace(dep.IPPoolEnd)
+	err := services.ValidateDepartmentNetwork(dep)
+	if errors.Is(err, services.ErrInvalidDepartmentNetwork) {
+		common.BadRequest(ctx, err.Error())
+		return false
+	} else if err != nil {
+		common.InternalError(ctx, err.Error())
+		return false
+	}
+	return true
+}
+
+// networkPolicyChanged 部门自己的网络策略是否有变化
+func networkPolicyChanged(old, updated *model.Department) bool {
+	return !reflect.DeepEqual(old.Routes.Compact(), updated.Routes) || !reflect.DeepEqual(old.DNSServers.Compact(), updated.DNSServers) ||
+		!reflect.DeepEqual(old.SearchDomains.Compact(), updated.SearchDomains) || old.IPPoolStart != updated.IPPoolStart || old.IPPoolEnd != updated.IPPoolEnd ||
+		(old.ClientToClient == nil) != (updated.ClientToClient == nil) || (old.ClientToClient != nil && *old.ClientToClient != *updated.ClientToClient)
+}
+
+// departmentWriteError 部门写操作失败：成员 CCD 校验失败返回 400，其余 500
+func departmentWriteError(ctx *gin.Context, err error) {
+	if errors.Is(err, services.ErrInvalidClientCCD) {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	common.InternalError(ctx, err.Error())
+}
+
+// checkDepartmentParent 校验上级部门存在且不会成环，失败时写入 400 响应
+func checkDepartmentParent(ctx *gin.Context, id, parentID string) bool {
+	err := services.CheckDepartmentParent(database.DB, id, parentID)
+	if errors.Is(err, services.ErrDepartmentCycle) || errors.Is(err, services.ErrParentDepartmentNotFound) {
+		common.BadRequest(ctx, err.Error())
+		return false
+	} else if err != nil {
+		common.InternalError(ctx, err.Error())
+		return false
+	}
+	return true
+}
+
 // DeleteDepartment 删除部门
 func (c *DepartmentController) DeleteDepartment(ctx *gin.Context) {
 	id := ctx.Param("id")
+	var existing model.Department
+	if err := database.DB.First(&existing, "id = ?", id).Error; err == nil {
+		middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: existing.Name, Before: existing})
+	}
 	if err := database.DB.Delete(&model.Department{}, "id = ?", id).Error; err != nil {
 		common.InternalError(ctx, err.Error())
 		return
 	}
+	// 成员（含下级部门）不再继承该部门的网络策略
+	if err := services.RefreshDepartmentCCDs(database.DB, id); err != nil {
+		logging.Warn("重新生成部门 %s 成员CCD失败: %v", id, err)
+	}
+	refreshClientFirewall()
 	common.OKMsg(ctx, "department deleted")
 }
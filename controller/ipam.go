@@ -0,0 +1,22 @@
+package controller
+
+import (
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IPAMController 隧道地址管理（路由要求 ipam.read）
+type IPAMController struct{}
+
+// Get 返回服务端网段与各部门 IP 范围的使用率、全部地址占用记录以及被多个客户端占用的地址
+func (c *IPAMController) Get(ctx *gin.Context) {
+	view, err := services.GetIPAMView(database.DB)
+	if err != nil {
+		common.InternalError(ctx, "Failed to collect IP address assignments: "+err.Error())
+		return
+	}
+	common.OK(ctx, view)
+}
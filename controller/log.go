@@ -8,7 +8,6 @@ import (
 
 	"openvpn-admin-go/common"
 	"openvpn-admin-go/logging"
-	"openvpn-admin-go/middleware"
 	"openvpn-admin-go/openvpn"
 
 	"github.com/gin-gonic/gin"
@@ -17,14 +16,8 @@ import (
 // LogController 日志查询
 type LogController struct{}
 
-// GetServerLogs 获取服务器日志
+// GetServerLogs 获取服务器日志（路由要求 logs.read）
 func (c *LogController) GetServerLogs(ctx *gin.Context) {
-	claims := ctx.MustGet("claims").(*middleware.Claims)
-	if claims.Role != string("superadmin") && claims.Role != string("admin") {
-		common.Forbidden(ctx, "forbidden")
-		return
-	}
-
 	cfg, err := openvpn.LoadConfig()
 	if err != nil {
 		common.InternalError(ctx, "failed to load OpenVPN config")
@@ -52,12 +45,6 @@ func (c *LogController) GetServerLogs(ctx *gin.Context) {
 
 // GetClientLogs 获取客户端日志，支持分页
 func (c *LogController) GetClientLogs(ctx *gin.Context) {
-	claims := ctx.MustGet("claims").(*middleware.Claims)
-	if claims.Role != string("superadmin") && claims.Role != string("admin") {
-		common.Forbidden(ctx, "forbidden")
-		return
-	}
-
 	cfg, err := openvpn.LoadConfig()
 	if err != nil {
 		common.InternalError(ctx, "failed to load OpenVPN config")
@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"errors"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMySessions 当前用户的有效登录会话（current 标记发起请求的会话）
+func ListMySessions(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	sessions, err := services.ListLoginSessions(database.DB, claims.UserID)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	items := make([]gin.H, 0, len(sessions))
+	for _, s := range sessions {
+		items = append(items, gin.H{
+			"id":         s.ID,
+			"ip":         s.IP,
+			"userAgent":  s.UserAgent,
+			"createdAt":  s.CreatedAt,
+			"lastUsedAt": s.LastUsedAt,
+			"expiresAt":  s.ExpiresAt,
+			"current":    s.ID == claims.ID,
+		})
+	}
+	common.OK(c, items)
+}
+
+// RevokeMySession 吊销当前用户的一个会话（可以是当前会话，相当于登出）
+func RevokeMySession(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	err := services.RevokeLoginSession(database.DB, claims.UserID, c.Param("id"), services.SessionRevokedByUser)
+	if errors.Is(err, services.ErrLoginSessionNotFound) {
+		common.NotFound(c, err.Error())
+		return
+	} else if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	common.OKMsg(c, "session revoked")
+}
+
+// RevokeOtherSessions 吊销当前用户除当前会话以外的全部会话
+func RevokeOtherSessions(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	if err := services.RevokeUserSessions(database.DB, claims.UserID, claims.ID, services.SessionRevokedByUser); err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	common.OKMsg(c, "other sessions revoked")
+}
@@ -0,0 +1,420 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
+	"openvpn-admin-go/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mfaRecoveryCodeCount 每次生成的恢复码个数
+const mfaRecoveryCodeCount = 10
+
+// mfaRequired 该角色是否必须启用两步验证（MFA_REQUIRED_ROLES）
+func mfaRequired(role model.Role) bool {
+	for _, r := range utils.GetMFARequiredRoles() {
+		if r == string(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func splitRecoveryCodes(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+// verifySecondFactor 校验 TOTP 验证码或恢复码（二选一）。TOTP 成功后推进 mfa_last_step，
+// 恢复码成功后将其删除；两者都以条件更新落库，并发请求里同一验证码 / 恢复码只能用一次。
+func verifySecondFactor(user *model.User, code, recoveryCode string) bool {
+	if code != "" {
+		step, ok := common.ValidateTOTP(user.MFASecret, code, time.Now(), user.MFALastStep)
+		if !ok {
+			return false
+		}
+		res := database.DB.Model(&model.User{}).
+			Where("id = ? AND mfa_last_step < ?", user.ID, step).
+			Update("mfa_last_step", step)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return false
+		}
+		user.MFALastStep = step
+		return true
+	}
+	if recoveryCode == "" || !user.MFAEnabled {
+		return false
+	}
+	hash := common.HashRecoveryCode(recoveryCode)
+	codes := splitRecoveryCodes(user.MFARecoveryCodes)
+	for i, h := range codes {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) != 1 {
+			continue
+		}
+		remaining := strings.Join(append(append([]string{}, codes[:i]...), codes[i+1:]...), ",")
+		res := database.DB.Model(&model.User{}).
+			Where("id = ? AND mfa_recovery_codes = ?", user.ID, user.MFARecoveryCodes).
+			Update("mfa_recovery_codes", remaining)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return false
+		}
+		user.MFARecoveryCodes = remaining
+		return true
+	}
+	return false
+}
+
+// newMFASecret 生成待确认的 TOTP 密钥并保存，返回密钥与扫码 URI
+func newMFASecret(user *model.User) (gin.H, error) {
+	secret, err := common.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{"mfa_secret": secret, "mfa_last_step": 0}).Error; err != nil {
+		return nil, err
+	}
+	user.MFASecret, user.MFALastStep = secret, 0
+	return gin.H{
+		"secret": secret,
+		"uri":    common.TOTPProvisioningURI(utils.GetMFAIssuer(), user.Email, secret),
+	}, nil
+}
+
+// enableMFA 用待确认密钥的验证码启用两步验证，返回新生成的恢复码（仅此一次明文展示）。
+// 验证码错误时返回 ok=false。
+func enableMFA(user *model.User, code string) (codes []string, ok bool, err error) {
+	if user.MFASecret == "" || !verifySecondFactor(user, code, "") {
+		return nil, false, nil
+	}
+	codes, hashes, err := common.GenerateRecoveryCodes(mfaRecoveryCodeCount)
+	if err != nil {
+		return nil, true, err
+	}
+	if err := database.DB.Model(user).Updates(map[string]interface{}{
+		"mfa_enabled":        true,
+		"mfa_recovery_codes": strings.Join(hashes, ","),
+	}).Error; err != nil {
+		return nil, true, err
+	}
+	user.MFAEnabled = true
+	return codes, true, nil
+}
+
+// issueLoginToken 签发登录 JWT 并返回用户信息（登录成功的统一出口）
+func issueLoginToken(c *gin.Context, user *model.User, extra gin.H) {
+	middleware.SetAudit(c, middleware.AuditInfo{ActorID: user.ID, TargetID: user.ID, TargetName: user.Name})
+	services.RecordLoginSuccess(database.DB, user)
+	session, refreshToken, err := services.CreateLoginSession(database.DB, user, c.ClientIP(), c.Request.UserAgent())
+	if err != nil {
+		common.InternalError(c, "create session failed")
+		return
+	}
+	token, err := middleware.GenerateToken(session.ID, user.ID, string(user.Role), user.DepartmentID)
+	if err != nil {
+		common.InternalError(c, "generate token failed")
+		return
+	}
+	resp := gin.H{"user": gin.H{
+		"id":    user.ID,
+		"name":  user.Name,
+		"email": user.Email,
+		"role":  user.Role,
+	}, "token": token, "refreshToken": refreshToken, "expiresIn": int(middleware.AccessTokenTTL.Seconds())}
+	for k, v := range extra {
+		resp[k] = v
+	}
+	common.OK(c, resp)
+}
+
+// newMFAChallenge 签发挑战令牌，jti 记为一次性令牌（同时作废该用户之前未使用的挑战令牌）
+func newMFAChallenge(user *model.User) (string, error) {
+	jti, err := services.IssueUserToken(database.DB, user, model.UserTokenMFAChallenge, middleware.MFAChallengeTTL)
+	if err != nil {
+		return "", err
+	}
+	return middleware.GenerateMFAChallengeToken(user.ID, jti)
+}
+
+// challengeUser 解析挑战令牌、加载用户并作废令牌（每个挑战令牌只能用一次，验证码错误也要重新登录）；
+// 失败时已写好响应
+func challengeUser(c *gin.Context, challengeToken string) (*model.User, bool) {
+	userID, jti, err := middleware.ParseMFAChallengeToken(challengeToken)
+	if err != nil {
+		common.Unauthorized(c, "invalid or expired challenge token")
+		return nil, false
+	}
+	var user model.User
+	if err := database.DB.First(&user, "id = ?", userID).Error; err != nil {
+		common.Unauthorized(c, "invalid or expired challenge token")
+		return nil, false
+	}
+	if rejectLocked(c, &user) {
+		return nil, false
+	}
+	if user.ApprovalStatus != model.ApprovalApproved {
+		common.Forbidden(c, "account is not approved")
+		return nil, false
+	}
+	row, err := services.ConsumeUserToken(database.DB, jti, model.UserTokenMFAChallenge)
+	if err != nil || row.UserID != user.ID {
+		common.Unauthorized(c, "invalid or expired challenge token")
+		return nil, false
+	}
+	return &user, true
+}
+
+type loginMFARequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recoveryCode"`
+}
+
+// LoginMFA 登录第二步：挑战令牌 + TOTP 验证码（或恢复码）换取登录 JWT。
+// 角色要求两步验证但尚未启用的用户，先调用 LoginMFASetup 拿到密钥，这里的验证码同时完成启用，
+// 响应里附带恢复码。
+func LoginMFA(c *gin.Context) {
+	var req loginMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	user, ok := challengeUser(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+
+	if !user.MFAEnabled {
+		codes, ok, err := enableMFA(user, req.Code)
+		if err != nil {
+			common.InternalError(c, "enable MFA failed: "+err.Error())
+			return
+		}
+		if !ok {
+			loginFailed(c, user, "invalid verification code")
+			return
+		}
+		issueLoginToken(c, user, gin.H{"recoveryCodes": codes})
+		return
+	}
+
+	if !verifySecondFactor(user, req.Code, req.RecoveryCode) {
+		loginFailed(c, user, "invalid verification code")
+		return
+	}
+	extra := gin.H{}
+	if req.Code == "" {
+		extra["recoveryCodesRemaining"] = len(splitRecoveryCodes(user.MFARecoveryCodes))
+	}
+	issueLoginToken(c, user, extra)
+}
+
+type loginMFASetupRequest struct {
+	ChallengeToken string `json:"challengeToken" binding:"required"`
+}
+
+// LoginMFASetup 登录过程中的强制启用：角色要求两步验证但尚未启用时，用挑战令牌生成 TOTP 密钥。
+// 传入的挑战令牌已作废，响应里附带新的挑战令牌供 LoginMFA 使用
+func LoginMFASetup(c *gin.Context) {
+	var req loginMFASetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	user, ok := challengeUser(c, req.ChallengeToken)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		common.BadRequest(c, "MFA is already enabled")
+		return
+	}
+	resp, err := newMFASecret(user)
+	if err != nil {
+		common.InternalError(c, "generate MFA secret failed: "+err.Error())
+		return
+	}
+	challenge, err := newMFAChallenge(user)
+	if err != nil {
+		common.InternalError(c, "generate challenge token failed")
+		return
+	}
+	resp["challengeToken"] = challenge
+	resp["expiresIn"] = int(middleware.MFAChallengeTTL.Seconds())
+	common.OK(c, resp)
+}
+
+// currentUser 加载当前登录用户；失败时已写好响应
+func currentUser(c *gin.Context) (*model.User, bool) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	var user model.User
+	if err := database.DB.First(&user, "id = ?", claims.UserID).Error; err != nil {
+		common.NotFound(c, "user not found")
+		return nil, false
+	}
+	return &user, true
+}
+
+// GetMFAStatus 当前用户的两步验证状态
+func GetMFAStatus(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	common.OK(c, gin.H{
+		"enabled":                user.MFAEnabled,
+		"required":               mfaRequired(user.Role),
+		"recoveryCodesRemaining": len(splitRecoveryCodes(user.MFARecoveryCodes)),
+	})
+}
+
+// SetupMFA 生成新的 TOTP 密钥（待 EnableMFA 确认）。已启用时需先停用。
+func SetupMFA(c *gin.Context) {
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		common.BadRequest(c, "MFA is already enabled")
+		return
+	}
+	resp, err := newMFASecret(user)
+	if err != nil {
+		common.InternalError(c, "generate MFA secret failed: "+err.Error())
+		return
+	}
+	common.OK(c, resp)
+}
+
+type mfaCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// EnableMFA 用验证器 App 上的验证码确认 SetupMFA 生成的密钥并启用，返回恢复码
+func EnableMFA(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if user.MFAEnabled {
+		common.BadRequest(c, "MFA is already enabled")
+		return
+	}
+	codes, ok, err := enableMFA(user, req.Code)
+	if err != nil {
+		common.InternalError(c, "enable MFA failed: "+err.Error())
+		return
+	}
+	if !ok {
+		common.BadRequest(c, "invalid verification code")
+		return
+	}
+	common.OK(c, gin.H{"recoveryCodes": codes})
+}
+
+// DisableMFA 停用两步验证（需验证码或恢复码）。角色要求两步验证时不允许停用。
+func DisableMFA(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		common.BadRequest(c, "MFA is not enabled")
+		return
+	}
+	if mfaRequired(user.Role) {
+		common.Forbidden(c, "MFA is required for role "+string(user.Role))
+		return
+	}
+	if !verifySecondFactor(user, req.Code, req.RecoveryCode) {
+		common.BadRequest(c, "invalid verification code")
+		return
+	}
+	if err := clearMFA(user.ID); err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	common.OKMsg(c, "MFA disabled")
+}
+
+// RegenerateRecoveryCodes 重新生成恢复码（旧恢复码全部作废），需 TOTP 验证码
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req mfaCodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	user, ok := currentUser(c)
+	if !ok {
+		return
+	}
+	if !user.MFAEnabled {
+		common.BadRequest(c, "MFA is not enabled")
+		return
+	}
+	if !verifySecondFactor(user, req.Code, "") {
+		common.BadRequest(c, "invalid verification code")
+		return
+	}
+	codes, hashes, err := common.GenerateRecoveryCodes(mfaRecoveryCodeCount)
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	if err := database.DB.Model(user).Update("mfa_recovery_codes", strings.Join(hashes, ",")).Error; err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	common.OK(c, gin.H{"recoveryCodes": codes})
+}
+
+// ResetUserMFA 为丢失验证器与恢复码的用户清除两步验证（需要 user.mfa.reset，superadmin 的只能由 superadmin 清除）；
+// 角色要求两步验证的用户下次登录时会被要求重新启用
+func ResetUserMFA(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	var user model.User
+	if err := database.DB.First(&user, "id = ?", c.Param("id")).Error; err != nil {
+		common.NotFound(c, "user not found")
+		return
+	}
+	middleware.SetAudit(c, middleware.AuditInfo{TargetName: user.Name, Before: gin.H{"mfaEnabled": user.MFAEnabled}})
+	if user.Role == model.RoleSuperAdmin && claims.Role != string(model.RoleSuperAdmin) {
+		common.Forbidden(c, "only superadmin can reset MFA of superadmin user")
+		return
+	}
+	if err := clearMFA(user.ID); err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	middleware.SetAudit(c, middleware.AuditInfo{After: gin.H{"mfaEnabled": false}})
+	common.OKMsg(c, "MFA reset")
+}
+
+func clearMFA(userID string) error {
+	return database.DB.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"mfa_enabled":        false,
+		"mfa_secret":         "",
+		"mfa_recovery_codes": "",
+		"mfa_last_step":      0,
+	}).Error
+}
@@ -20,6 +20,7 @@ type notificationResponse struct {
 	UserName  string `json:"userName"`
 	RealIP    string `json:"realIP"`
 	VirtualIP string `json:"virtualIP"`
+	Detail    string `json:"detail,omitempty"`
 	IsRead    bool   `json:"isRead"`
 	CreatedAt string `json:"createdAt"`
 }
@@ -31,6 +32,7 @@ func toResponse(n model.Notification) notificationResponse {
 		UserName:  n.UserName,
 		RealIP:    n.RealIP,
 		VirtualIP: n.VirtualIP,
+		Detail:    n.Detail,
 		IsRead:    n.IsRead,
 		CreatedAt: n.CreatedAt.UTC().Format(time.RFC3339),
 	}
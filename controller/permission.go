@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"errors"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PermissionController 权限注册表与角色权限管理（superadmin）
+type PermissionController struct{}
+
+// List 全部权限及每个角色当前拥有的权限
+func (c *PermissionController) List(ctx *gin.Context) {
+	roles := gin.H{string(model.RoleSuperAdmin): services.RolePermissions(string(model.RoleSuperAdmin))}
+	for _, r := range model.EditableRoles {
+		roles[string(r)] = services.RolePermissions(string(r))
+	}
+	common.OK(ctx, gin.H{
+		"permissions":   model.PermissionRegistry,
+		"roles":         roles,
+		"editableRoles": model.EditableRoles,
+	})
+}
+
+// UpdateRole 替换某个角色的全部权限
+func (c *PermissionController) UpdateRole(ctx *gin.Context) {
+	var req struct {
+		Permissions []string `json:"permissions" binding:"required"`
+	}
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	role := ctx.Param("role")
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: role, Before: gin.H{"permissions": services.RolePermissions(role)}})
+	if err := services.SetRolePermissions(database.DB, role, req.Permissions); err != nil {
+		if errors.Is(err, services.ErrRoleNotEditable) || errors.Is(err, services.ErrPermissionUnknown) {
+			common.BadRequest(ctx, err.Error())
+			return
+		}
+		common.InternalError(ctx, "failed to update role permissions: "+err.Error())
+		return
+	}
+	perms := services.RolePermissions(role)
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"permissions": perms}})
+	common.OK(ctx, gin.H{"role": role, "permissions": perms})
+}
+
+// GetMyPermissions 当前用户的有效权限，前端据此隐藏无权操作的按钮
+func GetMyPermissions(c *gin.Context) {
+	claims := c.MustGet("claims").(*middleware.Claims)
+	common.OK(c, gin.H{"role": claims.Role, "permissions": services.RolePermissions(claims.Role)})
+}
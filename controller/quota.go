@@ -0,0 +1,209 @@
+package controller
+
+import (
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// QuotaController 流量配额：设置用户 / 部门的日、月配额并查看当期用量
+type QuotaController struct{}
+
+type quotaRequest struct {
+	DailyQuotaBytes   *int64 `json:"dailyQuotaBytes" binding:"omitempty,min=0"`
+	MonthlyQuotaBytes *int64 `json:"monthlyQuotaBytes" binding:"omitempty,min=0"`
+}
+
+func (r quotaRequest) updates() map[string]interface{} {
+	updates := make(map[string]interface{})
+	if r.DailyQuotaBytes != nil {
+		updates["daily_quota_bytes"] = *r.DailyQuotaBytes
+	}
+	if r.MonthlyQuotaBytes != nil {
+		updates["monthly_quota_bytes"] = *r.MonthlyQuotaBytes
+	}
+	return updates
+}
+
+func userQuotaResponse(u *model.User, now time.Time) gin.H {
+	daily, monthly, _ := services.UserUsage(database.DB, u.ID, now)
+	return gin.H{
+		"id":                u.ID,
+		"name":              u.Name,
+		"departmentId":      u.DepartmentID,
+		"dailyQuotaBytes":   u.DailyQuotaBytes,
+		"monthlyQuotaBytes": u.MonthlyQuotaBytes,
+		"dailyUsedBytes":    daily,
+		"monthlyUsedBytes":  monthly,
+		"isPaused":          u.IsPaused,
+		"quotaPaused":       u.QuotaPaused,
+	}
+}
+
+func departmentQuotaResponse(d *model.Department, now time.Time) gin.H {
+	daily, monthly, _ := services.DepartmentUsage(database.DB, d.ID, now)
+	return gin.H{
+		"id":                d.ID,
+		"name":              d.Name,
+		"dailyQuotaBytes":   d.DailyQuotaBytes,
+		"monthlyQuotaBytes": d.MonthlyQuotaBytes,
+		"dailyUsedBytes":    daily,
+		"monthlyUsedBytes":  monthly,
+	}
+}
+
+// quotaScope 限定非 superadmin / admin 角色只能看到本部门及下级部门的数据，column 为部门 ID 列
+func quotaScope(claims *middleware.Claims, column string) (*gorm.DB, error) {
+	db := database.DB
+	if !departmentScoped(claims) {
+		return db, nil
+	}
+	deptIDs, err := services.DepartmentSubtree(database.DB, claims.DeptID)
+	if err != nil {
+		return nil, err
+	}
+	return db.Where(column+" IN ?", deptIDs), nil
+}
+
+// ListUserQuotas 列出用户的配额与当期用量 (部门内角色仅本部门及下级部门)
+func (c *QuotaController) ListUserQuotas(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	db, err := quotaScope(claims, "department_id")
+	if err != nil {
+		common.InternalError(ctx, "Failed to list users: "+err.Error())
+		return
+	}
+	var users []model.User
+	if err := db.Order("name").Find(&users).Error; err != nil {
+		common.InternalError(ctx, "Failed to list users: "+err.Error())
+		return
+	}
+	now := time.Now()
+	resp := make([]gin.H, 0, len(users))
+	for i := range users {
+		resp = append(resp, userQuotaResponse(&users[i], now))
+	}
+	common.OK(ctx, resp)
+}
+
+// GetUserQuota 获取单个用户的配额与当期用量
+func (c *QuotaController) GetUserQuota(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var u model.User
+	if err := database.DB.First(&u, "id = ?", ctx.Param("id")).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return
+	}
+	if !managesDepartment(claims, u.DepartmentID) {
+		common.Forbidden(ctx, "you can only view quotas of users in own department or sub-departments")
+		return
+	}
+	common.OK(ctx, userQuotaResponse(&u, time.Now()))
+}
+
+// SetUserQuota 设置用户配额（0 表示不限）。调高配额后已自动暂停的用户会立即恢复。
+// 部门内角色只能设置本部门及下级部门其他用户的配额，不能改自己的
+func (c *QuotaController) SetUserQuota(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var req quotaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	var u model.User
+	if err := database.DB.First(&u, "id = ?", ctx.Param("id")).Error; err != nil {
+		common.NotFound(ctx, "user not found")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: u.Name, Before: userQuotaResponse(&u, time.Now())})
+	if departmentScoped(claims) && (!managesDepartment(claims, u.DepartmentID) || u.ID == claims.UserID) {
+		common.Forbidden(ctx, "you can only set quotas of users in own department or sub-departments and cannot change own quota")
+		return
+	}
+	if updates := req.updates(); len(updates) > 0 {
+		if err := database.DB.Model(&u).Updates(updates).Error; err != nil {
+			common.InternalError(ctx, "Failed to update quota: "+err.Error())
+			return
+		}
+		services.ResumeQuotaPausedUsers(database.DB)
+		database.DB.First(&u, "id = ?", u.ID)
+	}
+	resp := userQuotaResponse(&u, time.Now())
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: resp})
+	common.OK(ctx, resp)
+}
+
+// ListDepartmentQuotas 列出部门的配额与当期用量 (部门内角色仅本部门及下级部门)
+func (c *QuotaController) ListDepartmentQuotas(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	db, err := quotaScope(claims, "id")
+	if err != nil {
+		common.InternalError(ctx, "Failed to list departments: "+err.Error())
+		return
+	}
+	var deps []model.Department
+	if err := db.Order("name").Find(&deps).Error; err != nil {
+		common.InternalError(ctx, "Failed to list departments: "+err.Error())
+		return
+	}
+	now := time.Now()
+	resp := make([]gin.H, 0, len(deps))
+	for i := range deps {
+		resp = append(resp, departmentQuotaResponse(&deps[i], now))
+	}
+	common.OK(ctx, resp)
+}
+
+// GetDepartmentQuota 获取单个部门的配额与当期用量
+func (c *QuotaController) GetDepartmentQuota(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var d model.Department
+	if err := database.DB.First(&d, "id = ?", ctx.Param("id")).Error; err != nil {
+		common.NotFound(ctx, "department not found")
+		return
+	}
+	if !managesDepartment(claims, d.ID) {
+		common.Forbidden(ctx, "you can only view quotas of own department or sub-departments")
+		return
+	}
+	common.OK(ctx, departmentQuotaResponse(&d, time.Now()))
+}
+
+// SetDepartmentQuota 设置部门配额（部门及下级部门全体成员合计，0 表示不限）。
+// 部门内角色只能设置下级部门的配额，不能放宽约束自己的本部门配额
+func (c *QuotaController) SetDepartmentQuota(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	var req quotaRequest
+	if err := ctx.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(ctx, err.Error())
+		return
+	}
+	var d model.Department
+	if err := database.DB.First(&d, "id = ?", ctx.Param("id")).Error; err != nil {
+		common.NotFound(ctx, "department not found")
+		return
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetName: d.Name, Before: departmentQuotaResponse(&d, time.Now())})
+	if departmentScoped(claims) && (!managesDepartment(claims, d.ID) || d.ID == claims.DeptID) {
+		common.Forbidden(ctx, "you can only set quotas of sub-departments")
+		return
+	}
+	if updates := req.updates(); len(updates) > 0 {
+		if err := database.DB.Model(&d).Updates(updates).Error; err != nil {
+			common.InternalError(ctx, "Failed to update quota: "+err.Error())
+			return
+		}
+		services.ResumeQuotaPausedUsers(database.DB)
+		database.DB.First(&d, "id = ?", d.ID)
+	}
+	resp := departmentQuotaResponse(&d, time.Now())
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: resp})
+	common.OK(ctx, resp)
+}
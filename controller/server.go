@@ -1,7 +1,9 @@
 package controller
 
 import (
+	"crypto/sha256"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"strings"
@@ -9,7 +11,9 @@ import (
 
 	"openvpn-admin-go/common"
 	"openvpn-admin-go/constants"
+	"openvpn-admin-go/middleware"
 	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/openvpn/pki"
 	"openvpn-admin-go/utils"
 
 	"github.com/gin-gonic/gin"
@@ -37,6 +41,7 @@ func (c *ServerController) ListServers(ctx *gin.Context) {
 		Protocol  string `json:"protocol"`
 		Network   string `json:"network"`
 		Netmask   string `json:"netmask"`
+		NetworkV6 string `json:"networkIpv6,omitempty"`
 		Status    string `json:"status"`
 		Uptime    string `json:"uptime"`
 		Connected int    `json:"connected"`
@@ -46,6 +51,7 @@ func (c *ServerController) ListServers(ctx *gin.Context) {
 		Protocol:  cfg.OpenVPNProto,
 		Network:   cfg.OpenVPNServerNetwork,
 		Netmask:   cfg.OpenVPNServerNetmask,
+		NetworkV6: cfg.OpenVPNServerIPv6,
 		Status:    status.Status,
 		Uptime:    status.Uptime,
 		Connected: status.Connected,
@@ -122,6 +128,7 @@ func (c *ServerController) UpdateServer(ctx *gin.Context) {
 		common.BadRequest(ctx, err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: server})
 	// 使用 openvpn/server 包处理参数更新与服务重启
 	if err := openvpn.ConfigureServer(server.Port, server.Protocol, server.Network, server.Netmask); err != nil {
 		common.InternalError(ctx, err.Error())
@@ -204,6 +211,11 @@ func (c *ServerController) UpdateServerConfig(ctx *gin.Context) {
 		common.BadRequest(ctx, err.Error())
 		return
 	}
+	// 配置中可能内联密钥，审计只记录内容摘要
+	if old, err := os.ReadFile(constants.ServerConfigPath); err == nil {
+		middleware.SetAudit(ctx, middleware.AuditInfo{Before: gin.H{"configSha256": fmt.Sprintf("%x", sha256.Sum256(old))}})
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"configSha256": fmt.Sprintf("%x", sha256.Sum256([]byte(config.Config)))}})
 	// 使用 openvpn/server 包写入自定义配置并重启服务
 	if err := openvpn.ApplyServerConfig(config.Config); err != nil {
 		common.InternalError(ctx, err.Error())
@@ -222,6 +234,11 @@ func (c *ServerController) UpdatePort(ctx *gin.Context) {
 		return
 	}
 
+	if cfg, err := openvpn.LoadConfig(); err == nil {
+		middleware.SetAudit(ctx, middleware.AuditInfo{Before: gin.H{"port": cfg.OpenVPNPort}})
+	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: gin.H{"port": port.Port}})
+
 	// 更新端口
 	if err := openvpn.UpdatePort(port.Port); err != nil {
 		common.InternalError(ctx, err.Error())
@@ -302,14 +319,24 @@ func getConfigItemI18n() map[string]ConfigItemI18n {
 				"en-US":   "VPN internal network subnet mask",
 			},
 		},
+		"openvpn_server_ipv6": {
+			Label: map[string]string{
+				"zh-Hans": "IPv6 网络",
+				"en-US":   "IPv6 Network",
+			},
+			Description: map[string]string{
+				"zh-Hans": "VPN 内部 IPv6 前缀（如 fd00:8::/64），留空则隧道只使用 IPv4",
+				"en-US":   "VPN internal IPv6 prefix (e.g. fd00:8::/64); leave empty for an IPv4-only tunnel",
+			},
+		},
 		"openvpn_client_to_client": {
 			Label: map[string]string{
 				"zh-Hans": "客户端互通",
 				"en-US":   "Client-to-Client",
 			},
 			Description: map[string]string{
-				"zh-Hans": "允许客户端之间直接通信",
-				"en-US":   "Allow direct communication between clients",
+				"zh-Hans": "默认是否允许客户端之间直接通信，部门可单独设置",
+				"en-US":   "Whether clients may reach each other by default; departments can override it",
 			},
 		},
 		"openvpn_routes": {
@@ -322,6 +349,16 @@ func getConfigItemI18n() map[string]ConfigItemI18n {
 				"en-US":   "Routes pushed to clients",
 			},
 		},
+		"openvpn_routes_ipv6": {
+			Label: map[string]string{
+				"zh-Hans": "IPv6 路由配置",
+				"en-US":   "IPv6 Route Configuration",
+			},
+			Description: map[string]string{
+				"zh-Hans": "推送给客户端的 IPv6 路由列表（CIDR）",
+				"en-US":   "IPv6 routes pushed to clients (CIDR)",
+			},
+		},
 		"dns_server_ip": {
 			Label: map[string]string{
 				"zh-Hans": "DNS服务器IP",
@@ -342,6 +379,36 @@ func getConfigItemI18n() map[string]ConfigItemI18n {
 				"en-US":   "DNS domain pushed to clients",
 			},
 		},
+		"openvpn_key_algorithm": {
+			Label: map[string]string{
+				"zh-Hans": "证书密钥算法",
+				"en-US":   "Certificate Key Algorithm",
+			},
+			Description: map[string]string{
+				"zh-Hans": "新签发客户端证书使用的密钥算法；ECDSA / Ed25519 时服务端使用 dh none + ecdh-curve",
+				"en-US":   "Key algorithm for newly issued client certificates; ECDSA / Ed25519 switch the server to dh none + ecdh-curve",
+			},
+		},
+		"openvpn_tls_mode": {
+			Label: map[string]string{
+				"zh-Hans": "控制通道保护",
+				"en-US":   "Control Channel Protection",
+			},
+			Description: map[string]string{
+				"zh-Hans": "tls-auth / tls-crypt 全体共享一把密钥；tls-crypt-v2 为每个用户生成独立密钥，删除用户时一并吊销。切换后用户需重新下载 .ovpn",
+				"en-US":   "tls-auth / tls-crypt share one key across all clients; tls-crypt-v2 issues a per-user key that is revoked when the user is deleted. Users must download a new .ovpn after switching",
+			},
+		},
+		"openvpn_auth_mode": {
+			Label: map[string]string{
+				"zh-Hans": "VPN 二次验证",
+				"en-US":   "VPN Second Factor",
+			},
+			Description: map[string]string{
+				"zh-Hans": "开启后，部门设置了「连接需动态口令」的成员连接 VPN 时需在密码框输入动态口令（otp）或「登录密码+动态口令」（password+otp）；其他用户不受影响",
+				"en-US":   "When enabled, members of departments that require a one-time code must enter the authenticator code (otp) or their login password followed by the code (password+otp) when connecting; other users are unaffected",
+			},
+		},
 		"openvpn_management_port": {
 			Label: map[string]string{
 				"zh-Hans": "管理端口",
@@ -417,6 +484,15 @@ func (c *ServerController) GetConfigItems(ctx *gin.Context) {
 			Required:    true,
 			Validation:  "netmask",
 		},
+		{
+			Key:         "openvpn_server_ipv6",
+			Value:       cfg.OpenVPNServerIPv6,
+			Type:        "text",
+			Label:       i18nData["openvpn_server_ipv6"].Label[lang],
+			Description: i18nData["openvpn_server_ipv6"].Description[lang],
+			Required:    false,
+			Validation:  "ipv6_cidr",
+		},
 		{
 			Key:         "openvpn_client_to_client",
 			Value:       cfg.OpenVPNClientToClient,
@@ -433,6 +509,14 @@ func (c *ServerController) GetConfigItems(ctx *gin.Context) {
 			Description: i18nData["openvpn_routes"].Description[lang],
 			Required:    false,
 		},
+		{
+			Key:         "openvpn_routes_ipv6",
+			Value:       cfg.OpenVPNRoutesIPv6,
+			Type:        "array",
+			Label:       i18nData["openvpn_routes_ipv6"].Label[lang],
+			Description: i18nData["openvpn_routes_ipv6"].Description[lang],
+			Required:    false,
+		},
 		{
 			Key:         "dns_server_ip",
 			Value:       cfg.DNSServerIP,
@@ -450,6 +534,33 @@ func (c *ServerController) GetConfigItems(ctx *gin.Context) {
 			Description: i18nData["dns_server_domain"].Description[lang],
 			Required:    false,
 		},
+		{
+			Key:         "openvpn_key_algorithm",
+			Value:       string(cfg.KeyAlgorithm()),
+			Type:        "select",
+			Label:       i18nData["openvpn_key_algorithm"].Label[lang],
+			Description: i18nData["openvpn_key_algorithm"].Description[lang],
+			Options:     keyAlgorithmOptions(),
+			Required:    true,
+		},
+		{
+			Key:         "openvpn_tls_mode",
+			Value:       string(cfg.TLSMode()),
+			Type:        "select",
+			Label:       i18nData["openvpn_tls_mode"].Label[lang],
+			Description: i18nData["openvpn_tls_mode"].Description[lang],
+			Options:     tlsModeOptions(),
+			Required:    true,
+		},
+		{
+			Key:         "openvpn_auth_mode",
+			Value:       string(cfg.VPNAuthMode()),
+			Type:        "select",
+			Label:       i18nData["openvpn_auth_mode"].Label[lang],
+			Description: i18nData["openvpn_auth_mode"].Description[lang],
+			Options:     vpnAuthModeOptions(),
+			Required:    true,
+		},
 		{
 			Key:         "openvpn_management_port",
 			Value:       cfg.OpenVPNManagementPort,
@@ -486,6 +597,7 @@ func (c *ServerController) UpdateConfigItem(ctx *gin.Context) {
 		common.InternalError(ctx, "加载配置失败: "+err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{TargetID: key, Before: cfg})
 
 	// 更新指定的配置项
 	if err := updateSingleConfigItem(cfg, key, request.Value); err != nil {
@@ -498,6 +610,7 @@ func (c *ServerController) UpdateConfigItem(ctx *gin.Context) {
 		common.InternalError(ctx, "保存配置失败: "+err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: cfg})
 
 	// 重新生成服务器配置
 	if err := openvpn.UpdateServerConfig(); err != nil {
@@ -524,6 +637,7 @@ func (c *ServerController) UpdateConfigItems(ctx *gin.Context) {
 		common.InternalError(ctx, "加载配置失败: "+err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{Before: cfg})
 
 	// 批量更新配置项
 	for key, value := range request.Items {
@@ -538,6 +652,7 @@ func (c *ServerController) UpdateConfigItems(ctx *gin.Context) {
 		common.InternalError(ctx, "保存配置失败: "+err.Error())
 		return
 	}
+	middleware.SetAudit(ctx, middleware.AuditInfo{After: cfg})
 
 	// 重新生成服务器配置
 	if err := openvpn.UpdateServerConfig(); err != nil {
@@ -548,6 +663,33 @@ func (c *ServerController) UpdateConfigItems(ctx *gin.Context) {
 	common.OKMsg(ctx, "配置项批量更新成功")
 }
 
+// keyAlgorithmOptions 证书密钥算法的可选值
+func keyAlgorithmOptions() []string {
+	options := make([]string, 0, len(pki.KeyAlgorithms))
+	for _, alg := range pki.KeyAlgorithms {
+		options = append(options, string(alg))
+	}
+	return options
+}
+
+// tlsModeOptions 控制通道保护方式的可选值
+func tlsModeOptions() []string {
+	options := make([]string, 0, len(openvpn.TLSModes))
+	for _, m := range openvpn.TLSModes {
+		options = append(options, string(m))
+	}
+	return options
+}
+
+// vpnAuthModeOptions VPN 二次验证方式的可选值
+func vpnAuthModeOptions() []string {
+	options := make([]string, 0, len(openvpn.VPNAuthModes))
+	for _, m := range openvpn.VPNAuthModes {
+		options = append(options, string(m))
+	}
+	return options
+}
+
 // updateSingleConfigItem 更新单个配置项的辅助函数
 func updateSingleConfigItem(cfg *openvpn.Config, key string, value interface{}) error {
 	switch key {
@@ -601,6 +743,18 @@ func updateSingleConfigItem(cfg *openvpn.Config, key string, value interface{})
 		} else {
 			return fmt.Errorf("子网掩码必须是字符串")
 		}
+	case "openvpn_server_ipv6":
+		prefix, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("IPv6 网络必须是字符串")
+		}
+		prefix = strings.TrimSpace(prefix)
+		if prefix != "" {
+			if err := openvpn.ValidateServerIPv6(prefix); err != nil {
+				return fmt.Errorf("IPv6 网络无效: %v", err)
+			}
+		}
+		cfg.OpenVPNServerIPv6 = prefix
 	case "openvpn_client_to_client":
 		if clientToClient, ok := value.(bool); ok {
 			cfg.OpenVPNClientToClient = clientToClient
@@ -621,6 +775,22 @@ func updateSingleConfigItem(cfg *openvpn.Config, key string, value interface{})
 		} else {
 			return fmt.Errorf("路由配置必须是数组")
 		}
+	case "openvpn_routes_ipv6":
+		routes, ok := value.([]interface{})
+		if !ok {
+			return fmt.Errorf("IPv6 路由配置必须是数组")
+		}
+		cfg.OpenVPNRoutesIPv6 = make([]string, 0, len(routes))
+		for _, route := range routes {
+			routeStr, ok := route.(string)
+			if !ok {
+				return fmt.Errorf("IPv6 路由配置必须是字符串数组")
+			}
+			if _, ipNet, err := net.ParseCIDR(routeStr); err != nil || ipNet.IP.To4() != nil {
+				return fmt.Errorf("IPv6 路由无效: %s", routeStr)
+			}
+			cfg.OpenVPNRoutesIPv6 = append(cfg.OpenVPNRoutesIPv6, routeStr)
+		}
 	case "dns_server_ip":
 		if dnsIP, ok := value.(string); ok {
 			cfg.DNSServerIP = dnsIP
@@ -639,6 +809,36 @@ func updateSingleConfigItem(cfg *openvpn.Config, key string, value interface{})
 		} else {
 			return fmt.Errorf("管理端口必须是数字")
 		}
+	case "openvpn_key_algorithm":
+		algStr, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("证书密钥算法必须是字符串")
+		}
+		alg, err := pki.ParseKeyAlgorithm(algStr)
+		if err != nil {
+			return fmt.Errorf("证书密钥算法无效，必须是: %s", strings.Join(keyAlgorithmOptions(), ", "))
+		}
+		cfg.OpenVPNKeyAlgorithm = string(alg)
+	case "openvpn_tls_mode":
+		modeStr, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("控制通道保护方式必须是字符串")
+		}
+		mode, err := openvpn.ParseTLSMode(modeStr)
+		if err != nil {
+			return fmt.Errorf("控制通道保护方式无效，必须是: %s", strings.Join(tlsModeOptions(), ", "))
+		}
+		cfg.OpenVPNTLSMode = string(mode)
+	case "openvpn_auth_mode":
+		modeStr, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("VPN 二次验证方式必须是字符串")
+		}
+		mode, err := openvpn.ParseVPNAuthMode(modeStr)
+		if err != nil {
+			return fmt.Errorf("VPN 二次验证方式无效，必须是: %s", strings.Join(vpnAuthModeOptions(), ", "))
+		}
+		cfg.OpenVPNAuthMode = string(mode)
 	default:
 		return fmt.Errorf("未知的配置项: %s", key)
 	}
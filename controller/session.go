@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"strconv"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+const sessionDateLayout = "2006-01-02"
+
+// ListSessions 分页查询用户的 VPN 会话历史（client_logs），按开始时间倒序。
+// from/to 支持 RFC3339 或 YYYY-MM-DD（to 为日期时包含当天），返回与该时间段有重叠的会话，
+// 即“这段时间内谁在线”。可见范围见 viewsUser；用户已删除时有 user.read 的 superadmin/admin 仍可按 ID 查询。
+func (c *ClientController) ListSessions(ctx *gin.Context) {
+	claims := ctx.MustGet("claims").(*middleware.Claims)
+	id := ctx.Param("id")
+	isAdmin := !departmentScoped(claims) && middleware.HasPermission(claims, model.PermUserRead)
+
+	var u model.User
+	if err := database.DB.First(&u, "id = ?", id).Error; err != nil {
+		if !isAdmin {
+			common.NotFound(ctx, "user not found")
+			return
+		}
+	} else {
+		if !viewsUser(claims, &u) {
+			common.Forbidden(ctx, "you can only view yourself or users of own department (and sub-departments)")
+			return
+		}
+	}
+
+	offset, err := strconv.Atoi(ctx.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		common.BadRequest(ctx, "invalid offset parameter")
+		return
+	}
+	limit, err := strconv.Atoi(ctx.DefaultQuery("limit", "50"))
+	if err != nil || limit <= 0 || limit > 500 {
+		common.BadRequest(ctx, "invalid limit parameter")
+		return
+	}
+
+	db := database.DB.Model(&model.ClientLog{}).Where("user_id = ?", id)
+	if v := ctx.Query("from"); v != "" {
+		from, ok := parseSessionTime(v, false)
+		if !ok {
+			common.BadRequest(ctx, "invalid from parameter")
+			return
+		}
+		db = db.Where("(ended_at IS NULL OR ended_at >= ?)", from)
+	}
+	if v := ctx.Query("to"); v != "" {
+		to, ok := parseSessionTime(v, true)
+		if !ok {
+			common.BadRequest(ctx, "invalid to parameter")
+			return
+		}
+		db = db.Where("started_at <= ?", to)
+	}
+
+	var total int64
+	if err := db.Count(&total).Error; err != nil {
+		common.InternalError(ctx, "Failed to count sessions: "+err.Error())
+		return
+	}
+	var logs []model.ClientLog
+	if err := db.Order("started_at DESC").Offset(offset).Limit(limit).Find(&logs).Error; err != nil {
+		common.InternalError(ctx, "Failed to list sessions: "+err.Error())
+		return
+	}
+
+	sessions := make([]gin.H, 0, len(logs))
+	for _, l := range logs {
+		sessions = append(sessions, gin.H{
+			"id":             l.ID,
+			"userId":         l.UserID,
+			"userName":       l.UserName,
+			"isOnline":       l.IsOnline,
+			"startedAt":      l.StartedAt,
+			"endedAt":        l.EndedAt,
+			"realAddress":    l.RealAddress,
+			"virtualAddress": l.VirtualAddress,
+			"bytesReceived":  l.BytesReceived,
+			"bytesSent":      l.BytesSent,
+			"cipher":         l.Cipher,
+			"onlineDuration": l.OnlineDuration,
+			"lastSeen":       l.LastConnectionTime,
+		})
+	}
+	common.OK(ctx, gin.H{
+		"sessions": sessions,
+		"total":    total,
+		"offset":   offset,
+		"limit":    limit,
+		"hasMore":  int64(offset+len(logs)) < total,
+	})
+}
+
+// parseSessionTime 解析 RFC3339 或 YYYY-MM-DD；endOfDay 为 true 时日期取当天结束。
+func parseSessionTime(v string, endOfDay bool) (time.Time, bool) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, true
+	}
+	t, err := time.ParseInLocation(sessionDateLayout, v, time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	}
+	return t, true
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"path"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/database"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/services"
+	"openvpn-admin-go/sso"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSSOConfig 登录页是否显示单点登录按钮
+func GetSSOConfig(c *gin.Context) {
+	cfg := sso.Current()
+	if cfg == nil {
+		common.OK(c, gin.H{"enabled": false})
+		return
+	}
+	common.OK(c, gin.H{"enabled": true, "displayName": cfg.DisplayName})
+}
+
+// ssoStateCookie 保存发起登录的浏览器的 state，回调时与提交的 state 核对，
+// 防止把别人发起的登录（攻击者的授权码）塞进受害者的浏览器（登录 CSRF）
+const ssoStateCookie = "oidc_state"
+
+// ssoCookiePath 限定 state cookie 只发给 /oidc 下的接口（login 与 callback）
+func ssoCookiePath(c *gin.Context) string {
+	return path.Dir(c.Request.URL.Path)
+}
+
+// SSOLogin 跳转到身份提供方（授权码 + PKCE）
+func SSOLogin(c *gin.Context) {
+	if !sso.Enabled() {
+		common.NotFound(c, "single sign-on is not configured")
+		return
+	}
+	p, err := sso.Default(c.Request.Context())
+	if err != nil {
+		logging.Error("OIDC 身份提供方不可用: %v", err)
+		common.InternalError(c, "identity provider unavailable")
+		return
+	}
+	authURL, state, err := p.AuthCodeURL()
+	if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, state, int(sso.AuthRequestTTL.Seconds()), ssoCookiePath(c), "", c.Request.TLS != nil, true)
+	c.Redirect(http.StatusFound, authURL)
+}
+
+type ssoCallbackRequest struct {
+	Code  string `json:"code" binding:"required"`
+	State string `json:"state" binding:"required"`
+}
+
+// SSOCallback 前端回调页提交授权码与 state；之后与密码登录相同（审批门控、两步验证、签发 JWT）
+func SSOCallback(c *gin.Context) {
+	var req ssoCallbackRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		common.BadRequest(c, err.Error())
+		return
+	}
+	if !sso.Enabled() {
+		common.NotFound(c, "single sign-on is not configured")
+		return
+	}
+	// state 只能由发起登录的同一个浏览器提交，用过即清除
+	cookieState, _ := c.Cookie(ssoStateCookie)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(ssoStateCookie, "", -1, ssoCookiePath(c), "", c.Request.TLS != nil, true)
+	if cookieState == "" || subtle.ConstantTimeCompare([]byte(cookieState), []byte(req.State)) != 1 {
+		common.Unauthorized(c, "single sign-on failed: login was not started in this browser")
+		return
+	}
+	p, err := sso.Default(c.Request.Context())
+	if err != nil {
+		logging.Error("OIDC 身份提供方不可用: %v", err)
+		common.InternalError(c, "identity provider unavailable")
+		return
+	}
+	id, err := p.Exchange(c.Request.Context(), req.State, req.Code)
+	switch {
+	case errors.Is(err, sso.ErrEmailNotVerified), errors.Is(err, sso.ErrGroupNotAllowed):
+		common.Forbidden(c, err.Error())
+		return
+	case err != nil:
+		logging.Warn("OIDC 登录失败: %v", err)
+		common.Unauthorized(c, "single sign-on failed")
+		return
+	}
+	user, err := services.ResolveSSOUser(database.DB, p.Config(), id)
+	if errors.Is(err, services.ErrSSONoAccount) || errors.Is(err, services.ErrSSOLinkRefused) {
+		common.Forbidden(c, err.Error())
+		return
+	} else if err != nil {
+		common.InternalError(c, err.Error())
+		return
+	}
+	completeLogin(c, user)
+}
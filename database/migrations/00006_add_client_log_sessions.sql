@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS user_name       VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS virtual_address VARCHAR(45)  NOT NULL DEFAULT '';
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS bytes_received  BIGINT       NOT NULL DEFAULT 0;
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS bytes_sent      BIGINT       NOT NULL DEFAULT 0;
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS cipher          VARCHAR(64)  NOT NULL DEFAULT '';
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS started_at      TIMESTAMPTZ;
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS ended_at        TIMESTAMPTZ;
+ALTER TABLE client_logs ADD COLUMN IF NOT EXISTS client_id       VARCHAR(20)  NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_client_logs_user_started ON client_logs(user_id, started_at DESC);
+-- duplicate-cn 下同一用户可有多个会话同时在线，未结束的会话按 OpenVPN 的 CID + 连接时间区分
+CREATE INDEX IF NOT EXISTS idx_client_logs_open ON client_logs(user_name, client_id) WHERE ended_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_client_logs_open;
+DROP INDEX IF EXISTS idx_client_logs_user_started;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS client_id;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS ended_at;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS started_at;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS cipher;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS bytes_sent;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS bytes_received;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS virtual_address;
+ALTER TABLE client_logs DROP COLUMN IF EXISTS user_name;
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS daily_quota_bytes   BIGINT  NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS monthly_quota_bytes BIGINT  NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS quota_paused        BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS daily_quota_bytes   BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS monthly_quota_bytes BIGINT NOT NULL DEFAULT 0;
+
+ALTER TABLE notifications ADD COLUMN IF NOT EXISTS detail VARCHAR(255) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS traffic_usages (
+    id      VARCHAR(36) PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    day     VARCHAR(10) NOT NULL,
+    bytes   BIGINT      NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_traffic_usages_user_day ON traffic_usages(user_id, day);
+CREATE INDEX IF NOT EXISTS idx_traffic_usages_day ON traffic_usages(day);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS traffic_usages;
+ALTER TABLE notifications DROP COLUMN IF EXISTS detail;
+ALTER TABLE departments DROP COLUMN IF EXISTS monthly_quota_bytes;
+ALTER TABLE departments DROP COLUMN IF EXISTS daily_quota_bytes;
+ALTER TABLE users DROP COLUMN IF EXISTS quota_paused;
+ALTER TABLE users DROP COLUMN IF EXISTS monthly_quota_bytes;
+ALTER TABLE users DROP COLUMN IF EXISTS daily_quota_bytes;
+-- +goose StatementEnd
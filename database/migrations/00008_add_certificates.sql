@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS certificates (
+    id                 VARCHAR(36)  PRIMARY KEY,
+    user_id            VARCHAR(36),
+    user_name          VARCHAR(100) NOT NULL,
+    serial             VARCHAR(64)  NOT NULL,
+    not_before         TIMESTAMPTZ  NOT NULL,
+    not_after          TIMESTAMPTZ  NOT NULL,
+    status             VARCHAR(20)  NOT NULL DEFAULT 'valid',
+    revoked_at         TIMESTAMPTZ,
+    expiry_notified_at TIMESTAMPTZ,
+    created_at         TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_certificates_serial ON certificates(serial);
+CREATE INDEX IF NOT EXISTS idx_certificates_user_id ON certificates(user_id);
+CREATE INDEX IF NOT EXISTS idx_certificates_user_name ON certificates(user_name);
+CREATE INDEX IF NOT EXISTS idx_certificates_not_after ON certificates(not_after);
+
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS cert_validity_days INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE departments DROP COLUMN IF EXISTS cert_validity_days;
+DROP TABLE IF EXISTS certificates;
+-- +goose StatementEnd
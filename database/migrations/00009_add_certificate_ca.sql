@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS ca_id VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS last_seen_at TIMESTAMPTZ;
+CREATE INDEX IF NOT EXISTS idx_certificates_ca_id ON certificates(ca_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_certificates_ca_id;
+ALTER TABLE certificates DROP COLUMN IF EXISTS last_seen_at;
+ALTER TABLE certificates DROP COLUMN IF EXISTS ca_id;
+-- +goose StatementEnd
@@ -0,0 +1,11 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS csr_only BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE certificates ADD COLUMN IF NOT EXISTS from_csr BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE certificates DROP COLUMN IF EXISTS from_csr;
+ALTER TABLE departments DROP COLUMN IF EXISTS csr_only;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_enabled        BOOLEAN     NOT NULL DEFAULT FALSE;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_secret         VARCHAR(64) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_recovery_codes TEXT        NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS mfa_last_step      BIGINT      NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_last_step;
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_recovery_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_secret;
+ALTER TABLE users DROP COLUMN IF EXISTS mfa_enabled;
+-- +goose StatementEnd
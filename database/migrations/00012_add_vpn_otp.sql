@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS vpn_otp_required BOOLEAN NOT NULL DEFAULT false;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE departments DROP COLUMN IF EXISTS vpn_otp_required;
+-- +goose StatementEnd
@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS auth_source VARCHAR(20) NOT NULL DEFAULT 'local';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS external_id VARCHAR(255) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS directory_paused BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE INDEX IF NOT EXISTS idx_users_auth_source ON users(auth_source);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_auth_source;
+ALTER TABLE users DROP COLUMN IF EXISTS directory_paused;
+ALTER TABLE users DROP COLUMN IF EXISTS external_id;
+ALTER TABLE users DROP COLUMN IF EXISTS auth_source;
+-- +goose StatementEnd
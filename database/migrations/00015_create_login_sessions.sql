@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS login_sessions (
+    id                VARCHAR(36)  PRIMARY KEY,
+    user_id           VARCHAR(36)  NOT NULL,
+    refresh_hash      VARCHAR(64)  NOT NULL,
+    prev_refresh_hash VARCHAR(64)  NOT NULL DEFAULT '',
+    user_agent        VARCHAR(255),
+    ip                VARCHAR(45),
+    created_at        TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    last_used_at      TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    expires_at        TIMESTAMPTZ  NOT NULL,
+    revoked_at        TIMESTAMPTZ,
+    revoke_reason     VARCHAR(50)
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_login_sessions_refresh_hash ON login_sessions(refresh_hash);
+CREATE INDEX IF NOT EXISTS idx_login_sessions_user_id ON login_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_login_sessions_expires_at ON login_sessions(expires_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS login_sessions;
+-- +goose StatementEnd
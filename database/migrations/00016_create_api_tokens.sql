@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS api_tokens (
+    id           VARCHAR(36)  PRIMARY KEY,
+    user_id      VARCHAR(36)  NOT NULL,
+    name         VARCHAR(100) NOT NULL,
+    prefix       VARCHAR(16)  NOT NULL,
+    token_hash   VARCHAR(64)  NOT NULL,
+    scopes       VARCHAR(255) NOT NULL,
+    expires_at   TIMESTAMPTZ  NOT NULL,
+    last_used_at TIMESTAMPTZ,
+    last_used_ip VARCHAR(45),
+    created_at   TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_api_tokens_token_hash ON api_tokens(token_hash);
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_tokens;
+-- +goose StatementEnd
@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role       VARCHAR(20) NOT NULL,
+    permission VARCHAR(64) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (role, permission)
+);
+
+-- 已按默认值授予过的权限（新增权限在首次启动时授予一次）
+CREATE TABLE IF NOT EXISTS registered_permissions (
+    key        VARCHAR(64) PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS registered_permissions;
+DROP TABLE IF EXISTS role_permissions;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN IF NOT EXISTS failed_login_count INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS last_failed_login_at TIMESTAMPTZ;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS locked_until TIMESTAMPTZ;
+
+-- RATE_LIMIT_BACKEND=database 时的限流计数，多副本共享且重启不丢失
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key      VARCHAR(255) PRIMARY KEY,
+    count    INTEGER      NOT NULL,
+    reset_at TIMESTAMPTZ  NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_rate_limit_buckets_reset_at ON rate_limit_buckets(reset_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS rate_limit_buckets;
+ALTER TABLE users DROP COLUMN IF EXISTS locked_until;
+ALTER TABLE users DROP COLUMN IF EXISTS last_failed_login_at;
+ALTER TABLE users DROP COLUMN IF EXISTS failed_login_count;
+-- +goose StatementEnd
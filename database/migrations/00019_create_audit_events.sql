@@ -0,0 +1,33 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS audit_events (
+    id            VARCHAR(36)  PRIMARY KEY,
+    created_at    TIMESTAMPTZ  NOT NULL DEFAULT NOW(),
+    actor_id      VARCHAR(36)  NOT NULL DEFAULT '',
+    actor_name    VARCHAR(100) NOT NULL DEFAULT '',
+    actor_role    VARCHAR(20)  NOT NULL DEFAULT '',
+    via_api_token BOOLEAN      NOT NULL DEFAULT FALSE,
+    action        VARCHAR(100) NOT NULL,
+    target_type   VARCHAR(50)  NOT NULL DEFAULT '',
+    target_id     VARCHAR(100) NOT NULL DEFAULT '',
+    target_name   VARCHAR(255) NOT NULL DEFAULT '',
+    changes       TEXT         NOT NULL DEFAULT '',
+    source_ip     VARCHAR(45)  NOT NULL DEFAULT '',
+    method        VARCHAR(10)  NOT NULL DEFAULT '',
+    path          VARCHAR(255) NOT NULL DEFAULT '',
+    status        INTEGER      NOT NULL DEFAULT 0,
+    result        VARCHAR(10)  NOT NULL,
+    error         VARCHAR(500) NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_action ON audit_events(action);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_result ON audit_events(result);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS audit_events;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 用户专属的 CCD 推送设置（路由、DNS 等），固定 IP 与子网仍在 users 表
+CREATE TABLE IF NOT EXISTS client_ccds (
+    user_id          VARCHAR(36)  PRIMARY KEY,
+    push_reset       BOOLEAN      NOT NULL DEFAULT FALSE,
+    routes           TEXT         NOT NULL DEFAULT '',
+    dns_servers      TEXT         NOT NULL DEFAULT '',
+    search_domains   TEXT         NOT NULL DEFAULT '',
+    redirect_gateway VARCHAR(100) NOT NULL DEFAULT '',
+    directives       TEXT         NOT NULL DEFAULT '',
+    updated_at       TIMESTAMPTZ  NOT NULL DEFAULT NOW()
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS client_ccds;
+-- +goose StatementEnd
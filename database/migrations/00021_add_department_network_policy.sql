@@ -0,0 +1,20 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 部门网络策略：成员 CCD 默认推送的路由与 DNS（每行一项）、固定 IP 范围、客户端互访
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS routes           TEXT        NOT NULL DEFAULT '';
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS dns_servers      TEXT        NOT NULL DEFAULT '';
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS search_domains   TEXT        NOT NULL DEFAULT '';
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS ip_pool_start    VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS ip_pool_end      VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE departments ADD COLUMN IF NOT EXISTS client_to_client BOOLEAN;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE departments DROP COLUMN IF EXISTS client_to_client;
+ALTER TABLE departments DROP COLUMN IF EXISTS ip_pool_end;
+ALTER TABLE departments DROP COLUMN IF EXISTS ip_pool_start;
+ALTER TABLE departments DROP COLUMN IF EXISTS search_domains;
+ALTER TABLE departments DROP COLUMN IF EXISTS dns_servers;
+ALTER TABLE departments DROP COLUMN IF EXISTS routes;
+-- +goose StatementEnd
@@ -0,0 +1,12 @@
+-- +goose Up
+-- +goose StatementBegin
+-- IPv6 隧道地址：固定分配的地址（ifconfig-ipv6-push）与在线时的虚拟地址
+ALTER TABLE users ADD COLUMN IF NOT EXISTS fixed_ipv6           VARCHAR(45) NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS virtual_ipv6_address VARCHAR(45) NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users DROP COLUMN IF EXISTS virtual_ipv6_address;
+ALTER TABLE users DROP COLUMN IF EXISTS fixed_ipv6;
+-- +goose StatementEnd
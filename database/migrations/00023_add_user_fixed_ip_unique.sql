@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- 固定地址在数据库层唯一：LockIPAM 只在单个进程内串行化，多实例并发分配时由唯一索引兜底。
+-- 已有重复的固定地址时迁移失败，需先在 IPAM 冲突列表中处理
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_fixed_ip ON users(fixed_ip) WHERE fixed_ip <> '';
+CREATE UNIQUE INDEX IF NOT EXISTS idx_users_fixed_ipv6 ON users(fixed_ipv6) WHERE fixed_ipv6 <> '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_fixed_ipv6;
+DROP INDEX IF EXISTS idx_users_fixed_ip;
+-- +goose StatementEnd
@@ -0,0 +1,152 @@
+// Package directory 连接 LDAP / Active Directory：校验目录用户的密码，列出映射组的成员。
+//
+// 配置文件默认为 config/ldap.json（LDAP_CONFIG 可覆盖），文件不存在即不启用。
+package directory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/utils"
+)
+
+// DefaultConfigPath 默认配置文件路径（相对工作目录）
+const DefaultConfigPath = "config/ldap.json"
+
+// 成员从目录中移除（或不再属于任何映射组）后的处理方式
+const (
+	// RemovedPause 暂停 VPN 访问，保留账号与证书（重新加入映射组后自动恢复）
+	RemovedPause = "pause"
+	// RemovedRevoke 吊销证书并删除账号
+	RemovedRevoke = "revoke"
+)
+
+// GroupMapping 目录组 → 部门与角色。成员属于多个映射组时，列表中靠前的映射优先。
+type GroupMapping struct {
+	GroupDN    string `json:"group_dn"`
+	Department string `json:"department"` // 部门名称，不存在时同步自动创建
+	Role       string `json:"role"`       // user / manager / admin（不允许经目录授予 superadmin）
+}
+
+// Config LDAP 连接与同步参数
+type Config struct {
+	URL                string `json:"url"` // ldap://host:389 或 ldaps://host:636
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	BindDN             string `json:"bind_dn"`
+	BindPassword       string `json:"bind_password"` // 为空时读取 LDAP_BIND_PASSWORD
+	BaseDN             string `json:"base_dn"`
+	// UserFilter 限定用户对象，与其他条件取 AND
+	UserFilter string `json:"user_filter"`
+	// LoginAttribute 登录时用户输入（邮箱）对应的属性
+	LoginAttribute    string `json:"login_attribute"`
+	UsernameAttribute string `json:"username_attribute"`
+	EmailAttribute    string `json:"email_attribute"`
+	// NestedGroups 使用 AD 的 LDAP_MATCHING_RULE_IN_CHAIN 解析嵌套组（仅 Active Directory 支持）
+	NestedGroups        bool           `json:"nested_groups"`
+	SyncIntervalMinutes int            `json:"sync_interval_minutes"`
+	RemovedAction       string         `json:"removed_action"`
+	GroupMappings       []GroupMapping `json:"group_mappings"`
+	TimeoutSeconds      int            `json:"timeout_seconds"`
+}
+
+// LoadConfig 读取配置并补全默认值；文件不存在时返回 nil, nil（不启用）
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *Config) applyDefaults() {
+	if c.BindPassword == "" {
+		c.BindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+	}
+	if c.UserFilter == "" {
+		c.UserFilter = "(objectClass=person)"
+	}
+	if c.LoginAttribute == "" {
+		c.LoginAttribute = "mail"
+	}
+	if c.UsernameAttribute == "" {
+		c.UsernameAttribute = "sAMAccountName"
+	}
+	if c.EmailAttribute == "" {
+		c.EmailAttribute = "mail"
+	}
+	if c.SyncIntervalMinutes <= 0 {
+		c.SyncIntervalMinutes = 15
+	}
+	if c.RemovedAction == "" {
+		c.RemovedAction = RemovedPause
+	}
+	if c.TimeoutSeconds <= 0 {
+		c.TimeoutSeconds = 10
+	}
+}
+
+// Validate 检查必填项与取值
+func (c *Config) Validate() error {
+	if c.URL == "" || c.BaseDN == "" {
+		return fmt.Errorf("url and base_dn are required")
+	}
+	if c.RemovedAction != RemovedPause && c.RemovedAction != RemovedRevoke {
+		return fmt.Errorf("removed_action must be %q or %q", RemovedPause, RemovedRevoke)
+	}
+	if len(c.GroupMappings) == 0 {
+		return fmt.Errorf("at least one group mapping is required")
+	}
+	for i, m := range c.GroupMappings {
+		if m.GroupDN == "" || m.Department == "" {
+			return fmt.Errorf("group_mappings[%d]: group_dn and department are required", i)
+		}
+		switch strings.ToLower(m.Role) {
+		case "", "user", "manager", "admin":
+		default:
+			return fmt.Errorf("group_mappings[%d]: role must be user, manager or admin", i)
+		}
+	}
+	return nil
+}
+
+// SyncInterval 同步周期
+func (c *Config) SyncInterval() time.Duration {
+	return time.Duration(c.SyncIntervalMinutes) * time.Minute
+}
+
+// current 启用的配置；nil 表示未配置 LDAP
+var current *Config
+
+// Init 加载配置文件（LDAP_CONFIG，默认 config/ldap.json）
+func Init() error {
+	cfg, err := LoadConfig(utils.GetEnvOrDefault("LDAP_CONFIG", DefaultConfigPath))
+	if err != nil {
+		return err
+	}
+	current = cfg
+	return nil
+}
+
+// Current 当前配置；未启用时返回 nil
+func Current() *Config {
+	return current
+}
+
+// Enabled 是否启用了 LDAP
+func Enabled() bool {
+	return current != nil
+}
@@ -0,0 +1,197 @@
+package directory
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+// ErrInvalidCredentials 目录中没有该用户，或密码错误
+var ErrInvalidCredentials = errors.New("invalid directory credentials")
+
+// adAccountDisable userAccountControl 中的 ACCOUNTDISABLE 位
+const adAccountDisable = 0x2
+
+// adMatchingRuleInChain AD 递归解析组成员的匹配规则
+const adMatchingRuleInChain = "1.2.840.113556.1.4.1941"
+
+// Entry 目录中的一个用户
+type Entry struct {
+	DN       string
+	Username string
+	Email    string
+	// Disabled AD 账号已停用（userAccountControl 含 ACCOUNTDISABLE）
+	Disabled bool
+}
+
+// Member 映射组的成员及其生效的映射（属于多个组时取最靠前的映射）
+type Member struct {
+	Entry
+	Mapping GroupMapping
+}
+
+// Client 目录连接参数；每次操作建立一个短连接
+type Client struct {
+	cfg *Config
+}
+
+// NewClient 创建目录客户端
+func NewClient(cfg *Config) *Client {
+	return &Client{cfg: cfg}
+}
+
+// dial 连接目录（按需 StartTLS），不绑定
+func (c *Client) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(c.cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP url: %v", err)
+	}
+	timeout := time.Duration(c.cfg.TimeoutSeconds) * time.Second
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: c.cfg.InsecureSkipVerify}
+	conn, err := ldap.DialURL(c.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: timeout}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("connect LDAP: %v", err)
+	}
+	conn.SetTimeout(timeout)
+	if c.cfg.StartTLS && u.Scheme != "ldaps" {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// serviceConn 以服务账号绑定的连接（未配置 bind_dn 时匿名）
+func (c *Client) serviceConn() (*ldap.Conn, error) {
+	conn, err := c.dial()
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.BindDN != "" {
+		if err := conn.Bind(c.cfg.BindDN, c.cfg.BindPassword); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP service bind: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+func (c *Client) attributes() []string {
+	return []string{c.cfg.UsernameAttribute, c.cfg.EmailAttribute, "userAccountControl"}
+}
+
+// memberFilter 属于 groupDN 的用户
+func (c *Client) memberFilter(groupDN string) string {
+	attr := "memberOf"
+	if c.cfg.NestedGroups {
+		attr += ":" + adMatchingRuleInChain + ":"
+	}
+	return fmt.Sprintf("(&%s(%s=%s))", c.cfg.UserFilter, attr, ldap.EscapeFilter(groupDN))
+}
+
+func (c *Client) search(conn *ldap.Conn, base string, scope int, filter string) ([]*ldap.Entry, error) {
+	req := ldap.NewSearchRequest(base, scope, ldap.NeverDerefAliases, 0, c.cfg.TimeoutSeconds, false,
+		filter, c.attributes(), nil)
+	res, err := conn.SearchWithPaging(req, 500)
+	if err != nil {
+		return nil, err
+	}
+	return res.Entries, nil
+}
+
+func (c *Client) toEntry(e *ldap.Entry) Entry {
+	entry := Entry{
+		DN:       e.DN,
+		Username: e.GetEqualFoldAttributeValue(c.cfg.UsernameAttribute),
+		Email:    e.GetEqualFoldAttributeValue(c.cfg.EmailAttribute),
+	}
+	if uac, err := strconv.ParseInt(e.GetEqualFoldAttributeValue("userAccountControl"), 10, 64); err == nil {
+		entry.Disabled = uac&adAccountDisable != 0
+	}
+	return entry
+}
+
+// Authenticate 按登录属性找到用户并以其 DN 绑定校验密码，返回用户所在的第一个映射组。
+// 不属于任何映射组的用户返回 ErrInvalidCredentials（目录用户只有在映射组里才能使用 VPN）。
+func (c *Client) Authenticate(login, password string) (*Member, error) {
+	if login == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+	conn, err := c.serviceConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	filter := fmt.Sprintf("(&%s(%s=%s))", c.cfg.UserFilter, c.cfg.LoginAttribute, ldap.EscapeFilter(login))
+	entries, err := c.search(conn, c.cfg.BaseDN, ldap.ScopeWholeSubtree, filter)
+	if err != nil {
+		return nil, fmt.Errorf("LDAP search: %v", err)
+	}
+	if len(entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+	entry := c.toEntry(entries[0])
+
+	// 先确定映射（仍是服务账号身份），再用用户的 DN 与密码重新绑定
+	var mapping *GroupMapping
+	for i := range c.cfg.GroupMappings {
+		m := c.cfg.GroupMappings[i]
+		found, err := c.search(conn, entry.DN, ldap.ScopeBaseObject, c.memberFilter(m.GroupDN))
+		if err != nil {
+			return nil, fmt.Errorf("LDAP search: %v", err)
+		}
+		if len(found) > 0 {
+			mapping = &m
+			break
+		}
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("LDAP bind: %v", err)
+	}
+	if mapping == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Member{Entry: entry, Mapping: *mapping}, nil
+}
+
+// Members 列出全部映射组的成员（按 DN 去重，靠前的映射优先）。
+// 任一组查询失败都返回错误：调用方据此放弃本轮同步，避免把查询失败当成「成员被移除」。
+func (c *Client) Members() ([]Member, error) {
+	conn, err := c.serviceConn()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	seen := make(map[string]bool)
+	var members []Member
+	for _, m := range c.cfg.GroupMappings {
+		entries, err := c.search(conn, c.cfg.BaseDN, ldap.ScopeWholeSubtree, c.memberFilter(m.GroupDN))
+		if err != nil {
+			return nil, fmt.Errorf("LDAP search members of %s: %v", m.GroupDN, err)
+		}
+		for _, e := range entries {
+			key := strings.ToLower(e.DN)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			members = append(members, Member{Entry: c.toEntry(e), Mapping: m})
+		}
+	}
+	return members, nil
+}
@@ -0,0 +1,281 @@
+package directory
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// testServer 进程内的最小 LDAP 服务器：支持简单绑定与搜索（and/or/not/等值/存在/扩展匹配过滤器）
+type testServer struct {
+	entries   map[string]map[string][]string // DN → 属性（属性名小写）
+	passwords map[string]string              // DN → 密码
+}
+
+func (s *testServer) start(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return "ldap://" + ln.Addr().String()
+}
+
+func (s *testServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		req, err := ber.ReadPacket(conn)
+		if err != nil || len(req.Children) < 2 {
+			return
+		}
+		id := req.Children[0].Value.(int64)
+		op := req.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			dn := ber.DecodeString(op.Children[1].Data.Bytes())
+			password := ber.DecodeString(op.Children[2].Data.Bytes())
+			code := ldap.LDAPResultSuccess
+			if want, ok := s.passwords[strings.ToLower(dn)]; !ok || want != password {
+				code = ldap.LDAPResultInvalidCredentials
+			}
+			conn.Write(envelope(id, result(ldap.ApplicationBindResponse, code)).Bytes())
+		case ldap.ApplicationUnbindRequest:
+			return
+		case ldap.ApplicationSearchRequest:
+			base := strings.ToLower(ber.DecodeString(op.Children[0].Data.Bytes()))
+			scope := op.Children[1].Value.(int64)
+			filter := op.Children[6]
+			for dn, attrs := range s.entries {
+				inScope := dn == base || (scope == ldap.ScopeWholeSubtree && strings.HasSuffix(dn, ","+base))
+				if !inScope || !match(filter, dn, attrs) {
+					continue
+				}
+				conn.Write(envelope(id, searchEntry(dn, attrs)).Bytes())
+			}
+			conn.Write(envelope(id, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess)).Bytes())
+		default:
+			return
+		}
+	}
+}
+
+func envelope(id int64, op *ber.Packet) *ber.Packet {
+	p := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	p.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "MessageID"))
+	p.AppendChild(op)
+	return p
+}
+
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func searchEntry(dn string, attrs map[string][]string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, vals := range attrs {
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range vals {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "val"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	return op
+}
+
+func hasValue(attrs map[string][]string, name, value string) bool {
+	for _, v := range attrs[strings.ToLower(name)] {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func match(f *ber.Packet, dn string, attrs map[string][]string) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !match(c, dn, attrs) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if match(c, dn, attrs) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return !match(f.Children[0], dn, attrs)
+	case ldap.FilterEqualityMatch:
+		return hasValue(attrs, ber.DecodeString(f.Children[0].Data.Bytes()), ber.DecodeString(f.Children[1].Data.Bytes()))
+	case ldap.FilterPresent:
+		return len(attrs[strings.ToLower(ber.DecodeString(f.Data.Bytes()))]) > 0
+	case ldap.FilterExtensibleMatch:
+		// 测试中把 AD 的 in-chain 规则当作普通等值匹配
+		var name, value string
+		for _, c := range f.Children {
+			switch c.Tag {
+			case ldap.MatchingRuleAssertionType:
+				name = ber.DecodeString(c.Data.Bytes())
+			case ldap.MatchingRuleAssertionMatchValue:
+				value = ber.DecodeString(c.Data.Bytes())
+			}
+		}
+		return hasValue(attrs, name, value)
+	}
+	return false
+}
+
+const (
+	testBase    = "dc=corp,dc=example"
+	engGroup    = "cn=vpn-eng,ou=groups,dc=corp,dc=example"
+	adminGroup  = "cn=vpn-admins,ou=groups,dc=corp,dc=example"
+	serviceDN   = "cn=svc-vpn,ou=service,dc=corp,dc=example"
+	aliceDN     = "cn=alice,ou=people,dc=corp,dc=example"
+	bobDN       = "cn=bob,ou=people,dc=corp,dc=example"
+	carolDN     = "cn=carol,ou=people,dc=corp,dc=example"
+	outsiderDN  = "cn=dave,ou=people,dc=corp,dc=example"
+	servicePass = "svc-secret"
+)
+
+func newTestDirectory(t *testing.T) *Client {
+	t.Helper()
+	person := func(user, mail, uac string, groups ...string) map[string][]string {
+		return map[string][]string{
+			"objectclass":        {"person"},
+			"samaccountname":     {user},
+			"mail":               {mail},
+			"useraccountcontrol": {uac},
+			"memberof":           groups,
+		}
+	}
+	s := &testServer{
+		entries: map[string]map[string][]string{
+			aliceDN:    person("alice", "alice@corp.example", "512", engGroup, adminGroup),
+			bobDN:      person("bob", "bob@corp.example", "512", engGroup),
+			carolDN:    person("carol", "carol@corp.example", "514", engGroup), // 已停用
+			outsiderDN: person("dave", "dave@corp.example", "512"),
+		},
+		passwords: map[string]string{
+			serviceDN:  servicePass,
+			aliceDN:    "alice-pw",
+			bobDN:      "bob-pw",
+			outsiderDN: "dave-pw",
+		},
+	}
+	cfg := &Config{
+		URL:          s.start(t),
+		BindDN:       serviceDN,
+		BindPassword: servicePass,
+		BaseDN:       testBase,
+		GroupMappings: []GroupMapping{
+			{GroupDN: adminGroup, Department: "IT", Role: "admin"},
+			{GroupDN: engGroup, Department: "Engineering", Role: "user"},
+		},
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(cfg)
+}
+
+func TestAuthenticate(t *testing.T) {
+	c := newTestDirectory(t)
+
+	m, err := c.Authenticate("alice@corp.example", "alice-pw")
+	if err != nil {
+		t.Fatalf("Authenticate(alice): %v", err)
+	}
+	if m.Username != "alice" || m.Mapping.Department != "IT" || m.Mapping.Role != "admin" {
+		t.Fatalf("alice mapped to %+v", m)
+	}
+
+	m, err = c.Authenticate("bob@corp.example", "bob-pw")
+	if err != nil || m.Mapping.Department != "Engineering" {
+		t.Fatalf("Authenticate(bob) = %+v, %v", m, err)
+	}
+
+	for _, tc := range []struct{ login, password string }{
+		{"bob@corp.example", "wrong"},
+		{"nobody@corp.example", "x"},
+		{"bob@corp.example", ""},
+		// 密码正确但不在任何映射组
+		{"dave@corp.example", "dave-pw"},
+		// 过滤器注入
+		{"*)(mail=*", "bob-pw"},
+	} {
+		if _, err := c.Authenticate(tc.login, tc.password); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("Authenticate(%q, %q) err = %v, want ErrInvalidCredentials", tc.login, tc.password, err)
+		}
+	}
+}
+
+func TestMembers(t *testing.T) {
+	c := newTestDirectory(t)
+	members, err := c.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]Member)
+	for _, m := range members {
+		got[m.Username] = m
+	}
+	if len(got) != 3 || len(members) != 3 {
+		t.Fatalf("members = %+v", members)
+	}
+	if got["alice"].Mapping.Department != "IT" {
+		t.Errorf("alice should take the first matching mapping, got %+v", got["alice"].Mapping)
+	}
+	if got["bob"].Disabled || !got["carol"].Disabled {
+		t.Errorf("disabled flags: bob=%v carol=%v", got["bob"].Disabled, got["carol"].Disabled)
+	}
+}
+
+func TestMembersServiceBindFailure(t *testing.T) {
+	c := newTestDirectory(t)
+	c.cfg.BindPassword = "wrong"
+	if _, err := c.Members(); err == nil {
+		t.Fatal("expected an error when the service account cannot bind")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	cfg := &Config{URL: "ldap://x", BaseDN: "dc=x", GroupMappings: []GroupMapping{{GroupDN: "cn=g", Department: "D", Role: "superadmin"}}}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("superadmin must not be grantable through the directory")
+	}
+	cfg.GroupMappings[0].Role = "manager"
+	cfg.RemovedAction = "delete"
+	if err := cfg.Validate(); err == nil {
+		t.Fatal("unknown removed_action accepted")
+	}
+}
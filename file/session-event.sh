@@ -0,0 +1,38 @@
+#!/bin/bash
+# OpenVPN client-connect / client-disconnect 脚本：把会话事件追加到会话事件记录，Web 服务同步状态时读取。
+# - client-connect 在证书、CRL、黑名单与动态口令都通过之后才运行，记下的证书序列号用于
+#   CA 轮换统计谁已用新证书连接（被拒绝的握手不会留下记录）；
+# - client-disconnect 带会话最终的流量与时长：两次轮询之间开始又结束的会话在 status 里
+#   从未出现，只能靠它入库。
+#
+# 每行以制表符分隔：
+#   <script_type> <time_unix> <time_duration> <bytes_received> <bytes_sent> <tls_serial_0> <ifconfig_pool_remote_ip> <trusted_ip> <trusted_port> <common_name>
+# 缺失的字段写 "-"（client-connect 没有时长与流量）。
+# 本脚本永远 exit 0：client-connect 非零退出会拒绝连接，记录失败不能影响客户端的连接与断开。
+set -u
+
+SESSION_LOG_FILE="${OPENVPN_SESSION_LOG_FILE:-}"
+if [ -z "$SESSION_LOG_FILE" ] || [ -z "${common_name:-}" ]; then
+    exit 0
+fi
+
+field() {
+    if [ -n "${1:-}" ]; then
+        printf '%s' "$1"
+    else
+        printf '-'
+    fi
+}
+
+printf '%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n' \
+    "$(field "${script_type:-}")" \
+    "$(field "${time_unix:-}")" \
+    "$(field "${time_duration:-}")" \
+    "$(field "${bytes_received:-}")" \
+    "$(field "${bytes_sent:-}")" \
+    "$(field "${tls_serial_0:-}")" \
+    "$(field "${ifconfig_pool_remote_ip:-}")" \
+    "$(field "${trusted_ip:-${trusted_ip6:-}}")" \
+    "$(field "${trusted_port:-}")" \
+    "$(field "$common_name")" >> "$SESSION_LOG_FILE" 2>/dev/null || true
+exit 0
@@ -0,0 +1,30 @@
+#!/bin/bash
+# OpenVPN tls-crypt-v2-verify 脚本：拒绝已吊销的用户 tls-crypt-v2 密钥。
+# 在 TLS 握手之前调用，此时还没有证书 / CN，只能靠密钥里包装的 metadata 识别用户。
+#
+# OpenVPN 提供：metadata_type（0 = 用户自定义）与 metadata_file（metadata 原始内容的临时文件）。
+# 本项目签发的密钥 metadata 为 "<用户名>:<随机 ID>"，删除用户时写入吊销列表（第一个参数）。
+#
+# 语义：metadata 在吊销列表里 → exit 1（丢弃该客户端的握手）；否则 exit 0。
+# 注意 OpenVPN 以全新的环境变量集合调用本脚本（不含 setenv 和 PATH）。
+set -u
+PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+
+REVOKED_FILE="${1:-/etc/openvpn/server/tls-crypt-v2-revoked.txt}"
+metadata_type="${metadata_type:-}"
+metadata_file="${metadata_file:-}"
+
+# 非本项目签发的密钥（例如 openvpn --genkey 生成的时间戳 metadata）不在吊销列表管理范围内，放行。
+if [ "$metadata_type" != "0" ] || [ -z "$metadata_file" ] || [ ! -f "$metadata_file" ]; then
+    exit 0
+fi
+
+if [ ! -f "$REVOKED_FILE" ]; then
+    exit 0
+fi
+
+metadata=$(cat "$metadata_file")
+if [ -n "$metadata" ] && grep -qxF -- "$metadata" "$REVOKED_FILE"; then
+    exit 1
+fi
+exit 0
@@ -30,7 +30,6 @@ type APILogConfig struct {
 	EnableResponseBody bool     `json:"enable_response_body"` // 是否记录响应体
 	MaxBodySize        int64    `json:"max_body_size"`        // 最大记录的请求/响应体大小
 	SkipPaths          []string `json:"skip_paths"`           // 跳过记录的路径
-	SensitivePaths     []string `json:"sensitive_paths"`      // 敏感路径（需要特殊处理）
 }
 
 // DefaultLogConfig 返回默认的日志配置
@@ -52,14 +51,6 @@ func DefaultLogConfig() LogConfig {
 				"/api/ping",
 				"/favicon.ico",
 			},
-			SensitivePaths: []string{
-				"/api/auth/login",
-				"/api/auth/logout",
-				"/api/users",
-				"/api/client",
-				"/api/server",
-				"/api/departments",
-			},
 		},
 	}
 }
@@ -2,6 +2,7 @@ package logging
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"time"
 
@@ -68,16 +69,18 @@ func isSensitiveOperation(c *gin.Context) bool {
 
 	// 定义敏感操作的路径模式
 	sensitivePatterns := []string{
-		"/api/auth/login",
-		"/api/auth/logout",
-		"/api/users",
+		"/api/user/login",
+		"/api/user/logout",
 		"/api/client",
 		"/api/server",
 		"/api/departments",
+		"/api/quota",
+		"/api/ca",
+		"/api/permissions",
 	}
 
-	// 检查是否为POST、PUT、DELETE操作
-	if method == "POST" || method == "PUT" || method == "DELETE" {
+	// 检查是否为POST、PUT、PATCH、DELETE操作
+	if method == "POST" || method == "PUT" || method == "PATCH" || method == "DELETE" {
 		for _, pattern := range sensitivePatterns {
 			if contains(path, pattern) {
 				return true
@@ -88,53 +91,49 @@ func isSensitiveOperation(c *gin.Context) bool {
 	return false
 }
 
-// logSensitiveOperation 记录敏感操作的详细信息
+// Actor 已认证请求的操作者（middleware.Claims 实现），用于在日志中标识操作者
+type Actor interface {
+	ActorIdentity() (userID, role string)
+}
+
+// logSensitiveOperation 记录敏感操作的详细信息（结构化的审计事件见 audit_events 表）
 func logSensitiveOperation(c *gin.Context, requestBody, responseBody []byte) {
 	username := "anonymous"
 	if claims, exists := c.Get("claims"); exists {
-		if claimsData, ok := claims.(map[string]interface{}); ok {
-			if user, ok := claimsData["username"].(string); ok {
-				username = user
-			}
+		if actor, ok := claims.(Actor); ok {
+			id, role := actor.ActorIdentity()
+			username = id + " (" + role + ")"
 		}
 	}
 
 	action := c.Request.Method
 	resource := c.Request.URL.Path
 	details := ""
+	status := c.Writer.Status()
 
 	// 根据不同的操作类型记录不同的详细信息
 	switch {
-	case contains(resource, "/auth/login"):
-		LogSecurityEvent("LOGIN_ATTEMPT", username, c.ClientIP(), "User login attempt")
-	case contains(resource, "/auth/logout"):
+	case contains(resource, "/api/user/login"):
+		LogSecurityEvent("LOGIN_ATTEMPT", username, c.ClientIP(), fmt.Sprintf("User login attempt (status %d)", status))
+	case contains(resource, "/api/user/logout"):
 		LogSecurityEvent("LOGOUT", username, c.ClientIP(), "User logout")
-	case contains(resource, "/users"):
-		if action == "POST" {
-			details = "Create new user"
-		} else if action == "PUT" {
-			details = "Update user information"
-		} else if action == "DELETE" {
-			details = "Delete user"
-		}
-		LogUserAction(username, action, "USER", details)
-	case contains(resource, "/client"):
+	case contains(resource, "/api/client"):
 		if action == "POST" {
-			details = "Create new client certificate"
+			details = "Create or change client"
 		} else if action == "PUT" {
 			details = "Update client configuration"
 		} else if action == "DELETE" {
 			details = "Revoke client certificate"
 		}
-		LogUserAction(username, action, "CLIENT", details)
-	case contains(resource, "/server"):
+		LogUserAction(username, action, "CLIENT", fmt.Sprintf("%s %s (status %d)", details, resource, status))
+	case contains(resource, "/api/server"):
 		if action == "POST" {
 			details = "Start/Stop OpenVPN server"
 		} else if action == "PUT" {
 			details = "Update server configuration"
 		}
-		LogUserAction(username, action, "SERVER", details)
-	case contains(resource, "/departments"):
+		LogUserAction(username, action, "SERVER", fmt.Sprintf("%s %s (status %d)", details, resource, status))
+	case contains(resource, "/api/departments"):
 		if action == "POST" {
 			details = "Create new department"
 		} else if action == "PUT" {
@@ -142,7 +141,9 @@ func logSensitiveOperation(c *gin.Context, requestBody, responseBody []byte) {
 		} else if action == "DELETE" {
 			details = "Delete department"
 		}
-		LogUserAction(username, action, "DEPARTMENT", details)
+		LogUserAction(username, action, "DEPARTMENT", fmt.Sprintf("%s %s (status %d)", details, resource, status))
+	default:
+		LogUserAction(username, action, "SYSTEM", fmt.Sprintf("%s (status %d)", resource, status))
 	}
 }
 
@@ -0,0 +1,207 @@
+// Package mailer 发送系统邮件（邮箱验证、重置密码）。
+//
+// 传输方式可替换：默认按环境变量连接 SMTP 服务器；未配置 SMTP_HOST 时只记录日志、不发信。
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/utils"
+)
+
+// Message 一封纯文本邮件
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件传输
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Default 系统使用的邮件传输（启动时由 Init 按环境变量设置，测试中可替换）
+var Default Mailer = logMailer{}
+
+// Init 按环境变量选择邮件传输
+func Init() {
+	cfg := ConfigFromEnv()
+	if cfg.Host == "" {
+		logging.Warn("SMTP_HOST 未配置，验证邮件与重置密码邮件不会发送")
+		Default = logMailer{}
+		return
+	}
+	Default = NewSMTPMailer(cfg)
+}
+
+// Send 用 Default 发送邮件
+func Send(msg Message) error {
+	return Default.Send(msg)
+}
+
+// logMailer 未配置 SMTP 时使用：只记录收件人与主题（链接里有令牌，不写日志）
+type logMailer struct{}
+
+func (logMailer) Send(msg Message) error {
+	logging.Warn("SMTP 未配置，未发送邮件给 %s: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// TLS 模式
+const (
+	// TLSStartTLS 明文连接后升级（587 端口）；服务器不支持 STARTTLS 时拒绝发送
+	TLSStartTLS = "starttls"
+	// TLSImplicit 直接 TLS 连接（465 端口）
+	TLSImplicit = "tls"
+	// TLSNone 不加密（仅限本机或内网测试 SMTP 服务器）
+	TLSNone = "none"
+)
+
+// SMTPConfig SMTP 服务器参数
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+	TLS      string
+}
+
+// ConfigFromEnv 读取 SMTP_HOST / SMTP_PORT / SMTP_USERNAME / SMTP_PASSWORD / SMTP_FROM / SMTP_TLS
+func ConfigFromEnv() SMTPConfig {
+	port, err := strconv.Atoi(utils.GetEnvOrDefault("SMTP_PORT", "587"))
+	if err != nil || port <= 0 {
+		logging.Warn("SMTP_PORT must be a positive integer. Using default 587.")
+		port = 587
+	}
+	return SMTPConfig{
+		Host:     utils.GetEnvOrDefault("SMTP_HOST", ""),
+		Port:     port,
+		Username: utils.GetEnvOrDefault("SMTP_USERNAME", ""),
+		Password: utils.GetEnvOrDefault("SMTP_PASSWORD", ""),
+		From:     utils.GetEnvOrDefault("SMTP_FROM", "noreply@localhost"),
+		TLS:      strings.ToLower(utils.GetEnvOrDefault("SMTP_TLS", TLSStartTLS)),
+	}
+}
+
+// SMTPMailer 通过 SMTP 服务器发信
+type SMTPMailer struct {
+	cfg     SMTPConfig
+	timeout time.Duration
+}
+
+// NewSMTPMailer 创建 SMTP 传输
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg, timeout: 30 * time.Second}
+}
+
+// Send 投递一封邮件
+func (m *SMTPMailer) Send(msg Message) error {
+	from, err := mail.ParseAddress(m.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %v", err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient: %v", err)
+	}
+	data, err := buildMessage(from, to, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	tlsConfig := &tls.Config{ServerName: m.cfg.Host}
+	var conn net.Conn
+	if m.cfg.TLS == TLSImplicit {
+		conn, err = tls.DialWithDialer(&net.Dialer{Timeout: m.timeout}, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.DialTimeout("tcp", addr, m.timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("connect SMTP server: %v", err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(m.timeout))
+
+	c, err := smtp.NewClient(conn, m.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("SMTP handshake: %v", err)
+	}
+	defer c.Close()
+
+	if m.cfg.TLS == TLSStartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return fmt.Errorf("SMTP server does not support STARTTLS (set SMTP_TLS=none to send unencrypted)")
+		}
+		if err := c.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("STARTTLS: %v", err)
+		}
+	}
+	if m.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)); err != nil {
+			return fmt.Errorf("SMTP auth: %v", err)
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM: %v", err)
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("SMTP RCPT TO: %v", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("SMTP DATA: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP DATA: %v", err)
+	}
+	return c.Quit()
+}
+
+// buildMessage 组装 RFC 5322 邮件：主题按 RFC 2047 编码，正文 UTF-8 + base64（每行 76 字符）
+func buildMessage(from, to *mail.Address, msg Message, now time.Time) ([]byte, error) {
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from.Address, "@"); at >= 0 {
+		domain = from.Address[at+1:]
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from.String())
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: base64\r\n\r\n")
+
+	body := base64.StdEncoding.EncodeToString([]byte(strings.ReplaceAll(msg.Body, "\n", "\r\n")))
+	for len(body) > 76 {
+		b.WriteString(body[:76] + "\r\n")
+		body = body[76:]
+	}
+	b.WriteString(body + "\r\n")
+	return b.Bytes(), nil
+}
@@ -0,0 +1,137 @@
+package mailer
+
+import (
+	"bufio"
+	"encoding/base64"
+	"io"
+	"mime"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer 最小的进程内 SMTP 服务器：接收一封邮件后把 DATA 内容发到 got
+func fakeSMTPServer(t *testing.T) (addr string, got <-chan string) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		reply("220 localhost ESMTP test")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250-localhost")
+				reply("250 8BITMIME")
+			case strings.HasPrefix(cmd, "MAIL FROM"), strings.HasPrefix(cmd, "RCPT TO"):
+				reply("250 OK")
+			case cmd == "DATA":
+				reply("354 go ahead")
+				var data strings.Builder
+				for {
+					l, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if l == ".\r\n" {
+						break
+					}
+					data.WriteString(l)
+				}
+				ch <- data.String()
+				reply("250 queued")
+			case cmd == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("502 not implemented")
+			}
+		}
+	}()
+	return ln.Addr().String(), ch
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	addr, got := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	m := NewSMTPMailer(SMTPConfig{Host: host, Port: p, From: "Aegis <noreply@example.com>", TLS: TLSNone})
+
+	subject, body, err := Render("zh-Hans", TemplateResetPassword, map[string]interface{}{
+		"AppName": "Aegis", "Name": "alice", "Link": "https://vpn.example.com/auth/resetpassword/reset?code=abc", "Hours": 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Send(Message{To: "alice@example.com", Subject: subject, Body: body}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(<-got))
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || decoded != "[Aegis] 重置密码" {
+		t.Fatalf("subject = %q (%v)", decoded, err)
+	}
+	if msg.Header.Get("To") != "<alice@example.com>" {
+		t.Fatalf("To = %q", msg.Header.Get("To"))
+	}
+	text, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, msg.Body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(text), "https://vpn.example.com/auth/resetpassword/reset?code=abc") ||
+		!strings.Contains(string(text), "1 小时") {
+		t.Fatalf("unexpected body:\n%s", text)
+	}
+}
+
+func TestSMTPMailerRequiresStartTLS(t *testing.T) {
+	addr, _ := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+	p, _ := strconv.Atoi(port)
+	m := NewSMTPMailer(SMTPConfig{Host: host, Port: p, From: "noreply@example.com", TLS: TLSStartTLS})
+	if err := m.Send(Message{To: "alice@example.com", Subject: "s", Body: "b"}); err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Fatalf("expected STARTTLS error, got %v", err)
+	}
+}
+
+func TestRenderLocalized(t *testing.T) {
+	data := map[string]interface{}{"AppName": "Aegis", "Name": "bob", "Link": "L", "Hours": 24}
+	for lang, want := range map[string]string{
+		"en-US":          "[Aegis] Verify your email address",
+		"en-GB,en;q=0.9": "[Aegis] Verify your email address",
+		"zh-CN":          "[Aegis] 请验证您的邮箱",
+		"":               "[Aegis] 请验证您的邮箱",
+	} {
+		subject, body, err := Render(lang, TemplateVerifyEmail, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subject != want {
+			t.Errorf("Render(%q) subject = %q, want %q", lang, subject, want)
+		}
+		if !strings.Contains(body, "L") || !strings.Contains(body, "24") {
+			t.Errorf("Render(%q) body missing link or TTL:\n%s", lang, body)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+//go:embed templates/*/*.tmpl
+var templateFS embed.FS
+
+// 模板名
+const (
+	TemplateVerifyEmail   = "verify_email"
+	TemplateResetPassword = "reset_password"
+)
+
+// DefaultLang 没有对应语言的模板时使用的语言（与前端默认语言一致）
+const DefaultLang = "zh-Hans"
+
+// Langs 已有邮件模板的语言
+var Langs = []string{"zh-Hans", "en-US"}
+
+// NormalizeLang 把 lang 参数或 Accept-Language 首选项映射到已有模板的语言
+func NormalizeLang(lang string) string {
+	lang = strings.TrimSpace(strings.SplitN(strings.SplitN(lang, ",", 2)[0], ";", 2)[0])
+	for _, l := range Langs {
+		if strings.EqualFold(l, lang) {
+			return l
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(lang), "en") {
+		return "en-US"
+	}
+	return DefaultLang
+}
+
+// Render 渲染邮件模板。模板文件定义 subject 与 body 两个子模板。
+func Render(lang, name string, data interface{}) (subject, body string, err error) {
+	lang = NormalizeLang(lang)
+	tmpl, err := template.ParseFS(templateFS, fmt.Sprintf("templates/%s/%s.tmpl", lang, name))
+	if err != nil {
+		return "", "", fmt.Errorf("parse mail template %s/%s: %v", lang, name, err)
+	}
+	var s, b bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&s, "subject", data); err != nil {
+		return "", "", err
+	}
+	if err := tmpl.ExecuteTemplate(&b, "body", data); err != nil {
+		return "", "", err
+	}
+	return strings.TrimSpace(s.String()), strings.TrimSpace(b.String()) + "\n", nil
+}
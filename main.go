@@ -17,6 +17,7 @@ import (
 	"openvpn-admin-go/logging"
 	"openvpn-admin-go/model"
 	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/services"
 	"path/filepath"
 
 	"gorm.io/gorm"
@@ -111,6 +112,14 @@ func InitCore() error {
 	if err := openvpn.EnsureCRLSetup(); err != nil {
 		logging.Warn("初始化 CRL 失败: %v", err)
 	}
+	if cfg, err := openvpn.LoadConfig(); err == nil {
+		if err := openvpn.EnsureTLSKeySetup(cfg); err != nil {
+			logging.Warn("初始化 tls-crypt-v2 密钥失败: %v", err)
+		}
+		if err := openvpn.EnsureVPNAuthSetup(cfg); err != nil {
+			logging.Warn("写入 vpn-auth 数据库配置失败: %v", err)
+		}
+	}
 
 	// 初始化数据库
 	if err := database.Init(); err != nil {
@@ -119,6 +128,10 @@ func InitCore() error {
 	if err := database.Migrate(&model.User{}, &model.Department{}, &model.Notification{}); err != nil {
 		return fmt.Errorf("数据库迁移失败: %v", err)
 	}
+	// 渲染 .ovpn 时按部门开关决定是否带 auth-user-pass
+	openvpn.ClientOTPRequired = func(username string) bool {
+		return services.RequiresVPNOTPByName(database.DB, username)
+	}
 	// 数据库为空（无超级管理员）时，从环境变量创建超级管理员
 	if err := seedSuperAdmin(); err != nil {
 		return err
@@ -133,7 +146,9 @@ func InitCore() error {
 			for _, u := range users {
 				clientPath := filepath.Join(constants.ClientConfigDir, u.Name+".ovpn")
 				if _, errStat := os.Stat(clientPath); os.IsNotExist(errStat) {
-					if errCreate := openvpn.CreateClient(u.Name); errCreate != nil {
+					if errCreate := services.IssueUserCertificate(database.DB, &u); errors.Is(errCreate, services.ErrCSRRequired) {
+						continue // 等用户上传 CSR 自助签发
+					} else if errCreate != nil {
 						logging.Error("创建 OpenVPN 客户端 %s 失败: %v", u.Name, errCreate) // Log and continue
 					} else {
 						logging.Info("为数据库用户 %s 创建了 OpenVPN 客户端配置", u.Name)
@@ -176,16 +191,13 @@ func InitCore() error {
 						}
 						logging.Info("为 OpenVPN 客户端 %s 生成随机密码（请管理员重置）", userName)
 
-						// 检查是否有固定IP配置
-						fixedIP, errFixedIP := openvpn.GetClientFixedIP(userName)
-						if errFixedIP != nil {
-							logging.Warn("检查 OpenVPN 客户端 %s 固定IP配置失败: %v", userName, errFixedIP)
-						}
-
-						// 检查是否有子网配置
-						subnet, errSubnet := openvpn.GetClientSubnet(userName)
-						if errSubnet != nil {
-							logging.Warn("检查 OpenVPN 客户端 %s 子网配置失败: %v", userName, errSubnet)
+						// 沿用现有 CCD 中的固定IP与子网配置（如果有）
+						var fixedIP, subnet string
+						legacyCCD, errCCD := openvpn.ReadClientCCD(userName)
+						if errCCD != nil {
+							logging.Warn("读取 OpenVPN 客户端 %s 的CCD配置失败: %v", userName, errCCD)
+						} else if legacyCCD != nil {
+							fixedIP, subnet = legacyCCD.FixedIP, legacyCCD.Subnet
 						}
 
 						newUser := model.User{
@@ -203,22 +215,9 @@ func InitCore() error {
 						} else {
 							logging.Info("为 OpenVPN 客户端 %s 创建了数据库用户（随机密码，请管理员重置）", userName)
 
-							// 如果有固定IP配置，确保CCD配置正确
-							if fixedIP != "" {
-								if errSetIP := openvpn.SetClientFixedIP(userName, fixedIP); errSetIP != nil {
-									logging.Error("为用户 %s 设置固定IP %s 失败: %v", userName, fixedIP, errSetIP)
-								} else {
-									logging.Info("用户 %s 已设置固定IP: %s", userName, fixedIP)
-								}
-							}
-
-							// 如果有子网配置，确保CCD配置正确
-							if subnet != "" {
-								if errSetSubnet := openvpn.SetClientSubnet(userName, subnet); errSetSubnet != nil {
-									logging.Error("为用户 %s 设置子网 %s 失败: %v", userName, subnet, errSetSubnet)
-								} else {
-									logging.Info("用户 %s 已设置子网: %s", userName, subnet)
-								}
+							// 导入CCD中的其余推送设置并按数据库重写
+							if errSync := services.SyncClientCCD(database.DB, &newUser); errSync != nil {
+								logging.Error("为用户 %s 同步CCD配置失败: %v", userName, errSync)
 							}
 						}
 					} else {
@@ -228,22 +227,8 @@ func InitCore() error {
 					// 用户已存在，以数据库为准，确保CCD配置与数据库一致
 					logging.Info("用户 %s 已存在，检查CCD配置是否与数据库一致", userName)
 
-					// 如果数据库中有固定IP配置，确保CCD配置正确
-					if existingUser.FixedIP != "" {
-						if errSetIP := openvpn.SetClientFixedIP(userName, existingUser.FixedIP); errSetIP != nil {
-							logging.Error("为用户 %s 设置固定IP %s 失败: %v", userName, existingUser.FixedIP, errSetIP)
-						} else {
-							logging.Info("为用户 %s 确保固定IP配置: %s", userName, existingUser.FixedIP)
-						}
-					}
-
-					// 如果数据库中有子网配置，确保CCD配置正确
-					if existingUser.Subnet != "" {
-						if errSetSubnet := openvpn.SetClientSubnet(userName, existingUser.Subnet); errSetSubnet != nil {
-							logging.Error("为用户 %s 设置子网 %s 失败: %v", userName, existingUser.Subnet, errSetSubnet)
-						} else {
-							logging.Info("为用户 %s 确保子网配置: %s", userName, existingUser.Subnet)
-						}
+					if errSync := services.SyncClientCCD(database.DB, &existingUser); errSync != nil {
+						logging.Error("为用户 %s 同步CCD配置失败: %v", userName, errSync)
 					}
 				}
 			}
@@ -303,8 +288,12 @@ func seedSuperAdmin() error {
 func main() {
 	// Assign the public functions to the variables in the cmd package.
 	cmd.CoreInitializer = InitCore
-	if err := cmd.CoreInitializer(); err != nil {
-		logging.Fatal("核心初始化失败: %v", err)
+	// 离线根 CA 子命令（ca init-root / ca sign）在没有 OpenVPN 和数据库的机器上运行；
+	// vpn-auth 由 OpenVPN 调用，自行连接数据库
+	if cmd.NeedsCoreInit(os.Args[1:]) {
+		if err := cmd.CoreInitializer(); err != nil {
+			logging.Fatal("核心初始化失败: %v", err)
+		}
 	}
 	cmd.Execute()
 }
@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APITokenPrefix 个人 API 令牌的前缀，用来和 JWT 区分
+const APITokenPrefix = "pat_"
+
+// API 令牌的权限范围。令牌永远不会超出创建者本人角色的权限（路由上的 RoleRequired 照常生效）。
+const (
+	// ScopeRead 只读：所有 GET 请求（下载 .ovpn 除外）
+	ScopeRead = "read"
+	// ScopeClientsCreate 创建客户端
+	ScopeClientsCreate = "clients:create"
+	// ScopeClientsPause 暂停 / 恢复客户端
+	ScopeClientsPause = "clients:pause"
+	// ScopeClientsConfig 下载客户端 .ovpn（含私钥）
+	ScopeClientsConfig = "clients:config"
+	// ScopeClientsWrite 全部客户端管理操作（创建、修改、删除、暂停、续签、审批、解锁）
+	ScopeClientsWrite = "clients:write"
+	// ScopeAll 与本人登录相同的权限（令牌、会话与两步验证管理除外）
+	ScopeAll = "all"
+)
+
+// APITokenScopes 全部可用的权限范围
+var APITokenScopes = []string{ScopeRead, ScopeClientsCreate, ScopeClientsPause, ScopeClientsConfig, ScopeClientsWrite, ScopeAll}
+
+// scopeRoutes 需要特定范围的请求（"方法 路由模板"）；其余 GET 请求属于 read，其余写操作只有 all 可以
+var scopeRoutes = map[string][]string{
+	ScopeClientsCreate: {"POST /api/client"},
+	ScopeClientsPause:  {"POST /api/client/:username/pause", "POST /api/client/:username/resume"},
+	ScopeClientsConfig: {"GET /api/client/config/:username"},
+	ScopeClientsWrite: {
+		"POST /api/client",
+		"PUT /api/client/:id",
+		"PUT /api/client/:id/ccd",
+		"DELETE /api/client/:id",
+		"POST /api/client/:username/pause",
+		"POST /api/client/:username/resume",
+		"POST /api/client/:username/renew",
+		"POST /api/client/:username/approve",
+		"POST /api/client/:username/reject",
+		"POST /api/client/:username/unlock",
+	},
+}
+
+// ValidAPITokenScope 是否为已知的权限范围
+func ValidAPITokenScope(scope string) bool {
+	for _, s := range APITokenScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// scopeAllows 令牌的权限范围是否允许该请求
+func scopeAllows(scopes []string, method, route string) bool {
+	key := method + " " + route
+	special := false
+	for _, routes := range scopeRoutes {
+		for _, r := range routes {
+			if r == key {
+				special = true
+			}
+		}
+	}
+	for _, s := range scopes {
+		if s == ScopeAll {
+			return true
+		}
+		for _, r := range scopeRoutes[s] {
+			if r == key {
+				return true
+			}
+		}
+		if s == ScopeRead && method == http.MethodGet && !special {
+			return true
+		}
+	}
+	return false
+}
+
+// APITokenAuth 校验个人 API 令牌，返回按令牌所有者当前角色生成的 Claims 与令牌的权限范围；
+// 由 Web 服务启动时设置，为 nil 时不接受 API 令牌
+var APITokenAuth func(token, clientIP string) (*Claims, []string, error)
+
+// authenticateAPIToken JWTAuthMiddleware 中处理 API 令牌：校验令牌与权限范围
+func authenticateAPIToken(c *gin.Context, token string) {
+	if APITokenAuth == nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	claims, scopes, err := APITokenAuth(token, c.ClientIP())
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
+		return
+	}
+	if !scopeAllows(scopes, c.Request.Method, c.FullPath()) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "token scope does not allow this request"})
+		return
+	}
+	c.Set("claims", claims)
+	c.Set("apiToken", true)
+	c.Next()
+}
+
+// SessionRequired 只允许交互式登录会话（JWT），拒绝 API 令牌。
+// 用于令牌 / 会话 / 两步验证 / 密码管理，避免泄露的令牌为自己续命或接管账号。
+func SessionRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetBool("apiToken") {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "this endpoint requires an interactive login"})
+			return
+		}
+		c.Next()
+	}
+}
+
+// isAPIToken 令牌是否为个人 API 令牌
+func isAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestScopeAllows(t *testing.T) {
+	cases := []struct {
+		scopes []string
+		method string
+		route  string
+		want   bool
+	}{
+		{[]string{ScopeRead}, http.MethodGet, "/api/client/list", true},
+		{[]string{ScopeRead}, http.MethodGet, "/api/client/config/:username", false},
+		{[]string{ScopeRead}, http.MethodPost, "/api/client", false},
+		{[]string{ScopeClientsCreate}, http.MethodPost, "/api/client", true},
+		{[]string{ScopeClientsCreate}, http.MethodGet, "/api/client/list", false},
+		{[]string{ScopeClientsPause}, http.MethodPost, "/api/client/:username/pause", true},
+		{[]string{ScopeClientsPause}, http.MethodDelete, "/api/client/:id", false},
+		{[]string{ScopeClientsConfig}, http.MethodGet, "/api/client/config/:username", true},
+		{[]string{ScopeClientsWrite}, http.MethodDelete, "/api/client/:id", true},
+		{[]string{ScopeClientsWrite}, http.MethodPost, "/api/server/restart", false},
+		{[]string{ScopeRead, ScopeClientsPause}, http.MethodPost, "/api/client/:username/resume", true},
+		{[]string{ScopeAll}, http.MethodPost, "/api/server/restart", true},
+		{nil, http.MethodGet, "/api/client/list", false},
+	}
+	for _, tc := range cases {
+		if got := scopeAllows(tc.scopes, tc.method, tc.route); got != tc.want {
+			t.Errorf("scopeAllows(%v, %s %s) = %v, want %v", tc.scopes, tc.method, tc.route, got, tc.want)
+		}
+	}
+}
+
+func TestJWTAuthMiddlewareAPIToken(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	APITokenAuth = func(token, clientIP string) (*Claims, []string, error) {
+		if token != "pat_good" {
+			return nil, nil, errors.New("invalid")
+		}
+		return &Claims{UserID: "user-1", Role: "user"}, []string{ScopeRead}, nil
+	}
+	defer func() { APITokenAuth = nil }()
+
+	r := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	r.GET("/api/client/list", JWTAuthMiddleware(), ok)
+	r.POST("/api/client", JWTAuthMiddleware(), ok)
+	r.GET("/api/user/tokens", JWTAuthMiddleware(), SessionRequired(), ok)
+	status := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if got := status(http.MethodGet, "/api/client/list", "pat_good"); got != http.StatusOK {
+		t.Errorf("read scope GET: status %d", got)
+	}
+	if got := status(http.MethodPost, "/api/client", "pat_good"); got != http.StatusForbidden {
+		t.Errorf("read scope POST: status %d", got)
+	}
+	if got := status(http.MethodGet, "/api/client/list", "pat_bad"); got != http.StatusUnauthorized {
+		t.Errorf("unknown token: status %d", got)
+	}
+	// 令牌不能管理令牌
+	if got := status(http.MethodGet, "/api/user/tokens", "pat_good"); got != http.StatusForbidden {
+		t.Errorf("token on session-only route: status %d", got)
+	}
+}
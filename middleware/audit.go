@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AuditRecorder 保存审计事件；由 Web 服务启动时设置，为 nil 时不记录
+var AuditRecorder func(ev *model.AuditEvent)
+
+const auditContextKey = "audit"
+
+// AuditInfo 控制器为本次操作补充的审计信息；空字段沿用路由登记的默认值
+type AuditInfo struct {
+	// ActorID 未携带令牌的请求（登录、注册）由控制器指明操作者
+	ActorID    string
+	TargetType string
+	TargetID   string
+	TargetName string
+	// Before / After 修改前后的状态（结构体或 map），只记录有变化的字段
+	Before interface{}
+	After  interface{}
+}
+
+// SetAudit 控制器声明操作对象与修改前后的状态，可多次调用，后设置的非空字段覆盖之前的
+func SetAudit(c *gin.Context, info AuditInfo) {
+	cur, _ := c.Get(auditContextKey)
+	merged, _ := cur.(AuditInfo)
+	if info.ActorID != "" {
+		merged.ActorID = info.ActorID
+	}
+	if info.TargetType != "" {
+		merged.TargetType = info.TargetType
+	}
+	if info.TargetID != "" {
+		merged.TargetID = info.TargetID
+	}
+	if info.TargetName != "" {
+		merged.TargetName = info.TargetName
+	}
+	// 立即取快照，之后修改传入的对象不影响记录
+	if info.Before != nil {
+		merged.Before = auditFields(info.Before)
+	}
+	if info.After != nil {
+		merged.After = auditFields(info.After)
+	}
+	c.Set(auditContextKey, merged)
+}
+
+// auditRoute 路由对应的审计动作与默认对象：param 为 id 时路由参数作为对象 ID，为 username 时作为对象名称，
+// 为 self 时对象是操作者本人
+type auditRoute struct {
+	action     string
+	targetType string
+	param      string
+}
+
+// auditRoutes 写操作路由（"方法 路由模板"）对应的审计动作；未登记的写操作以 "方法 路由模板" 为动作
+var auditRoutes = map[string]auditRoute{
+	"POST /api/user/register":               {"user.register", "user", ""},
+	"POST /api/user/login":                  {"user.login", "user", ""},
+	"POST /api/user/login/mfa":              {"user.login.mfa", "user", ""},
+	"POST /api/user/login/mfa/setup":        {"user.login.mfa_setup", "user", ""},
+	"POST /api/user/oidc/callback":          {"user.login.sso", "user", ""},
+	"POST /api/user/verify-email":           {"user.verify_email.resend", "user", "self"},
+	"POST /api/user/forgot-password":        {"user.password.forgot", "user", ""},
+	"PATCH /api/user/reset-password/:token": {"user.password.reset", "user", ""},
+	"PATCH /api/user/me":                    {"user.profile.update", "user", "self"},
+	"POST /api/user/logout":                 {"user.logout", "session", ""},
+	"DELETE /api/user/sessions":             {"user.sessions.revoke_others", "user", "self"},
+	"DELETE /api/user/sessions/:id":         {"user.session.revoke", "session", "id"},
+	"POST /api/user/tokens":                 {"user.token.create", "api_token", ""},
+	"DELETE /api/user/tokens/:id":           {"user.token.delete", "api_token", "id"},
+	"POST /api/user/mfa/setup":              {"user.mfa.setup", "user", "self"},
+	"POST /api/user/mfa/enable":             {"user.mfa.enable", "user", "self"},
+	"POST /api/user/mfa/disable":            {"user.mfa.disable", "user", "self"},
+	"POST /api/user/mfa/recovery-codes":     {"user.mfa.recovery_codes", "user", "self"},
+	"DELETE /api/user/mfa/:id":              {"user.mfa.reset", "user", "id"},
+
+	"POST /api/client":                   {"client.create", "user", ""},
+	"PUT /api/client/:id":                {"client.update", "user", "id"},
+	"DELETE /api/client/:id":             {"client.delete", "user", "id"},
+	"PUT /api/client/:id/ccd":            {"client.ccd.update", "user", "id"},
+	"POST /api/client/:username/pause":   {"client.pause", "user", "username"},
+	"POST /api/client/:username/resume":  {"client.resume", "user", "username"},
+	"POST /api/client/:username/renew":   {"client.renew", "user", "username"},
+	"POST /api/client/:username/approve": {"client.approve", "user", "username"},
+	"POST /api/client/:username/reject":  {"client.reject", "user", "username"},
+	"POST /api/client/:username/unlock":  {"client.unlock", "user", "username"},
+	"POST /api/client/enroll":            {"client.enroll", "user", ""},
+
+	"POST /api/departments":       {"department.create", "department", ""},
+	"PUT /api/departments/:id":    {"department.update", "department", "id"},
+	"DELETE /api/departments/:id": {"department.delete", "department", "id"},
+
+	"PUT /api/quota/users/:id":       {"quota.user.update", "user", "id"},
+	"PUT /api/quota/departments/:id": {"quota.department.update", "department", "id"},
+
+	"POST /api/server/start":           {"server.start", "server", ""},
+	"POST /api/server/stop":            {"server.stop", "server", ""},
+	"POST /api/server/restart":         {"server.restart", "server", ""},
+	"PUT /api/server/update":           {"server.update", "server", ""},
+	"DELETE /api/server/delete":        {"server.delete", "server", ""},
+	"PUT /api/server/config":           {"server.config.update", "server", ""},
+	"PUT /api/server/port":             {"server.port.update", "server", ""},
+	"PUT /api/server/config/items":     {"server.config.items.update", "server", ""},
+	"PUT /api/server/config/item/:key": {"server.config.item.update", "server_config", ""},
+
+	"POST /api/ca/csr":    {"ca.csr.create", "ca", ""},
+	"POST /api/ca/rotate": {"ca.rotate", "ca", ""},
+	"POST /api/ca/retire": {"ca.retire", "ca", ""},
+
+	"PUT /api/permissions/roles/:role": {"permission.role.update", "role", ""},
+}
+
+// auditSkipped 不记录的写操作：刷新令牌与通知已读状态过于频繁且不改变业务数据
+var auditSkipped = map[string]bool{
+	"POST /api/user/refresh":            true,
+	"PATCH /api/notifications/read-all": true,
+	"PATCH /api/notifications/:id/read": true,
+}
+
+// AuditRouteKeys 已登记审计动作或明确不记录的写操作路由（"方法 路由模板"），供路由测试检查遗漏与过期条目
+func AuditRouteKeys() []string {
+	keys := make([]string, 0, len(auditRoutes)+len(auditSkipped))
+	for k := range auditRoutes {
+		keys = append(keys, k)
+	}
+	for k := range auditSkipped {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// auditResponseWriter 截取响应体，失败时从中取出错误信息
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditResponseWriter) Write(b []byte) (int, error) {
+	if w.body.Len() < 4096 {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// AuditTrail 为每个写操作（GET / HEAD / OPTIONS 之外）在请求结束后记录一条审计事件
+func AuditTrail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		method := c.Request.Method
+		key := method + " " + c.FullPath()
+		if method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions ||
+			c.FullPath() == "" || auditSkipped[key] || AuditRecorder == nil {
+			c.Next()
+			return
+		}
+		w := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = w
+		c.Next()
+
+		ev := &model.AuditEvent{
+			Action:   key,
+			SourceIP: c.ClientIP(),
+			Method:   method,
+			Path:     c.Request.URL.Path,
+			Status:   w.Status(),
+			Result:   model.AuditResultSuccess,
+		}
+		if r, ok := auditRoutes[key]; ok {
+			ev.Action, ev.TargetType = r.action, r.targetType
+			switch r.param {
+			case "id":
+				ev.TargetID = c.Param("id")
+			case "username":
+				ev.TargetName = c.Param("username")
+			}
+		}
+		if v, ok := c.Get("claims"); ok {
+			claims := v.(*Claims)
+			ev.ActorID, ev.ActorRole = claims.UserID, claims.Role
+			ev.ViaAPIToken = c.GetBool("apiToken")
+			if r := auditRoutes[key]; r.param == "self" {
+				ev.TargetID = claims.UserID
+			}
+		}
+		if v, ok := c.Get(auditContextKey); ok {
+			info := v.(AuditInfo)
+			if ev.ActorID == "" {
+				ev.ActorID = info.ActorID
+			}
+			if info.TargetType != "" {
+				ev.TargetType = info.TargetType
+			}
+			if info.TargetID != "" {
+				ev.TargetID = info.TargetID
+			}
+			if info.TargetName != "" {
+				ev.TargetName = info.TargetName
+			}
+			if changes := AuditChanges(info.Before, info.After); len(changes) > 0 {
+				if data, err := json.Marshal(changes); err == nil {
+					ev.Changes = string(data)
+				}
+			}
+		}
+		if ev.Status >= http.StatusBadRequest {
+			ev.Result = model.AuditResultFailure
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if json.Unmarshal(w.body.Bytes(), &resp) == nil {
+				ev.Error = truncate(resp.Error, 500)
+			}
+		}
+		AuditRecorder(ev)
+	}
+}
+
+// AuditChange 一个字段修改前后的值
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// auditIgnoredFields 不参与比较的字段（时间戳、关联对象、在线状态等）
+var auditIgnoredFields = map[string]bool{
+	"createdat": true, "updatedat": true, "head": true, "parent": true, "children": true, "users": true,
+	"isonline": true, "lastconnectiontime": true, "realaddress": true, "virtualaddress": true,
+	"bytesreceived": true, "bytessent": true, "connectedsince": true, "lastref": true, "onlineduration": true,
+	"mfalaststep": true, "lastfailedloginat": true,
+}
+
+// auditSensitive 敏感字段只记录“已修改”，不记录值
+func auditSensitive(field string) bool {
+	f := strings.ToLower(field)
+	for _, s := range []string{"password", "secret", "token", "recovery", "hash", "privatekey", "private_key", "tls_key"} {
+		if strings.Contains(f, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// AuditChanges 比较修改前后的状态（按 JSON 字段），返回有变化的字段。
+// 新建时 before 为 nil，删除时 after 为 nil。
+func AuditChanges(before, after interface{}) map[string]AuditChange {
+	b, a := auditFields(before), auditFields(after)
+	changes := make(map[string]AuditChange)
+	for k, bv := range b {
+		if av, ok := a[k]; !ok || !reflect.DeepEqual(bv, av) {
+			changes[k] = AuditChange{Before: bv, After: a[k]}
+		}
+	}
+	for k, av := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = AuditChange{After: av}
+		}
+	}
+	for k, ch := range changes {
+		if auditSensitive(k) {
+			changes[k] = AuditChange{Before: redacted(ch.Before), After: redacted(ch.After)}
+		}
+	}
+	return changes
+}
+
+// auditFields 把状态转为 JSON 字段 map，去掉忽略的字段
+func auditFields(v interface{}) map[string]interface{} {
+	out := map[string]interface{}{}
+	if v == nil {
+		return out
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return out
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return map[string]interface{}{}
+	}
+	for k := range out {
+		if auditIgnoredFields[strings.ToLower(k)] {
+			delete(out, k)
+		}
+	}
+	return out
+}
+
+func redacted(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return "[redacted]"
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// ActorIdentity 实现 logging.Actor，文件日志据此记录操作者
+func (c *Claims) ActorIdentity() (userID, role string) {
+	return c.UserID, c.Role
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditChanges(t *testing.T) {
+	before := map[string]interface{}{"name": "alice", "role": "user", "passwordHash": "old", "updatedAt": "t1"}
+	after := map[string]interface{}{"name": "alice", "role": "manager", "passwordHash": "new", "updatedAt": "t2", "subnet": "10.0.0.0/24"}
+	changes := AuditChanges(before, after)
+
+	if len(changes) != 3 {
+		t.Fatalf("changes = %v, want role, passwordHash and subnet", changes)
+	}
+	if c := changes["role"]; c.Before != "user" || c.After != "manager" {
+		t.Errorf("role change = %+v", c)
+	}
+	if c := changes["passwordHash"]; c.Before != "[redacted]" || c.After != "[redacted]" {
+		t.Errorf("password hash not redacted: %+v", c)
+	}
+	if c := changes["subnet"]; c.Before != nil || c.After != "10.0.0.0/24" {
+		t.Errorf("subnet change = %+v", c)
+	}
+
+	// 删除：全部字段变为 nil
+	if c := AuditChanges(before, nil); len(c) != 3 || c["name"].After != nil {
+		t.Errorf("delete changes = %v", c)
+	}
+}
+
+func TestAuditTrail(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(r func(*model.AuditEvent)) { AuditRecorder = r }(AuditRecorder)
+	var events []*model.AuditEvent
+	AuditRecorder = func(ev *model.AuditEvent) { events = append(events, ev) }
+
+	r := gin.New()
+	api := r.Group("/api", AuditTrail(), func(c *gin.Context) {
+		c.Set("claims", &Claims{UserID: "u1", Role: "admin"})
+	})
+	api.GET("/client/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+	api.PUT("/client/:id", func(c *gin.Context) {
+		SetAudit(c, AuditInfo{TargetName: "bob", Before: gin.H{"role": "user"}})
+		SetAudit(c, AuditInfo{After: gin.H{"role": "manager"}})
+		c.JSON(http.StatusOK, gin.H{"success": true})
+	})
+	api.POST("/client/:username/pause", func(c *gin.Context) {
+		c.JSON(http.StatusForbidden, gin.H{"success": false, "error": "not your department"})
+	})
+
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/api/client/42"},
+		{http.MethodPut, "/api/client/42"},
+		{http.MethodPost, "/api/client/carol/pause"},
+	} {
+		req := httptest.NewRequest(req.method, req.path, nil)
+		req.RemoteAddr = "192.0.2.7:5555"
+		r.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if len(events) != 2 {
+		t.Fatalf("recorded %d events, want 2 (GET is not audited)", len(events))
+	}
+	upd := events[0]
+	if upd.Action != "client.update" || upd.ActorID != "u1" || upd.ActorRole != "admin" ||
+		upd.TargetType != "user" || upd.TargetID != "42" || upd.TargetName != "bob" ||
+		upd.SourceIP != "192.0.2.7" || upd.Result != model.AuditResultSuccess {
+		t.Errorf("update event = %+v", upd)
+	}
+	var changes map[string]AuditChange
+	if err := json.Unmarshal([]byte(upd.Changes), &changes); err != nil || changes["role"].After != "manager" {
+		t.Errorf("update changes = %s (%v)", upd.Changes, err)
+	}
+
+	pause := events[1]
+	if pause.Action != "client.pause" || pause.TargetName != "carol" || pause.Status != http.StatusForbidden ||
+		pause.Result != model.AuditResultFailure || pause.Error != "not your department" {
+		t.Errorf("pause event = %+v", pause)
+	}
+}
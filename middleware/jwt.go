@@ -8,17 +8,27 @@ import (
    "os"
    "path/filepath"
    "strings"
+   "sync"
    "time"
 
    "github.com/gin-gonic/gin"
    "github.com/golang-jwt/jwt/v4"
 )
 
-var jwtSecret []byte
+var (
+   jwtSecret     []byte
+   jwtSecretOnce sync.Once
+)
 
 const jwtSecretFile = "data/.jwt_secret"
 
-func init() {
+// secretKey 首次签发/校验令牌时才加载密钥，导入本包（例如其他包的单元测试）不会生成密钥文件
+func secretKey() []byte {
+   jwtSecretOnce.Do(loadJWTSecret)
+   return jwtSecret
+}
+
+func loadJWTSecret() {
    secret := os.Getenv("JWT_SECRET")
    if secret != "" {
        jwtSecret = []byte(secret)
@@ -52,25 +62,33 @@ type Claims struct {
    jwt.RegisteredClaims
 }
 
-// GenerateToken 生成 JWT
-func GenerateToken(userID, role, deptID string) (string, error) {
+// AccessTokenTTL 访问令牌有效期；过期后用刷新令牌换新
+const AccessTokenTTL = 15 * time.Minute
+
+// SessionActive 校验访问令牌所属的登录会话（jti）仍有效，由 Web 服务启动时设置；
+// 为 nil 时不校验（单元测试）
+var SessionActive func(sessionID, userID string) bool
+
+// GenerateToken 生成 JWT，jti 为登录会话 ID
+func GenerateToken(sessionID, userID, role, deptID string) (string, error) {
    claims := Claims{
        UserID: userID,
        Role:   role,
        DeptID: deptID,
        RegisteredClaims: jwt.RegisteredClaims{
-           ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
+           ID:        sessionID,
+           ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenTTL)),
            IssuedAt:  jwt.NewNumericDate(time.Now()),
        },
    }
    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-   return token.SignedString(jwtSecret)
+   return token.SignedString(secretKey())
 }
 
 // ParseToken 验证并解析 JWT
 func ParseToken(tokenString string) (*Claims, error) {
    token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-       return jwtSecret, nil
+       return secretKey(), nil
    })
    if err != nil {
        return nil, err
@@ -81,7 +99,7 @@ func ParseToken(tokenString string) (*Claims, error) {
    return nil, err
 }
 
-// JWTAuthMiddleware JWT 中间件
+// JWTAuthMiddleware JWT 中间件；同时接受个人 API 令牌（pat_ 前缀）
 func JWTAuthMiddleware() gin.HandlerFunc {
    return func(c *gin.Context) {
        authHeader := c.GetHeader("Authorization")
@@ -95,11 +113,20 @@ func JWTAuthMiddleware() gin.HandlerFunc {
            return
        }
        token := parts[1]
+       if isAPIToken(token) {
+           authenticateAPIToken(c, token)
+           return
+       }
        claims, err := ParseToken(token)
        if err != nil {
            c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid token"})
            return
        }
+       // 已登出 / 被吊销的会话立即失效，不必等访问令牌过期
+       if SessionActive != nil && (claims.ID == "" || !SessionActive(claims.ID, claims.UserID)) {
+           c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "session revoked"})
+           return
+       }
        c.Set("claims", claims)
        c.Next()
    }
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestJWTAuthMiddlewareRejectsRevokedSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	revoked := map[string]bool{"session-2": true}
+	SessionActive = func(sessionID, userID string) bool { return !revoked[sessionID] }
+	defer func() { SessionActive = nil }()
+
+	r := gin.New()
+	r.GET("/", JWTAuthMiddleware(), func(c *gin.Context) { c.Status(http.StatusOK) })
+	status := func(token string) int {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	active, _ := GenerateToken("session-1", "user-1", "user", "")
+	if got := status(active); got != http.StatusOK {
+		t.Errorf("active session: status %d", got)
+	}
+	revokedToken, _ := GenerateToken("session-2", "user-1", "user", "")
+	if got := status(revokedToken); got != http.StatusUnauthorized {
+		t.Errorf("revoked session: status %d", got)
+	}
+	// 没有 jti 的旧令牌不再被接受
+	legacy, _ := GenerateToken("", "user-1", "user", "")
+	if got := status(legacy); got != http.StatusUnauthorized {
+		t.Errorf("token without jti: status %d", got)
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// MFAChallengeTTL 登录第一步（密码）通过后，完成两步验证的时限
+const MFAChallengeTTL = 5 * time.Minute
+
+// MFAChallengeClaims 两步验证挑战令牌：只证明密码已通过，不能当作登录 JWT 使用。
+// jti 对应一条一次性的 model.UserToken，使用时作废，令牌在有效期内也不能重放
+type MFAChallengeClaims struct {
+	UserID string `json:"user_id"`
+	jwt.RegisteredClaims
+}
+
+// mfaChallengeSecret 挑战令牌使用从 jwtSecret 派生的独立密钥签名，
+// 保证它无论如何都不会被 ParseToken / JWTAuthMiddleware 接受
+func mfaChallengeSecret() []byte {
+	sum := sha256.Sum256(append([]byte("mfa-challenge:"), secretKey()...))
+	return sum[:]
+}
+
+// GenerateMFAChallengeToken 为已通过密码校验的用户签发挑战令牌，jti 为一次性令牌
+func GenerateMFAChallengeToken(userID, jti string) (string, error) {
+	now := time.Now()
+	claims := MFAChallengeClaims{
+		UserID: userID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(mfaChallengeSecret())
+}
+
+// ParseMFAChallengeToken 验证挑战令牌，返回用户 ID 与 jti
+func ParseMFAChallengeToken(tokenString string) (userID, jti string, err error) {
+	token, err := jwt.ParseWithClaims(tokenString, &MFAChallengeClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, errors.New("unexpected signing method")
+		}
+		return mfaChallengeSecret(), nil
+	})
+	if err != nil {
+		return "", "", err
+	}
+	claims, ok := token.Claims.(*MFAChallengeClaims)
+	if !ok || !token.Valid || claims.UserID == "" || claims.ID == "" {
+		return "", "", errors.New("invalid challenge token")
+	}
+	return claims.UserID, claims.ID, nil
+}
@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"os"
+	"testing"
+)
+
+// 提供 JWT_SECRET，避免首次签发令牌时在包目录下生成 data/.jwt_secret
+var _ = os.Setenv("JWT_SECRET", "test-secret")
+
+func TestMFAChallengeTokenIsolation(t *testing.T) {
+	challenge, err := GenerateMFAChallengeToken("user-1", "jti-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, jti, err := ParseMFAChallengeToken(challenge); err != nil || id != "user-1" || jti != "jti-1" {
+		t.Errorf("ParseMFAChallengeToken = %q, %q, %v", id, jti, err)
+	}
+	// 没有 jti 的令牌无法作废，不接受
+	noJTI, _ := GenerateMFAChallengeToken("user-1", "")
+	if _, _, err := ParseMFAChallengeToken(noJTI); err == nil {
+		t.Error("challenge token without jti must be rejected")
+	}
+	// 挑战令牌不能当登录 JWT 用，登录 JWT 也不能当挑战令牌用
+	if _, err := ParseToken(challenge); err == nil {
+		t.Error("challenge token must not be accepted as a login token")
+	}
+	token, _ := GenerateToken("session-1", "user-1", "admin", "")
+	if _, _, err := ParseMFAChallengeToken(token); err == nil {
+		t.Error("login token must not be accepted as a challenge token")
+	}
+}
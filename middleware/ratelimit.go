@@ -5,48 +5,76 @@ import (
 	"sync"
 	"time"
 
+	"openvpn-admin-go/logging"
+
 	"github.com/gin-gonic/gin"
 )
 
+// RateLimitStore 限流计数的存储：Hit 记一次请求，返回 key 在当前窗口内的请求数
+type RateLimitStore interface {
+	Hit(key string, window time.Duration) (int, error)
+}
+
+// RateLimitBackend 当前使用的限流存储，默认为进程内存；
+// 多副本部署时由 Web 服务启动时替换为数据库实现（RATE_LIMIT_BACKEND=database）
+var RateLimitBackend RateLimitStore = NewMemoryRateLimitStore()
+
 // ipBucket 记录每个 IP 的请求桶
 type ipBucket struct {
-	count    int
-	resetAt  time.Time
-	mu       sync.Mutex
+	count   int
+	resetAt time.Time
+	mu      sync.Mutex
 }
 
-var (
-	buckets   = make(map[string]*ipBucket)
-	bucketsMu sync.Mutex
-)
+// memoryRateLimitStore 进程内的限流计数，重启后清零
+type memoryRateLimitStore struct {
+	buckets map[string]*ipBucket
+	mu      sync.Mutex
+}
+
+// NewMemoryRateLimitStore 进程内的限流存储
+func NewMemoryRateLimitStore() RateLimitStore {
+	return &memoryRateLimitStore{buckets: make(map[string]*ipBucket)}
+}
 
-// getOrCreateBucket 获取或创建 IP 对应的令牌桶
-func getOrCreateBucket(ip string, window time.Duration) *ipBucket {
-	bucketsMu.Lock()
-	defer bucketsMu.Unlock()
+// getOrCreateBucket 获取或创建 key 对应的令牌桶
+func (s *memoryRateLimitStore) getOrCreateBucket(key string, window time.Duration) *ipBucket {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	b, ok := buckets[ip]
+	b, ok := s.buckets[key]
 	if !ok || time.Now().After(b.resetAt) {
 		b = &ipBucket{resetAt: time.Now().Add(window)}
-		buckets[ip] = b
+		s.buckets[key] = b
 	}
 	return b
 }
 
-// RateLimit 对指定路由限制每个 IP 在 window 时间内最多 maxReqs 次请求
+func (s *memoryRateLimitStore) Hit(key string, window time.Duration) (int, error) {
+	b := s.getOrCreateBucket(key, window)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if time.Now().After(b.resetAt) {
+		b.count = 0
+		b.resetAt = time.Now().Add(window)
+	}
+	b.count++
+	return b.count, nil
+}
+
+// RateLimit 对指定路由限制每个 IP 在 window 时间内最多 maxReqs 次请求。
+// 计数按「路由 + IP」分桶，各路由的限额互不占用。
+// 存储出错时放行并记录日志，避免数据库故障导致无法登录。
 func RateLimit(maxReqs int, window time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		ip := c.ClientIP()
-		b := getOrCreateBucket(ip, window)
-
-		b.mu.Lock()
-		if time.Now().After(b.resetAt) {
-			b.count = 0
-			b.resetAt = time.Now().Add(window)
+		count, err := RateLimitBackend.Hit(rateLimitKey(c.FullPath(), ip), window)
+		if err != nil {
+			logging.Error("Rate limit store failed for %s: %v", ip, err)
+			c.Next()
+			return
 		}
-		b.count++
-		count := b.count
-		b.mu.Unlock()
 
 		if count > maxReqs {
 			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
@@ -58,3 +86,8 @@ func RateLimit(maxReqs int, window time.Duration) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// rateLimitKey 限流计数的键：路由模板（不含路径参数的值）加客户端 IP
+func rateLimitKey(route, ip string) string {
+	return route + "|" + ip
+}
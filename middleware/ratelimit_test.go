@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Hit(string, time.Duration) (int, error) {
+	return 0, errors.New("database unavailable")
+}
+
+func TestRateLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	defer func(s RateLimitStore) { RateLimitBackend = s }(RateLimitBackend)
+
+	r := gin.New()
+	r.POST("/login", RateLimit(2, time.Minute), func(c *gin.Context) { c.Status(http.StatusOK) })
+	r.POST("/forgot-password", RateLimit(2, time.Minute), func(c *gin.Context) { c.Status(http.StatusOK) })
+	request := func(path string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	status := func() int { return request("/login") }
+
+	RateLimitBackend = NewMemoryRateLimitStore()
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		if got := status(); got != want {
+			t.Errorf("request %d: status %d, want %d", i+1, got, want)
+		}
+	}
+	// 每个路由单独计数：/login 用完限额不影响同一 IP 的其他路由
+	if got := request("/forgot-password"); got != http.StatusOK {
+		t.Errorf("other route shares the /login bucket: status %d", got)
+	}
+
+	// 存储故障时放行
+	RateLimitBackend = failingRateLimitStore{}
+	if got := status(); got != http.StatusOK {
+		t.Errorf("failing store: status %d", got)
+	}
+}
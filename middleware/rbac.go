@@ -8,11 +8,25 @@ package middleware
 import (
 	"net/http"
 
+	"openvpn-admin-go/model"
+
 	"github.com/gin-gonic/gin"
 )
 
-// RoleRequired 基于角色的访问控制中间件
-func RoleRequired(roles ...string) gin.HandlerFunc {
+// RoleHasPermission 角色是否拥有某项权限（读取 role_permissions 的缓存）；
+// 由 Web 服务启动时设置，为 nil 时只有 superadmin 拥有权限
+var RoleHasPermission func(role, permission string) bool
+
+// HasPermission 当前用户是否拥有某项权限；superadmin 拥有全部权限
+func HasPermission(claims *Claims, permission string) bool {
+	if claims.Role == string(model.RoleSuperAdmin) {
+		return true
+	}
+	return RoleHasPermission != nil && RoleHasPermission(claims.Role, permission)
+}
+
+// PermissionRequired 基于权限的访问控制中间件：要求拥有全部给定权限
+func PermissionRequired(permissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		val, exists := c.Get("claims")
 		if !exists {
@@ -20,12 +34,12 @@ func RoleRequired(roles ...string) gin.HandlerFunc {
 			return
 		}
 		claims := val.(*Claims)
-		for _, r := range roles {
-			if claims.Role == r {
-				c.Next()
+		for _, p := range permissions {
+			if !HasPermission(claims, p) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed", "permission": p})
 				return
 			}
 		}
-		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "not allowed"})
+		c.Next()
 	}
 }
@@ -0,0 +1,56 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPermissionRequired(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	granted := map[string]map[string]bool{
+		"admin": {model.PermLogsRead: true, model.PermServerRead: true},
+		"user":  {model.PermServerRead: true},
+	}
+	RoleHasPermission = func(role, permission string) bool { return granted[role][permission] }
+	defer func() { RoleHasPermission = nil }()
+
+	status := func(role string, perms ...string) int {
+		r := gin.New()
+		r.GET("/", func(c *gin.Context) {
+			c.Set("claims", &Claims{UserID: "u", Role: role})
+		}, PermissionRequired(perms...), func(c *gin.Context) { c.Status(http.StatusOK) })
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}
+
+	cases := []struct {
+		role  string
+		perms []string
+		want  int
+	}{
+		{"admin", []string{model.PermLogsRead}, http.StatusOK},
+		{"admin", []string{model.PermLogsRead, model.PermServerRead}, http.StatusOK},
+		{"admin", []string{model.PermLogsRead, model.PermCAManage}, http.StatusForbidden},
+		{"user", []string{model.PermLogsRead}, http.StatusForbidden},
+		{"manager", []string{model.PermServerRead}, http.StatusForbidden},
+		// superadmin 隐含全部权限
+		{"superadmin", []string{model.PermPermissionManage}, http.StatusOK},
+	}
+	for _, tc := range cases {
+		if got := status(tc.role, tc.perms...); got != tc.want {
+			t.Errorf("%s %v: status %d, want %d", tc.role, tc.perms, got, tc.want)
+		}
+	}
+
+	// 未设置权限来源时只有 superadmin 可以访问
+	RoleHasPermission = nil
+	if got := status("admin", model.PermLogsRead); got != http.StatusForbidden {
+		t.Errorf("nil RoleHasPermission: status %d", got)
+	}
+}
@@ -0,0 +1,30 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// APIToken 个人 API 令牌（自动化脚本使用）。数据库只存 SHA-256，明文只在创建时返回一次。
+type APIToken struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	UserID string `gorm:"size:36;not null;index"`
+	Name   string `gorm:"size:100;not null"`
+	// Prefix 令牌开头几位，便于在列表中辨认
+	Prefix    string `gorm:"size:16;not null"`
+	TokenHash string `gorm:"size:64;not null;uniqueIndex"`
+	// Scopes 逗号分隔的权限范围，见 middleware.APITokenScopes
+	Scopes     string    `gorm:"size:255;not null"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	LastUsedAt *time.Time
+	LastUsedIP string `gorm:"size:45"`
+	CreatedAt  time.Time
+}
+
+// BeforeCreate 在创建记录前生成 UUID
+func (t *APIToken) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.NewString()
+	return
+}
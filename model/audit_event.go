@@ -0,0 +1,47 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 审计结果
+const (
+	AuditResultSuccess = "success"
+	AuditResultFailure = "failure"
+)
+
+// AuditEvent 一次写操作的审计记录：谁（操作者与当时的角色）在何处（来源 IP）对什么对象做了什么，
+// 修改了哪些字段，结果如何。由 middleware.AuditTrail 在请求结束后写入。
+type AuditEvent struct {
+	ID        string    `gorm:"primaryKey;size:36" json:"id"`
+	CreatedAt time.Time `gorm:"index" json:"createdAt"`
+	// ActorID 为空表示未登录的请求（登录、注册、找回密码等）
+	ActorID   string `gorm:"size:36;index" json:"actorId"`
+	ActorName string `gorm:"size:100" json:"actorName"`
+	ActorRole string `gorm:"size:20" json:"actorRole"`
+	// ViaAPIToken 通过个人 API 令牌发起
+	ViaAPIToken bool `gorm:"column:via_api_token;default:false" json:"viaApiToken"`
+	// Action 动作，如 client.create、department.update；未登记的路由为 "方法 路由模板"
+	Action     string `gorm:"size:100;not null;index" json:"action"`
+	TargetType string `gorm:"size:50;index" json:"targetType"`
+	TargetID   string `gorm:"size:100;index" json:"targetId"`
+	TargetName string `gorm:"size:255" json:"targetName"`
+	// Changes 修改前后有变化的字段（JSON：{"字段": {"before": …, "after": …}}），敏感字段只记录“已修改”
+	Changes  string `gorm:"type:text" json:"changes,omitempty"`
+	SourceIP string `gorm:"size:45" json:"sourceIp"`
+	Method   string `gorm:"size:10" json:"method"`
+	Path     string `gorm:"size:255" json:"path"`
+	Status   int    `json:"status"`
+	Result   string `gorm:"size:10;not null;index" json:"result"`
+	// Error 失败时的错误信息
+	Error string `gorm:"size:500" json:"error,omitempty"`
+}
+
+// BeforeCreate 在创建记录前生成 UUID
+func (e *AuditEvent) BeforeCreate(tx *gorm.DB) (err error) {
+	e.ID = uuid.NewString()
+	return
+}
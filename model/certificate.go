@@ -0,0 +1,44 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// CertificateStatus 客户端证书状态
+type CertificateStatus string
+
+const (
+	CertificateValid   CertificateStatus = "valid"
+	CertificateRevoked CertificateStatus = "revoked"
+	CertificateExpired CertificateStatus = "expired"
+)
+
+// Certificate 已签发的客户端证书（每次签发/续签一行）
+type Certificate struct {
+	ID        string            `gorm:"primaryKey;size:36"`
+	UserID    string            `gorm:"size:36;index"`
+	UserName  string            `gorm:"size:100;not null;index"` // 证书 CN
+	Serial    string            `gorm:"size:64;not null;uniqueIndex"`
+	NotBefore time.Time         `gorm:"not null"`
+	NotAfter  time.Time         `gorm:"not null;index"`
+	Status    CertificateStatus `gorm:"size:20;not null;default:valid"`
+	RevokedAt *time.Time
+	// CAID 签发 CA 的标识（pki.AuthorityID）；升级前签发、没有 AKID 的证书为空
+	CAID string `gorm:"column:ca_id;size:64;not null;default:'';index"`
+	// FromCSR 按用户上传的 CSR 签发（服务器上没有私钥）
+	FromCSR bool `gorm:"column:from_csr;not null;default:false"`
+	// LastSeenAt 最近一次用这张证书建立 VPN 连接的时间（CA 轮换据此判断用户是否已换上新证书）
+	LastSeenAt *time.Time
+	// ExpiryNotifiedAt 已发出到期提醒的时间，避免重复提醒
+	ExpiryNotifiedAt *time.Time
+	CreatedAt        time.Time
+}
+
+// BeforeCreate 在创建记录前生成 UUID
+func (c *Certificate) BeforeCreate(tx *gorm.DB) (err error) {
+	c.ID = uuid.NewString()
+	return
+}
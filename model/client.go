@@ -26,33 +26,72 @@ const (
 	ApprovalRejected ApprovalStatus = "rejected" // 已拒绝
 )
 
+// AuthSource 账号来源：决定登录时在哪里校验密码
+type AuthSource string
+
+const (
+	AuthSourceLocal AuthSource = "local" // 本地 bcrypt 密码
+	AuthSourceLDAP  AuthSource = "ldap"  // LDAP / Active Directory，由目录同步维护
+	AuthSourceOIDC  AuthSource = "oidc"  // OpenID Connect 自动开通，只能经身份提供方登录
+)
+
 // User 用户模型
 type User struct {
-	ID           string `gorm:"primaryKey;size:36"`
-	Name         string `gorm:"uniqueIndex;size:100;not null"`
-	Email        string `gorm:"uniqueIndex;size:100;not null"`
-	PasswordHash string `gorm:"size:255;not null"`
-	Role         Role   `gorm:"size:20;not null"`
+	ID    string `gorm:"primaryKey;size:36"`
+	Name  string `gorm:"uniqueIndex;size:100;not null"`
+	Email string `gorm:"uniqueIndex;size:100;not null"`
+	// EmailVerified 已通过邮件链接验证邮箱；修改邮箱后重置为 false
+	EmailVerified bool   `gorm:"default:false"`
+	PasswordHash  string `gorm:"size:255;not null"`
+	Role          Role   `gorm:"size:20;not null"`
 	// ApprovalStatus 注册审批状态：pending/approved/rejected
 	ApprovalStatus ApprovalStatus `gorm:"size:20;not null;default:approved"`
 	DepartmentID   string         `gorm:"size:36"`
 	CreatorID      string         `gorm:"size:36"`
-	FixedIP        string         `gorm:"size:45"` // IPv4 or IPv6 address
-	Subnet         string         `gorm:"size:45"` // Subnet in CIDR format (e.g., 10.10.120.0/23)
+	FixedIP        string         `gorm:"size:45;uniqueIndex:idx_users_fixed_ip,where:fixed_ip <> ''"`                       // IPv4 tunnel address (ifconfig-push)
+	FixedIPv6      string         `gorm:"column:fixed_ipv6;size:45;uniqueIndex:idx_users_fixed_ipv6,where:fixed_ipv6 <> ''"` // IPv6 tunnel address (ifconfig-ipv6-push)
+	Subnet         string         `gorm:"size:45"`                                                                           // Subnet in CIDR format (e.g., 10.10.120.0/23)
 	CreatedAt      time.Time
 	UpdatedAt      time.Time
 
 	// OpenVPN status fields
 	IsOnline           bool `gorm:"default:false"`
 	LastConnectionTime *time.Time
-	RealAddress        string `gorm:"size:45"` // Client's real IP address
-	VirtualAddress     string `gorm:"size:45"` // Client's VPN IP address
+	RealAddress        string `gorm:"size:45"`                             // Client's real IP address
+	VirtualAddress     string `gorm:"size:45"`                             // Client's VPN IP address
+	VirtualIPv6Address string `gorm:"column:virtual_ipv6_address;size:45"` // Client's VPN IPv6 address (dual-stack tunnel)
 	BytesReceived      int64  `gorm:"default:0"`
 	BytesSent          int64  `gorm:"default:0"`
 	ConnectedSince     *time.Time
 	LastRef            *time.Time
 	OnlineDuration     int64 `gorm:"default:0"` // Duration in seconds
 	IsPaused           bool  `gorm:"default:false"`
+
+	// 流量配额（字节，0 表示不限）
+	DailyQuotaBytes   int64 `gorm:"default:0"`
+	MonthlyQuotaBytes int64 `gorm:"default:0"`
+	// QuotaPaused 因超出配额被自动暂停；仅此类暂停会在配额周期重置后自动恢复
+	QuotaPaused bool `gorm:"default:false"`
+
+	// 两步验证（TOTP）。MFASecret 为 base32 密钥，未启用时是待确认的新密钥；
+	// MFARecoveryCodes 为逗号分隔的恢复码 SHA-256（十六进制），用掉一个删一个；
+	// MFALastStep 为最近一次通过校验的 TOTP 时间步，同一验证码不能重放。
+	MFAEnabled       bool   `gorm:"column:mfa_enabled;default:false"`
+	MFASecret        string `gorm:"column:mfa_secret;size:64"`
+	MFARecoveryCodes string `gorm:"column:mfa_recovery_codes;type:text"`
+	MFALastStep      int64  `gorm:"column:mfa_last_step;default:0"`
+
+	// 外部账号：AuthSource 非 local 时密码由外部校验，ExternalID 为目录中的 DN 或 OIDC subject；
+	// DirectoryPaused 因目录账号停用或移出映射组被同步暂停，目录恢复后自动解除
+	AuthSource      AuthSource `gorm:"size:20;not null;default:local"`
+	ExternalID      string     `gorm:"size:255;not null;default:''"`
+	DirectoryPaused bool       `gorm:"default:false"`
+
+	// 登录失败锁定：FailedLoginCount 为连续失败次数（成功登录或管理员解锁后清零），
+	// 距上次失败超过一天重新计数；LockedUntil 之前拒绝该账号的密码登录
+	FailedLoginCount  int `gorm:"default:0"`
+	LastFailedLoginAt *time.Time
+	LockedUntil       *time.Time
 }
 
 // BeforeCreate 在创建记录前生成 UUID
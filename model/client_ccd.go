@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+// ClientCCD 用户的客户端专属推送设置，与 User 上的 FixedIP、Subnet 一起生成该用户的 CCD 文件。
+// 列表为空时沿用所在部门的网络策略。
+type ClientCCD struct {
+	UserID string `gorm:"primaryKey;size:36"`
+	// PushReset 不继承服务端全局 push 的路由与 DNS
+	PushReset bool
+	// Routes 推送的路由（CIDR）
+	Routes StringList `gorm:"type:text"`
+	// DNSServers 推送的 DNS 服务器
+	DNSServers StringList `gorm:"type:text"`
+	// SearchDomains 推送的搜索域，第一个同时作为 DOMAIN
+	SearchDomains StringList `gorm:"type:text"`
+	// RedirectGateway redirect-gateway 参数，空表示不推送
+	RedirectGateway string `gorm:"size:100"`
+	// Directives 其他经过校验的指令
+	Directives StringList `gorm:"type:text"`
+	UpdatedAt  time.Time
+}
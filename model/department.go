@@ -24,6 +24,25 @@ type Department struct {
    CreatedAt time.Time `json:"createdAt"`
    UpdatedAt time.Time `json:"updatedAt"`
    Users     []User    `gorm:"foreignKey:DepartmentID" json:"-"`
+   // 部门流量配额（部门全体成员合计，字节，0 表示不限）
+   DailyQuotaBytes   int64 `gorm:"default:0" json:"dailyQuotaBytes"`
+   MonthlyQuotaBytes int64 `gorm:"default:0" json:"monthlyQuotaBytes"`
+   // CertValidityDays 成员客户端证书有效期（天），0 表示沿用上级部门 / 全局默认
+   CertValidityDays int `gorm:"default:0" json:"certValidityDays"`
+   // CSROnly 成员只能上传 CSR 自助签发证书（私钥不经过服务器），对下级部门同样生效
+   CSROnly bool `gorm:"column:csr_only;default:false" json:"csrOnly"`
+   // VPNOTPRequired 成员连接 VPN 时需输入动态口令（服务端需开启 openvpn_auth_mode），对下级部门同样生效
+   VPNOTPRequired bool `gorm:"column:vpn_otp_required;default:false" json:"vpnOtpRequired"`
+   // 网络策略：成员 CCD 默认推送的路由、DNS 与搜索域，成员自己设置了同一项时以成员为准；为空时沿用上级部门
+   Routes        StringList `gorm:"type:text" json:"routes"`
+   DNSServers    StringList `gorm:"type:text" json:"dnsServers"`
+   SearchDomains StringList `gorm:"type:text" json:"searchDomains"`
+   // IPPoolStart / IPPoolEnd 成员固定 IP 的可用范围（服务端网段内），为空时沿用上级部门
+   IPPoolStart string `gorm:"column:ip_pool_start;size:45" json:"ipPoolStart"`
+   IPPoolEnd   string `gorm:"column:ip_pool_end;size:45" json:"ipPoolEnd"`
+   // ClientToClient 成员能否与其他 VPN 客户端互访，为空时沿用上级部门，顶级部门默认跟随服务端 client-to-client 开关。
+   // 由 Web 服务维护的防火墙规则执行（见 SyncClientToClientFirewall）
+   ClientToClient *bool `gorm:"column:client_to_client" json:"clientToClient"`
 }
 
 // BeforeCreate 在创建记录前生成 UUID
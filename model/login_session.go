@@ -0,0 +1,35 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// LoginSession 管理面板的登录会话。ID 即访问令牌（JWT）的 jti；
+// 刷新令牌每次使用后轮换，数据库只存 SHA-256。
+type LoginSession struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	UserID string `gorm:"size:36;not null;index"`
+	// RefreshHash 当前刷新令牌；PrevRefreshHash 上一个（已轮换掉的）刷新令牌，被再次使用说明令牌泄露
+	RefreshHash     string `gorm:"size:64;not null;uniqueIndex"`
+	PrevRefreshHash string `gorm:"size:64;not null;default:''"`
+	UserAgent       string `gorm:"size:255"`
+	IP              string `gorm:"size:45"`
+	CreatedAt       time.Time
+	LastUsedAt      time.Time
+	// ExpiresAt 刷新令牌过期时间，每次刷新顺延
+	ExpiresAt time.Time `gorm:"not null;index"`
+	// RevokedAt 非空即已吊销（登出、改密码、改角色、删除用户……）
+	RevokedAt    *time.Time
+	RevokeReason string `gorm:"size:50"`
+}
+
+// BeforeCreate 在创建记录前生成 UUID（刷新令牌里含会话 ID，调用方可预先生成）
+func (s *LoginSession) BeforeCreate(tx *gorm.DB) (err error) {
+	if s.ID == "" {
+		s.ID = uuid.NewString()
+	}
+	return
+}
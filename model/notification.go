@@ -11,8 +11,16 @@ import (
 type NotificationType string
 
 const (
-	NotificationTypeConnected    NotificationType = "user_connected"
-	NotificationTypeDisconnected NotificationType = "user_disconnected"
+	NotificationTypeConnected     NotificationType = "user_connected"
+	NotificationTypeDisconnected  NotificationType = "user_disconnected"
+	NotificationTypeQuotaExceeded NotificationType = "quota_exceeded"
+	NotificationTypeCertExpiring  NotificationType = "cert_expiring"
+	NotificationTypeCertReissued  NotificationType = "cert_reissued"
+	NotificationTypeCertReenroll  NotificationType = "cert_reenroll_required"
+	NotificationTypeDirectoryPaused  NotificationType = "directory_user_paused"
+	NotificationTypeDirectoryRemoved NotificationType = "directory_user_removed"
+	NotificationTypeAccountLocked    NotificationType = "account_locked"
+	NotificationTypeCARotationDone   NotificationType = "ca_rotation_done"
 )
 
 // Notification records a VPN connection event for superadmin review
@@ -22,6 +30,7 @@ type Notification struct {
 	UserName   string           `gorm:"size:100;not null;index"`
 	RealIP     string           `gorm:"size:45"`
 	VirtualIP  string           `gorm:"size:45"`
+	Detail     string           `gorm:"size:255"` // free-form context, e.g. which quota was exceeded
 	IsRead     bool             `gorm:"default:false;index"`
 	CreatedAt  time.Time        `gorm:"index"`
 }
@@ -0,0 +1,104 @@
+package model
+
+import "time"
+
+// 权限标识，格式为 "资源.操作"。路由通过 middleware.PermissionRequired 校验，
+// 角色拥有哪些权限保存在 role_permissions 表中，由 superadmin 编辑；superadmin 隐含全部权限。
+const (
+	PermClientRead        = "client.read"
+	PermClientCreate      = "client.create"
+	PermClientUpdate      = "client.update"
+	PermClientDelete      = "client.delete"
+	PermClientPause       = "client.pause"
+	PermClientRenew       = "client.renew"
+	PermClientApprove     = "client.approve"
+	PermClientUnlock      = "client.unlock"
+	PermClientConfig      = "client.config"
+	PermClientEnroll      = "client.enroll"
+	PermClientNetwork     = "client.network"
+	PermClientRoleAssign  = "client.role.assign"
+	PermUserRead          = "user.read"
+	PermUserMFAReset      = "user.mfa.reset"
+	PermDepartmentRead    = "department.read"
+	PermDepartmentWrite   = "department.write"
+	PermServerRead        = "server.read"
+	PermServerControl     = "server.control"
+	PermServerConfigRead  = "server.config.read"
+	PermServerConfigWrite = "server.config.write"
+	PermLogsRead          = "logs.read"
+	PermNotificationRead  = "notification.read"
+	PermQuotaRead         = "quota.read"
+	PermQuotaWrite        = "quota.write"
+	PermCAManage          = "ca.manage"
+	PermAuditRead         = "audit.read"
+	PermIPAMRead          = "ipam.read"
+	PermPermissionManage  = "permission.manage"
+)
+
+// PermissionInfo 权限注册表条目
+type PermissionInfo struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+	// Reserved 仅 superadmin 拥有，不能授予其他角色
+	Reserved bool `json:"reserved"`
+	// Defaults 默认拥有该权限的角色（superadmin 之外）
+	Defaults []Role `json:"defaults"`
+}
+
+// PermissionRegistry 全部权限。新增权限在首次启动时按 Defaults 授予一次，之后以 superadmin 的编辑为准。
+var PermissionRegistry = []PermissionInfo{
+	{Key: PermClientRead, Description: "View clients, their VPN sessions and certificates (other users than self also need user.read)", Defaults: []Role{RoleAdmin, RoleManager, RoleUser}},
+	{Key: PermClientCreate, Description: "Create clients", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientUpdate, Description: "Update clients", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientDelete, Description: "Delete clients", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientPause, Description: "Pause and resume clients", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientRenew, Description: "Renew client certificates", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientApprove, Description: "Approve or reject registrations", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientUnlock, Description: "Unlock accounts locked after failed logins", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermClientConfig, Description: "Download client .ovpn files (other users' files also need user.read)", Defaults: []Role{RoleAdmin, RoleManager, RoleUser}},
+	{Key: PermClientEnroll, Description: "Enroll a certificate from an own CSR", Defaults: []Role{RoleAdmin, RoleManager, RoleUser}},
+	{Key: PermClientNetwork, Description: "Set client fixed IP, subnet and pushed routes, DNS and options", Defaults: []Role{RoleAdmin}},
+	{Key: PermClientRoleAssign, Description: "Assign roles other than user (superadmin only by superadmins)", Defaults: []Role{RoleAdmin}},
+	{Key: PermUserRead, Description: "Look up other users (department-scoped roles: own department and sub-departments)", Defaults: []Role{RoleAdmin, RoleManager}},
+	{Key: PermUserMFAReset, Description: "Clear another user's two-factor authentication"},
+	{Key: PermDepartmentRead, Description: "View department details", Defaults: []Role{RoleAdmin}},
+	{Key: PermDepartmentWrite, Description: "Create, update and delete departments", Defaults: []Role{RoleAdmin}},
+	{Key: PermServerRead, Description: "View server list, status and host metrics", Defaults: []Role{RoleAdmin, RoleManager, RoleUser}},
+	{Key: PermServerControl, Description: "Start, stop and restart the OpenVPN server"},
+	{Key: PermServerConfigRead, Description: "View the OpenVPN server configuration"},
+	{Key: PermServerConfigWrite, Description: "Change the OpenVPN server configuration and port"},
+	{Key: PermLogsRead, Description: "Read server and client logs", Defaults: []Role{RoleAdmin}},
+	{Key: PermNotificationRead, Description: "Read and acknowledge notifications"},
+	{Key: PermQuotaRead, Description: "View traffic quotas", Defaults: []Role{RoleAdmin}},
+	{Key: PermQuotaWrite, Description: "Set traffic quotas", Defaults: []Role{RoleAdmin}},
+	{Key: PermCAManage, Description: "Manage the issuing CA and CA rotation"},
+	{Key: PermAuditRead, Description: "Query and export the audit log"},
+	{Key: PermIPAMRead, Description: "View tunnel IP address utilization and conflicts", Defaults: []Role{RoleAdmin}},
+	{Key: PermPermissionManage, Description: "Edit role permissions", Reserved: true},
+}
+
+// EditableRoles 权限可编辑的角色（superadmin 固定拥有全部权限）
+var EditableRoles = []Role{RoleAdmin, RoleManager, RoleUser}
+
+// LookupPermission 按标识查找注册表条目
+func LookupPermission(key string) (PermissionInfo, bool) {
+	for _, p := range PermissionRegistry {
+		if p.Key == key {
+			return p, true
+		}
+	}
+	return PermissionInfo{}, false
+}
+
+// RolePermission 角色拥有的一项权限
+type RolePermission struct {
+	Role       Role      `gorm:"primaryKey;size:20" json:"role"`
+	Permission string    `gorm:"primaryKey;size:64" json:"permission"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// RegisteredPermission 已按默认值授予过的权限，避免 superadmin 撤销后在重启时又被授予
+type RegisteredPermission struct {
+	Key       string `gorm:"primaryKey;size:64"`
+	CreatedAt time.Time
+}
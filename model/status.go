@@ -7,15 +7,24 @@ import (
 	"gorm.io/gorm"
 )
 
-// ClientLog records client connection status and usage
+// ClientLog records one VPN session of a client: opened when the client connects,
+// updated with traffic while online, closed (EndedAt set) when it disconnects.
 type ClientLog struct {
-	ID                 string    `gorm:"primaryKey;size:36"`
-	UserID             string    `gorm:"size:36;index"` // Indexed for faster lookups
-	IsOnline           bool
-	RealAddress        string    `gorm:"size:255;default:null"` // Added field for client's real address
-	OnlineDuration     int64 // in seconds
-	TrafficUsage       int64 // in bytes
-	LastConnectionTime *time.Time
+	ID                 string     `gorm:"primaryKey;size:36"`
+	UserID             string     `gorm:"size:36;index"` // Indexed for faster lookups
+	UserName           string     `gorm:"size:100"`      // CN at the time of the session, kept after user deletion
+	ClientID           string     `gorm:"size:20"`       // OpenVPN CID; with StartedAt identifies the session (duplicate-cn)
+	IsOnline           bool       // true while the session is still open
+	RealAddress        string     `gorm:"size:255;default:null"` // Added field for client's real address
+	VirtualAddress     string     `gorm:"size:45"`
+	BytesReceived      int64      // bytes received from the client
+	BytesSent          int64      // bytes sent to the client
+	Cipher             string     `gorm:"size:64"` // data channel cipher
+	OnlineDuration     int64      // in seconds
+	TrafficUsage       int64      // in bytes (received + sent)
+	LastConnectionTime *time.Time // last time the session was seen alive
+	StartedAt          *time.Time
+	EndedAt            *time.Time // nil while the session is open
 	CreatedAt          time.Time
 }
 
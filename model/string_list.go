@@ -0,0 +1,42 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strings"
+)
+
+// StringList 字符串列表，数据库中按行保存在文本列里，JSON 中为数组。空项与首尾空白在保存时去掉。
+type StringList []string
+
+// Value 实现 driver.Valuer
+func (l StringList) Value() (driver.Value, error) {
+	return strings.Join(l.Compact(), "\n"), nil
+}
+
+// Scan 实现 sql.Scanner
+func (l *StringList) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into StringList", src)
+	}
+	*l = StringList(strings.Split(s, "\n")).Compact()
+	return nil
+}
+
+// Compact 去掉空项与首尾空白
+func (l StringList) Compact() StringList {
+	var out StringList
+	for _, s := range l {
+		if s = strings.TrimSpace(s); s != "" {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// TrafficUsage accumulates one user's VPN traffic for one calendar day (server local time).
+// Daily/monthly quota consumption is summed from these rows.
+type TrafficUsage struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	UserID string `gorm:"size:36;not null;uniqueIndex:idx_traffic_usages_user_day"`
+	Day    string `gorm:"size:10;not null;uniqueIndex:idx_traffic_usages_user_day"` // YYYY-MM-DD
+	Bytes  int64  `gorm:"not null;default:0"`
+}
+
+// BeforeCreate sets a UUID primary key
+func (t *TrafficUsage) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.NewString()
+	return
+}
@@ -0,0 +1,40 @@
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// UserTokenPurpose 一次性令牌的用途
+type UserTokenPurpose string
+
+const (
+	// UserTokenVerifyEmail 邮箱验证链接
+	UserTokenVerifyEmail UserTokenPurpose = "verify_email"
+	// UserTokenResetPassword 重置密码链接
+	UserTokenResetPassword UserTokenPurpose = "reset_password"
+	// UserTokenMFAChallenge 登录两步验证挑战令牌的 jti，每个挑战令牌只能用一次
+	UserTokenMFAChallenge UserTokenPurpose = "mfa_challenge"
+)
+
+// UserToken 邮件链接里的一次性令牌。数据库只存 SHA-256，明文只出现在邮件中。
+type UserToken struct {
+	ID        string           `gorm:"primaryKey;size:36"`
+	UserID    string           `gorm:"size:36;not null;index"`
+	Purpose   UserTokenPurpose `gorm:"size:20;not null"`
+	TokenHash string           `gorm:"size:64;not null;uniqueIndex"`
+	// Email 签发时的邮箱：改过邮箱后，发往旧邮箱的验证链接不能验证新邮箱
+	Email     string    `gorm:"size:100;not null;default:''"`
+	ExpiresAt time.Time `gorm:"not null"`
+	// UsedAt 已使用时间，非空即失效
+	UsedAt    *time.Time
+	CreatedAt time.Time
+}
+
+// BeforeCreate 在创建记录前生成 UUID
+func (t *UserToken) BeforeCreate(tx *gorm.DB) (err error) {
+	t.ID = uuid.NewString()
+	return
+}
@@ -50,44 +50,51 @@ const unwrapData = <T>(body: any): T => {
   return body as T;
 };
 
+// 访问令牌只有 15 分钟有效期，由刷新令牌续期；刷新令牌每次使用后都会换新，
+// 旧的刷新令牌再被使用时后端会吊销整个会话。
+const TOKEN_COOKIE = "token";
+const REFRESH_TOKEN_COOKIE = "refreshToken";
+
+// 不携带访问令牌、401 时也不尝试刷新的接口
+const authFreeUrls = [
+  "/api/user/login",
+  "/api/user/register",
+  "/api/user/refresh",
+  "/api/user/verify-email",
+  "/api/user/forgot-password",
+  "/api/user/reset-password",
+];
+
+const isAuthFreeUrl = (url?: string) =>
+  !!url && authFreeUrls.some((u) => url.includes(u));
+
+// 保存登录 / 刷新接口返回的令牌对
+const storeTokens = (data?: { token?: string; refreshToken?: string }) => {
+  if (data?.token) {
+    Cookies.set(TOKEN_COOKIE, data.token, { expires: 7 });
+  }
+  if (data?.refreshToken) {
+    Cookies.set(REFRESH_TOKEN_COOKIE, data.refreshToken, { expires: 7 });
+  }
+};
+
+const clearTokens = () => {
+  Cookies.remove(TOKEN_COOKIE);
+  Cookies.remove(REFRESH_TOKEN_COOKIE);
+};
+
+// 进行中的刷新请求：并发的 401 与页面加载时的刷新共用同一次轮换，
+// 否则同一个刷新令牌被提交两次会被当作重放而吊销会话。
+let refreshing: Promise<ApiResponse<{ token: string; refreshToken: string }>> | null =
+  null;
+
 // 请求拦截器添加token
 api.interceptors.request.use(
-  async (config) => {
-    const excludedUrls = [
-      "/api/user/login",
-      "/api/user/register",
-      "/api/user/refresh",
-      "/api/user/verify-email",
-      "/api/user/forgot-password",
-      "/api/user/reset-password",
-    ];
-
-    // Check if the current request URL is one of the excluded URLs
-    if (config.url && !excludedUrls.some((url) => config.url!.includes(url))) {
-      try {
-        console.log("Attempting to refresh token for URL:", config.url);
-        const refreshResponse = await userAPI.refreshToken(); // userAPI is defined in the same file
-        if (!refreshResponse.success) {
-          console.warn("Token refresh failed, clearing login info.");
-          useUserStore.getState().clearLoginInfo(); // useUserStore needs to be imported
-          // Optional: redirect to login or throw an error to stop the request
-          // For now, letting it proceed will likely result in a 401, handled by response interceptor
-        } else {
-          console.log("Token refreshed successfully.");
-        }
-      } catch (error) {
-        console.error("Error during token refresh:", error);
-        useUserStore.getState().clearLoginInfo();
-        // Optional: redirect or throw
-      }
-    }
-
-    // Re-read token from cookies as refreshToken might have updated it
-    const token = Cookies.get("token");
-    if (token) {
+  (config) => {
+    const token = Cookies.get(TOKEN_COOKIE);
+    if (token && !isAuthFreeUrl(config.url)) {
       config.headers["Authorization"] = `Bearer ${token}`;
     } else {
-      // If no token (e.g., after clearLoginInfo), remove auth header
       delete config.headers["Authorization"];
     }
     return config;
@@ -98,28 +105,31 @@ api.interceptors.request.use(
   }
 );
 
-// 响应拦截器：处理 401 错误
+// 响应拦截器：401 时用刷新令牌换新的访问令牌并重试一次，刷新失败才清除登录态
 api.interceptors.response.use(
   (response) => response, // 正常返回
-  (error) => {
-    if (error.response?.status === 401) {
-      // Check if login info still exists before clearing
-      // This avoids redundant calls if the request interceptor already cleared it
-      const { isLogin } = useUserStore.getState();
-      if (isLogin) {
-        console.warn(
-          "Response interceptor: Unauthorized (401) and user was still logged in. Clearing login info..."
-        );
-        useUserStore.getState().clearLoginInfo();
-        // Consider redirecting to login page here as a fallback
-        // window.location.href = '/auth/login'; // or use Next.js router if available outside component context
-      } else {
-        console.warn(
-          "Response interceptor: Unauthorized (401), but user info already cleared."
-        );
+  async (error) => {
+    const original = error.config;
+    if (error.response?.status !== 401) {
+      return Promise.reject(error); // 继续抛出错误，供业务代码处理
+    }
+    if (
+      original &&
+      !original._retried &&
+      !isAuthFreeUrl(original.url) &&
+      Cookies.get(REFRESH_TOKEN_COOKIE)
+    ) {
+      original._retried = true;
+      const refreshed = await userAPI.refreshToken();
+      if (refreshed.success) {
+        return api(original);
       }
     }
-    return Promise.reject(error); // 继续抛出错误，供业务代码处理
+    if (useUserStore.getState().isLogin) {
+      console.warn("Unauthorized (401) and token refresh failed. Clearing login info...");
+      useUserStore.getState().clearLoginInfo();
+    }
+    return Promise.reject(error);
   }
 );
 
@@ -207,11 +217,11 @@ export const userAPI = {
   // 用户登录
   login: async (
     credentials: LoginCredentials
-  ): Promise<ApiResponse<{ user: User; token: string }>> => {
+  ): Promise<ApiResponse<{ user: User; token: string; refreshToken: string }>> => {
     try {
       const response = await api.post("/api/user/login", credentials);
-      if (response.data.success && response.data.data.token) {
-        Cookies.set("token", response.data.data.token, { expires: 7 });
+      if (response.data.success) {
+        storeTokens(response.data.data);
       }
       return response.data;
     } catch (error: any) {
@@ -222,20 +232,38 @@ export const userAPI = {
     }
   },
 
-  // Refresh token
-  refreshToken: async (): Promise<ApiResponse<{ token: string }>> => {
-    try {
-      const response = await api.get("/api/user/refresh");
-      if (response.data.success && response.data.data.token) {
-        Cookies.set("token", response.data.data.token, { expires: 7 });
-      }
-      return response.data;
-    } catch (error) {
-      return {
-        success: false,
-        error: "Token refresh failed",
-      };
+  // 用刷新令牌换取新的令牌对；并发调用共用同一次请求
+  refreshToken: async (): Promise<
+    ApiResponse<{ token: string; refreshToken: string }>
+  > => {
+    const refreshToken = Cookies.get(REFRESH_TOKEN_COOKIE);
+    if (!refreshToken) {
+      return { success: false, error: "Please login first" };
+    }
+    if (!refreshing) {
+      refreshing = api
+        .post("/api/user/refresh", { refreshToken })
+        .then((response) => {
+          if (response.data.success) {
+            storeTokens(response.data.data);
+          }
+          return response.data;
+        })
+        .catch((error) => {
+          // 刷新令牌无效、过期或被吊销：本地令牌已无用
+          if (error.response?.status === 401) {
+            clearTokens();
+          }
+          return {
+            success: false,
+            error: error.response?.data?.error || "Token refresh failed",
+          };
+        })
+        .finally(() => {
+          refreshing = null;
+        });
     }
+    return refreshing;
   },
 
   getEnterpriseById: async (id: string): Promise<ApiResponse<User>> => {
@@ -284,15 +312,15 @@ export const userAPI = {
   logout: async () => {
     try {
       const response = await api.post("/api/user/logout");
-      if (response.data.success) {
-        Cookies.remove("token");
-      }
       return response.data;
     } catch (error) {
       return {
         success: false,
         error: "Logout failed",
       };
+    } finally {
+      // 服务端吊销失败也要丢掉本地令牌
+      clearTokens();
     }
   },
 
@@ -39,8 +39,9 @@ export const useUserStore = create<UserState>()(
           isLogin: false,
           accessToken: "",
           user: {} as User, // 避免类型错误
-        }),
-          Cookies.remove("token");
+        });
+        Cookies.remove("token");
+        Cookies.remove("refreshToken");
       },
     }),
     {
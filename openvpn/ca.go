@@ -0,0 +1,516 @@
+package openvpn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"openvpn-admin-go/constants"
+	"openvpn-admin-go/openvpn/pki"
+	"openvpn-admin-go/utils"
+)
+
+// caLayout 一套 CA 的文件位置。当前签发 CA 用 constants 里的路径，轮换中的旧 CA
+// 在 constants.ServerCARetiringDir 下用同样的文件名。
+type caLayout struct {
+	dir     string
+	cert    string // 签发 CA 证书
+	key     string // 签发 CA 私钥
+	chain   string // 签发 CA 之上的各级证书（自签根 CA 时不存在）
+	rootCRL string // 离线根 CA 签发的 CRL（自签根 CA 时不存在）
+	dbDir   string // 签发记录目录（含旧 openssl ca 账本）
+}
+
+func (l caLayout) db() string {
+	return filepath.Join(l.dbDir, filepath.Base(constants.ServerPKIDBPath))
+}
+
+func (l caLayout) rotationState() string {
+	return filepath.Join(l.dir, "rotation.json")
+}
+
+// layoutIn 目录 dir 下按默认文件名组织的一套 CA
+func layoutIn(dir string) caLayout {
+	return caLayout{
+		dir:     dir,
+		cert:    filepath.Join(dir, filepath.Base(constants.ServerCACertPath)),
+		key:     filepath.Join(dir, filepath.Base(constants.ServerCAKeyPath)),
+		chain:   filepath.Join(dir, filepath.Base(constants.ServerCAChainPath)),
+		rootCRL: filepath.Join(dir, filepath.Base(constants.ServerRootCRLPath)),
+		dbDir:   filepath.Join(dir, filepath.Base(constants.ServerCRLDBDir)),
+	}
+}
+
+var (
+	currentCA = caLayout{
+		dir:     filepath.Dir(constants.ServerCACertPath),
+		cert:    constants.ServerCACertPath,
+		key:     constants.ServerCAKeyPath,
+		chain:   constants.ServerCAChainPath,
+		rootCRL: constants.ServerRootCRLPath,
+		dbDir:   constants.ServerCRLDBDir,
+	}
+	retiringCA = layoutIn(constants.ServerCARetiringDir)
+)
+
+// openLayout 打开一套 CA 与其签发记录。
+//
+// 迁移：签发记录首次创建时导入旧 openssl ca 账本（ca-db/index.txt、crlnumber），
+// 否则旧卷里已吊销的证书在新 CRL 中消失 = 被删用户重新能连。
+func openLayout(l caLayout) (*pki.PKI, error) {
+	p, err := pki.Open(l.cert, l.key, l.db())
+	if err != nil {
+		return nil, err
+	}
+	if !p.Store().Exists() {
+		indexPath := filepath.Join(l.dbDir, "index.txt")
+		if _, err := os.Stat(indexPath); err == nil {
+			n, err := p.Store().ImportOpenSSLIndex(indexPath, filepath.Join(l.dbDir, "crlnumber"))
+			if err != nil {
+				return nil, fmt.Errorf("导入旧 CA 数据库失败: %v", err)
+			}
+			fmt.Printf("已从 %s 导入 %d 条证书记录\n", indexPath, n)
+		}
+	}
+	return p, nil
+}
+
+// readChain 读取 CA 链文件，不存在时返回空
+func readChain(path string) ([]*x509.Certificate, error) {
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pki.ParseCertificatesPEM(raw)
+}
+
+// caSet 当前签发 CA，以及轮换期间仍受信任的旧 CA
+type caSet struct {
+	current  *pki.PKI
+	retiring *pki.PKI // 未在轮换时为 nil
+
+	layouts []caLayout
+	chains  [][]*x509.Certificate
+}
+
+func openCASet(cur, ret caLayout) (*caSet, error) {
+	s := &caSet{}
+	layouts := []caLayout{cur}
+	if utils.IsExists(ret.cert) {
+		layouts = append(layouts, ret)
+	}
+	for _, l := range layouts {
+		p, err := openLayout(l)
+		if err != nil {
+			return nil, err
+		}
+		chain, err := readChain(l.chain)
+		if err != nil {
+			return nil, fmt.Errorf("读取CA链失败: %v", err)
+		}
+		if s.current == nil {
+			s.current = p
+		} else {
+			s.retiring = p
+		}
+		s.layouts = append(s.layouts, l)
+		s.chains = append(s.chains, chain)
+	}
+	return s, nil
+}
+
+func (s *caSet) all() []*pki.PKI {
+	if s.retiring == nil {
+		return []*pki.PKI{s.current}
+	}
+	return []*pki.PKI{s.current, s.retiring}
+}
+
+// owner 签发 cert 的 CA；都不是时归到当前 CA（与迁移前未登记证书的处理一致）
+func (s *caSet) owner(cert *x509.Certificate) *pki.PKI {
+	for _, p := range s.all() {
+		if pki.IssuedBy(cert, p.CA().Cert) {
+			return p
+		}
+	}
+	return s.current
+}
+
+// trustBundle server.conf `ca` 与客户端 <ca> 的内容：各签发 CA 及其上级证书
+func (s *caSet) trustBundle() []byte {
+	var certs []*x509.Certificate
+	for i, p := range s.all() {
+		certs = append(certs, s.chains[i]...)
+		certs = append(certs, p.CA().Cert)
+	}
+	return pki.EncodeCertificatesPEM(certs...)
+}
+
+// crl crl-verify 文件：每个签发 CA 的 CRL 加上离线根 CA 的 CRL，拼成一个 PEM 文件
+func (s *caSet) crl() ([]byte, error) {
+	var buf bytes.Buffer
+	for i, p := range s.all() {
+		data, err := p.CRL(pki.DefaultCRLValidity)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(data)
+		rootCRL, err := os.ReadFile(s.layouts[i].rootCRL)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("读取根CA CRL失败: %v", err)
+		}
+		buf.Write(rootCRL)
+	}
+	return buf.Bytes(), nil
+}
+
+// write 原子重写 crl-verify 文件与信任集合
+func (s *caSet) write(crlPath, bundlePath string) error {
+	data, err := s.crl()
+	if err != nil {
+		return err
+	}
+	if err := pki.WriteFileAtomic(crlPath, data, 0644); err != nil {
+		return fmt.Errorf("写入 CRL 失败: %v", err)
+	}
+	if err := pki.WriteFileAtomic(bundlePath, s.trustBundle(), 0644); err != nil {
+		return fmt.Errorf("写入CA信任集合失败: %v", err)
+	}
+	return nil
+}
+
+// withCAs 在 PKI 锁内打开当前与轮换中的 CA 并执行 fn
+func withCAs(fn func(s *caSet) error) error {
+	unlock, err := lockPKI(currentCA.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	s, err := openCASet(currentCA, retiringCA)
+	if err != nil {
+		return fmt.Errorf("打开 CA 失败: %v", err)
+	}
+	return fn(s)
+}
+
+// writeServerFiles 重写 crl.pem 与 ca-bundle.crt（调用方持有 PKI 锁）
+func (s *caSet) writeServerFiles() error {
+	return s.write(constants.ServerCRLPath, constants.ServerCABundlePath)
+}
+
+// trustBundlePath server.conf `ca` 引用的文件：信任集合尚未生成（旧卷、未跑过 EnsureCRLSetup）时退回 ca.crt
+func trustBundlePath() string {
+	if utils.IsExists(constants.ServerCABundlePath) {
+		return constants.ServerCABundlePath
+	}
+	return constants.ServerCACertPath
+}
+
+// rotationState 轮换开始时写入 ca-retiring/rotation.json
+type rotationState struct {
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// CAInfo 一个签发 CA 的概况
+type CAInfo struct {
+	ID           string    `json:"id"`
+	Subject      string    `json:"subject"`
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	KeyAlgorithm string    `json:"keyAlgorithm"`
+	// Intermediate 为 true 表示由离线根 CA 签发，Root 为根 CA 的 CN
+	Intermediate bool   `json:"intermediate"`
+	Root         string `json:"root,omitempty"`
+}
+
+// CAStatus 当前签发 CA 与轮换状态
+type CAStatus struct {
+	Current   CAInfo     `json:"current"`
+	Rotating  bool       `json:"rotating"`
+	Retiring  *CAInfo    `json:"retiring,omitempty"`
+	StartedAt *time.Time `json:"startedAt,omitempty"`
+}
+
+func caInfo(ca *x509.Certificate, chain []*x509.Certificate) CAInfo {
+	info := CAInfo{
+		ID:           pki.CAID(ca),
+		Subject:      ca.Subject.CommonName,
+		NotBefore:    ca.NotBefore,
+		NotAfter:     ca.NotAfter,
+		KeyAlgorithm: ca.PublicKeyAlgorithm.String(),
+		Intermediate: !pki.IsSelfSigned(ca),
+	}
+	for _, c := range chain {
+		if pki.IsSelfSigned(c) {
+			info.Root = c.Subject.CommonName
+		}
+	}
+	return info
+}
+
+func readCAStatus(cur, ret caLayout) (*CAStatus, error) {
+	unlock, err := lockPKI(cur.dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	s, err := openCASet(cur, ret)
+	if err != nil {
+		return nil, err
+	}
+	status := &CAStatus{Current: caInfo(s.current.CA().Cert, s.chains[0])}
+	if s.retiring != nil {
+		info := caInfo(s.retiring.CA().Cert, s.chains[1])
+		status.Rotating = true
+		status.Retiring = &info
+		var st rotationState
+		if raw, err := os.ReadFile(ret.rotationState()); err == nil && json.Unmarshal(raw, &st) == nil {
+			status.StartedAt = &st.StartedAt
+		}
+	}
+	return status, nil
+}
+
+// GetCAStatus 当前签发 CA 与轮换状态
+func GetCAStatus() (*CAStatus, error) {
+	return readCAStatus(currentCA, retiringCA)
+}
+
+// CurrentCAID 当前签发 CA 的标识（pki.CAID），与其签发证书的 pki.AuthorityID 相同
+func CurrentCAID() (string, error) {
+	raw, err := os.ReadFile(constants.ServerCACertPath)
+	if err != nil {
+		return "", err
+	}
+	cert, err := pki.ParseCertificatePEM(raw)
+	if err != nil {
+		return "", err
+	}
+	return pki.CAID(cert), nil
+}
+
+// startRotation 把当前 CA 挪到 ret，next 成为新的签发 CA。
+//
+// 旧 CA 的证书、私钥、链与签发记录原样保留在 ret 下：轮换期间旧证书照常可连、照常可吊销，
+// crl.pem 与 ca-bundle.crt 同时覆盖新旧两套 CA。
+func startRotation(cur, ret caLayout, next *pki.CA, chain []*x509.Certificate, rootCRL []byte, now time.Time) error {
+	if utils.IsExists(ret.dir) {
+		return errors.New("已有进行中的 CA 轮换，请先退役旧 CA")
+	}
+	if err := next.Verify(chain); err != nil {
+		return err
+	}
+	if !pki.IsSelfSigned(next.Cert) {
+		if err := checkRootCRL(rootCRL, chain); err != nil {
+			return err
+		}
+	}
+	keyPEM, err := pki.EncodePrivateKeyPEM(next.Key)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockPKI(cur.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if _, err := openLayout(cur); err != nil {
+		return fmt.Errorf("打开当前 CA 失败: %v", err)
+	}
+	if err := os.MkdirAll(ret.dir, 0700); err != nil {
+		return fmt.Errorf("创建 %s 失败: %v", ret.dir, err)
+	}
+	// 旧 CA 的文件先复制再覆盖，签发记录整个目录搬走：当前路径上任何时刻都有一套完整的 CA
+	for _, f := range [][2]string{{cur.cert, ret.cert}, {cur.key, ret.key}, {cur.chain, ret.chain}, {cur.rootCRL, ret.rootCRL}} {
+		if !utils.IsExists(f[0]) {
+			continue
+		}
+		if err := copyFile(f[0], f[1]); err != nil {
+			return err
+		}
+	}
+	if err := os.Chmod(ret.key, 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(cur.dbDir, ret.dbDir); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("移动签发记录失败: %v", err)
+	}
+	if err := os.MkdirAll(cur.dbDir, 0755); err != nil {
+		return err
+	}
+
+	if err := pki.WriteFileAtomic(cur.key, keyPEM, 0600); err != nil {
+		return fmt.Errorf("写入CA密钥失败: %v", err)
+	}
+	if err := pki.WriteFileAtomic(cur.cert, pki.EncodeCertificatePEM(next.Cert), 0644); err != nil {
+		return fmt.Errorf("写入CA证书失败: %v", err)
+	}
+	if err := replaceOptional(cur.chain, pki.EncodeCertificatesPEM(chain...)); err != nil {
+		return fmt.Errorf("写入CA链失败: %v", err)
+	}
+	if err := replaceOptional(cur.rootCRL, rootCRL); err != nil {
+		return fmt.Errorf("写入根CA CRL失败: %v", err)
+	}
+	state, _ := json.Marshal(rotationState{StartedAt: now})
+	if err := os.WriteFile(ret.rotationState(), state, 0644); err != nil {
+		return err
+	}
+	return nil
+}
+
+// retireRotation 用当前 CA 重签服务端证书，把 ret 归档为 ca-retired-<时间>，
+// 之后 crl.pem / ca-bundle.crt 只含当前 CA，旧 CA 签发的证书不再被信任。
+func retireRotation(cur, ret caLayout, serverCert, serverKey string, alg pki.KeyAlgorithm, now time.Time) error {
+	unlock, err := lockPKI(cur.dir)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if !utils.IsExists(ret.dir) {
+		return errors.New("没有进行中的 CA 轮换")
+	}
+	p, err := openLayout(cur)
+	if err != nil {
+		return fmt.Errorf("打开当前 CA 失败: %v", err)
+	}
+	cn := "OpenVPN-Server"
+	if raw, err := os.ReadFile(serverCert); err == nil {
+		if old, err := pki.ParseCertificatePEM(raw); err == nil && old.Subject.CommonName != "" {
+			cn = old.Subject.CommonName
+		}
+	}
+	issued, err := p.IssueServer(cn, pki.DefaultClientValidity, alg)
+	if err != nil {
+		return fmt.Errorf("签发服务端证书失败: %v", err)
+	}
+	if err := pki.WriteFileAtomic(serverKey, issued.KeyPEM, 0600); err != nil {
+		return fmt.Errorf("写入服务器密钥失败: %v", err)
+	}
+	if err := pki.WriteFileAtomic(serverCert, issued.CertPEM, 0644); err != nil {
+		return fmt.Errorf("写入服务器证书失败: %v", err)
+	}
+	archive := filepath.Join(filepath.Dir(ret.dir), "ca-retired-"+now.Format("20060102150405"))
+	if err := os.Rename(ret.dir, archive); err != nil {
+		return fmt.Errorf("归档旧 CA 失败: %v", err)
+	}
+	fmt.Printf("旧 CA 已归档到 %s\n", archive)
+	return nil
+}
+
+// checkRootCRL 中间 CA 必须附带根 CA 签发的 CRL（见 pki.RootCRL）
+func checkRootCRL(data []byte, chain []*x509.Certificate) error {
+	if len(data) == 0 {
+		return errors.New("中间CA需要附带根CA签发的CRL")
+	}
+	crl, err := pki.ParseCRLPEM(data)
+	if err != nil {
+		return fmt.Errorf("解析根CA CRL失败: %v", err)
+	}
+	for _, c := range chain {
+		if pki.IsSelfSigned(c) && crl.CheckSignatureFrom(c) == nil {
+			return nil
+		}
+	}
+	return errors.New("CRL 不是由根CA签发的")
+}
+
+// replaceOptional data 为空时删除 path，否则原子写入
+func replaceOptional(path string, data []byte) error {
+	if len(data) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return pki.WriteFileAtomic(path, data, 0644)
+}
+
+// applyCAChange 轮换开始 / 结束后重写 crl.pem、ca-bundle.crt，重新渲染 server.conf 与所有 .ovpn
+// 并重启 OpenVPN（`ca` 文件只在启动时读取）
+func applyCAChange() error {
+	if err := withCAs(func(s *caSet) error { return s.writeServerFiles() }); err != nil {
+		return err
+	}
+	return UpdateServerConfig()
+}
+
+// NewIntermediateCSR 生成中间 CA 私钥（存为 ca-pending.key）与 CSR。CSR 交给离线根 CA 签名后，
+// 用 StartCARotationWithIntermediate 导入签好的证书。
+func NewIntermediateCSR(commonName string, alg pki.KeyAlgorithm) ([]byte, error) {
+	if commonName == "" {
+		commonName = "OpenVPN-Intermediate-CA-" + time.Now().Format("20060102")
+	}
+	key, csr, err := pki.NewIntermediateRequest(commonName, alg)
+	if err != nil {
+		return nil, err
+	}
+	keyPEM, err := pki.EncodePrivateKeyPEM(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := pki.WriteFileAtomic(constants.ServerCAPendingKeyPath, keyPEM, 0600); err != nil {
+		return nil, fmt.Errorf("写入中间CA私钥失败: %v", err)
+	}
+	return csr, nil
+}
+
+// StartCARotationWithIntermediate 以离线根 CA 签发的中间 CA（私钥为 NewIntermediateCSR 生成的
+// ca-pending.key）开始轮换。chainPEM 为中间 CA 之上的证书（至少含根 CA），rootCRLPEM 为根 CA
+// 签发的 CRL。
+func StartCARotationWithIntermediate(certPEM, chainPEM, rootCRLPEM []byte) error {
+	cert, err := pki.ParseCertificatePEM(certPEM)
+	if err != nil {
+		return fmt.Errorf("解析中间CA证书失败: %v", err)
+	}
+	chain, err := pki.ParseCertificatesPEM(chainPEM)
+	if err != nil {
+		return fmt.Errorf("解析CA链失败: %v", err)
+	}
+	keyPEM, err := os.ReadFile(constants.ServerCAPendingKeyPath)
+	if err != nil {
+		return fmt.Errorf("读取中间CA私钥失败（请先生成 CSR）: %v", err)
+	}
+	key, err := pki.ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return fmt.Errorf("解析中间CA私钥失败: %v", err)
+	}
+	if err := startRotation(currentCA, retiringCA, &pki.CA{Cert: cert, Key: key}, chain, rootCRLPEM, time.Now()); err != nil {
+		return err
+	}
+	os.Remove(constants.ServerCAPendingKeyPath)
+	return applyCAChange()
+}
+
+// StartCARotation 生成 alg 算法的新自签 CA 并开始轮换
+func StartCARotation(alg pki.KeyAlgorithm) error {
+	next, _, err := pki.NewCA("OpenVPN-CA-"+time.Now().Format("20060102"), pki.DefaultCAValidity, alg)
+	if err != nil {
+		return err
+	}
+	if err := startRotation(currentCA, retiringCA, next, nil, nil, time.Now()); err != nil {
+		return err
+	}
+	return applyCAChange()
+}
+
+// RetireCA 结束轮换：用新 CA 重签服务端证书、停止信任旧 CA 并重启 OpenVPN。
+// 仍在使用旧证书的客户端此后无法连接，调用方负责确认所有人都已换上新证书。
+func RetireCA() error {
+	cfg, err := LoadConfig()
+	if err != nil {
+		return fmt.Errorf("加载配置失败: %v", err)
+	}
+	if err := retireRotation(currentCA, retiringCA, constants.ServerCertPath, constants.ServerKeyPath, cfg.KeyAlgorithm(), time.Now()); err != nil {
+		return err
+	}
+	return applyCAChange()
+}
@@ -0,0 +1,138 @@
+package openvpn
+
+import (
+	"bytes"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"openvpn-admin-go/openvpn/pki"
+)
+
+// writeTestCA 在 l 下写入一套自签 CA（模拟轮换前的旧卷）
+func writeTestCA(t *testing.T, l caLayout) *pki.CA {
+	t.Helper()
+	ca, files, err := pki.NewCA("OpenVPN-CA", 24*time.Hour, pki.KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(l.dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(l.cert, files.CertPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(l.key, files.KeyPEM, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func TestCARotationWithIntermediate(t *testing.T) {
+	base := t.TempDir()
+	cur := layoutIn(filepath.Join(base, "server"))
+	ret := layoutIn(filepath.Join(base, "server", "ca-retiring"))
+	oldCA := writeTestCA(t, cur)
+
+	p, err := openLayout(cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := p.IssueClient("alice", time.Hour, pki.KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, _, _ := pki.NewCA("Offline-Root", 24*time.Hour, pki.KeyECDSAP256)
+	inter, _, err := pki.NewIntermediate(root, "Online-Intermediate", time.Hour, pki.KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootCRL, _ := pki.RootCRL(root, 0)
+	chain := []*x509.Certificate{root.Cert}
+
+	if err := startRotation(cur, ret, inter, chain, nil, time.Now()); err == nil {
+		t.Fatal("intermediate without root CRL must be rejected")
+	}
+	if err := startRotation(cur, ret, inter, chain, rootCRL, time.Now()); err != nil {
+		t.Fatalf("startRotation failed: %v", err)
+	}
+	if err := startRotation(cur, ret, inter, chain, rootCRL, time.Now()); err == nil {
+		t.Fatal("a second rotation must be rejected while one is in progress")
+	}
+
+	status, err := readCAStatus(cur, ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Rotating || status.StartedAt == nil || status.Retiring.ID != pki.CAID(oldCA.Cert) {
+		t.Errorf("unexpected status %+v", status)
+	}
+	if status.Current.ID != pki.CAID(inter.Cert) || !status.Current.Intermediate || status.Current.Root != "Offline-Root" {
+		t.Errorf("unexpected current CA %+v", status.Current)
+	}
+
+	s, err := openCASet(cur, ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 旧证书记在旧 CA 名下，吊销写进旧 CA 的 CRL
+	if s.owner(alice.Cert) != s.retiring {
+		t.Fatal("old certificate must belong to the retiring CA")
+	}
+	if _, ok := s.retiring.Store().Lookup(pki.SerialHex(alice.Cert.SerialNumber)); !ok {
+		t.Error("issued records must move with the retiring CA")
+	}
+	if err := s.owner(alice.Cert).Revoke(alice.Cert, pki.ReasonSuperseded); err != nil {
+		t.Fatal(err)
+	}
+	crlPath, bundlePath := filepath.Join(base, "crl.pem"), filepath.Join(base, "ca-bundle.crt")
+	if err := s.write(crlPath, bundlePath); err != nil {
+		t.Fatal(err)
+	}
+	raw, _ := os.ReadFile(crlPath)
+	if n := bytes.Count(raw, []byte("BEGIN X509 CRL")); n != 3 {
+		t.Errorf("CRL bundle has %d CRLs, want 3 (intermediate, root, old CA)", n)
+	}
+	raw, _ = os.ReadFile(bundlePath)
+	trusted, _ := pki.ParseCertificatesPEM(raw)
+	if len(trusted) != 3 {
+		t.Errorf("trust bundle has %d certs during rotation, want 3", len(trusted))
+	}
+
+	serverCert, serverKey := filepath.Join(base, "server.crt"), filepath.Join(base, "server.key")
+	if err := retireRotation(cur, ret, serverCert, serverKey, pki.KeyECDSAP256, time.Now()); err != nil {
+		t.Fatalf("retireRotation failed: %v", err)
+	}
+	if _, err := os.Stat(ret.dir); !os.IsNotExist(err) {
+		t.Error("retiring directory must be archived")
+	}
+	raw, _ = os.ReadFile(serverCert)
+	server, err := pki.ParseCertificatePEM(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	inters := x509.NewCertPool()
+	inters.AddCert(inter.Cert)
+	if _, err := server.Verify(x509.VerifyOptions{Roots: roots, Intermediates: inters, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+		t.Errorf("server certificate not issued by the new CA: %v", err)
+	}
+
+	s, err = openCASet(cur, ret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.retiring != nil {
+		t.Error("retired CA must no longer be loaded")
+	}
+	if got := len(s.all()); got != 1 {
+		t.Errorf("%d CAs after retirement", got)
+	}
+	if err := retireRotation(cur, ret, serverCert, serverKey, pki.KeyECDSAP256, time.Now()); err == nil {
+		t.Error("retiring without a rotation must fail")
+	}
+}
@@ -4,216 +4,477 @@ import (
 	"encoding/binary"
 	"fmt"
 	"net"
-	"openvpn-admin-go/logging"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/openvpn/pki"
+)
+
+// ccdHeader 渲染出的 CCD 文件首行：文件整体由数据库生成，手工修改会在下次保存时被覆盖
+const ccdHeader = "# Managed by openvpn-admin-go. Manual edits are overwritten; use the client network API instead."
+
+// ClientCCD 一个客户端 CCD 文件的全部内容。RenderClientCCD 据此生成整个文件，
+// 不再逐行修补已有内容。
+type ClientCCD struct {
+	// FixedIP 固定分配的隧道地址（ifconfig-push）
+	FixedIP string `json:"fixedIp"`
+	// FixedIPv6 固定分配的 IPv6 隧道地址（ifconfig-ipv6-push），需要服务端配置了 IPv6 前缀
+	FixedIPv6 string `json:"fixedIpv6"`
+	// Subnet 客户端背后的网络（iroute，CIDR）
+	Subnet string `json:"subnet"`
+	// PushReset 不继承服务端的全局 push（路由、DNS 等），只使用这里的设置
+	PushReset bool `json:"pushReset"`
+	// Routes 推送给客户端的路由（CIDR，IPv6 路由以 route-ipv6 推送）
+	Routes []string `json:"routes"`
+	// DNSServers 推送的 DNS 服务器
+	DNSServers []string `json:"dnsServers"`
+	// SearchDomains 推送的搜索域，第一个同时作为 DOMAIN
+	SearchDomains []string `json:"searchDomains"`
+	// RedirectGateway 全部流量走 VPN，值为 redirect-gateway 的参数（如 "def1 bypass-dhcp"），空表示不推送
+	RedirectGateway string `json:"redirectGateway"`
+	// Directives 其他指令，须通过 ValidateCCDDirective 校验
+	Directives []string `json:"directives"`
+}
+
+// Empty 没有任何设置时不需要 CCD 文件
+func (c *ClientCCD) Empty() bool {
+	return c.FixedIP == "" && c.FixedIPv6 == "" && c.Subnet == "" && !c.PushReset && len(c.Routes) == 0 && len(c.DNSServers) == 0 &&
+		len(c.SearchDomains) == 0 && c.RedirectGateway == "" && len(c.Directives) == 0
+}
+
+// redirectGatewayFlags redirect-gateway 允许的参数
+var redirectGatewayFlags = map[string]bool{
+	"local": true, "autolocal": true, "def1": true, "bypass-dhcp": true, "bypass-dns": true,
+	"block-local": true, "ipv6": true, "!ipv4": true,
+}
+
+// ccdDirectives Directives 中允许的 CCD 指令；ifconfig-push、iroute、push-reset 由结构化字段生成
+var ccdDirectives = map[string]bool{"push": true, "push-remove": true, "inactive": true}
+
+// pushableOptions push "…" 中允许推送的选项
+var pushableOptions = map[string]bool{
+	"route": true, "route-ipv6": true, "route-metric": true, "dhcp-option": true,
+	"redirect-gateway": true, "redirect-private": true, "block-outside-dns": true, "block-ipv6": true,
+	"register-dns": true, "ping": true, "ping-restart": true, "inactive": true,
+}
+
+var (
+	ccdDirectiveRe = regexp.MustCompile(`^([a-z][a-z0-9-]*)(?: (.*))?$`)
+	ccdPushRe      = regexp.MustCompile(`^"([a-z][a-z0-9-]*)((?: [^"\\\s]+)*)"$`)
+	ccdArgRe       = regexp.MustCompile(`^[A-Za-z0-9.:/_!-]+$`)
+	domainRe       = regexp.MustCompile(`^(?i)[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?(\.[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?)*$`)
 )
 
-// SetClientFixedIP creates or updates a client-specific configuration file (CCD)
-// to assign a fixed IP address to a client.
-// commonName is typically the user's ID.
-// ipAddress is the fixed IP to assign.
-// This function will fetch the serverNetmask from the main OpenVPN configuration.
-func SetClientFixedIP(commonName string, ipAddress string) error {
-	if commonName == "" {
-		return fmt.Errorf("commonName cannot be empty")
+// ValidateCCDDirective 校验一条附加指令：只允许 push（限定可推送的选项）、push-remove 与 inactive，
+// 参数只能是简单的单词（地址、数字、选项名），不能含引号、换行或内联块。
+func ValidateCCDDirective(line string) error {
+	if line != strings.TrimSpace(line) || strings.ContainsAny(line, "\r\n\t<>'`\\") {
+		return fmt.Errorf("directive %q contains forbidden characters", line)
 	}
-	if ipAddress == "" {
-		return fmt.Errorf("ipAddress cannot be empty")
+	m := ccdDirectiveRe.FindStringSubmatch(line)
+	if m == nil {
+		return fmt.Errorf("malformed directive %q", line)
 	}
+	name, args := m[1], m[2]
+	switch name {
+	case "ifconfig-push", "ifconfig-ipv6-push", "iroute", "push-reset":
+		return fmt.Errorf("%s is generated from the structured fields, not a free directive", name)
+	}
+	if !ccdDirectives[name] {
+		return fmt.Errorf("directive %s is not allowed in a client config", name)
+	}
+	if name == "push" {
+		p := ccdPushRe.FindStringSubmatch(args)
+		if p == nil {
+			return fmt.Errorf(`push must be written as push "option args"`)
+		}
+		if !pushableOptions[p[1]] {
+			return fmt.Errorf("pushing %s is not allowed", p[1])
+		}
+		args = strings.TrimSpace(p[2])
+	} else if args == "" {
+		return fmt.Errorf("%s requires an argument", name)
+	}
+	for _, a := range strings.Fields(args) {
+		if !ccdArgRe.MatchString(a) {
+			return fmt.Errorf("argument %q of %s is not allowed", a, name)
+		}
+	}
+	return nil
+}
 
-	cfg, err := LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+// Validate 校验全部字段（固定 IP 是否在服务端网段内由 ValidateFixedIP / ValidateFixedIPv6 校验）
+func (c *ClientCCD) Validate() error {
+	if c.FixedIP != "" {
+		if ip := net.ParseIP(c.FixedIP); ip == nil || ip.To4() == nil {
+			return fmt.Errorf("only IPv4 addresses are supported for fixed assignments: %s", c.FixedIP)
+		}
+	}
+	if c.FixedIPv6 != "" {
+		if ip := net.ParseIP(c.FixedIPv6); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid fixed IPv6 address: %s", c.FixedIPv6)
+		}
+	}
+	if c.Subnet != "" {
+		if _, err := parseIPv4CIDR(c.Subnet); err != nil {
+			return fmt.Errorf("invalid subnet: %w", err)
+		}
+	}
+	for _, r := range c.Routes {
+		if _, err := parseRouteCIDR(r); err != nil {
+			return fmt.Errorf("invalid route: %w", err)
+		}
+	}
+	for _, d := range c.DNSServers {
+		if net.ParseIP(d) == nil {
+			return fmt.Errorf("invalid DNS server address: %s", d)
+		}
 	}
+	for _, d := range c.SearchDomains {
+		if len(d) > 253 || !domainRe.MatchString(d) {
+			return fmt.Errorf("invalid search domain: %s", d)
+		}
+	}
+	for _, f := range strings.Fields(c.RedirectGateway) {
+		if !redirectGatewayFlags[f] {
+			return fmt.Errorf("invalid redirect-gateway flag: %s", f)
+		}
+	}
+	for _, d := range c.Directives {
+		if err := ValidateCCDDirective(d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if cfg.OpenVPNClientConfigDir == "" {
-		return fmt.Errorf("OpenVPNClientConfigDir is not set in the configuration")
+// parseIPv4CIDR 解析 IPv4 CIDR，要求地址就是网络地址（10.0.1.0/24 而不是 10.0.1.5/24）
+func parseIPv4CIDR(cidr string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("%s is not an IPv4 CIDR", cidr)
 	}
+	if !ip.Equal(ipNet.IP) {
+		return nil, fmt.Errorf("%s is not a network address (did you mean %s?)", cidr, ipNet.String())
+	}
+	return ipNet, nil
+}
+
+// ValidateFixedIP 校验固定 IP 在服务端网段内，且不是网络地址或广播地址
+func ValidateFixedIP(cfg *Config, ipAddress string) error {
 	if cfg.OpenVPNServerNetmask == "" {
 		return fmt.Errorf("OpenVPNServerNetmask is not set in the configuration")
 	}
-
 	parsedIP := net.ParseIP(ipAddress)
 	if parsedIP == nil {
 		return fmt.Errorf("invalid IP address format: %s", ipAddress)
 	}
-
 	ipv4 := parsedIP.To4()
 	if ipv4 == nil {
 		return fmt.Errorf("only IPv4 addresses are supported for fixed assignments: %s", ipAddress)
 	}
-
 	ipNet, broadcast, err := serverNetwork(cfg)
 	if err != nil {
 		return err
 	}
-
 	if !ipNet.Contains(ipv4) {
 		return fmt.Errorf("fixed IP %s is outside of the server network %s/%s", ipAddress, cfg.OpenVPNServerNetwork, cfg.OpenVPNServerNetmask)
 	}
-
 	if ipv4.Equal(ipNet.IP) {
 		return fmt.Errorf("fixed IP %s cannot be the network address", ipAddress)
 	}
-
 	if broadcast != nil && ipv4.Equal(broadcast) {
 		return fmt.Errorf("fixed IP %s cannot be the broadcast address", ipAddress)
 	}
+	return nil
+}
 
-	// Ensure the CCD directory exists
-	ccdDir := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd")
-	if err := os.MkdirAll(ccdDir, 0755); err != nil {
-		return fmt.Errorf("failed to create ccd directory '%s': %w", ccdDir, err)
+// ValidateIPPool 校验固定 IP 范围：起止地址都是服务端网段内可分配的地址，起始不大于结束，
+// 且整个范围在 StaticAddressRange 内（不与 OpenVPN 的动态地址池重叠）
+func ValidateIPPool(cfg *Config, start, end string) error {
+	if start == "" && end == "" {
+		return nil
 	}
+	if start == "" || end == "" {
+		return fmt.Errorf("both start and end of the IP pool are required")
+	}
+	for _, ip := range []string{start, end} {
+		if err := ValidateFixedIP(cfg, ip); err != nil {
+			return fmt.Errorf("invalid IP pool: %w", err)
+		}
+	}
+	if ipv4ToUint(net.ParseIP(start)) > ipv4ToUint(net.ParseIP(end)) {
+		return fmt.Errorf("IP pool start %s is after its end %s", start, end)
+	}
+	staticStart, staticEnd, err := StaticAddressRange(cfg)
+	if err != nil {
+		return err
+	}
+	if !IPInPool(start, staticStart, staticEnd) || !IPInPool(end, staticStart, staticEnd) {
+		return fmt.Errorf("IP pool %s-%s overlaps the dynamic address pool; it must be within %s-%s", start, end, staticStart, staticEnd)
+	}
+	return nil
+}
+
+// IPInPool ip 是否在 [start, end] 范围内；范围为空时不限制
+func IPInPool(ip, start, end string) bool {
+	if start == "" || end == "" {
+		return true
+	}
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() == nil {
+		return false
+	}
+	v := ipv4ToUint(parsed)
+	return v >= ipv4ToUint(net.ParseIP(start)) && v <= ipv4ToUint(net.ParseIP(end))
+}
 
-	ccdFilePath := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName)
-	newConfig := fmt.Sprintf("ifconfig-push %s %s", ipAddress, cfg.OpenVPNServerNetmask)
+func ipv4ToUint(ip net.IP) uint32 {
+	if ip4 := ip.To4(); ip4 != nil {
+		return binary.BigEndian.Uint32(ip4)
+	}
+	return 0
+}
 
-	// 读取现有文件内容
-	var existingContent string
-	if _, err := os.Stat(ccdFilePath); err == nil {
-		content, err := os.ReadFile(ccdFilePath)
+// RenderClientCCD 生成完整的 CCD 文件内容。push-reset 会连同 topology、route-gateway 与 keepalive
+// 推送一起清掉，这里按服务端配置重新推送，否则 topology subnet 的客户端无法建立隧道。
+func RenderClientCCD(c *ClientCCD, cfg *Config) (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+	lines := []string{ccdHeader}
+	if c.FixedIP != "" {
+		if err := ValidateFixedIP(cfg, c.FixedIP); err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf("ifconfig-push %s %s", c.FixedIP, cfg.OpenVPNServerNetmask))
+	}
+	if c.FixedIPv6 != "" {
+		if err := ValidateFixedIPv6(cfg, c.FixedIPv6); err != nil {
+			return "", err
+		}
+		ipNet, server, _ := ServerIPv6Network(cfg)
+		bits, _ := ipNet.Mask.Size()
+		lines = append(lines, fmt.Sprintf("ifconfig-ipv6-push %s/%d %s", net.ParseIP(c.FixedIPv6), bits, server))
+	}
+	if c.Subnet != "" {
+		subnetWithMask, err := cidrToNetmask(c.Subnet)
 		if err != nil {
-			return fmt.Errorf("failed to read existing config file: %w", err)
+			return "", fmt.Errorf("failed to convert subnet format: %w", err)
 		}
-		existingContent = string(content)
-	}
-
-	// 处理现有配置
-	lines := strings.Split(existingContent, "\n")
-	newLines := make([]string, 0)
-	configAdded := false
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmedLine, "ifconfig-push") {
-			// 替换已存在的ifconfig-push配置
-			newLines = append(newLines, newConfig)
-			configAdded = true
-		} else if strings.HasPrefix(trimmedLine, "iroute") {
-			// 保留iroute配置
-			newLines = append(newLines, line)
-		} else if trimmedLine != "" {
-			// 保留其他配置
-			newLines = append(newLines, line)
+		lines = append(lines, "iroute "+subnetWithMask)
+	}
+	if c.PushReset {
+		ipNet, _, err := serverNetwork(cfg)
+		if err != nil {
+			return "", err
 		}
+		gateway := make(net.IP, len(ipNet.IP))
+		binary.BigEndian.PutUint32(gateway, binary.BigEndian.Uint32(ipNet.IP)+1)
+		lines = append(lines,
+			"push-reset",
+			`push "topology subnet"`,
+			fmt.Sprintf(`push "route-gateway %s"`, gateway),
+			`push "ping 10"`,
+			`push "ping-restart 120"`,
+		)
+	}
+	for _, r := range c.Routes {
+		if strings.Contains(r, ":") {
+			lines = append(lines, fmt.Sprintf(`push "route-ipv6 %s"`, r))
+			continue
+		}
+		route, err := cidrToNetmask(r)
+		if err != nil {
+			return "", err
+		}
+		lines = append(lines, fmt.Sprintf(`push "route %s"`, route))
 	}
-
-	// 如果没有找到ifconfig-push配置，添加新的配置
-	if !configAdded {
-		newLines = append(newLines, newConfig)
+	for _, d := range c.DNSServers {
+		opt := "DNS"
+		if net.ParseIP(d).To4() == nil {
+			opt = "DNS6"
+		}
+		lines = append(lines, fmt.Sprintf(`push "dhcp-option %s %s"`, opt, d))
 	}
+	for i, d := range c.SearchDomains {
+		if i == 0 {
+			lines = append(lines, fmt.Sprintf(`push "dhcp-option DOMAIN %s"`, d))
+		}
+		lines = append(lines, fmt.Sprintf(`push "dhcp-option DOMAIN-SEARCH %s"`, d))
+	}
+	if c.RedirectGateway != "" {
+		lines = append(lines, fmt.Sprintf(`push "redirect-gateway %s"`, strings.Join(strings.Fields(c.RedirectGateway), " ")))
+	}
+	lines = append(lines, c.Directives...)
+	return strings.Join(lines, "\n") + "\n", nil
+}
 
-	// 写入更新后的内容
-	content := strings.Join(newLines, "\n")
-	if content != "" {
-		content += "\n"
+// ccdPath 客户端 CCD 文件路径
+func ccdPath(cfg *Config, commonName string) (string, error) {
+	if commonName == "" || strings.ContainsAny(commonName, `/\`) || commonName == "." || commonName == ".." {
+		return "", fmt.Errorf("invalid common name %q", commonName)
 	}
+	if cfg.OpenVPNClientConfigDir == "" {
+		return "", fmt.Errorf("OpenVPNClientConfigDir is not set in the configuration")
+	}
+	return filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName), nil
+}
 
-	err = os.WriteFile(ccdFilePath, []byte(content), 0644)
+// WriteClientCCD 用 c 整体替换客户端的 CCD 文件（原子写入）；没有任何设置时删除文件。
+// 新设置在客户端下次连接时生效。
+func WriteClientCCD(commonName string, c *ClientCCD) error {
+	cfg, err := LoadConfig()
 	if err != nil {
-		return fmt.Errorf("failed to write client fixed IP config file '%s': %w", ccdFilePath, err)
+		return fmt.Errorf("failed to load OpenVPN configuration: %w", err)
 	}
-
-	logging.Info("Successfully set fixed IP for %s to %s in %s", commonName, ipAddress, ccdFilePath)
+	if c.Empty() {
+		return removeClientCCD(cfg, commonName)
+	}
+	path, err := ccdPath(cfg, commonName)
+	if err != nil {
+		return err
+	}
+	content, err := RenderClientCCD(c, cfg)
+	if err != nil {
+		return err
+	}
+	if err := pki.WriteFileAtomic(path, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write client config file '%s': %w", path, err)
+	}
+	logging.Info("Client config for %s written to %s", commonName, path)
 	return nil
 }
 
-// RemoveClientFixedIP removes the client-specific configuration file (CCD)
-// for the given commonName, effectively removing their fixed IP assignment.
-func RemoveClientFixedIP(commonName string) error {
-	if commonName == "" {
-		return fmt.Errorf("commonName cannot be empty")
-	}
-
+// RemoveClientCCD 删除客户端的 CCD 文件（不存在时视为成功）
+func RemoveClientCCD(commonName string) error {
 	cfg, err := LoadConfig()
 	if err != nil {
 		return fmt.Errorf("failed to load OpenVPN configuration: %w", err)
 	}
+	return removeClientCCD(cfg, commonName)
+}
 
+func removeClientCCD(cfg *Config, commonName string) error {
 	if cfg.OpenVPNClientConfigDir == "" {
-		// If the directory isn't set, there's nothing to remove.
-		// Depending on desired strictness, this could be an error or a silent success.
 		logging.Debug("OpenVPNClientConfigDir is not set, skipping removal for %s", commonName)
 		return nil
 	}
-
-	ccdFilePath := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName)
-
-	// Check if the file exists before trying to remove it
-	if _, err := os.Stat(ccdFilePath); os.IsNotExist(err) {
-		// File doesn't exist, so consider it successfully "removed"
-		logging.Debug("CCD file for %s does not exist at %s, no action needed.", commonName, ccdFilePath)
-		return nil
-	} else if err != nil {
-		// Other error during stat
-		return fmt.Errorf("failed to check client fixed IP config file '%s': %w", ccdFilePath, err)
-	}
-
-	err = os.Remove(ccdFilePath)
+	path, err := ccdPath(cfg, commonName)
 	if err != nil {
-		return fmt.Errorf("failed to remove client fixed IP config file '%s': %w", ccdFilePath, err)
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove client config file '%s': %w", path, err)
 	}
-
-	logging.Info("Successfully removed fixed IP config for %s from %s", commonName, ccdFilePath)
 	return nil
 }
 
-// GetClientFixedIP reads the fixed IP address from a client-specific configuration file.
-// It returns the IP address string if found, or an empty string if not found or on error.
-func GetClientFixedIP(commonName string) (string, error) {
-	if commonName == "" {
-		return "", fmt.Errorf("commonName cannot be empty")
-	}
-
+// ReadClientCCD 读取并解析现有的 CCD 文件（导入旧版本或手工写的文件），文件不存在时返回 nil
+func ReadClientCCD(commonName string) (*ClientCCD, error) {
 	cfg, err := LoadConfig()
 	if err != nil {
-		return "", fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+		return nil, fmt.Errorf("failed to load OpenVPN configuration: %w", err)
 	}
-
 	if cfg.OpenVPNClientConfigDir == "" {
-		logging.Debug("OpenVPNClientConfigDir is not set, cannot get fixed IP for %s", commonName)
-		return "", nil // Or return an error: fmt.Errorf("OpenVPNClientConfigDir is not set")
+		return nil, nil
 	}
-
-	ccdFilePath := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName)
-
-	if _, err := os.Stat(ccdFilePath); os.IsNotExist(err) {
-		// File doesn't exist, no fixed IP assigned
-		return "", nil
+	path, err := ccdPath(cfg, commonName)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
 	} else if err != nil {
-		return "", fmt.Errorf("failed to check client fixed IP config file '%s': %w", ccdFilePath, err)
+		return nil, fmt.Errorf("failed to read client config file '%s': %w", path, err)
 	}
+	return ParseClientCCD(string(data)), nil
+}
 
-	contentBytes, err := os.ReadFile(ccdFilePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read client fixed IP config file '%s': %w", ccdFilePath, err)
-	}
-
-	content := string(contentBytes)
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmedLine, "ifconfig-push") {
-			parts := strings.Fields(trimmedLine)
-			// Expected: "ifconfig-push" "ip_address" "netmask"
-			if len(parts) == 3 {
-				parsedIP := net.ParseIP(parts[1])
-				if parsedIP == nil || parsedIP.To4() == nil {
-					logging.Warn("Invalid IPv4 address in ifconfig-push directive for %s: %s", commonName, parts[1])
-					continue
-				}
-				return parsedIP.String(), nil
+// ParseClientCCD 把 CCD 文件内容解析为 ClientCCD。能识别的行转为结构化字段，
+// 其余行原样放入 Directives（保存前仍需通过校验）；push-reset 后重新推送的 topology 等行被忽略。
+func ParseClientCCD(content string) *ClientCCD {
+	c := &ClientCCD{}
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		fields := strings.Fields(line)
+		switch {
+		case fields[0] == "ifconfig-push" && len(fields) == 3:
+			if ip := net.ParseIP(fields[1]); ip != nil && ip.To4() != nil {
+				c.FixedIP = ip.String()
+				continue
+			}
+		case fields[0] == "ifconfig-ipv6-push" && len(fields) >= 2:
+			if ip, _, err := net.ParseCIDR(fields[1]); err == nil && ip.To4() == nil {
+				c.FixedIPv6 = ip.String()
+				continue
+			}
+		case fields[0] == "iroute" && len(fields) == 3:
+			if cidr, err := netmaskToCIDR(fields[1], fields[2]); err == nil {
+				c.Subnet = cidr
+				continue
+			}
+		case line == "push-reset":
+			c.PushReset = true
+			continue
+		case fields[0] == "push":
+			if parsePushedOption(c, strings.Trim(strings.TrimPrefix(line, "push"), ` "`)) {
+				continue
 			}
-			logging.Warn("Malformed ifconfig-push line in %s for %s: %s", ccdFilePath, commonName, line)
 		}
+		c.Directives = append(c.Directives, line)
 	}
+	return c
+}
 
-	logging.Debug("No ifconfig-push directive found in %s for %s", ccdFilePath, commonName)
-	return "", nil // No ifconfig-push line found
+// parsePushedOption 把 push "…" 的内容转为结构化字段，无法识别时返回 false
+func parsePushedOption(c *ClientCCD, opt string) bool {
+	f := strings.Fields(opt)
+	if len(f) == 0 {
+		return false
+	}
+	switch {
+	case f[0] == "route" && len(f) == 3:
+		if cidr, err := netmaskToCIDR(f[1], f[2]); err == nil {
+			c.Routes = append(c.Routes, cidr)
+			return true
+		}
+	case f[0] == "route" && len(f) == 2 && net.ParseIP(f[1]) != nil && net.ParseIP(f[1]).To4() != nil:
+		c.Routes = append(c.Routes, f[1]+"/32")
+		return true
+	case f[0] == "route-ipv6" && len(f) == 2:
+		if _, err := parseIPv6CIDR(f[1]); err == nil {
+			c.Routes = append(c.Routes, f[1])
+			return true
+		}
+	case f[0] == "dhcp-option" && len(f) == 3 && (f[1] == "DNS" || f[1] == "DNS6"):
+		c.DNSServers = append(c.DNSServers, f[2])
+		return true
+	case f[0] == "dhcp-option" && len(f) == 3 && (f[1] == "DOMAIN" || f[1] == "DOMAIN-SEARCH"):
+		for _, d := range c.SearchDomains {
+			if d == f[2] {
+				return true
+			}
+		}
+		c.SearchDomains = append(c.SearchDomains, f[2])
+		return true
+	case f[0] == "redirect-gateway" && len(f) > 1:
+		// 不带参数的 redirect-gateway 无法用 RedirectGateway 表示，保留为指令
+		c.RedirectGateway = strings.Join(f[1:], " ")
+		return true
+	case c.PushReset && (opt == "topology subnet" || f[0] == "route-gateway" || f[0] == "ping" || f[0] == "ping-restart"):
+		// RenderClientCCD 在 push-reset 后自动补上的推送
+		return true
+	}
+	return false
 }
 
 // cidrToNetmask 将CIDR格式转换为子网掩码格式
@@ -244,216 +505,6 @@ func cidrToNetmask(cidr string) (string, error) {
 	return fmt.Sprintf("%s %s", ip, netmask), nil
 }
 
-// SetClientSubnet 为指定的客户端设置子网配置
-// commonName 是客户端的标识名
-// subnet 是要设置的子网地址（例如：10.10.120.0/23）
-func SetClientSubnet(commonName string, subnet string) error {
-	if commonName == "" {
-		return fmt.Errorf("commonName cannot be empty")
-	}
-	if subnet == "" {
-		return fmt.Errorf("subnet cannot be empty")
-	}
-
-	cfg, err := LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load OpenVPN configuration: %w", err)
-	}
-
-	if cfg.OpenVPNClientConfigDir == "" {
-		return fmt.Errorf("OpenVPNClientConfigDir is not set in the configuration")
-	}
-
-	// 确保CCD目录存在
-	ccdDir := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd")
-	if err := os.MkdirAll(ccdDir, 0755); err != nil {
-		return fmt.Errorf("failed to create ccd directory '%s': %w", ccdDir, err)
-	}
-
-	ccdFilePath := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName)
-
-	// 转换CIDR格式为子网掩码格式
-	subnetWithMask, err := cidrToNetmask(subnet)
-	if err != nil {
-		return fmt.Errorf("failed to convert subnet format: %w", err)
-	}
-
-	newConfig := fmt.Sprintf("iroute %s", subnetWithMask)
-
-	// 读取现有文件内容
-	var existingContent string
-	if _, err := os.Stat(ccdFilePath); err == nil {
-		content, err := os.ReadFile(ccdFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to read existing config file: %w", err)
-		}
-		existingContent = string(content)
-	}
-
-	// 处理现有配置
-	lines := strings.Split(existingContent, "\n")
-	newLines := make([]string, 0)
-	configAdded := false
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmedLine, "iroute") {
-			// 替换已存在的iroute配置
-			newLines = append(newLines, newConfig)
-			configAdded = true
-		} else if strings.HasPrefix(trimmedLine, "ifconfig-push") {
-			// 保留ifconfig-push配置
-			newLines = append(newLines, line)
-		} else if trimmedLine != "" {
-			// 保留其他配置
-			newLines = append(newLines, line)
-		}
-	}
-
-	// 如果没有找到iroute配置，添加新的配置
-	if !configAdded {
-		newLines = append(newLines, newConfig)
-	}
-
-	// 写入更新后的内容
-	content := strings.Join(newLines, "\n")
-	if content != "" {
-		content += "\n"
-	}
-
-	err = os.WriteFile(ccdFilePath, []byte(content), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to write client subnet config file '%s': %w", ccdFilePath, err)
-	}
-
-	return nil
-}
-
-// RemoveClientSubnet 移除客户端的子网配置
-// commonName 是客户端的标识名
-func RemoveClientSubnet(commonName string) error {
-	if commonName == "" {
-		return fmt.Errorf("commonName cannot be empty")
-	}
-
-	cfg, err := LoadConfig()
-	if err != nil {
-		return fmt.Errorf("failed to load OpenVPN configuration: %w", err)
-	}
-
-	if cfg.OpenVPNClientConfigDir == "" {
-		// 如果目录未设置，则无需移除
-		return nil
-	}
-
-	ccdFilePath := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName)
-
-	// 检查文件是否存在
-	if _, err := os.Stat(ccdFilePath); os.IsNotExist(err) {
-		// 文件不存在，视为已成功"移除"
-		return nil
-	} else if err != nil {
-		// 其他错误
-		return fmt.Errorf("failed to check client subnet config file '%s': %w", ccdFilePath, err)
-	}
-
-	// 读取现有文件内容
-	content, err := os.ReadFile(ccdFilePath)
-	if err != nil {
-		return fmt.Errorf("failed to read client config file '%s': %w", ccdFilePath, err)
-	}
-
-	// 处理文件内容，移除iroute配置
-	lines := strings.Split(string(content), "\n")
-	newLines := make([]string, 0)
-
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if !strings.HasPrefix(trimmedLine, "iroute") && trimmedLine != "" {
-			newLines = append(newLines, line)
-		}
-	}
-
-	// 如果文件为空，则删除文件
-	if len(newLines) == 0 {
-		err = os.Remove(ccdFilePath)
-		if err != nil {
-			return fmt.Errorf("failed to remove empty client config file '%s': %w", ccdFilePath, err)
-		}
-		return nil
-	}
-
-	// 写入更新后的内容
-	newContent := strings.Join(newLines, "\n")
-	if newContent != "" {
-		newContent += "\n"
-	}
-
-	err = os.WriteFile(ccdFilePath, []byte(newContent), 0644)
-	if err != nil {
-		return fmt.Errorf("failed to update client config file '%s': %w", ccdFilePath, err)
-	}
-
-	return nil
-}
-
-// GetClientSubnet 从客户端配置文件中读取子网配置
-// 返回子网地址（CIDR格式），如果没有找到则返回空字符串
-func GetClientSubnet(commonName string) (string, error) {
-	if commonName == "" {
-		return "", fmt.Errorf("commonName cannot be empty")
-	}
-
-	cfg, err := LoadConfig()
-	if err != nil {
-		return "", fmt.Errorf("failed to load OpenVPN configuration: %w", err)
-	}
-
-	if cfg.OpenVPNClientConfigDir == "" {
-		logging.Debug("OpenVPNClientConfigDir is not set, cannot get subnet for %s", commonName)
-		return "", nil
-	}
-
-	ccdFilePath := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd", commonName)
-
-	if _, err := os.Stat(ccdFilePath); os.IsNotExist(err) {
-		// 文件不存在，没有子网配置
-		return "", nil
-	} else if err != nil {
-		return "", fmt.Errorf("failed to check client subnet config file '%s': %w", ccdFilePath, err)
-	}
-
-	contentBytes, err := os.ReadFile(ccdFilePath)
-	if err != nil {
-		return "", fmt.Errorf("failed to read client subnet config file '%s': %w", ccdFilePath, err)
-	}
-
-	content := string(contentBytes)
-	lines := strings.Split(content, "\n")
-	for _, line := range lines {
-		trimmedLine := strings.TrimSpace(line)
-		if strings.HasPrefix(trimmedLine, "iroute") {
-			parts := strings.Fields(trimmedLine)
-			// Expected: "iroute" "network" "netmask"
-			if len(parts) == 3 {
-				// 将网络地址和子网掩码转换回CIDR格式
-				network := parts[1]
-				netmask := parts[2]
-				cidr, err := netmaskToCIDR(network, netmask)
-				if err != nil {
-					logging.Warn("Failed to convert netmask to CIDR for %s: %v", commonName, err)
-					continue
-				}
-				return cidr, nil
-			}
-			logging.Warn("Malformed iroute line in %s for %s: %s", ccdFilePath, commonName, line)
-		}
-	}
-
-	logging.Debug("No iroute directive found in %s for %s", ccdFilePath, commonName)
-	return "", nil // 没有找到iroute配置
-}
-
 // netmaskToCIDR 将网络地址和子网掩码转换为CIDR格式
 // 例如：将"10.10.120.0 255.255.254.0"转换为"10.10.120.0/23"
 func netmaskToCIDR(network, netmask string) (string, error) {
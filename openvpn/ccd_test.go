@@ -0,0 +1,176 @@
+package openvpn
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderClientCCD(t *testing.T) {
+	cfg := &Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: "255.255.255.0"}
+	c := &ClientCCD{
+		FixedIP:         "10.8.0.10",
+		Subnet:          "192.168.10.0/24",
+		PushReset:       true,
+		Routes:          []string{"10.20.0.0/16"},
+		DNSServers:      []string{"10.20.0.53", "fd00::53"},
+		SearchDomains:   []string{"corp.example", "dev.corp.example"},
+		RedirectGateway: "def1  bypass-dhcp",
+		Directives:      []string{`push "block-outside-dns"`},
+	}
+	got, err := RenderClientCCD(c, cfg)
+	if err != nil {
+		t.Fatalf("RenderClientCCD: %v", err)
+	}
+	want := ccdHeader + `
+ifconfig-push 10.8.0.10 255.255.255.0
+iroute 192.168.10.0 255.255.255.0
+push-reset
+push "topology subnet"
+push "route-gateway 10.8.0.1"
+push "ping 10"
+push "ping-restart 120"
+push "route 10.20.0.0 255.255.0.0"
+push "dhcp-option DNS 10.20.0.53"
+push "dhcp-option DNS6 fd00::53"
+push "dhcp-option DOMAIN corp.example"
+push "dhcp-option DOMAIN-SEARCH corp.example"
+push "dhcp-option DOMAIN-SEARCH dev.corp.example"
+push "redirect-gateway def1 bypass-dhcp"
+push "block-outside-dns"
+`
+	if got != want {
+		t.Errorf("rendered:\n%s\nwant:\n%s", got, want)
+	}
+
+	// 解析渲染结果应得到同样的设置（push-reset 后补上的推送不计入指令）
+	parsed := ParseClientCCD(got)
+	c.RedirectGateway = "def1 bypass-dhcp"
+	if !reflect.DeepEqual(parsed, c) {
+		t.Errorf("parsed = %+v, want %+v", parsed, c)
+	}
+
+	if _, err := RenderClientCCD(&ClientCCD{FixedIP: "10.9.0.10"}, cfg); err == nil {
+		t.Error("fixed IP outside the server network accepted")
+	}
+}
+
+func TestClientCCDValidate(t *testing.T) {
+	invalid := []*ClientCCD{
+		{Routes: []string{"10.20.0.5/16"}},
+		{Routes: []string{"fd00::5/64"}},
+		{FixedIPv6: "10.8.0.5"},
+		{DNSServers: []string{"dns.example"}},
+		{SearchDomains: []string{"bad domain"}},
+		{RedirectGateway: "def1 evil"},
+		{Directives: []string{"iroute 10.0.0.0 255.0.0.0"}},
+		{Directives: []string{"push-reset"}},
+		{Directives: []string{`push "route 10.0.0.0 255.0.0.0"` + "\nscript-security 2"}},
+		{Directives: []string{"up /tmp/evil.sh"}},
+		{Directives: []string{`push "up /tmp/evil.sh"`}},
+		{Directives: []string{`push "dhcp-option DNS 1.1.1.1" extra`}},
+		{Directives: []string{`push "route 'x'"`}},
+		{Directives: []string{"inactive"}},
+	}
+	for _, c := range invalid {
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate(%+v) accepted", c)
+		}
+	}
+	valid := &ClientCCD{
+		FixedIPv6:  "fd00:8::10",
+		Routes:     []string{"10.20.0.0/16", "10.30.1.7/32", "fd00:20::/48"},
+		Directives: []string{`push "route-ipv6 fd00:1::/64"`, `push-remove dhcp-option`, "inactive 3600 1000000", `push "block-outside-dns"`},
+	}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate(valid) = %v", err)
+	}
+}
+
+func TestParseClientCCDLegacy(t *testing.T) {
+	legacy := strings.Join([]string{
+		"ifconfig-push 10.8.0.20 255.255.255.0",
+		"iroute 192.168.20.0 255.255.255.0",
+		`push "route 172.16.0.0 255.240.0.0"`,
+		`push "dhcp-option DNS 172.16.0.53"`,
+		`push "redirect-gateway"`,
+		"# comment",
+		"script-security 2",
+	}, "\n")
+	got := ParseClientCCD(legacy)
+	want := &ClientCCD{
+		FixedIP:    "10.8.0.20",
+		Subnet:     "192.168.20.0/24",
+		Routes:     []string{"172.16.0.0/12"},
+		DNSServers: []string{"172.16.0.53"},
+		Directives: []string{`push "redirect-gateway"`, "script-security 2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseClientCCD = %+v, want %+v", got, want)
+	}
+}
+
+func TestIPPool(t *testing.T) {
+	cfg := &Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: "255.255.252.0"}
+	if err := ValidateIPPool(cfg, "10.8.2.10", "10.8.2.200"); err != nil {
+		t.Errorf("valid pool rejected: %v", err)
+	}
+	// 10.8.0.2-10.8.2.0 是动态地址池
+	for _, pool := range [][2]string{{"10.8.2.200", "10.8.2.10"}, {"10.8.2.10", ""}, {"10.8.0.0", "10.8.0.20"}, {"10.8.3.10", "10.8.4.10"}, {"10.8.1.10", "10.8.2.200"}, {"10.8.2.0", "10.8.2.10"}} {
+		if err := ValidateIPPool(cfg, pool[0], pool[1]); err == nil {
+			t.Errorf("pool %s-%s accepted", pool[0], pool[1])
+		}
+	}
+	if !IPInPool("10.8.1.10", "10.8.1.10", "10.8.1.200") || !IPInPool("10.8.1.200", "10.8.1.10", "10.8.1.200") || IPInPool("10.8.1.201", "10.8.1.10", "10.8.1.200") {
+		t.Error("IPInPool boundaries")
+	}
+	if !IPInPool("10.8.2.1", "", "") {
+		t.Error("empty pool should not restrict")
+	}
+}
+
+func TestRenderClientCCDIPv6(t *testing.T) {
+	cfg := &Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: "255.255.255.0", OpenVPNServerIPv6: "fd00:8::/64"}
+	c := &ClientCCD{FixedIP: "10.8.0.10", FixedIPv6: "fd00:8:0::10", Routes: []string{"10.20.0.0/16", "fd00:20::/48"}}
+	got, err := RenderClientCCD(c, cfg)
+	if err != nil {
+		t.Fatalf("RenderClientCCD: %v", err)
+	}
+	want := ccdHeader + `
+ifconfig-push 10.8.0.10 255.255.255.0
+ifconfig-ipv6-push fd00:8::10/64 fd00:8::1
+push "route 10.20.0.0 255.255.0.0"
+push "route-ipv6 fd00:20::/48"
+`
+	if got != want {
+		t.Errorf("RenderClientCCD =\n%s\nwant\n%s", got, want)
+	}
+
+	parsed := ParseClientCCD(got)
+	if parsed.FixedIPv6 != "fd00:8::10" || !reflect.DeepEqual(parsed.Routes, c.Routes) {
+		t.Errorf("ParseClientCCD(rendered) = %+v", parsed)
+	}
+
+	for _, ip := range []string{"fd00:9::10", "fd00:8::", "fd00:8::1"} {
+		if _, err := RenderClientCCD(&ClientCCD{FixedIPv6: ip}, cfg); err == nil {
+			t.Errorf("fixed IPv6 %s accepted", ip)
+		}
+	}
+	cfg.OpenVPNServerIPv6 = ""
+	if _, err := RenderClientCCD(&ClientCCD{FixedIPv6: "fd00:8::10"}, cfg); err == nil {
+		t.Error("fixed IPv6 accepted without an IPv6 server prefix")
+	}
+}
+
+func TestValidateServerIPv6(t *testing.T) {
+	for _, p := range []string{"fd00:8::/64", "2001:db8:0:1::/112"} {
+		if err := ValidateServerIPv6(p); err != nil {
+			t.Errorf("ValidateServerIPv6(%s) = %v", p, err)
+		}
+	}
+	for _, p := range []string{"fd00:8::1/64", "fd00::/48", "fd00::/126", "10.8.0.0/24", "fd00::"} {
+		if err := ValidateServerIPv6(p); err == nil {
+			t.Errorf("ValidateServerIPv6(%s) accepted", p)
+		}
+	}
+}
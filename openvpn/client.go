@@ -1,168 +1,215 @@
 package openvpn
 
 import (
-	"bufio"
+	"crypto/x509"
+	"errors"
 	"fmt"
-	"net"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"openvpn-admin-go/constants"
+	"openvpn-admin-go/openvpn/pki"
 	"openvpn-admin-go/utils"
 )
 
-// CreateClient 创建新的OpenVPN客户端
+// ErrInvalidCSR 用户上传的 CSR 本身不合格（无法解析、签名无效、密钥太弱、CN 与用户名不一致），
+// 与签发过程中的服务端错误区分开
+var ErrInvalidCSR = errors.New("invalid CSR")
+
+// CreateClient 创建新的OpenVPN客户端（默认证书有效期）
 func CreateClient(username string) error {
+	_, err := IssueClient(username, pki.DefaultClientValidity)
+	return err
+}
+
+// IssueClient 签发有效期为 validity 的客户端证书并生成 .ovpn，返回新证书
+// （调用方据此登记序列号与有效期）。已有证书文件会被覆盖，旧证书不会被吊销。
+func IssueClient(username string, validity time.Duration) (*x509.Certificate, error) {
 	fmt.Printf("开始创建客户端: %s\n", username)
 
 	// 检查证书目录
 	fmt.Printf("检查证书目录: %s\n", constants.ClientConfigDir)
-	if _, err := os.Stat(constants.ClientConfigDir); os.IsNotExist(err) {
-		fmt.Printf("创建证书目录: %s\n", constants.ClientConfigDir)
-		if err := utils.ExecCommand(fmt.Sprintf("mkdir -p %s", constants.ClientConfigDir)); err != nil {
-			return fmt.Errorf("创建证书目录失败: %v", err)
-		}
-		fmt.Println("证书目录创建成功")
+	if err := os.MkdirAll(constants.ClientConfigDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建证书目录失败: %v", err)
 	}
 
 	// 检查并生成TLS密钥
 	if _, err := os.Stat(constants.ServerTLSKeyPath); os.IsNotExist(err) {
 		fmt.Printf("正在生成TLS密钥: %s\n", constants.ServerTLSKeyPath)
 		if err := utils.ExecCommand(fmt.Sprintf("openvpn --genkey secret %s", constants.ServerTLSKeyPath)); err != nil {
-			return fmt.Errorf("生成TLS密钥失败: %v", err)
+			return nil, fmt.Errorf("生成TLS密钥失败: %v", err)
 		}
 		fmt.Println("TLS密钥生成成功")
 	}
 
-	// 检查CA证书和密钥是否存在
-	fmt.Printf("检查CA证书: %s\n", constants.ServerCACertPath)
-	fmt.Printf("检查CA密钥: %s\n", constants.ServerCAKeyPath)
-
-	if _, err := os.Stat(constants.ServerCACertPath); os.IsNotExist(err) {
-		return fmt.Errorf("CA证书不存在: %s", constants.ServerCACertPath)
-	}
-	if _, err := os.Stat(constants.ServerCAKeyPath); os.IsNotExist(err) {
-		return fmt.Errorf("CA密钥不存在: %s", constants.ServerCAKeyPath)
-	}
-
+	// 加载CA（证书 + 私钥）与签发记录
 	fmt.Printf("使用CA证书: %s\n", constants.ServerCACertPath)
 	fmt.Printf("使用CA密钥: %s\n", constants.ServerCAKeyPath)
-	fmt.Println("CA证书和密钥检查通过")
-
-	// 检查客户端扩展文件
-	clientExtFile := filepath.Join(filepath.Dir(constants.ServerConfigPath), "openssl-client.ext")
-	if _, err := os.Stat(clientExtFile); os.IsNotExist(err) {
-		return fmt.Errorf("客户端扩展文件不存在: %s", clientExtFile)
+	// 加载配置（密钥算法、.ovpn 渲染都要用）
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %v", err)
 	}
-	fmt.Printf("使用客户端扩展文件: %s\n", clientExtFile)
 
-	// 生成客户端私钥
-	fmt.Printf("正在为客户端 %s 生成私钥...\n", username)
-	keyPath := filepath.Join(constants.ClientConfigDir, username+".key")
-	if err := utils.ExecCommand(fmt.Sprintf("openssl genrsa -out %q 2048", keyPath)); err != nil {
-		return fmt.Errorf("生成私钥失败: %v", err)
+	// 生成客户端私钥并用CA签发证书
+	alg := cfg.KeyAlgorithm()
+	fmt.Printf("正在为客户端 %s 签发证书（%s，有效期 %d 天）...\n", username, alg, int(validity.Hours()/24))
+	var issued *pki.Issued
+	if err := withPKI(func(p *pki.PKI) (err error) {
+		issued, err = p.IssueClient(username, validity, alg)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("签发证书失败: %v", err)
+	}
+	if err := writeClientFiles(username, issued, cfg); err != nil {
+		return nil, err
 	}
-	fmt.Println("私钥生成成功")
+	return issued.Cert, nil
+}
 
-	// 生成证书签名请求
-	fmt.Printf("正在为客户端 %s 生成证书签名请求...\n", username)
-	csrPath := filepath.Join(constants.ClientConfigDir, username+".csr")
-	if err := utils.ExecCommand(fmt.Sprintf("openssl req -new -key %q -out %q -subj '/CN=%s'", keyPath, csrPath, username)); err != nil {
-		return fmt.Errorf("生成证书签名请求失败: %v", err)
+// issueClientFromCSR 按用户上传的 CSR 签发客户端证书并生成不含 <key> 的 .ovpn
+func issueClientFromCSR(username string, csr *x509.CertificateRequest, validity time.Duration) (*x509.Certificate, error) {
+	if err := os.MkdirAll(constants.ClientConfigDir, 0755); err != nil {
+		return nil, fmt.Errorf("创建证书目录失败: %v", err)
+	}
+	cfg, err := LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("加载配置失败: %v", err)
 	}
-	fmt.Println("证书签名请求生成成功")
+	fmt.Printf("正在按 CSR 为客户端 %s 签发证书（有效期 %d 天）...\n", username, int(validity.Hours()/24))
+	var issued *pki.Issued
+	if err := withPKI(func(p *pki.PKI) (err error) {
+		issued, err = p.SignClientCSR(csr, validity)
+		return err
+	}); err != nil {
+		return nil, fmt.Errorf("签发证书失败: %v", err)
+	}
+	if err := writeClientFiles(username, issued, cfg); err != nil {
+		return nil, err
+	}
+	return issued.Cert, nil
+}
 
-	// 使用CA证书签名
-	fmt.Printf("正在为客户端 %s 签名证书...\n", username)
+// writeClientFiles 写入 <user>.crt、<user>.key（CSR 签发时没有私钥，删除旧的 .key）、ca.crt 与 .ovpn
+func writeClientFiles(username string, issued *pki.Issued, cfg *Config) error {
+	keyPath := filepath.Join(constants.ClientConfigDir, username+".key")
+	if issued.KeyPEM != nil {
+		if err := os.WriteFile(keyPath, issued.KeyPEM, 0600); err != nil {
+			return fmt.Errorf("写入私钥失败: %v", err)
+		}
+	} else if err := os.Remove(keyPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除旧私钥失败: %v", err)
+	}
 	crtPath := filepath.Join(constants.ClientConfigDir, username+".crt")
-	if err := utils.ExecCommand(fmt.Sprintf("openssl x509 -req -in %q -CA %q -CAkey %q -CAcreateserial -out %q -days 3650 -extfile %q", csrPath, constants.ServerCACertPath, constants.ServerCAKeyPath, crtPath, clientExtFile)); err != nil {
-		return fmt.Errorf("签名证书失败: %v", err)
+	if err := os.WriteFile(crtPath, issued.CertPEM, 0644); err != nil {
+		return fmt.Errorf("写入证书失败: %v", err)
 	}
-	fmt.Println("证书签名成功")
+	fmt.Printf("证书签发成功，序列号: %s\n", pki.SerialHex(issued.Cert.SerialNumber))
 
-	// 复制CA证书到客户端目录
+	// 复制CA证书（信任集合）到客户端目录
 	clientCaPath := filepath.Join(constants.ClientConfigDir, "ca.crt")
 	fmt.Printf("正在复制CA证书到: %s\n", clientCaPath)
-	if err := utils.ExecCommand(fmt.Sprintf("cp %q %q", constants.ServerCACertPath, clientCaPath)); err != nil {
+	if err := copyFile(trustBundlePath(), clientCaPath); err != nil {
 		return fmt.Errorf("复制CA证书失败: %v", err)
 	}
 	fmt.Println("CA证书复制成功")
 
-	// 清理临时文件
-	fmt.Printf("清理临时文件: %s\n", csrPath)
-	utils.ExecCommand(fmt.Sprintf("rm %q", csrPath)) // 忽略错误，因为文件可能不存在
-
 	// 生成.ovpn配置文件
 	fmt.Printf("正在为客户端 %s 生成配置文件...\n", username)
 	ovpnPath := filepath.Join(constants.ClientConfigDir, username+".ovpn")
 
-	// 加载配置
-	cfg, err := LoadConfig()
-	if err != nil {
-		return fmt.Errorf("加载配置失败: %v", err)
-	}
-
 	// 生成客户端配置
 	clientConfig, err := GenerateClientConfig(username, cfg)
 	if err != nil {
 		return fmt.Errorf("生成客户端配置失败: %v", err)
 	}
 
-	// 使用sudo写入配置文件
-	tempFile := "/tmp/" + username + ".ovpn"
-	fmt.Printf("创建临时配置文件: %s\n", tempFile)
-	if err := os.WriteFile(tempFile, []byte(clientConfig), 0644); err != nil {
-		return fmt.Errorf("创建临时配置文件失败: %v", err)
-	}
-
-	fmt.Printf("移动配置文件到: %s\n", ovpnPath)
-	if err := utils.ExecCommand(fmt.Sprintf("mv %q %q", tempFile, ovpnPath)); err != nil {
-		return fmt.Errorf("移动配置文件失败: %v", err)
-	}
-
-	// 设置文件权限
-	fmt.Printf("设置文件权限: %s\n", ovpnPath)
-	if err := utils.ExecCommand(fmt.Sprintf("chmod 644 %q", ovpnPath)); err != nil {
-		return fmt.Errorf("设置文件权限失败: %v", err)
+	fmt.Printf("写入配置文件: %s\n", ovpnPath)
+	if err := os.WriteFile(ovpnPath, []byte(clientConfig), 0644); err != nil {
+		return fmt.Errorf("写入配置文件失败: %v", err)
 	}
 
 	fmt.Printf("客户端 %s 的证书和配置文件已生成并复制到 %s 目录\n", username, constants.ClientConfigDir)
 	return nil
 }
 
-// readFile 读取文件内容
-func readFile(path string) string {
-	content, err := os.ReadFile(path)
+// ClientCertificate 读取并解析用户当前的客户端证书（<user>.crt）
+func ClientCertificate(username string) (*x509.Certificate, error) {
+	raw, err := os.ReadFile(filepath.Join(constants.ClientConfigDir, username+".crt"))
 	if err != nil {
-		return ""
+		return nil, err
 	}
-	return string(content)
+	return pki.ParseCertificatePEM(raw)
+}
+
+// HasClientKey 服务器上是否保存着用户的私钥（CSR 自助签发的用户没有）
+func HasClientKey(username string) bool {
+	return utils.IsExists(filepath.Join(constants.ClientConfigDir, username+".key"))
+}
+
+// RenewClient 为已有客户端换发证书：先签发新证书并重写 .crt/.key/.ovpn，再以 superseded
+// 吊销旧证书并更新 CRL。返回旧证书（不存在时为 nil）和新证书。
+//
+// 已连接的会话不受影响，直到下次重协商/重连时旧证书被 CRL 拒绝——用户需下载新的 .ovpn。
+func RenewClient(username string, validity time.Duration) (old, renewed *x509.Certificate, err error) {
+	return replaceClient(username, func() (*x509.Certificate, error) {
+		return IssueClient(username, validity)
+	})
 }
 
-// killClientSession 经管理接口即时断开某用户的活动会话（best-effort，连不上/没连着都不算错）。
-func killClientSession(username string) error {
-	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", constants.DefaultOpenVPNManagementPort))
+// EnrollClient 按用户上传的 PKCS#10 CSR（PEM）签发客户端证书：CN 必须等于 username，
+// 私钥始终留在用户设备上，生成的 .ovpn 不含 <key>，由客户端在本地合并。服务器上残留的
+// <user>.key 会被删除，旧证书与 RenewClient 一样以 superseded 吊销。
+func EnrollClient(username string, csrPEM []byte, validity time.Duration) (old, enrolled *x509.Certificate, err error) {
+	csr, err := pki.ParseCertificateRequestPEM(csrPEM)
 	if err != nil {
-		return fmt.Errorf("connect management interface: %w", err)
+		return nil, nil, fmt.Errorf("%w: 解析CSR失败: %v", ErrInvalidCSR, err)
 	}
-	defer conn.Close()
+	if err := pki.CheckClientCSR(csr); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidCSR, err)
+	}
+	if csr.Subject.CommonName != username {
+		return nil, nil, fmt.Errorf("%w: CSR 的 CN %q 与用户名 %q 不一致", ErrInvalidCSR, csr.Subject.CommonName, username)
+	}
+	return replaceClient(username, func() (*x509.Certificate, error) {
+		return issueClientFromCSR(username, csr, validity)
+	})
+}
 
-	// 管理接口带口令：连上后第一行先发口令，否则 kill 会被当错误口令拒绝。
-	if pw, readErr := os.ReadFile(constants.ServerMgmtPasswordPath); readErr == nil {
-		password := strings.TrimRight(string(pw), "\r\n")
-		if password != "" {
-			fmt.Fprintf(conn, "%s\n", password)
-		}
+// replaceClient 先用 issue 签发新证书，成功后吊销旧证书并更新 CRL
+func replaceClient(username string, issue func() (*x509.Certificate, error)) (old, issued *x509.Certificate, err error) {
+	old, err = ClientCertificate(username)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, fmt.Errorf("读取旧证书失败: %v", err)
 	}
-	if _, err := fmt.Fprintf(conn, "kill %s\n", username); err != nil {
-		return fmt.Errorf("send kill: %w", err)
+	issued, err = issue()
+	if err != nil {
+		return nil, nil, err
 	}
-	if status, readErr := bufio.NewReader(conn).ReadString('\n'); readErr == nil {
-		fmt.Printf("management kill %s: %s\n", username, status)
+	if old == nil {
+		return nil, issued, nil
 	}
-	return nil
+	if err := withCAs(func(s *caSet) error {
+		if err := s.owner(old).Revoke(old, pki.ReasonSuperseded); err != nil {
+			return err
+		}
+		return s.writeServerFiles()
+	}); err != nil {
+		return old, issued, fmt.Errorf("吊销旧证书失败: %v", err)
+	}
+	fmt.Printf("已吊销用户 %s 的旧证书 %s\n", username, pki.SerialHex(old.SerialNumber))
+	return old, issued, nil
+}
+
+// readFile 读取文件内容
+func readFile(path string) string {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return string(content)
 }
 
 // DeleteClient 删除OpenVPN客户端
@@ -175,6 +222,10 @@ func DeleteClient(username string) error {
 			fmt.Printf("警告：吊销用户 %s 证书失败（仍继续删除）: %v\n", username, revokeErr)
 		}
 	}
+	// tls-crypt-v2 密钥随证书一起吊销（并删除密钥文件），泄露的 .ovpn 在握手前即被拒绝
+	if revokeErr := revokeClientTLSCryptV2Key(username); revokeErr != nil {
+		fmt.Printf("警告：吊销用户 %s 的 tls-crypt-v2 密钥失败（仍继续删除）: %v\n", username, revokeErr)
+	}
 	if killErr := killClientSession(username); killErr != nil {
 		fmt.Printf("断开用户 %s 会话失败(可忽略): %v\n", username, killErr)
 	}
@@ -200,37 +251,9 @@ func DeleteClient(username string) error {
 
 // PauseClient 暂停OpenVPN客户端
 func PauseClient(username string) error {
-	// Connect to OpenVPN management interface
-	conn, err := net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", constants.DefaultOpenVPNManagementPort))
-	if err != nil {
-		return fmt.Errorf("failed to connect to OpenVPN management interface: %w", err)
-	}
-	defer conn.Close()
-
-	// 管理接口现在带口令（server.conf: management ... <pw-file>）：连接后第一行必须先发口令，
-	// 否则后续 kill 命令会被当成错误口令拒绝。口令与 OpenVPN 读的是同一个文件。
-	if pw, readErr := os.ReadFile(constants.ServerMgmtPasswordPath); readErr == nil {
-		password := strings.TrimRight(string(pw), "\r\n")
-		if password != "" {
-			if _, err = fmt.Fprintf(conn, "%s\n", password); err != nil {
-				fmt.Printf("Failed to send management password for %s: %v\n", username, err)
-			}
-		}
-	}
-
-	// Send kill command
-	_, err = fmt.Fprintf(conn, "kill %s\n", username)
-	if err != nil {
-		// It's possible the client is not connected, so log but don't necessarily fail hard
-		fmt.Printf("Failed to send kill command for %s: %v. This might be okay if client was not connected.\n", username, err)
-	} else {
-		// Optional: Read response
-		status, readErr := bufio.NewReader(conn).ReadString('\n')
-		if readErr != nil {
-			fmt.Printf("Failed to read response from management interface after killing %s: %v\n", username, readErr)
-		} else {
-			fmt.Printf("OpenVPN management interface response for kill %s: %s\n", username, status)
-		}
+	// 经共享的管理接口客户端即时断开会话；客户端没连着也不影响拉黑
+	if err := killClientSession(username); err != nil {
+		fmt.Printf("Failed to kill session for %s: %v. This might be okay if OpenVPN is not running.\n", username, err)
 	}
 
 	// Append username to blacklist file
@@ -336,13 +359,14 @@ func GetClientStatus(username string) (*ClientStatus, error) {
 		return nil, nil
 	}
 	return &ClientStatus{
-		CommonName:     status.CommonName,
-		RealAddress:    status.RealAddress,
-		VirtualAddress: status.VirtualAddress,
-		BytesReceived:  status.BytesReceived,
-		BytesSent:      status.BytesSent,
-		ConnectedSince: status.ConnectedSince,
-		LastRef:        status.LastRef,
+		CommonName:         status.CommonName,
+		RealAddress:        status.RealAddress,
+		VirtualAddress:     status.VirtualAddress,
+		VirtualIPv6Address: status.VirtualIPv6Address,
+		BytesReceived:      status.BytesReceived,
+		BytesSent:          status.BytesSent,
+		ConnectedSince:     status.ConnectedSince,
+		LastRef:            status.LastRef,
 	}, nil
 }
 
@@ -356,13 +380,14 @@ func GetAllClientStatuses() ([]ClientStatus, error) {
 	result := make([]ClientStatus, len(statuses))
 	for i, status := range statuses {
 		result[i] = ClientStatus{
-			CommonName:     status.CommonName,
-			RealAddress:    status.RealAddress,
-			VirtualAddress: status.VirtualAddress,
-			BytesReceived:  status.BytesReceived,
-			BytesSent:      status.BytesSent,
-			ConnectedSince: status.ConnectedSince,
-			LastRef:        status.LastRef,
+			CommonName:         status.CommonName,
+			RealAddress:        status.RealAddress,
+			VirtualAddress:     status.VirtualAddress,
+			VirtualIPv6Address: status.VirtualIPv6Address,
+			BytesReceived:      status.BytesReceived,
+			BytesSent:          status.BytesSent,
+			ConnectedSince:     status.ConnectedSince,
+			LastRef:            status.LastRef,
 		}
 	}
 	return result, nil
@@ -370,13 +395,14 @@ func GetAllClientStatuses() ([]ClientStatus, error) {
 
 // ClientStatus 客户端状态
 type ClientStatus struct {
-	CommonName     string    `json:"commonName"`
-	RealAddress    string    `json:"realAddress"`
-	VirtualAddress string    `json:"virtualAddress"`
-	BytesReceived  int64     `json:"bytesReceived"`
-	BytesSent      int64     `json:"bytesSent"`
-	ConnectedSince time.Time `json:"connectedSince"`
-	LastRef        time.Time `json:"lastRef"`
+	CommonName         string    `json:"commonName"`
+	RealAddress        string    `json:"realAddress"`
+	VirtualAddress     string    `json:"virtualAddress"`
+	VirtualIPv6Address string    `json:"virtualIPv6Address,omitempty"`
+	BytesReceived      int64     `json:"bytesReceived"`
+	BytesSent          int64     `json:"bytesSent"`
+	ConnectedSince     time.Time `json:"connectedSince"`
+	LastRef            time.Time `json:"lastRef"`
 }
 
 // GenerateClientConfig 生成客户端配置文件内容
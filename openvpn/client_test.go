@@ -0,0 +1,48 @@
+package openvpn
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"testing"
+
+	"openvpn-admin-go/openvpn/pki"
+)
+
+func TestEnrollClientRejectsInvalidCSR(t *testing.T) {
+	key, err := pki.GenerateKey(pki.KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	csrPEM := func(cn string, key interface{}) []byte {
+		der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{Subject: pkix.Name{CommonName: cn}}, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der})
+	}
+	weak, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 篡改 CSR 内容使签名失效
+	tampered := csrPEM("alice", key)
+	block, _ := pem.Decode(tampered)
+	block.Bytes[len(block.Bytes)-1] ^= 0xff
+	tampered = pem.EncodeToMemory(block)
+
+	for name, csr := range map[string][]byte{
+		"not a CSR":     []byte("garbage"),
+		"wrong CN":      csrPEM("bob", key),
+		"weak key":      csrPEM("alice", weak),
+		"bad signature": tampered,
+	} {
+		// 校验在读写磁盘之前完成，不需要 CA
+		if _, _, err := EnrollClient("alice", csr, 0); !errors.Is(err, ErrInvalidCSR) {
+			t.Errorf("%s: err = %v, want ErrInvalidCSR", name, err)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"openvpn-admin-go/constants"
+	"openvpn-admin-go/openvpn/pki"
 )
 
 // Config 存储所有配置
@@ -20,7 +21,9 @@ type Config struct {
 	OpenVPNServerHostname  string   `json:"openvpn_server_hostname"`
 	OpenVPNServerNetwork   string   `json:"openvpn_server_network"`
 	OpenVPNServerNetmask   string   `json:"openvpn_server_netmask"`
+	OpenVPNServerIPv6      string   `json:"openvpn_server_ipv6,omitempty"` // IPv6 隧道前缀（server-ipv6），空表示只用 IPv4
 	OpenVPNRoutes          []string `json:"openvpn_routes"`
+	OpenVPNRoutesIPv6      []string `json:"openvpn_routes_ipv6,omitempty"`
 	OpenVPNClientConfigDir string   `json:"openvpn_client_config_dir"`
 	OpenVPNTLSVersion      string   `json:"openvpn_tls_version"`
 	OpenVPNTLSKey          string   `json:"openvpn_tls_key"`
@@ -32,6 +35,9 @@ type Config struct {
 	OpenVPNLogPath         string   `json:"openvpn_log_path"`
 	OpenVPNManagementPort  int      `json:"openvpn_management_port,omitempty"`
 	OpenVPNBlacklistFile   string   `json:"openvpn_blacklist_file,omitempty"`
+	OpenVPNKeyAlgorithm    string   `json:"openvpn_key_algorithm"`
+	OpenVPNTLSMode         string   `json:"openvpn_tls_mode"`
+	OpenVPNAuthMode        string   `json:"openvpn_auth_mode"`
 }
 
 // LoadConfig 从配置文件加载配置，优先使用 JSON 配置，回退到解析 server.conf
@@ -78,7 +84,9 @@ type AppConfig struct {
 	OpenVPNServerHostname  string   `json:"openvpn_server_hostname"`
 	OpenVPNServerNetwork   string   `json:"openvpn_server_network"`
 	OpenVPNServerNetmask   string   `json:"openvpn_server_netmask"`
+	OpenVPNServerIPv6      string   `json:"openvpn_server_ipv6,omitempty"` // IPv6 隧道前缀（server-ipv6），空表示只用 IPv4
 	OpenVPNRoutes          []string `json:"openvpn_routes"`
+	OpenVPNRoutesIPv6      []string `json:"openvpn_routes_ipv6,omitempty"`
 	OpenVPNClientConfigDir string   `json:"openvpn_client_config_dir"`
 	OpenVPNTLSVersion      string   `json:"openvpn_tls_version"`
 	OpenVPNTLSKey          string   `json:"openvpn_tls_key"`
@@ -90,6 +98,9 @@ type AppConfig struct {
 	OpenVPNLogPath         string   `json:"openvpn_log_path"`
 	OpenVPNManagementPort  int      `json:"openvpn_management_port"`
 	OpenVPNBlacklistFile   string   `json:"openvpn_blacklist_file"`
+	OpenVPNKeyAlgorithm    string   `json:"openvpn_key_algorithm"`
+	OpenVPNTLSMode         string   `json:"openvpn_tls_mode"`
+	OpenVPNAuthMode        string   `json:"openvpn_auth_mode"`
 }
 
 // createDefaultAppConfig 创建默认应用配置
@@ -114,6 +125,9 @@ func createDefaultAppConfig() (*AppConfig, error) {
 		OpenVPNLogPath:         constants.DefaultOpenVPNLogPath,
 		OpenVPNManagementPort:  constants.DefaultOpenVPNManagementPort,
 		OpenVPNBlacklistFile:   constants.DefaultOpenVPNBlacklistFile,
+		OpenVPNKeyAlgorithm:    constants.DefaultOpenVPNKeyAlgorithm,
+		OpenVPNTLSMode:         constants.DefaultOpenVPNTLSMode,
+		OpenVPNAuthMode:        constants.DefaultOpenVPNAuthMode,
 	}
 
 	// 保存默认配置
@@ -156,7 +170,9 @@ func convertAppConfigToConfig(appCfg *AppConfig) *Config {
 		OpenVPNServerHostname:  appCfg.OpenVPNServerHostname,
 		OpenVPNServerNetwork:   appCfg.OpenVPNServerNetwork,
 		OpenVPNServerNetmask:   appCfg.OpenVPNServerNetmask,
+		OpenVPNServerIPv6:      appCfg.OpenVPNServerIPv6,
 		OpenVPNRoutes:          append([]string{}, appCfg.OpenVPNRoutes...),
+		OpenVPNRoutesIPv6:      append([]string{}, appCfg.OpenVPNRoutesIPv6...),
 		OpenVPNClientConfigDir: appCfg.OpenVPNClientConfigDir,
 		OpenVPNTLSVersion:      appCfg.OpenVPNTLSVersion,
 		OpenVPNTLSKey:          appCfg.OpenVPNTLSKey,
@@ -168,6 +184,9 @@ func convertAppConfigToConfig(appCfg *AppConfig) *Config {
 		OpenVPNLogPath:         appCfg.OpenVPNLogPath,
 		OpenVPNManagementPort:  appCfg.OpenVPNManagementPort,
 		OpenVPNBlacklistFile:   appCfg.OpenVPNBlacklistFile,
+		OpenVPNKeyAlgorithm:    appCfg.OpenVPNKeyAlgorithm,
+		OpenVPNTLSMode:         appCfg.OpenVPNTLSMode,
+		OpenVPNAuthMode:        appCfg.OpenVPNAuthMode,
 	}
 }
 
@@ -225,11 +244,19 @@ func loadFromServerConfig() (*Config, error) {
 				cfg.OpenVPNServerNetwork = fields[1]
 				cfg.OpenVPNServerNetmask = fields[2]
 			}
+		case "server-ipv6":
+			cfg.OpenVPNServerIPv6 = fields[1]
 		case "push":
-			if strings.HasPrefix(fields[1], "route") {
+			if strings.HasPrefix(fields[1], `"route-ipv6`) {
+				cfg.OpenVPNRoutesIPv6 = append(cfg.OpenVPNRoutesIPv6, strings.Trim(strings.Join(fields[2:], " "), `"`))
+			} else if strings.HasPrefix(fields[1], "route") {
 				route := strings.Join(fields[2:], " ")
 				cfg.OpenVPNRoutes = append(cfg.OpenVPNRoutes, route)
 			}
+		case "tls-auth", "tls-crypt", "tls-crypt-v2":
+			cfg.OpenVPNTLSMode = fields[0]
+		case "auth-user-pass-verify":
+			cfg.OpenVPNAuthMode = parseVPNAuthVerifyLine(fields[1:])
 		}
 	}
 
@@ -260,6 +287,13 @@ func loadFromServerConfig() (*Config, error) {
 	cfg.OpenVPNLogPath = constants.DefaultOpenVPNLogPath
 	cfg.OpenVPNManagementPort = constants.DefaultOpenVPNManagementPort
 	cfg.OpenVPNBlacklistFile = constants.DefaultOpenVPNBlacklistFile
+	cfg.OpenVPNKeyAlgorithm = constants.DefaultOpenVPNKeyAlgorithm
+	if cfg.OpenVPNTLSMode == "" {
+		cfg.OpenVPNTLSMode = constants.DefaultOpenVPNTLSMode
+	}
+	if cfg.OpenVPNAuthMode == "" {
+		cfg.OpenVPNAuthMode = constants.DefaultOpenVPNAuthMode
+	}
 
 	// 设置默认路由
 	if len(cfg.OpenVPNRoutes) == 0 {
@@ -273,6 +307,33 @@ func loadFromServerConfig() (*Config, error) {
 	return cfg, nil
 }
 
+// KeyAlgorithm 新签发证书使用的密钥算法；旧配置文件没有该字段或值无效时回退到默认 RSA-2048
+func (c *Config) KeyAlgorithm() pki.KeyAlgorithm {
+	alg, err := pki.ParseKeyAlgorithm(c.OpenVPNKeyAlgorithm)
+	if err != nil {
+		return pki.DefaultKeyAlgorithm
+	}
+	return alg
+}
+
+// TLSMode 控制通道保护方式；旧配置文件没有该字段或值无效时回退到 tls-auth
+func (c *Config) TLSMode() TLSMode {
+	mode, err := ParseTLSMode(c.OpenVPNTLSMode)
+	if err != nil {
+		return TLSModeAuth
+	}
+	return mode
+}
+
+// VPNAuthMode VPN 连接的二次验证方式；旧配置文件没有该字段或值无效时回退到关闭
+func (c *Config) VPNAuthMode() VPNAuthMode {
+	mode, err := ParseVPNAuthMode(c.OpenVPNAuthMode)
+	if err != nil {
+		return VPNAuthOff
+	}
+	return mode
+}
+
 // GenerateServerConfig 生成 OpenVPN 服务器配置
 func (c *Config) GenerateServerConfig() (string, error) {
 	config, err := RenderServerConfig(c)
@@ -337,7 +398,9 @@ func convertConfigToAppConfig(cfg *Config) *AppConfig {
 		OpenVPNServerHostname:  cfg.OpenVPNServerHostname,
 		OpenVPNServerNetwork:   cfg.OpenVPNServerNetwork,
 		OpenVPNServerNetmask:   cfg.OpenVPNServerNetmask,
+		OpenVPNServerIPv6:      cfg.OpenVPNServerIPv6,
 		OpenVPNRoutes:          append([]string{}, cfg.OpenVPNRoutes...),
+		OpenVPNRoutesIPv6:      append([]string{}, cfg.OpenVPNRoutesIPv6...),
 		OpenVPNClientConfigDir: cfg.OpenVPNClientConfigDir,
 		OpenVPNTLSVersion:      cfg.OpenVPNTLSVersion,
 		OpenVPNTLSKey:          cfg.OpenVPNTLSKey,
@@ -349,5 +412,8 @@ func convertConfigToAppConfig(cfg *Config) *AppConfig {
 		OpenVPNLogPath:         cfg.OpenVPNLogPath,
 		OpenVPNManagementPort:  cfg.OpenVPNManagementPort,
 		OpenVPNBlacklistFile:   cfg.OpenVPNBlacklistFile,
+		OpenVPNKeyAlgorithm:    cfg.OpenVPNKeyAlgorithm,
+		OpenVPNTLSMode:         cfg.OpenVPNTLSMode,
+		OpenVPNAuthMode:        cfg.OpenVPNAuthMode,
 	}
 }
@@ -0,0 +1,76 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+)
+
+// 客户端互访按部门控制：OpenVPN 的 client-to-client 只有服务端整体开关，而且开启后客户端之间的包
+// 在 OpenVPN 内部转发、不经过内核，防火墙管不到。因此 server.conf 不再开启 client-to-client，
+// 客户端之间的包经 tun 设备交给内核转发，FORWARD 链跳到 OVPN_C2C：源地址与目的地址都在放行名单里才通过，
+// 其余（包括刚连上、尚未同步进名单的动态地址）一律丢弃。
+const (
+	clientToClientChain    = "OVPN_C2C"
+	clientToClientDstChain = "OVPN_C2C_DST"
+)
+
+// runFirewall 执行 iptables / iptables-restore，stdin 非空时作为标准输入（测试时替换）
+var runFirewall = func(name, stdin string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s %s: %v: %s", name, strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// renderClientToClientRules 生成 iptables-restore 的输入：重建 OVPN_C2C 与 OVPN_C2C_DST 两条链。
+// 不是合法 IP / CIDR 或地址族不符的条目跳过。
+func renderClientToClientRules(allowed []string, ipv6 bool) string {
+	var b strings.Builder
+	b.WriteString("*filter\n")
+	fmt.Fprintf(&b, ":%s - [0:0]\n:%s - [0:0]\n", clientToClientChain, clientToClientDstChain)
+	var addrs []string
+	for _, a := range allowed {
+		ip, _, err := net.ParseCIDR(a)
+		if err != nil {
+			ip = net.ParseIP(a)
+		}
+		if ip == nil || (ip.To4() == nil) != ipv6 {
+			continue
+		}
+		addrs = append(addrs, a)
+	}
+	for _, a := range addrs {
+		fmt.Fprintf(&b, "-A %s -s %s -j %s\n", clientToClientChain, a, clientToClientDstChain)
+	}
+	fmt.Fprintf(&b, "-A %s -j DROP\n", clientToClientChain)
+	for _, a := range addrs {
+		fmt.Fprintf(&b, "-A %s -d %s -j ACCEPT\n", clientToClientDstChain, a)
+	}
+	fmt.Fprintf(&b, "-A %s -j DROP\n", clientToClientDstChain)
+	b.WriteString("COMMIT\n")
+	return b.String()
+}
+
+// ApplyClientToClientRules 用放行名单（隧道地址或客户端子网）原子替换客户端互访规则，
+// 并确保 FORWARD 链中 tun 到 tun 的流量跳到 OVPN_C2C。ipv6 为 true 时操作 ip6tables。
+func ApplyClientToClientRules(allowed []string, ipv6 bool) error {
+	bin := "iptables"
+	if ipv6 {
+		bin = "ip6tables"
+	}
+	// --noflush 只重建这里声明的两条链，不动其他规则
+	if err := runFirewall(bin+"-restore", renderClientToClientRules(allowed, ipv6), "--noflush"); err != nil {
+		return err
+	}
+	jump := []string{"FORWARD", "-i", "tun+", "-o", "tun+", "-j", clientToClientChain}
+	if runFirewall(bin, "", append([]string{"-C"}, jump...)...) == nil {
+		return nil
+	}
+	return runFirewall(bin, "", append([]string{"-I"}, jump...)...)
+}
@@ -0,0 +1,68 @@
+package openvpn
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRenderClientToClientRules(t *testing.T) {
+	got := renderClientToClientRules([]string{"10.8.0.5", "10.10.120.0/23", "fd00::5", "bogus -j ACCEPT", ""}, false)
+	want := `*filter
+:OVPN_C2C - [0:0]
+:OVPN_C2C_DST - [0:0]
+-A OVPN_C2C -s 10.8.0.5 -j OVPN_C2C_DST
+-A OVPN_C2C -s 10.10.120.0/23 -j OVPN_C2C_DST
+-A OVPN_C2C -j DROP
+-A OVPN_C2C_DST -d 10.8.0.5 -j ACCEPT
+-A OVPN_C2C_DST -d 10.10.120.0/23 -j ACCEPT
+-A OVPN_C2C_DST -j DROP
+COMMIT
+`
+	if got != want {
+		t.Errorf("IPv4 rules:\n%s\nwant:\n%s", got, want)
+	}
+
+	// 地址族不符的条目跳过；名单为空时客户端之间全部丢弃
+	got = renderClientToClientRules([]string{"10.8.0.5"}, true)
+	if strings.Contains(got, "10.8.0.5") || !strings.Contains(got, "-A OVPN_C2C -j DROP\n") {
+		t.Errorf("IPv6 rules with only IPv4 addresses:\n%s", got)
+	}
+}
+
+func TestApplyClientToClientRules(t *testing.T) {
+	orig := runFirewall
+	t.Cleanup(func() { runFirewall = orig })
+
+	var calls [][]string
+	jumpExists := false
+	runFirewall = func(name, stdin string, args ...string) error {
+		calls = append(calls, append([]string{name}, args...))
+		if len(args) > 0 && args[0] == "-C" && !jumpExists {
+			return errors.New("no such rule")
+		}
+		return nil
+	}
+
+	if err := ApplyClientToClientRules([]string{"fd00::5"}, true); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		{"ip6tables-restore", "--noflush"},
+		{"ip6tables", "-C", "FORWARD", "-i", "tun+", "-o", "tun+", "-j", "OVPN_C2C"},
+		{"ip6tables", "-I", "FORWARD", "-i", "tun+", "-o", "tun+", "-j", "OVPN_C2C"},
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %v, want %v", calls, want)
+	}
+
+	// 跳转规则已存在时不重复插入
+	calls, jumpExists = nil, true
+	if err := ApplyClientToClientRules(nil, false); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 2 || calls[0][0] != "iptables-restore" {
+		t.Errorf("calls with existing jump = %v", calls)
+	}
+}
@@ -0,0 +1,171 @@
+package openvpn
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ServerAddressRange 服务端网段中可分配给客户端的地址：网络地址 +1 是服务端自身（server 指令），
+// 客户端从 +2 到广播地址 -1
+func ServerAddressRange(cfg *Config) (server, first, last string, err error) {
+	ipNet, broadcast, err := serverNetwork(cfg)
+	if err != nil {
+		return "", "", "", err
+	}
+	base := ipv4ToUint(ipNet.IP)
+	top := ipv4ToUint(broadcast)
+	if top-base < 3 {
+		return "", "", "", fmt.Errorf("server network %s/%s is too small for clients", cfg.OpenVPNServerNetwork, cfg.OpenVPNServerNetmask)
+	}
+	return uintToIPv4(base + 1), uintToIPv4(base + 2), uintToIPv4(top - 1), nil
+}
+
+// DynamicPoolRange OpenVPN 动态分配的地址范围（server.conf 中的 ifconfig-pool）：客户端可分配地址的前一半。
+// 后一半见 StaticAddressRange，留给固定 IP 与部门 IP 范围，动态地址不会与它们撞上
+func DynamicPoolRange(cfg *Config) (start, end string, err error) {
+	_, first, last, err := ServerAddressRange(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	f, l := ipv4ToUint(net.ParseIP(first)), ipv4ToUint(net.ParseIP(last))
+	size := l - f + 1
+	return first, uintToIPv4(f + size - size/2 - 1), nil
+}
+
+// StaticAddressRange 固定 IP 与部门 IP 范围可用的地址：动态地址池之后到网段末尾。
+// 网段只有一个客户端地址时范围为空（start 大于 end）
+func StaticAddressRange(cfg *Config) (start, end string, err error) {
+	_, dynamicEnd, err := DynamicPoolRange(cfg)
+	if err != nil {
+		return "", "", err
+	}
+	_, _, last, _ := ServerAddressRange(cfg)
+	return uintToIPv4(ipv4ToUint(net.ParseIP(dynamicEnd)) + 1), last, nil
+}
+
+// PoolSize [start, end] 中的地址数
+func PoolSize(start, end string) int {
+	s, e := ipv4ToUint(net.ParseIP(start)), ipv4ToUint(net.ParseIP(end))
+	if s == 0 || e < s {
+		return 0
+	}
+	return int(e-s) + 1
+}
+
+// NextFreeIP 返回 [start, end] 中第一个不在 used 里的地址；fromEnd 时从 end 往回找
+func NextFreeIP(start, end string, used map[string]bool, fromEnd bool) (string, bool) {
+	return NextFreeIPFunc(start, end, func(ip string) bool { return used[ip] }, fromEnd)
+}
+
+// NextFreeIPFunc 同 NextFreeIP，由 taken 判断地址是否不可用
+func NextFreeIPFunc(start, end string, taken func(ip string) bool, fromEnd bool) (string, bool) {
+	s, e := ipv4ToUint(net.ParseIP(start)), ipv4ToUint(net.ParseIP(end))
+	if s == 0 || e < s {
+		return "", false
+	}
+	for i := uint64(0); i <= uint64(e-s); i++ {
+		v := s + uint32(i)
+		if fromEnd {
+			v = e - uint32(i)
+		}
+		if ip := uintToIPv4(v); !taken(ip) {
+			return ip, true
+		}
+	}
+	return "", false
+}
+
+// CompareIPs 按地址大小比较（排序用），无法解析的地址排在最后
+func CompareIPs(a, b string) int {
+	ia, ib := net.ParseIP(a), net.ParseIP(b)
+	switch {
+	case ia == nil && ib == nil:
+		return strings.Compare(a, b)
+	case ia == nil:
+		return 1
+	case ib == nil:
+		return -1
+	}
+	if a4, b4 := ia.To4(), ib.To4(); (a4 == nil) != (b4 == nil) {
+		// IPv4 在前
+		if a4 != nil {
+			return -1
+		}
+		return 1
+	}
+	return strings.Compare(string(ia.To16()), string(ib.To16()))
+}
+
+func uintToIPv4(v uint32) string {
+	ip := make(net.IP, net.IPv4len)
+	binary.BigEndian.PutUint32(ip, v)
+	return ip.String()
+}
+
+// ReadIPPLeases 读取 ifconfig-pool-persist 文件（每行 "CN,IPv4[,IPv6]"），返回 CN 到其租约地址的映射；
+// 文件不存在时返回空映射
+func ReadIPPLeases(path string) (map[string][]string, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return map[string][]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return ParseIPPLeases(string(data)), nil
+}
+
+// ParseIPPLeases 解析 ifconfig-pool-persist 文件内容，忽略格式不对的行
+func ParseIPPLeases(content string) map[string][]string {
+	leases := make(map[string][]string)
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.Split(strings.TrimSpace(line), ",")
+		if len(parts) < 2 || parts[0] == "" {
+			continue
+		}
+		if ip := net.ParseIP(strings.TrimSpace(parts[1])); ip != nil && ip.To4() != nil {
+			leases[parts[0]] = append(leases[parts[0]], ip.String())
+		}
+		if len(parts) > 2 {
+			if ip := net.ParseIP(strings.TrimSpace(parts[2])); ip != nil && ip.To4() == nil {
+				leases[parts[0]] = append(leases[parts[0]], ip.String())
+			}
+		}
+	}
+	return leases
+}
+
+// ReadCCDAssignments 扫描 CCD 目录中各文件的 ifconfig-push 与 ifconfig-ipv6-push，返回 CN 到地址的映射
+// （含不由本程序管理的文件）
+func ReadCCDAssignments(cfg *Config) (map[string][]string, error) {
+	assignments := make(map[string][]string)
+	if cfg.OpenVPNClientConfigDir == "" {
+		return assignments, nil
+	}
+	dir := filepath.Join(cfg.OpenVPNClientConfigDir, "ccd")
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return assignments, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		c := ParseClientCCD(string(data))
+		for _, ip := range []string{c.FixedIP, c.FixedIPv6} {
+			if ip != "" {
+				assignments[e.Name()] = append(assignments[e.Name()], ip)
+			}
+		}
+	}
+	return assignments, nil
+}
@@ -0,0 +1,62 @@
+package openvpn
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestServerAddressRange(t *testing.T) {
+	server, first, last, err := ServerAddressRange(&Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: "255.255.255.0"})
+	if err != nil || server != "10.8.0.1" || first != "10.8.0.2" || last != "10.8.0.254" {
+		t.Errorf("range = %s %s %s (%v)", server, first, last, err)
+	}
+	if _, _, _, err := ServerAddressRange(&Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: "255.255.255.254"}); err == nil {
+		t.Error("/31 network accepted")
+	}
+	if n := PoolSize(first, last); n != 253 {
+		t.Errorf("PoolSize = %d, want 253", n)
+	}
+	if n := PoolSize("10.8.0.20", "10.8.0.10"); n != 0 {
+		t.Errorf("reversed PoolSize = %d, want 0", n)
+	}
+}
+
+func TestDynamicPoolRange(t *testing.T) {
+	for _, tc := range []struct{ netmask, dynamicEnd, staticStart string }{
+		{"255.255.255.0", "10.8.0.128", "10.8.0.129"}, // 253 个客户端地址：动态 127 个，固定 126 个
+		{"255.255.255.248", "10.8.0.4", "10.8.0.5"},
+		{"255.255.255.252", "10.8.0.2", "10.8.0.3"}, // 只有一个客户端地址，固定范围为空
+	} {
+		cfg := &Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: tc.netmask}
+		start, end, err := DynamicPoolRange(cfg)
+		if err != nil || start != "10.8.0.2" || end != tc.dynamicEnd {
+			t.Errorf("%s: dynamic pool = %s-%s (%v), want 10.8.0.2-%s", tc.netmask, start, end, err, tc.dynamicEnd)
+		}
+		_, _, last, _ := ServerAddressRange(cfg)
+		staticStart, staticEnd, err := StaticAddressRange(cfg)
+		if err != nil || staticStart != tc.staticStart || staticEnd != last {
+			t.Errorf("%s: static range = %s-%s (%v), want %s-%s", tc.netmask, staticStart, staticEnd, err, tc.staticStart, last)
+		}
+	}
+}
+
+func TestNextFreeIP(t *testing.T) {
+	used := map[string]bool{"10.8.0.10": true, "10.8.0.11": true, "10.8.0.13": true}
+	if ip, ok := NextFreeIP("10.8.0.10", "10.8.0.13", used, false); !ok || ip != "10.8.0.12" {
+		t.Errorf("NextFreeIP = %q %v, want 10.8.0.12", ip, ok)
+	}
+	if ip, ok := NextFreeIP("10.8.0.2", "10.8.0.13", used, true); !ok || ip != "10.8.0.12" {
+		t.Errorf("NextFreeIP from end = %q %v, want 10.8.0.12", ip, ok)
+	}
+	if ip, ok := NextFreeIP("10.8.0.10", "10.8.0.11", used, false); ok {
+		t.Errorf("full pool returned %q", ip)
+	}
+}
+
+func TestParseIPPLeases(t *testing.T) {
+	got := ParseIPPLeases("alice,10.8.0.2,\nbob,10.8.0.3,fd00:0::1000\n\nbroken\ncarol,not-an-ip\n")
+	want := map[string][]string{"alice": {"10.8.0.2"}, "bob": {"10.8.0.3", "fd00::1000"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseIPPLeases = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,82 @@
+package openvpn
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// IPv6Enabled 是否配置了 IPv6 隧道前缀（server-ipv6），未配置时隧道只有 IPv4
+func (c *Config) IPv6Enabled() bool {
+	return strings.TrimSpace(c.OpenVPNServerIPv6) != ""
+}
+
+// ValidateServerIPv6 校验 server-ipv6 前缀：IPv6 网络地址，前缀长度在 OpenVPN 支持的 /64 到 /124 之间
+func ValidateServerIPv6(prefix string) error {
+	ipNet, err := parseIPv6CIDR(prefix)
+	if err != nil {
+		return err
+	}
+	if bits, _ := ipNet.Mask.Size(); bits < 64 || bits > 124 {
+		return fmt.Errorf("IPv6 server prefix must be between /64 and /124: %s", prefix)
+	}
+	return nil
+}
+
+// ServerIPv6Network 服务端 IPv6 前缀与服务端自身的隧道地址（前缀 +1，与 IPv4 的 server 指令一致）
+func ServerIPv6Network(cfg *Config) (*net.IPNet, net.IP, error) {
+	if !cfg.IPv6Enabled() {
+		return nil, nil, fmt.Errorf("IPv6 is not enabled on the server (openvpn_server_ipv6 is empty)")
+	}
+	prefix := strings.TrimSpace(cfg.OpenVPNServerIPv6)
+	if err := ValidateServerIPv6(prefix); err != nil {
+		return nil, nil, err
+	}
+	_, ipNet, _ := net.ParseCIDR(prefix)
+	server := make(net.IP, net.IPv6len)
+	copy(server, ipNet.IP)
+	server[net.IPv6len-1]++
+	return ipNet, server, nil
+}
+
+// ValidateFixedIPv6 校验固定 IPv6 地址在服务端 IPv6 前缀内，且不是网络地址或服务端自身的地址
+func ValidateFixedIPv6(cfg *Config, ipAddress string) error {
+	ip := net.ParseIP(ipAddress)
+	if ip == nil || ip.To4() != nil {
+		return fmt.Errorf("invalid IPv6 address: %s", ipAddress)
+	}
+	ipNet, server, err := ServerIPv6Network(cfg)
+	if err != nil {
+		return err
+	}
+	if !ipNet.Contains(ip) {
+		return fmt.Errorf("fixed IPv6 %s is outside of the server prefix %s", ipAddress, ipNet)
+	}
+	if ip.Equal(ipNet.IP) {
+		return fmt.Errorf("fixed IPv6 %s cannot be the network address", ipAddress)
+	}
+	if ip.Equal(server) {
+		return fmt.Errorf("fixed IPv6 %s is the server's own address", ipAddress)
+	}
+	return nil
+}
+
+// parseIPv6CIDR 解析 IPv6 CIDR，要求地址就是网络地址
+func parseIPv6CIDR(cidr string) (*net.IPNet, error) {
+	ip, ipNet, err := net.ParseCIDR(cidr)
+	if err != nil || ip.To4() != nil {
+		return nil, fmt.Errorf("%s is not an IPv6 CIDR", cidr)
+	}
+	if !ip.Equal(ipNet.IP) {
+		return nil, fmt.Errorf("%s is not a network address (did you mean %s?)", cidr, ipNet.String())
+	}
+	return ipNet, nil
+}
+
+// parseRouteCIDR 路由可以是 IPv4 或 IPv6 CIDR，IPv6 路由以 route-ipv6 推送
+func parseRouteCIDR(cidr string) (*net.IPNet, error) {
+	if strings.Contains(cidr, ":") {
+		return parseIPv6CIDR(cidr)
+	}
+	return parseIPv4CIDR(cidr)
+}
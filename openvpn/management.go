@@ -0,0 +1,48 @@
+package openvpn
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"openvpn-admin-go/constants"
+	"openvpn-admin-go/openvpn/mgmt"
+)
+
+var (
+	mgmtOnce   sync.Once
+	mgmtClient *mgmt.Client
+)
+
+// Management 返回进程内共享的管理接口客户端。
+// 地址取配置里的 openvpn_management_port（缺省 7505），口令文件与 server.conf 的 management 行一致。
+// 客户端懒连接：CLI 下首条命令才拨号；web 服务启动时调用 Start 保持长连接，供同步服务每个周期取 "status 2"。
+func Management() *mgmt.Client {
+	mgmtOnce.Do(func() {
+		port := constants.DefaultOpenVPNManagementPort
+		if cfg, err := LoadConfig(); err == nil && cfg.OpenVPNManagementPort != 0 {
+			port = cfg.OpenVPNManagementPort
+		}
+		mgmtClient = mgmt.New(mgmt.Config{
+			Addr:         fmt.Sprintf("127.0.0.1:%d", port),
+			PasswordFile: constants.ServerMgmtPasswordPath,
+		})
+	})
+	return mgmtClient
+}
+
+// killClientSession 经管理接口即时断开某用户的活动会话（best-effort，连不上/没连着都不算错）。
+func killClientSession(username string) error {
+	status, err := Management().Kill(username)
+	if err != nil {
+		var cmdErr *mgmt.CommandError
+		if errors.As(err, &cmdErr) {
+			// 服务端回 ERROR（通常是 "common name ... not found"）= 用户当前不在线
+			fmt.Printf("management kill %s: %s\n", username, cmdErr.Message)
+			return nil
+		}
+		return err
+	}
+	fmt.Printf("management kill %s: %s\n", username, status)
+	return nil
+}
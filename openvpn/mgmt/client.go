@@ -0,0 +1,397 @@
+// Package mgmt 实现 OpenVPN management interface 的原生客户端。
+//
+// 管理协议是一条文本 TCP 连接：命令按行发送，服务端按发送顺序逐条回复
+// （单行 SUCCESS:/ERROR:，或以 END 结尾的多行块），同时随时可能插入以 '>'
+// 开头的实时通知（>INFO / >CLIENT / >BYTECOUNT_CLI ...）。本包维护一条持久连接，
+// 按 FIFO 把回复分派给等待中的命令，把通知广播给订阅者，断线后自动重连。
+package mgmt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+)
+
+const passwordPrompt = "ENTER PASSWORD:"
+
+var (
+	// ErrNotConnected 连接在命令完成前断开（或尚未建立）
+	ErrNotConnected = errors.New("management interface not connected")
+	// ErrClosed 客户端已被 Close
+	ErrClosed = errors.New("management client closed")
+)
+
+// CommandError 服务端对命令回复了 "ERROR: ..."
+type CommandError struct {
+	Command string
+	Message string
+}
+
+func (e *CommandError) Error() string {
+	return fmt.Sprintf("management command %q failed: %s", e.Command, e.Message)
+}
+
+// Config 管理接口连接参数
+type Config struct {
+	// Addr 管理接口地址，如 127.0.0.1:7505
+	Addr string
+	// PasswordFile 口令文件（首行即口令，与 server.conf 的 management 行引用同一文件）。
+	// 每次拨号时重读，口令轮换后无需重建客户端；为空表示管理接口不带口令。
+	PasswordFile string
+	// DialTimeout 拨号 + 口令握手超时
+	DialTimeout time.Duration
+	// CommandTimeout 单条命令等待回复的超时
+	CommandTimeout time.Duration
+	// ReconnectInterval Start 后台循环断线重连的间隔
+	ReconnectInterval time.Duration
+}
+
+// Client 管理接口客户端，可被多个 goroutine 共享。
+type Client struct {
+	cfg Config
+
+	mu      sync.Mutex
+	conn    net.Conn
+	pending []*request // 已发送、等待回复的命令（FIFO，与服务端回复顺序一致）
+	closed  bool
+	dial    *dialCall     // 进行中的拨号，并发的 connect 共用同一次拨号
+	lost    chan struct{} // 连接断开信号（容量 1），唤醒 Start 的重连循环
+
+	subMu   sync.Mutex
+	subs    map[int]chan Event
+	nextSub int
+
+	hookMu    sync.Mutex
+	onConnect []func(*Client)
+}
+
+type request struct {
+	cmd   string
+	lines []string
+	done  chan result
+}
+
+type result struct {
+	lines []string
+	err   error
+}
+
+type dialCall struct {
+	done chan struct{}
+	err  error
+}
+
+// New 创建客户端。不会立即拨号：首条命令懒连接，或调用 Start 启动后台保活。
+func New(cfg Config) *Client {
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = 5 * time.Second
+	}
+	if cfg.CommandTimeout <= 0 {
+		cfg.CommandTimeout = 10 * time.Second
+	}
+	if cfg.ReconnectInterval <= 0 {
+		cfg.ReconnectInterval = 5 * time.Second
+	}
+	return &Client{
+		cfg:  cfg,
+		lost: make(chan struct{}, 1),
+		subs: make(map[int]chan Event),
+	}
+}
+
+// Start 启动后台保活：立即尝试连接，断线后每隔 ReconnectInterval 重连，直到 ctx 取消。
+// 需要持续接收实时通知（会话跟踪）的长驻进程调用；一次性命令（CLI）无需调用。
+func (c *Client) Start(ctx context.Context) {
+	go func() {
+		for {
+			if err := c.connect(); err != nil && !errors.Is(err, ErrClosed) {
+				logging.Debug("management interface %s unavailable: %v", c.cfg.Addr, err)
+			}
+			if c.Connected() {
+				select {
+				case <-ctx.Done():
+					c.Close()
+					return
+				case <-c.lost:
+				}
+			}
+			select {
+			case <-ctx.Done():
+				c.Close()
+				return
+			case <-time.After(c.cfg.ReconnectInterval):
+			}
+		}
+	}()
+}
+
+// Connected 当前是否持有一条已完成握手的连接
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn != nil
+}
+
+// OnConnect 注册连接（含重连）建立后的回调，用于重新下发 bytecount 等会话级设置。
+// 回调在独立 goroutine 中执行，可以直接调用 Exec。
+func (c *Client) OnConnect(fn func(*Client)) {
+	c.hookMu.Lock()
+	c.onConnect = append(c.onConnect, fn)
+	c.hookMu.Unlock()
+	if c.Connected() {
+		go fn(c)
+	}
+}
+
+// Close 断开连接并停止后续的懒连接/重连，等待中的命令返回 ErrClosed。
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	conn := c.conn
+	c.mu.Unlock()
+	if conn != nil {
+		c.dropConn(conn, ErrClosed)
+	}
+	return nil
+}
+
+// Exec 发送一条命令并等待回复。
+// 单行回复返回 "SUCCESS: " 之后的内容；多行回复返回 END 之前的所有行；
+// "ERROR: ..." 以 *CommandError 返回。未连接时先尝试连接一次。
+func (c *Client) Exec(cmd string) ([]string, error) {
+	if strings.ContainsAny(cmd, "\r\n") {
+		return nil, fmt.Errorf("management command must be a single line: %q", cmd)
+	}
+	if err := c.connect(); err != nil {
+		return nil, err
+	}
+
+	req := &request{cmd: cmd, done: make(chan result, 1)}
+	c.mu.Lock()
+	conn := c.conn
+	if conn == nil {
+		c.mu.Unlock()
+		return nil, ErrNotConnected
+	}
+	// 入队与写出在同一把锁内完成，保证 pending 顺序与服务端收到命令的顺序一致。
+	c.pending = append(c.pending, req)
+	_ = conn.SetWriteDeadline(time.Now().Add(c.cfg.CommandTimeout))
+	_, err := fmt.Fprintf(conn, "%s\n", cmd)
+	c.mu.Unlock()
+	if err != nil {
+		c.dropConn(conn, err)
+		return nil, fmt.Errorf("send %q: %w", cmd, err)
+	}
+
+	select {
+	case res := <-req.done:
+		return res.lines, res.err
+	case <-time.After(c.cfg.CommandTimeout):
+		// 回复丢失后 FIFO 已经错位，只能丢弃整条连接重来。
+		c.dropConn(conn, fmt.Errorf("timeout waiting for reply to %q", cmd))
+		return nil, fmt.Errorf("timeout waiting for reply to %q", cmd)
+	}
+}
+
+// connect 若尚未连接则拨号并完成口令握手。拨号与握手不持有 c.mu（管理端口卡住时
+// Connected / Close / 回复分派不受影响），完成后再在锁内换上新连接；并发调用共用同一次拨号。
+func (c *Client) connect() error {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return ErrClosed
+	}
+	if c.conn != nil {
+		c.mu.Unlock()
+		return nil
+	}
+	if d := c.dial; d != nil {
+		c.mu.Unlock()
+		<-d.done
+		return d.err
+	}
+	d := &dialCall{done: make(chan struct{})}
+	c.dial = d
+	c.mu.Unlock()
+
+	conn, reader, err := c.dialConn()
+	c.mu.Lock()
+	c.dial = nil
+	if err == nil && c.closed {
+		conn.Close()
+		err = ErrClosed
+	}
+	if err == nil {
+		c.conn = conn
+	}
+	c.mu.Unlock()
+	d.err = err
+	close(d.done)
+	if err != nil {
+		return err
+	}
+	go c.readLoop(conn, reader)
+
+	c.hookMu.Lock()
+	hooks := append([]func(*Client){}, c.onConnect...)
+	c.hookMu.Unlock()
+	for _, fn := range hooks {
+		go fn(c)
+	}
+	return nil
+}
+
+// dialConn 拨号并完成口令握手
+func (c *Client) dialConn() (net.Conn, *bufio.Reader, error) {
+	conn, err := net.DialTimeout("tcp", c.cfg.Addr, c.cfg.DialTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect management interface: %w", err)
+	}
+	reader := bufio.NewReader(conn)
+	if err := c.handshake(conn, reader); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, reader, nil
+}
+
+// handshake 处理口令提示。带口令时服务端先发不换行的 "ENTER PASSWORD:"，
+// 回 "SUCCESS: password is correct" 后才进入正常命令模式；不带口令时直接是 >INFO 横幅，
+// 原样留在 reader 里交给 readLoop 当通知处理。
+func (c *Client) handshake(conn net.Conn, reader *bufio.Reader) error {
+	_ = conn.SetReadDeadline(time.Now().Add(c.cfg.DialTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	head, err := reader.Peek(len(passwordPrompt))
+	if err != nil {
+		return fmt.Errorf("read management greeting: %w", err)
+	}
+	if string(head) != passwordPrompt {
+		return nil
+	}
+	if _, err := reader.Discard(len(passwordPrompt)); err != nil {
+		return err
+	}
+
+	password, err := c.password()
+	if err != nil {
+		return err
+	}
+	if password == "" {
+		return fmt.Errorf("management interface requires a password but none is configured")
+	}
+	if _, err := fmt.Fprintf(conn, "%s\n", password); err != nil {
+		return fmt.Errorf("send management password: %w", err)
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return fmt.Errorf("read password reply: %w", err)
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "SUCCESS:"):
+			return nil
+		case strings.HasPrefix(line, "ERROR:"), strings.HasPrefix(line, passwordPrompt):
+			return fmt.Errorf("management password rejected: %s", line)
+		}
+	}
+}
+
+func (c *Client) password() (string, error) {
+	if c.cfg.PasswordFile == "" {
+		return "", nil
+	}
+	data, err := os.ReadFile(c.cfg.PasswordFile)
+	if err != nil {
+		return "", fmt.Errorf("read management password file: %w", err)
+	}
+	line, _, _ := strings.Cut(string(data), "\n")
+	return strings.TrimRight(line, "\r"), nil
+}
+
+// readLoop 读取连接上的每一行：'>' 开头的是实时通知，其余归属队首命令的回复。
+func (c *Client) readLoop(conn net.Conn, reader *bufio.Reader) {
+	// 正在组装的 >CLIENT 通知：CONNECT/REAUTH/ESTABLISHED/DISCONNECT 之后跟若干
+	// >CLIENT:ENV 行，直到 >CLIENT:ENV,END 才算完整。
+	var building *ClientEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			c.dropConn(conn, err)
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if strings.HasPrefix(line, ">") {
+			c.handleNotification(line[1:], &building)
+			continue
+		}
+		c.handleReplyLine(line)
+	}
+}
+
+func (c *Client) handleReplyLine(line string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.pending) == 0 {
+		if line != "" {
+			logging.Debug("management: unsolicited line %q", line)
+		}
+		return
+	}
+	req := c.pending[0]
+	var res *result
+	switch {
+	case len(req.lines) == 0 && strings.HasPrefix(line, "SUCCESS:"):
+		res = &result{lines: []string{strings.TrimSpace(strings.TrimPrefix(line, "SUCCESS:"))}}
+	case len(req.lines) == 0 && strings.HasPrefix(line, "ERROR:"):
+		res = &result{err: &CommandError{Command: req.cmd, Message: strings.TrimSpace(strings.TrimPrefix(line, "ERROR:"))}}
+	case line == "END":
+		res = &result{lines: req.lines}
+	default:
+		req.lines = append(req.lines, line)
+		return
+	}
+	c.pending = c.pending[1:]
+	req.done <- *res
+}
+
+// dropConn 关闭 conn（若仍是当前连接），让所有等待中的命令失败并通知重连循环。
+func (c *Client) dropConn(conn net.Conn, cause error) {
+	c.mu.Lock()
+	if c.conn != conn {
+		c.mu.Unlock()
+		return
+	}
+	c.conn = nil
+	pending := c.pending
+	c.pending = nil
+	closed := c.closed
+	c.mu.Unlock()
+
+	conn.Close()
+	err := ErrNotConnected
+	if closed {
+		err = ErrClosed
+	}
+	for _, req := range pending {
+		req.done <- result{err: fmt.Errorf("%w: %v", err, cause)}
+	}
+	if !closed {
+		logging.Warn("management interface %s disconnected: %v", c.cfg.Addr, cause)
+	}
+	select {
+	case c.lost <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,336 @@
+package mgmt
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServer 进程内的假管理接口：口令握手 + 少量命令 + 可主动推送通知/断开连接。
+type fakeServer struct {
+	t        *testing.T
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	conns    []net.Conn
+	accepted int
+	commands []string
+}
+
+func newFakeServer(t *testing.T, password string) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeServer{t: t, ln: ln, password: password}
+	go s.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		s.dropAll()
+	})
+	return s
+}
+
+func (s *fakeServer) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.conns = append(s.conns, conn)
+		s.accepted++
+		s.mu.Unlock()
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeServer) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	if s.password != "" {
+		fmt.Fprint(conn, "ENTER PASSWORD:")
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		if strings.TrimSpace(line) != s.password {
+			fmt.Fprint(conn, "ERROR: bad password\n")
+			return
+		}
+		fmt.Fprint(conn, "SUCCESS: password is correct\n")
+	}
+	fmt.Fprint(conn, ">INFO:OpenVPN Management Interface Version 3 -- type 'help' for more info\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		s.mu.Lock()
+		s.commands = append(s.commands, cmd)
+		s.mu.Unlock()
+		switch {
+		case cmd == "status 2":
+			// 回复中间插一条通知，验证通知不会混进命令回复
+			fmt.Fprint(conn, "TITLE,OpenVPN 2.6.8\n")
+			fmt.Fprint(conn, ">BYTECOUNT_CLI:7,100,200\n")
+			fmt.Fprint(conn, "CLIENT_LIST,alice,1.2.3.4:5555,10.8.0.2,,1,2,x,1,UNDEF,7,0,AES-256-GCM\n")
+			fmt.Fprint(conn, "END\n")
+		case cmd == `kill "alice"`:
+			fmt.Fprint(conn, "SUCCESS: common name 'alice' found, 1 client(s) killed\n")
+		case strings.HasPrefix(cmd, "kill "):
+			fmt.Fprintf(conn, "ERROR: common name '%s' not found\n", strings.Trim(strings.TrimPrefix(cmd, "kill "), `"`))
+		case strings.HasPrefix(cmd, "bytecount "):
+			fmt.Fprint(conn, "SUCCESS: bytecount interval changed\n")
+		default:
+			fmt.Fprint(conn, "ERROR: unknown command, enter 'help' for more options\n")
+		}
+	}
+}
+
+// push 向所有连接推送原始行
+func (s *fakeServer) push(lines ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		for _, l := range lines {
+			fmt.Fprint(c, l+"\n")
+		}
+	}
+}
+
+func (s *fakeServer) dropAll() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.conns {
+		c.Close()
+	}
+	s.conns = nil
+}
+
+func (s *fakeServer) acceptedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted
+}
+
+func newTestClient(t *testing.T, s *fakeServer) *Client {
+	pwFile := filepath.Join(t.TempDir(), "mgmt-pw.txt")
+	if err := os.WriteFile(pwFile, []byte(s.password+"\n"), 0600); err != nil {
+		t.Fatalf("write password file: %v", err)
+	}
+	c := New(Config{
+		Addr:              s.ln.Addr().String(),
+		PasswordFile:      pwFile,
+		DialTimeout:       time.Second,
+		CommandTimeout:    2 * time.Second,
+		ReconnectInterval: 20 * time.Millisecond,
+	})
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestExecWithPassword(t *testing.T) {
+	s := newFakeServer(t, "s3cret")
+	c := newTestClient(t, s)
+
+	reply, err := c.Kill("alice")
+	if err != nil {
+		t.Fatalf("Kill failed: %v", err)
+	}
+	if !strings.Contains(reply, "1 client(s) killed") {
+		t.Errorf("unexpected kill reply %q", reply)
+	}
+
+	_, err = c.Kill("bob")
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		t.Fatalf("expected CommandError for offline CN, got %v", err)
+	}
+	if !strings.Contains(cmdErr.Message, "not found") {
+		t.Errorf("unexpected error message %q", cmdErr.Message)
+	}
+}
+
+func TestBadPassword(t *testing.T) {
+	s := newFakeServer(t, "s3cret")
+	c := newTestClient(t, s)
+	c.cfg.PasswordFile = filepath.Join(t.TempDir(), "wrong")
+	os.WriteFile(c.cfg.PasswordFile, []byte("nope\n"), 0600)
+
+	if _, err := c.Exec("version"); err == nil || !strings.Contains(err.Error(), "rejected") {
+		t.Fatalf("expected password rejection, got %v", err)
+	}
+}
+
+func TestMultiLineResponseWithInterleavedNotification(t *testing.T) {
+	s := newFakeServer(t, "s3cret")
+	c := newTestClient(t, s)
+	events, cancel := c.Subscribe(16)
+	defer cancel()
+
+	lines, err := c.Status()
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], "CLIENT_LIST,alice") {
+		t.Fatalf("unexpected status lines %q", lines)
+	}
+
+	ev := waitEvent(t, events, EventByteCountCli)
+	if ev.Bytes == nil || ev.Bytes.CID != 7 || ev.Bytes.BytesIn != 100 || ev.Bytes.BytesOut != 200 {
+		t.Errorf("unexpected bytecount event %+v", ev.Bytes)
+	}
+}
+
+func TestClientNotificationWithEnv(t *testing.T) {
+	s := newFakeServer(t, "s3cret")
+	c := newTestClient(t, s)
+	events, cancel := c.Subscribe(16)
+	defer cancel()
+	if _, err := c.Exec("bytecount 5"); err != nil {
+		t.Fatalf("bytecount failed: %v", err)
+	}
+
+	s.push(
+		">CLIENT:ESTABLISHED,3",
+		">CLIENT:ENV,common_name=alice",
+		">CLIENT:ENV,trusted_ip=1.2.3.4",
+		">CLIENT:ENV,ifconfig_pool_remote_ip=10.8.0.6",
+		">CLIENT:ENV,time_unix=1749637756",
+		">CLIENT:ENV,END",
+		">CLIENT:ADDRESS,3,10.8.0.6,1",
+	)
+
+	ev := waitEvent(t, events, EventClient)
+	if ev.Client.Action != ClientEstablished || ev.Client.CID != 3 {
+		t.Fatalf("unexpected client event %+v", ev.Client)
+	}
+	if ev.Client.CommonName() != "alice" || ev.Client.Env["trusted_ip"] != "1.2.3.4" {
+		t.Errorf("unexpected env %v", ev.Client.Env)
+	}
+	if ev.Client.EnvInt64("time_unix") != 1749637756 {
+		t.Errorf("unexpected time_unix %d", ev.Client.EnvInt64("time_unix"))
+	}
+
+	ev = waitEvent(t, events, EventClient)
+	if ev.Client.Action != ClientAddress || ev.Client.Address != "10.8.0.6" {
+		t.Errorf("unexpected address event %+v", ev.Client)
+	}
+}
+
+func TestReconnectReplaysOnConnectHooks(t *testing.T) {
+	s := newFakeServer(t, "s3cret")
+	c := newTestClient(t, s)
+
+	hooks := make(chan struct{}, 4)
+	c.OnConnect(func(cl *Client) {
+		if err := cl.ByteCount(5); err == nil {
+			hooks <- struct{}{}
+		}
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c.Start(ctx)
+
+	waitSignal(t, hooks, "first OnConnect")
+	s.dropAll()
+	waitSignal(t, hooks, "OnConnect after reconnect")
+
+	if n := s.acceptedCount(); n < 2 {
+		t.Errorf("expected reconnect, server accepted %d connections", n)
+	}
+	if _, err := c.Kill("alice"); err != nil {
+		t.Errorf("command after reconnect failed: %v", err)
+	}
+}
+
+// 管理端口接受连接却迟迟不发问候时，拨号不能卡住其他调用方
+func TestStalledDialDoesNotHoldLock(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+	c := New(Config{Addr: ln.Addr().String(), DialTimeout: 2 * time.Second})
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := c.Exec("status 2")
+			errs <- err
+		}()
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	if c.Connected() {
+		t.Error("should not be connected")
+	}
+	c.Close()
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("Connected/Close blocked for %s during dial", d)
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err == nil {
+			t.Error("Exec should fail against a stalled server")
+		}
+	}
+	if c.Connected() {
+		t.Error("closed client must not keep the late connection")
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := quote(`a"b\c`); got != `"a\"b\\c"` {
+		t.Errorf("quote = %s", got)
+	}
+	if _, err := (&Client{}).Exec("kill a\nsignal SIGTERM"); err == nil {
+		t.Error("expected multi-line command to be rejected")
+	}
+}
+
+func waitEvent(t *testing.T, ch <-chan Event, typ string) Event {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-ch:
+			if ev.Type == typ {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("timed out waiting for >%s event", typ)
+		}
+	}
+}
+
+func waitSignal(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(2 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
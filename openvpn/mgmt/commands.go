@@ -0,0 +1,44 @@
+package mgmt
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Kill 断开 CN 为 commonName 的所有会话。CN 不在线时服务端回 ERROR，以 *CommandError 返回。
+func (c *Client) Kill(commonName string) (string, error) {
+	lines, err := c.Exec("kill " + quote(commonName))
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// ClientKill 按客户端 ID（>CLIENT 通知里的 CID）断开单个会话
+func (c *Client) ClientKill(cid int64) error {
+	_, err := c.Exec(fmt.Sprintf("client-kill %d", cid))
+	return err
+}
+
+// ByteCount 让服务端每隔 seconds 秒推送一次 >BYTECOUNT_CLI；0 表示关闭。
+// 该设置随连接失效，重连后需重新下发（见 OnConnect）。
+func (c *Client) ByteCount(seconds int) error {
+	_, err := c.Exec(fmt.Sprintf("bytecount %d", seconds))
+	return err
+}
+
+// Status 返回 status 2 格式（与 status.log 相同的逗号分隔格式）的实时状态行
+func (c *Client) Status() ([]string, error) {
+	return c.Exec("status 2")
+}
+
+// Version 返回 OpenVPN 与管理接口版本信息
+func (c *Client) Version() ([]string, error) {
+	return c.Exec("version")
+}
+
+// quote 按管理协议的参数规则加引号：包在双引号里，反斜杠与双引号转义。
+func quote(arg string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + r.Replace(arg) + `"`
+}
@@ -0,0 +1,162 @@
+package mgmt
+
+import (
+	"strconv"
+	"strings"
+
+	"openvpn-admin-go/logging"
+)
+
+// 实时通知类型（'>' 之后、第一个 ':' 之前的部分）
+const (
+	EventInfo         = "INFO"
+	EventClient       = "CLIENT"
+	EventByteCount    = "BYTECOUNT"     // 客户端模式：>BYTECOUNT:in,out
+	EventByteCountCli = "BYTECOUNT_CLI" // 服务端模式：>BYTECOUNT_CLI:cid,in,out
+	EventState        = "STATE"
+)
+
+// >CLIENT 通知的动作
+const (
+	ClientConnect     = "CONNECT"
+	ClientReauth      = "REAUTH"
+	ClientEstablished = "ESTABLISHED"
+	ClientDisconnect  = "DISCONNECT"
+	ClientAddress     = "ADDRESS"
+)
+
+// Event 一条实时通知
+type Event struct {
+	Type    string
+	Payload string // 第一个 ':' 之后的原始内容
+	// Client 仅 Type == EventClient 时非空
+	Client *ClientEvent
+	// Bytes 仅 Type == EventByteCount / EventByteCountCli 时非空
+	Bytes *ByteCount
+}
+
+// ClientEvent >CLIENT 通知。CONNECT/REAUTH/ESTABLISHED/DISCONNECT 带完整的 ENV 块，
+// ADDRESS 为单行（Address 字段）。
+type ClientEvent struct {
+	Action  string
+	CID     int64
+	KID     int64
+	Address string
+	Env     map[string]string
+}
+
+// CommonName 证书 CN（即用户名）
+func (e *ClientEvent) CommonName() string {
+	return e.Env["common_name"]
+}
+
+// EnvInt64 把 ENV 中的数值字段（bytes_received、time_unix 等）解析为 int64，缺失或非法返回 0
+func (e *ClientEvent) EnvInt64(key string) int64 {
+	v, _ := strconv.ParseInt(e.Env[key], 10, 64)
+	return v
+}
+
+// ByteCount 流量计数通知；服务端模式下 CID 标识客户端，客户端模式下为 -1。
+// BytesIn / BytesOut 以服务端视角计：In 为从该客户端收到的字节。
+type ByteCount struct {
+	CID      int64
+	BytesIn  int64
+	BytesOut int64
+}
+
+// Subscribe 订阅实时通知。buffer 满时新通知被丢弃（不阻塞读循环）；
+// 调用返回的 cancel 取消订阅并关闭 channel。
+func (c *Client) Subscribe(buffer int) (<-chan Event, func()) {
+	ch := make(chan Event, buffer)
+	c.subMu.Lock()
+	id := c.nextSub
+	c.nextSub++
+	c.subs[id] = ch
+	c.subMu.Unlock()
+
+	cancel := func() {
+		c.subMu.Lock()
+		if _, ok := c.subs[id]; ok {
+			delete(c.subs, id)
+			close(ch)
+		}
+		c.subMu.Unlock()
+	}
+	return ch, cancel
+}
+
+func (c *Client) publish(ev Event) {
+	c.subMu.Lock()
+	defer c.subMu.Unlock()
+	for _, ch := range c.subs {
+		select {
+		case ch <- ev:
+		default:
+			logging.Warn("management: subscriber buffer full, dropping >%s event", ev.Type)
+		}
+	}
+}
+
+// handleNotification 解析一条 '>' 通知（已去掉 '>'）。building 保存跨行组装中的 >CLIENT 事件。
+func (c *Client) handleNotification(line string, building **ClientEvent) {
+	typ, payload, _ := strings.Cut(line, ":")
+	ev := Event{Type: typ, Payload: payload}
+
+	switch typ {
+	case EventClient:
+		action, rest, _ := strings.Cut(payload, ",")
+		if action == "ENV" {
+			if *building == nil {
+				return
+			}
+			if rest == "END" {
+				ev.Client = *building
+				*building = nil
+				c.publish(ev)
+				return
+			}
+			key, value, _ := strings.Cut(rest, "=")
+			(*building).Env[key] = value
+			return
+		}
+		args := strings.Split(rest, ",")
+		ce := &ClientEvent{Action: action, CID: -1, KID: -1, Env: make(map[string]string)}
+		if len(args) > 0 {
+			ce.CID = parseInt64(args[0])
+		}
+		if action == ClientAddress {
+			if len(args) > 1 {
+				ce.Address = args[1]
+			}
+			ev.Client = ce
+			c.publish(ev)
+			return
+		}
+		if len(args) > 1 {
+			ce.KID = parseInt64(args[1])
+		}
+		*building = ce
+	case EventByteCountCli:
+		f := strings.Split(payload, ",")
+		if len(f) == 3 {
+			ev.Bytes = &ByteCount{CID: parseInt64(f[0]), BytesIn: parseInt64(f[1]), BytesOut: parseInt64(f[2])}
+		}
+		c.publish(ev)
+	case EventByteCount:
+		f := strings.Split(payload, ",")
+		if len(f) == 2 {
+			ev.Bytes = &ByteCount{CID: -1, BytesIn: parseInt64(f[0]), BytesOut: parseInt64(f[1])}
+		}
+		c.publish(ev)
+	default:
+		c.publish(ev)
+	}
+}
+
+func parseInt64(s string) int64 {
+	v, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	if err != nil {
+		return -1
+	}
+	return v
+}
@@ -0,0 +1,212 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultIntermediateValidity 中间 CA 的有效期。根 CA 离线保存，中间 CA 在线签发，
+// 有效期短一些，到期前通过 CA 轮换换新。
+const DefaultIntermediateValidity = 5 * 365 * 24 * time.Hour
+
+// NewIntermediateRequest 在线生成中间 CA 的私钥与 CSR（PEM）。私钥不离开服务器，
+// CSR 拿到离线的根 CA 上用 SignIntermediate 签名。
+func NewIntermediateRequest(commonName string, alg KeyAlgorithm) (crypto.Signer, []byte, error) {
+	key, err := GenerateKey(alg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成中间CA私钥失败: %w", err)
+	}
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成CSR失败: %w", err)
+	}
+	return key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: der}), nil
+}
+
+// SignIntermediate 用根 CA 签发中间 CA 证书（pathlen=0：只能签终端证书）。
+// 只采用 CSR 里的 CN 与公钥，其余扩展由这里决定。
+func SignIntermediate(root *CA, csrPEM []byte, validity time.Duration) (*x509.Certificate, error) {
+	csr, err := ParseCertificateRequestPEM(csrPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析CSR失败: %w", err)
+	}
+	if err := csr.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("CSR 签名无效: %w", err)
+	}
+	return signIntermediate(root, csr.Subject.CommonName, csr.PublicKey, validity)
+}
+
+// NewIntermediate 根私钥临时可用时一步生成中间 CA（密钥 + 根 CA 签发的证书）
+func NewIntermediate(root *CA, commonName string, validity time.Duration, alg KeyAlgorithm) (*CA, *Issued, error) {
+	key, err := GenerateKey(alg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成中间CA私钥失败: %w", err)
+	}
+	cert, err := signIntermediate(root, commonName, key.Public(), validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := EncodePrivateKeyPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &CA{Cert: cert, Key: key}, &Issued{Cert: cert, CertPEM: EncodeCertificatePEM(cert), KeyPEM: keyPEM}, nil
+}
+
+func signIntermediate(root *CA, commonName string, pub crypto.PublicKey, validity time.Duration) (*x509.Certificate, error) {
+	if commonName == "" {
+		return nil, errors.New("common name is required")
+	}
+	if validity <= 0 {
+		validity = DefaultIntermediateValidity
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(root.Cert.NotAfter) {
+		// 中间 CA 不能比根 CA 活得久
+		notAfter = root.Cert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              notAfter,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+		SubjectKeyId:          subjectKeyID(pub),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuerCert(root.Cert), pub, root.Key)
+	if err != nil {
+		return nil, fmt.Errorf("签发中间CA证书失败: %w", err)
+	}
+	return x509.ParseCertificate(der)
+}
+
+// RootCRL 根 CA 签发的（空）CRL。
+//
+// OpenVPN 的 crl-verify 会检查整条证书链（OpenSSL X509_V_FLAG_CRL_CHECK_ALL），中间 CA 也
+// 需要一份由根 CA 签发的 CRL，否则所有连接都会因「找不到 CRL」被拒。根私钥离线保存，
+// 所以在签中间 CA 时顺手签出一份长有效期的 CRL；序号取当前 Unix 时间，保证单调递增。
+func RootCRL(root *CA, validity time.Duration) ([]byte, error) {
+	return signCRL(root, nil, time.Now().Unix(), validity)
+}
+
+// Verify 检查 CA 私钥与证书匹配，且证书能经 chain（签发 CA 之上的证书）验证到 chain 里的自签根。
+// chain 为空时 CA 自身必须是自签根。
+func (ca *CA) Verify(chain []*x509.Certificate) error {
+	pub, ok := ca.Key.Public().(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(ca.Cert.PublicKey) {
+		return errors.New("CA 私钥与证书不匹配")
+	}
+	if !ca.Cert.IsCA {
+		return errors.New("证书不是 CA 证书")
+	}
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	if len(chain) == 0 {
+		if !IsSelfSigned(ca.Cert) {
+			return errors.New("中间CA缺少根CA证书")
+		}
+		roots.AddCert(issuerCert(ca.Cert))
+	}
+	for _, c := range chain {
+		if IsSelfSigned(c) {
+			roots.AddCert(issuerCert(c))
+		} else {
+			intermediates.AddCert(c)
+		}
+	}
+	if _, err := issuerCert(ca.Cert).Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("CA 证书链验证失败: %w", err)
+	}
+	return nil
+}
+
+// IsSelfSigned 是否为自签证书（根 CA）
+func IsSelfSigned(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, cert.RawSubject) && cert.CheckSignatureFrom(issuerCert(cert)) == nil
+}
+
+// IssuedBy 证书是否由 ca 签发
+func IssuedBy(cert, ca *x509.Certificate) bool {
+	return bytes.Equal(cert.RawIssuer, ca.RawSubject) && cert.CheckSignatureFrom(issuerCert(ca)) == nil
+}
+
+// CAID CA 的标识：SubjectKeyId 的大写十六进制（旧 CA 没有 SKID 时按公钥计算，与 openssl "hash" 一致）
+func CAID(ca *x509.Certificate) string {
+	return strings.ToUpper(hex.EncodeToString(issuerCert(ca).SubjectKeyId))
+}
+
+// AuthorityID 证书签发 CA 的标识（AuthorityKeyId），与签发 CA 的 CAID 相同；证书没有 AKID 时为空串
+func AuthorityID(cert *x509.Certificate) string {
+	return strings.ToUpper(hex.EncodeToString(cert.AuthorityKeyId))
+}
+
+// ParseCRLPEM 解析第一个 X509 CRL 块
+func ParseCRLPEM(data []byte) (*x509.RevocationList, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no X509 CRL block found")
+		}
+		if block.Type == "X509 CRL" {
+			return x509.ParseRevocationList(block.Bytes)
+		}
+	}
+}
+
+// ParseCertificatesPEM 解析所有 CERTIFICATE 块（CA 链 / 信任集合文件）
+func ParseCertificatesPEM(data []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs, nil
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+}
+
+// EncodeCertificatesPEM 依次编码多张证书，跳过重复的证书
+func EncodeCertificatesPEM(certs ...*x509.Certificate) []byte {
+	var buf bytes.Buffer
+	seen := make(map[string]bool)
+	for _, c := range certs {
+		if seen[string(c.Raw)] {
+			continue
+		}
+		seen[string(c.Raw)] = true
+		buf.Write(EncodeCertificatePEM(c))
+	}
+	return buf.Bytes()
+}
@@ -0,0 +1,115 @@
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"strings"
+)
+
+// KeyAlgorithm 新签发证书使用的密钥算法
+type KeyAlgorithm string
+
+const (
+	KeyRSA2048   KeyAlgorithm = "rsa2048"
+	KeyRSA3072   KeyAlgorithm = "rsa3072"
+	KeyRSA4096   KeyAlgorithm = "rsa4096"
+	KeyECDSAP256 KeyAlgorithm = "ecdsa-p256"
+	KeyECDSAP384 KeyAlgorithm = "ecdsa-p384"
+	KeyEd25519   KeyAlgorithm = "ed25519"
+)
+
+// DefaultKeyAlgorithm 与原 `openssl genrsa 2048` 一致
+const DefaultKeyAlgorithm = KeyRSA2048
+
+// KeyAlgorithms 所有支持的算法（配置项的可选值）
+var KeyAlgorithms = []KeyAlgorithm{KeyRSA2048, KeyRSA3072, KeyRSA4096, KeyECDSAP256, KeyECDSAP384, KeyEd25519}
+
+// ParseKeyAlgorithm 解析配置值（大小写不敏感），空串返回默认算法
+func ParseKeyAlgorithm(s string) (KeyAlgorithm, error) {
+	if s == "" {
+		return DefaultKeyAlgorithm, nil
+	}
+	alg := KeyAlgorithm(strings.ToLower(strings.TrimSpace(s)))
+	for _, a := range KeyAlgorithms {
+		if a == alg {
+			return a, nil
+		}
+	}
+	return "", fmt.Errorf("unsupported key algorithm %q", s)
+}
+
+// IsEC 是否为椭圆曲线算法（ECDSA / Ed25519）：服务端改用 `dh none` + ECDHE，无需 dh.pem
+func (a KeyAlgorithm) IsEC() bool {
+	switch a {
+	case KeyECDSAP256, KeyECDSAP384, KeyEd25519:
+		return true
+	}
+	return false
+}
+
+// ECDHCurve server.conf `ecdh-curve` 使用的曲线名（OpenSSL 命名）；RSA 返回空串
+func (a KeyAlgorithm) ECDHCurve() string {
+	switch a {
+	case KeyECDSAP256:
+		return "prime256v1"
+	case KeyECDSAP384:
+		return "secp384r1"
+	case KeyEd25519:
+		return "X25519"
+	}
+	return ""
+}
+
+// GenerateKey 按算法生成私钥
+func GenerateKey(alg KeyAlgorithm) (crypto.Signer, error) {
+	switch alg {
+	case KeyRSA2048, "":
+		return rsa.GenerateKey(rand.Reader, 2048)
+	case KeyRSA3072:
+		return rsa.GenerateKey(rand.Reader, 3072)
+	case KeyRSA4096:
+		return rsa.GenerateKey(rand.Reader, 4096)
+	case KeyECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case KeyECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	case KeyEd25519:
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		return key, err
+	}
+	return nil, fmt.Errorf("unsupported key algorithm %q", alg)
+}
+
+// CheckPublicKey 校验用户自带密钥（CSR）的强度：RSA 至少 2048 位，ECDSA 仅 P-256 / P-384，或 Ed25519
+func CheckPublicKey(pub crypto.PublicKey) error {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return fmt.Errorf("RSA key too short: %d bits", k.N.BitLen())
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() {
+			return fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+		return nil
+	case ed25519.PublicKey:
+		return nil
+	}
+	return fmt.Errorf("unsupported public key type %T", pub)
+}
+
+// leafKeyUsage 终端证书的 keyUsage：只有 RSA 密钥交换需要 keyEncipherment
+func leafKeyUsage(pub crypto.PublicKey, server bool) x509.KeyUsage {
+	usage := x509.KeyUsageDigitalSignature
+	if _, isRSA := pub.(*rsa.PublicKey); isRSA && server {
+		usage |= x509.KeyUsageKeyEncipherment
+	}
+	return usage
+}
@@ -0,0 +1,447 @@
+// Package pki 基于 crypto/x509 的最小 CA：签发客户端 / 服务端证书、维护签发记录、生成 CRL。
+//
+// 取代原先拼 openssl 命令行（genrsa / req / x509 / ca）的做法：不再依赖 openssl 可执行文件，
+// 用户名只作为证书 CN 字段传入，不经过 shell，签发流程可以直接写 Go 单元测试。
+package pki
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// DefaultClientValidity 客户端证书默认有效期，与原 `openssl x509 -days 3650` 一致
+const DefaultClientValidity = 3650 * 24 * time.Hour
+
+// DefaultCAValidity 新建根 CA 的有效期，与原 `openssl req -x509 -days 3650` 一致
+const DefaultCAValidity = 3650 * 24 * time.Hour
+
+// DefaultCRLValidity CRL 的 nextUpdate 距今时长，与原 crl.cnf 的 default_crl_days = 3650 一致。
+// crl-verify 遇到过期 CRL 会拒绝所有连接，所以给足余量，每次吊销都会重签。
+const DefaultCRLValidity = 3650 * 24 * time.Hour
+
+// CA 签发用的证书与私钥
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// LoadCA 读取 PEM 格式的 CA 证书与私钥（私钥支持 PKCS#1 / PKCS#8 / SEC1）
+func LoadCA(certPath, keyPath string) (*CA, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取CA证书失败: %w", err)
+	}
+	cert, err := ParseCertificatePEM(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析CA证书失败: %w", err)
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取CA密钥失败: %w", err)
+	}
+	key, err := ParsePrivateKeyPEM(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("解析CA密钥失败: %w", err)
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// NewCA 生成 alg 算法的自签根 CA（取代 `openssl req -x509`），带 cRLSign / keyCertSign 用途。
+// 返回的 Issued 含 CA 证书与私钥的 PEM，便于调用方落盘。
+func NewCA(commonName string, validity time.Duration, alg KeyAlgorithm) (*CA, *Issued, error) {
+	key, err := GenerateKey(alg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成CA私钥失败: %w", err)
+	}
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          subjectKeyID(key.Public()),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("生成CA证书失败: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := EncodePrivateKeyPEM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &CA{Cert: cert, Key: key}, &Issued{Cert: cert, CertPEM: EncodeCertificatePEM(cert), KeyPEM: keyPEM}, nil
+}
+
+// ParseCertificatePEM 解析第一个 CERTIFICATE 块
+func ParseCertificatePEM(data []byte) (*x509.Certificate, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no CERTIFICATE block found")
+		}
+		if block.Type == "CERTIFICATE" {
+			return x509.ParseCertificate(block.Bytes)
+		}
+	}
+}
+
+// ParseCertificateRequestPEM 解析 PEM 格式的 PKCS#10 CSR（不校验签名）
+func ParseCertificateRequestPEM(data []byte) (*x509.CertificateRequest, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no CERTIFICATE REQUEST block found")
+		}
+		if block.Type == "CERTIFICATE REQUEST" || block.Type == "NEW CERTIFICATE REQUEST" {
+			return x509.ParseCertificateRequest(block.Bytes)
+		}
+	}
+}
+
+// ParsePrivateKeyPEM 解析 PKCS#1、PKCS#8 或 SEC1 私钥
+func ParsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key block found")
+		}
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported private key type %T", key)
+			}
+			return signer, nil
+		}
+	}
+}
+
+// EncodeCertificatePEM 证书编码为 PEM
+func EncodeCertificatePEM(cert *x509.Certificate) []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+}
+
+// EncodePrivateKeyPEM 私钥编码为 PKCS#8 PEM（OpenVPN / OpenSSL 3 的默认格式）
+func EncodePrivateKeyPEM(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// SerialHex 证书序列号的大写十六进制表示，与 `openssl x509 -serial` 输出一致，用作签发记录的主键
+func SerialHex(serial *big.Int) string {
+	return fmt.Sprintf("%X", serial)
+}
+
+// PKI 一个 CA 加上它的签发记录
+type PKI struct {
+	ca    *CA
+	store *Store
+}
+
+// New 组合 CA 与签发记录
+func New(ca *CA, store *Store) *PKI {
+	return &PKI{ca: ca, store: store}
+}
+
+// Open 加载 CA 并打开（不存在则新建）签发记录
+func Open(caCertPath, caKeyPath, dbPath string) (*PKI, error) {
+	ca, err := LoadCA(caCertPath, caKeyPath)
+	if err != nil {
+		return nil, err
+	}
+	store, err := OpenStore(dbPath)
+	if err != nil {
+		return nil, err
+	}
+	return New(ca, store), nil
+}
+
+// CA 返回签发用的 CA
+func (p *PKI) CA() *CA { return p.ca }
+
+// Store 返回签发记录
+func (p *PKI) Store() *Store { return p.store }
+
+// Issued 一次签发的结果
+type Issued struct {
+	Cert    *x509.Certificate
+	CertPEM []byte
+	KeyPEM  []byte
+}
+
+// IssueClient 为 commonName 生成 alg 算法的新密钥并签发客户端证书（extendedKeyUsage = clientAuth），
+// 写入签发记录。扩展与原 openssl-client.ext 保持一致。
+func (p *PKI) IssueClient(commonName string, validity time.Duration, alg KeyAlgorithm) (*Issued, error) {
+	if validity <= 0 {
+		validity = DefaultClientValidity
+	}
+	return p.issue(commonName, validity, alg, false)
+}
+
+// IssueServer 签发服务端证书（extendedKeyUsage = serverAuth），扩展与原 openssl-server.ext 一致
+func (p *PKI) IssueServer(commonName string, validity time.Duration, alg KeyAlgorithm) (*Issued, error) {
+	if validity <= 0 {
+		validity = DefaultClientValidity
+	}
+	return p.issue(commonName, validity, alg, true)
+}
+
+func (p *PKI) issue(commonName string, validity time.Duration, alg KeyAlgorithm, server bool) (*Issued, error) {
+	if commonName == "" {
+		return nil, errors.New("common name is required")
+	}
+	key, err := GenerateKey(alg)
+	if err != nil {
+		return nil, fmt.Errorf("生成私钥失败: %w", err)
+	}
+	issued, err := p.sign(commonName, key.Public(), validity, server)
+	if err != nil {
+		return nil, err
+	}
+	if issued.KeyPEM, err = EncodePrivateKeyPEM(key); err != nil {
+		return nil, err
+	}
+	return issued, nil
+}
+
+// CheckClientCSR 校验用户上传的 CSR：签名有效、密钥强度合格、带 CN
+func CheckClientCSR(csr *x509.CertificateRequest) error {
+	if err := csr.CheckSignature(); err != nil {
+		return fmt.Errorf("CSR 签名无效: %w", err)
+	}
+	if err := CheckPublicKey(csr.PublicKey); err != nil {
+		return err
+	}
+	if csr.Subject.CommonName == "" {
+		return errors.New("common name is required")
+	}
+	return nil
+}
+
+// SignClientCSR 按 PKCS#10 CSR 签发客户端证书：私钥留在用户设备上，返回的 Issued 没有 KeyPEM。
+// 只采用 CSR 里的 CN 与公钥，扩展与 IssueClient 相同；CN 是否与账号一致由调用方校验。
+func (p *PKI) SignClientCSR(csr *x509.CertificateRequest, validity time.Duration) (*Issued, error) {
+	if err := CheckClientCSR(csr); err != nil {
+		return nil, err
+	}
+	if validity <= 0 {
+		validity = DefaultClientValidity
+	}
+	return p.sign(csr.Subject.CommonName, csr.PublicKey, validity, false)
+}
+
+func (p *PKI) sign(commonName string, pub crypto.PublicKey, validity time.Duration, server bool) (*Issued, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+	extUsage := x509.ExtKeyUsageClientAuth
+	if server {
+		extUsage = x509.ExtKeyUsageServerAuth
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             now.Add(-5 * time.Minute), // 容忍客户端时钟略慢
+		NotAfter:              now.Add(validity),
+		KeyUsage:              leafKeyUsage(pub, server),
+		ExtKeyUsage:           []x509.ExtKeyUsage{extUsage},
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+		SubjectKeyId:          subjectKeyID(pub),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, issuerCert(p.ca.Cert), pub, p.ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("签名证书失败: %w", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.store.Add(RecordFromCert(cert)); err != nil {
+		return nil, err
+	}
+	return &Issued{Cert: cert, CertPEM: EncodeCertificatePEM(cert)}, nil
+}
+
+// Revoke 吊销一张证书。证书不在签发记录里（例如迁移前由 openssl 签发的）时先补登记再吊销。
+// 已吊销的证书再次吊销不报错。
+func (p *PKI) Revoke(cert *x509.Certificate, reason int) error {
+	serial := SerialHex(cert.SerialNumber)
+	if _, ok := p.store.Lookup(serial); !ok {
+		if err := p.store.Add(RecordFromCert(cert)); err != nil {
+			return err
+		}
+	}
+	return p.store.Revoke(serial, time.Now(), reason)
+}
+
+// RevokeCommonName 吊销 commonName 名下所有仍有效的证书，返回吊销张数
+func (p *PKI) RevokeCommonName(commonName string, reason int) (int, error) {
+	n := 0
+	for _, rec := range p.store.ByCommonName(commonName) {
+		if rec.Status != StatusValid {
+			continue
+		}
+		if err := p.store.Revoke(rec.Serial, time.Now(), reason); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// CRL 用 CA 签出包含所有已吊销证书的 CRL（PEM），CRL 序号自增并持久化
+func (p *PKI) CRL(validity time.Duration) ([]byte, error) {
+	var entries []x509.RevocationListEntry
+	for _, rec := range p.store.Revoked() {
+		serial, ok := new(big.Int).SetString(rec.Serial, 16)
+		if !ok {
+			return nil, fmt.Errorf("invalid serial %q in cert database", rec.Serial)
+		}
+		entry := x509.RevocationListEntry{SerialNumber: serial, RevocationTime: rec.NotBefore}
+		if rec.RevokedAt != nil {
+			entry.RevocationTime = *rec.RevokedAt
+		}
+		if rec.Reason > 0 {
+			entry.ReasonCode = rec.Reason
+		}
+		entries = append(entries, entry)
+	}
+	number, err := p.store.NextCRLNumber()
+	if err != nil {
+		return nil, err
+	}
+	return signCRL(p.ca, entries, number, validity)
+}
+
+func signCRL(ca *CA, entries []x509.RevocationListEntry, number int64, validity time.Duration) ([]byte, error) {
+	if validity <= 0 {
+		validity = DefaultCRLValidity
+	}
+	now := time.Now()
+	tmpl := &x509.RevocationList{
+		RevokedCertificateEntries: entries,
+		Number:                    big.NewInt(number),
+		ThisUpdate:                now,
+		NextUpdate:                now.Add(validity),
+	}
+	der, err := x509.CreateRevocationList(rand.Reader, tmpl, issuerCert(ca.Cert), ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("签发 CRL 失败: %w", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// WriteCRL 生成 CRL 并原子替换 path（OpenVPN 每次新连接都会重读 crl-verify 文件，不能读到半截）
+func (p *PKI) WriteCRL(path string, validity time.Duration) error {
+	data, err := p.CRL(validity)
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(path, data, 0644)
+}
+
+// issuerCert crypto/x509 要求 CRL 签发者带 cRLSign 用途与 SubjectKeyId。
+// 旧版 `openssl req -x509` 建的 CA 可能没有 keyUsage 扩展（RFC 5280：缺省即不限用途）
+// 或没有 SKID，这里在副本上补齐，只影响 Go 的校验与签出证书 / CRL 的 AKID，不改 CA 本身。
+// 签发证书时同样以它为父证书，保证新证书都带 AKID（轮换时据此区分新旧 CA 签发的证书）。
+func issuerCert(ca *x509.Certificate) *x509.Certificate {
+	issuer := *ca
+	if issuer.KeyUsage == 0 {
+		issuer.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if len(issuer.SubjectKeyId) == 0 {
+		issuer.SubjectKeyId = subjectKeyID(ca.PublicKey)
+	}
+	return &issuer
+}
+
+func randomSerial() (*big.Int, error) {
+	// 128 位随机序列号，最高位清零保证 DER 编码为正数且不超过 20 字节
+	limit := new(big.Int).Lsh(big.NewInt(1), 127)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("生成序列号失败: %w", err)
+	}
+	return serial.Add(serial, big.NewInt(1)), nil
+}
+
+// subjectKeyID 按 RFC 5280 4.2.1.2 方法 (1) 计算：公钥 BIT STRING 的 SHA-1，与 openssl 的 "hash" 一致
+func subjectKeyID(pub crypto.PublicKey) []byte {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return nil
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil
+	}
+	sum := sha1.Sum(spki.PublicKey.Bytes)
+	return sum[:]
+}
+
+// WriteFileAtomic 先写同目录临时文件再 rename，读者（OpenVPN、并发请求）不会读到半截内容
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
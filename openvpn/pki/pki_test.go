@@ -0,0 +1,508 @@
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// newTestCA 生成自签 CA。bare 为 true 时模拟 `openssl req -x509` 默认配置：没有 keyUsage 扩展。
+func newTestCA(t *testing.T, bare bool) *CA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "OpenVPN-CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          subjectKeyID(key.Public()),
+	}
+	if !bare {
+		tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CA{Cert: cert, Key: key}
+}
+
+func newTestPKI(t *testing.T, bare bool) (*PKI, string) {
+	t.Helper()
+	dbPath := filepath.Join(t.TempDir(), "issued.json")
+	store, err := OpenStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return New(newTestCA(t, bare), store), dbPath
+}
+
+func TestIssueClient(t *testing.T) {
+	p, dbPath := newTestPKI(t, false)
+
+	issued, err := p.IssueClient("alice", time.Hour, DefaultKeyAlgorithm)
+	if err != nil {
+		t.Fatalf("IssueClient failed: %v", err)
+	}
+	cert, err := ParseCertificatePEM(issued.CertPEM)
+	if err != nil {
+		t.Fatalf("parse issued cert: %v", err)
+	}
+	if cert.Subject.CommonName != "alice" {
+		t.Errorf("CN = %q", cert.Subject.CommonName)
+	}
+	if cert.IsCA {
+		t.Error("client cert must not be a CA")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(p.CA().Cert)
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("issued cert does not verify as clientAuth: %v", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err == nil {
+		t.Error("client cert must not verify as serverAuth")
+	}
+
+	key, err := ParsePrivateKeyPEM(issued.KeyPEM)
+	if err != nil {
+		t.Fatalf("parse issued key: %v", err)
+	}
+	if !key.Public().(*rsa.PublicKey).Equal(cert.PublicKey) {
+		t.Error("private key does not match certificate")
+	}
+
+	// 签发记录落盘且可重新打开
+	store, err := OpenStore(dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, ok := store.Lookup(SerialHex(cert.SerialNumber))
+	if !ok || rec.CommonName != "alice" || rec.Status != StatusValid {
+		t.Errorf("unexpected record %+v (found=%v)", rec, ok)
+	}
+}
+
+func TestKeyAlgorithms(t *testing.T) {
+	for _, alg := range KeyAlgorithms {
+		if alg == KeyRSA4096 && testing.Short() {
+			continue
+		}
+		// CA 与终端证书使用同一算法（全新安装时 cmd/environment.go 的做法）
+		ca, caPEM, err := NewCA("OpenVPN-CA", time.Hour, alg)
+		if err != nil {
+			t.Fatalf("%s: NewCA failed: %v", alg, err)
+		}
+		if _, err := ParsePrivateKeyPEM(caPEM.KeyPEM); err != nil {
+			t.Fatalf("%s: CA key PEM does not round-trip: %v", alg, err)
+		}
+		store, _ := OpenStore(filepath.Join(t.TempDir(), "issued.json"))
+		p := New(ca, store)
+		roots := x509.NewCertPool()
+		roots.AddCert(ca.Cert)
+
+		client, err := p.IssueClient("alice", time.Hour, alg)
+		if err != nil {
+			t.Fatalf("%s: IssueClient failed: %v", alg, err)
+		}
+		if _, err := client.Cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+			t.Errorf("%s: client cert does not verify: %v", alg, err)
+		}
+		key, err := ParsePrivateKeyPEM(client.KeyPEM)
+		if err != nil {
+			t.Fatalf("%s: parse client key: %v", alg, err)
+		}
+		if !key.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(client.Cert.PublicKey) {
+			t.Errorf("%s: private key does not match certificate", alg)
+		}
+
+		server, err := p.IssueServer("OpenVPN-Server", time.Hour, alg)
+		if err != nil {
+			t.Fatalf("%s: IssueServer failed: %v", alg, err)
+		}
+		if _, err := server.Cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+			t.Errorf("%s: server cert does not verify: %v", alg, err)
+		}
+		wantKE := alg == KeyRSA2048 || alg == KeyRSA3072 || alg == KeyRSA4096
+		if got := server.Cert.KeyUsage&x509.KeyUsageKeyEncipherment != 0; got != wantKE {
+			t.Errorf("%s: server keyEncipherment = %v, want %v", alg, got, wantKE)
+		}
+		if alg.IsEC() != (alg.ECDHCurve() != "") {
+			t.Errorf("%s: IsEC / ECDHCurve mismatch", alg)
+		}
+	}
+
+	if alg, err := ParseKeyAlgorithm(""); err != nil || alg != DefaultKeyAlgorithm {
+		t.Errorf("ParseKeyAlgorithm(\"\") = %q, %v", alg, err)
+	}
+	if alg, err := ParseKeyAlgorithm("ECDSA-P384"); err != nil || alg != KeyECDSAP384 {
+		t.Errorf("ParseKeyAlgorithm(ECDSA-P384) = %q, %v", alg, err)
+	}
+	if _, err := ParseKeyAlgorithm("dsa1024"); err == nil {
+		t.Error("ParseKeyAlgorithm must reject unknown algorithms")
+	}
+}
+
+func TestRevokeAndCRL(t *testing.T) {
+	for _, bare := range []bool{false, true} {
+		p, _ := newTestPKI(t, bare)
+		a1, _ := p.IssueClient("alice", time.Hour, DefaultKeyAlgorithm)
+		a2, _ := p.IssueClient("alice", time.Hour, DefaultKeyAlgorithm)
+		b, _ := p.IssueClient("bob", time.Hour, DefaultKeyAlgorithm)
+
+		n, err := p.RevokeCommonName("alice", ReasonCessationOfOperation)
+		if err != nil || n != 2 {
+			t.Fatalf("RevokeCommonName = %d, %v", n, err)
+		}
+		// 重复吊销不报错也不重复计数
+		if n, _ := p.RevokeCommonName("alice", ReasonCessationOfOperation); n != 0 {
+			t.Errorf("second RevokeCommonName revoked %d", n)
+		}
+
+		crlPath := filepath.Join(t.TempDir(), "crl.pem")
+		if err := p.WriteCRL(crlPath, 0); err != nil {
+			t.Fatalf("WriteCRL (bare CA=%v) failed: %v", bare, err)
+		}
+		raw, _ := os.ReadFile(crlPath)
+		block, _ := pem.Decode(raw)
+		if block == nil || block.Type != "X509 CRL" {
+			t.Fatalf("unexpected CRL PEM: %q", raw)
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := crl.CheckSignatureFrom(p.CA().Cert); err != nil {
+			t.Errorf("CRL signature invalid: %v", err)
+		}
+		revoked := map[string]bool{}
+		for _, e := range crl.RevokedCertificateEntries {
+			revoked[SerialHex(e.SerialNumber)] = true
+			if e.ReasonCode != ReasonCessationOfOperation {
+				t.Errorf("reason = %d", e.ReasonCode)
+			}
+		}
+		if !revoked[SerialHex(a1.Cert.SerialNumber)] || !revoked[SerialHex(a2.Cert.SerialNumber)] {
+			t.Error("revoked alice certs missing from CRL")
+		}
+		if revoked[SerialHex(b.Cert.SerialNumber)] {
+			t.Error("bob must not be in CRL")
+		}
+		if crl.Number.Int64() != firstCRLNumber {
+			t.Errorf("CRL number = %v", crl.Number)
+		}
+
+		// CRL 序号单调递增
+		if err := p.WriteCRL(crlPath, 0); err != nil {
+			t.Fatal(err)
+		}
+		raw, _ = os.ReadFile(crlPath)
+		block, _ = pem.Decode(raw)
+		crl, _ = x509.ParseRevocationList(block.Bytes)
+		if crl.Number.Int64() != firstCRLNumber+1 {
+			t.Errorf("second CRL number = %v", crl.Number)
+		}
+	}
+}
+
+func TestRevokeUnknownCert(t *testing.T) {
+	p, _ := newTestPKI(t, false)
+	other, _ := newTestPKI(t, false)
+	// 模拟迁移前签发、未登记的证书
+	legacy, err := other.IssueClient("carol", time.Hour, DefaultKeyAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Revoke(legacy.Cert, ReasonUnspecified); err != nil {
+		t.Fatalf("Revoke unknown cert: %v", err)
+	}
+	rec, ok := p.Store().Lookup(SerialHex(legacy.Cert.SerialNumber))
+	if !ok || rec.Status != StatusRevoked || rec.CommonName != "carol" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+}
+
+func TestImportOpenSSLIndex(t *testing.T) {
+	dir := t.TempDir()
+	index := filepath.Join(dir, "index.txt")
+	content := "R\t351231000000Z\t250601120000Z,superseded\t0A1B\tunknown\t/CN=dave\n" +
+		"V\t351231000000Z\t\t0C2D\tunknown\t/CN=erin\n"
+	if err := os.WriteFile(index, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	crlNumber := filepath.Join(dir, "crlnumber")
+	os.WriteFile(crlNumber, []byte("100A\n"), 0644)
+
+	store, err := OpenStore(filepath.Join(dir, "issued.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.ImportOpenSSLIndex(index, crlNumber)
+	if err != nil || n != 2 {
+		t.Fatalf("ImportOpenSSLIndex = %d, %v", n, err)
+	}
+	rec, _ := store.Lookup("0a1b")
+	if rec.Status != StatusRevoked || rec.CommonName != "dave" || rec.Reason != ReasonSuperseded {
+		t.Errorf("unexpected revoked record %+v", rec)
+	}
+	if rec.RevokedAt == nil || !rec.RevokedAt.Equal(time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected revocation time %v", rec.RevokedAt)
+	}
+	if rec, _ := store.Lookup("0C2D"); rec.Status != StatusValid {
+		t.Errorf("unexpected valid record %+v", rec)
+	}
+	if next, _ := store.NextCRLNumber(); next != 0x100A {
+		t.Errorf("CRL number not carried over: %d", next)
+	}
+}
+
+func TestIntermediateCA(t *testing.T) {
+	root, _, err := NewCA("Offline-Root", 24*time.Hour, KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, csr, err := NewIntermediateRequest("Online-Intermediate", KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := SignIntermediate(root, csr, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("SignIntermediate failed: %v", err)
+	}
+	if !cert.NotAfter.Equal(root.Cert.NotAfter) {
+		t.Errorf("intermediate outlives root: %v > %v", cert.NotAfter, root.Cert.NotAfter)
+	}
+	if !cert.MaxPathLenZero || !IssuedBy(cert, root.Cert) || IsSelfSigned(cert) {
+		t.Error("unexpected intermediate constraints")
+	}
+	inter := &CA{Cert: cert, Key: key}
+	if err := inter.Verify([]*x509.Certificate{root.Cert}); err != nil {
+		t.Errorf("Verify with root: %v", err)
+	}
+	if err := inter.Verify(nil); err == nil {
+		t.Error("Verify without root must fail")
+	}
+	other, _, _ := NewCA("Other", time.Hour, KeyECDSAP256)
+	if err := (&CA{Cert: cert, Key: other.Key}).Verify([]*x509.Certificate{root.Cert}); err == nil {
+		t.Error("Verify must reject a mismatched key")
+	}
+
+	// 中间 CA 签发的终端证书经根 CA 验证，AKID 指向中间 CA
+	store, _ := OpenStore(filepath.Join(t.TempDir(), "issued.json"))
+	client, err := New(inter, store).IssueClient("alice", time.Hour, KeyECDSAP256)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(root.Cert)
+	inters := x509.NewCertPool()
+	inters.AddCert(cert)
+	if _, err := client.Cert.Verify(x509.VerifyOptions{Roots: roots, Intermediates: inters, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("client cert does not chain to root: %v", err)
+	}
+	if AuthorityID(client.Cert) != CAID(cert) || CAID(cert) == CAID(root.Cert) {
+		t.Errorf("AuthorityID = %s, intermediate CAID = %s", AuthorityID(client.Cert), CAID(cert))
+	}
+
+	crlPEM, err := RootCRL(root, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	crl, err := ParseCRLPEM(crlPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crl.CheckSignatureFrom(root.Cert); err != nil || len(crl.RevokedCertificateEntries) != 0 {
+		t.Errorf("unexpected root CRL: %v", err)
+	}
+
+	bundle := EncodeCertificatesPEM(root.Cert, cert, root.Cert)
+	certs, err := ParseCertificatesPEM(bundle)
+	if err != nil || len(certs) != 2 {
+		t.Errorf("bundle round-trip = %d certs, %v", len(certs), err)
+	}
+}
+
+func TestLegacyCAWithoutSKID(t *testing.T) {
+	p, _ := newTestPKI(t, true)
+	p.CA().Cert.SubjectKeyId = nil
+	issued, err := p.IssueClient("alice", time.Hour, DefaultKeyAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 没有 SKID 的旧 CA 签出的证书同样带 AKID，且与按公钥计算的 CAID 一致
+	if id := AuthorityID(issued.Cert); id == "" || id != CAID(p.CA().Cert) {
+		t.Errorf("AuthorityID = %q, CAID = %q", id, CAID(p.CA().Cert))
+	}
+	if !IssuedBy(issued.Cert, p.CA().Cert) {
+		t.Error("IssuedBy must accept a bare legacy CA")
+	}
+}
+
+// newTestCSR 用 key 生成 CN 为 cn 的 CSR（PEM）
+func newTestCSR(t *testing.T, cn string, key crypto.Signer) []byte {
+	t.Helper()
+	der, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: cn},
+	}, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "NEW CERTIFICATE REQUEST", Bytes: der})
+}
+
+func TestSignClientCSR(t *testing.T) {
+	p, _ := newTestPKI(t, false)
+	key, _ := GenerateKey(KeyECDSAP256)
+	csr, err := ParseCertificateRequestPEM(newTestCSR(t, "alice", key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	issued, err := p.SignClientCSR(csr, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issued.KeyPEM != nil {
+		t.Error("CSR enrollment must not return a private key")
+	}
+	if issued.Cert.Subject.CommonName != "alice" || !IssuedBy(issued.Cert, p.CA().Cert) {
+		t.Errorf("unexpected certificate %v issued by %v", issued.Cert.Subject, issued.Cert.Issuer)
+	}
+	if pub, ok := issued.Cert.PublicKey.(*ecdsa.PublicKey); !ok || !pub.Equal(key.Public()) {
+		t.Error("certificate must carry the CSR public key")
+	}
+	if len(issued.Cert.ExtKeyUsage) != 1 || issued.Cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Errorf("ExtKeyUsage = %v, want clientAuth", issued.Cert.ExtKeyUsage)
+	}
+	if _, ok := p.Store().Lookup(SerialHex(issued.Cert.SerialNumber)); !ok {
+		t.Error("CSR-issued certificate must be recorded")
+	}
+
+	// 弱密钥、无 CN 的 CSR 被拒绝
+	weak, _ := rsa.GenerateKey(rand.Reader, 1024)
+	csr, _ = ParseCertificateRequestPEM(newTestCSR(t, "bob", weak))
+	if _, err := p.SignClientCSR(csr, time.Hour); err == nil {
+		t.Error("RSA-1024 CSR must be rejected")
+	}
+	csr, _ = ParseCertificateRequestPEM(newTestCSR(t, "", key))
+	if _, err := p.SignClientCSR(csr, time.Hour); err == nil {
+		t.Error("CSR without common name must be rejected")
+	}
+	if _, err := ParseCertificateRequestPEM([]byte("not a csr")); err == nil {
+		t.Error("garbage must not parse as a CSR")
+	}
+}
+
+// tls-crypt-v2 已知正确的向量：服务端密钥为字节 (7i+3) mod 256，Kc 为 (13i+1) mod 256，
+// metadata 为用户类型 "alice"。WKc 按 OpenVPN tls_crypt_v2_wrap_client_key 的步骤用
+// openssl enc -aes-256-ctr 与独立的 HMAC-SHA256 实现计算，不经过本包的代码。
+const tlsCryptV2VectorServerKey = `-----BEGIN OpenVPN tls-crypt-v2 server key-----
+AwoRGB8mLTQ7QklQV15lbHN6gYiPlp2kq7K5wMfO1dzj6vH4/wYNFBsiKTA3PkVM
+U1phaG92fYSLkpmgp661vMPK0djf5u30+wIJEBceJSwzOkFIT1ZdZGtyeYCHjpWc
+o6qxuL/GzdTb4unw9/4FDBMaISgvNj1ES1JZYGdudXw=
+-----END OpenVPN tls-crypt-v2 server key-----
+`
+
+const tlsCryptV2VectorClientKey = `-----BEGIN OpenVPN tls-crypt-v2 client key-----
+AQ4bKDVCT1xpdoOQnaq3xNHe6/gFEh8sOUZTYG16h5ShrrvI1eLv/AkWIzA9Sldk
+cX6LmKWyv8zZ5vMADRonNEFOW2h1go+cqbbD0N3q9wQRHis4RVJfbHmGk6CtusfU
+4e77CBUiLzxJVmNwfYqXpLG+y9jl8v8MGSYzQE1aZ3SBjpuotcLP3On2AxAdKjdE
+UV5reIWSn6y5xtPg7foHFCEuO0hVYm98iZajsL3K1+Tx/gsYJTI/TFlmc4CNmqe0
+wc7b6PUCDxwpNkNQXWp3hJGeq7jF0t/s+QYTIC06R1RhbnuIlaKvvMnW4/D9Chck
+MT5LWGVyf4yZprPAzdrn9KuIsOExtugUZqYHtWISFjj2avH/qQSSVjlmDMDoHlLF
+hA61vmHF2qjNqDb2O9BYtp4Wcb0EZvoONsJJXGRrSkEG75hlRtLYEIH3/Gl5bpHw
+O4PWuIyLfNyDhmu0DRD1RQc4XDUxjLNamxSpxI520C+Gf6RhmFVMeFUJbklwmmwd
+WGeRWmmwHsbKLtq0uI1IQAeXrCeWz2zykyBMwkbyMQhp3/uCm9eDQObjA5rVoN48
++wv0LHkGaRxiK5f0IB3l0/IbSBmhM9S8b5pmVDdXzzjSeJ3RHhnn1zA0h/XqqdUf
+Z/LPRBx4C7Z/r2PwcGwN8f6n1aFPyHjLkh+2cDgZY2TE3l1aPoa8UvvIV9QLH0cJ
+3d/p8CBopBLWZcVa91IcX3kd6/00MgEo
+-----END OpenVPN tls-crypt-v2 client key-----
+`
+
+func TestTLSCryptV2KnownVector(t *testing.T) {
+	meta, err := TLSCryptV2ClientMetadata([]byte(tlsCryptV2VectorServerKey), []byte(tlsCryptV2VectorClientKey))
+	if err != nil || string(meta) != "alice" {
+		t.Fatalf("metadata = %q, %v", meta, err)
+	}
+
+	// 同样的 Kc 与 metadata 包装出来的密钥文件逐字节相同
+	ke, ka, err := parseTLSCryptV2ServerKey([]byte(tlsCryptV2VectorServerKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, _ := pem.Decode([]byte(tlsCryptV2VectorClientKey))
+	got, err := wrapTLSCryptV2ClientKey(ke, ka, want.Bytes[:256], append([]byte{tlsCryptMetadataTypeUser}, "alice"...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want.Bytes) {
+		t.Errorf("wrapped client key differs from the vector:\n got %x\nwant %x", got, want.Bytes)
+	}
+}
+
+func TestTLSCryptV2Keys(t *testing.T) {
+	serverKey, err := NewTLSCryptV2ServerKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(serverKey)
+	if block == nil || block.Type != TLSCryptV2ServerKeyType || len(block.Bytes) != 128 {
+		t.Fatalf("unexpected server key %q", serverKey)
+	}
+
+	clientKey, err := NewTLSCryptV2ClientKey(serverKey, []byte("alice:0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ = pem.Decode(clientKey)
+	if block == nil || block.Type != TLSCryptV2ClientKeyType {
+		t.Fatalf("unexpected client key %q", clientKey)
+	}
+	// Kc(256) || T(32) || 密文(256 + 1 + 22) || len(2)
+	if want := 256 + 32 + 256 + 1 + 22 + 2; len(block.Bytes) != want {
+		t.Errorf("client key has %d bytes, want %d", len(block.Bytes), want)
+	}
+	meta, err := TLSCryptV2ClientMetadata(serverKey, clientKey)
+	if err != nil || string(meta) != "alice:0123456789abcdef" {
+		t.Errorf("metadata = %q, %v", meta, err)
+	}
+
+	// 每个客户端的 Kc 不同
+	other, _ := NewTLSCryptV2ClientKey(serverKey, []byte("alice:0123456789abcdef"))
+	if bytes.Equal(other, clientKey) {
+		t.Error("client keys must be unique")
+	}
+	// 其他服务端密钥无法解包，篡改的 WKc 校验失败
+	otherServer, _ := NewTLSCryptV2ServerKey()
+	if _, err := TLSCryptV2ClientMetadata(otherServer, clientKey); err == nil {
+		t.Error("client key must not unwrap with another server key")
+	}
+	raw, _ := pem.Decode(clientKey)
+	raw.Bytes[300] ^= 0xff
+	if _, err := TLSCryptV2ClientMetadata(serverKey, pem.EncodeToMemory(raw)); err == nil {
+		t.Error("tampered client key must be rejected")
+	}
+	if _, err := NewTLSCryptV2ClientKey(serverKey, make([]byte, 800)); err == nil {
+		t.Error("oversized metadata must be rejected")
+	}
+}
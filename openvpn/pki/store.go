@@ -0,0 +1,285 @@
+package pki
+
+import (
+	"bufio"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Status 证书状态
+type Status string
+
+const (
+	StatusValid   Status = "valid"
+	StatusRevoked Status = "revoked"
+)
+
+// CRL 吊销原因码（RFC 5280 5.3.1），只列出本项目会用到的
+const (
+	ReasonUnspecified          = 0
+	ReasonKeyCompromise        = 1
+	ReasonCACompromise         = 2
+	ReasonAffiliationChanged   = 3
+	ReasonSuperseded           = 4
+	ReasonCessationOfOperation = 5
+)
+
+// firstCRLNumber 与原 crlnumber 文件的初值一致
+const firstCRLNumber = 1000
+
+// Record 签发记录中的一张证书
+type Record struct {
+	Serial     string     `json:"serial"` // 大写十六进制，见 SerialHex
+	CommonName string     `json:"commonName"`
+	NotBefore  time.Time  `json:"notBefore"`
+	NotAfter   time.Time  `json:"notAfter"`
+	Status     Status     `json:"status"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+	Reason     int        `json:"reason,omitempty"`
+}
+
+// RecordFromCert 由证书生成一条有效记录
+func RecordFromCert(cert *x509.Certificate) Record {
+	return Record{
+		Serial:     SerialHex(cert.SerialNumber),
+		CommonName: cert.Subject.CommonName,
+		NotBefore:  cert.NotBefore,
+		NotAfter:   cert.NotAfter,
+		Status:     StatusValid,
+	}
+}
+
+type storeData struct {
+	CRLNumber int64    `json:"crlNumber"`
+	Records   []Record `json:"records"`
+}
+
+// Store 签发记录（取代 openssl ca 的 index.txt / crlnumber），以 JSON 文件持久化。
+// 每次修改整体原子重写；同一进程内并发安全。多个进程共用一份记录时，调用方要在
+// 「打开 → 修改」整个过程中持有文件锁（见 openvpn 包的 lockPKI），否则会互相覆盖。
+type Store struct {
+	path string
+
+	mu   sync.Mutex
+	data storeData
+}
+
+// OpenStore 打开 path 处的签发记录，文件不存在时返回空记录（首次写入时创建）
+func OpenStore(path string) (*Store, error) {
+	s := &Store{path: path, data: storeData{CRLNumber: firstCRLNumber}}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取证书数据库失败: %w", err)
+	}
+	if err := json.Unmarshal(raw, &s.data); err != nil {
+		return nil, fmt.Errorf("解析证书数据库 %s 失败: %w", path, err)
+	}
+	return s, nil
+}
+
+// Exists 数据库文件是否已落盘
+func (s *Store) Exists() bool {
+	_, err := os.Stat(s.path)
+	return err == nil
+}
+
+// Add 登记一张证书；序列号已存在时报错
+func (s *Store) Add(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.find(rec.Serial) >= 0 {
+		return fmt.Errorf("serial %s already recorded", rec.Serial)
+	}
+	s.data.Records = append(s.data.Records, rec)
+	return s.save()
+}
+
+// Lookup 按序列号查找
+func (s *Store) Lookup(serial string) (Record, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i := s.find(serial); i >= 0 {
+		return s.data.Records[i], true
+	}
+	return Record{}, false
+}
+
+// ByCommonName 返回某 CN 名下的所有证书（按签发时间先后）
+func (s *Store) ByCommonName(commonName string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Record
+	for _, r := range s.data.Records {
+		if r.CommonName == commonName {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].NotBefore.Before(out[j].NotBefore) })
+	return out
+}
+
+// All 返回所有记录的副本
+func (s *Store) All() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.data.Records...)
+}
+
+// Revoked 返回所有已吊销的记录
+func (s *Store) Revoked() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []Record
+	for _, r := range s.data.Records {
+		if r.Status == StatusRevoked {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// Revoke 把记录标为已吊销；已吊销时保持原吊销时间不变
+func (s *Store) Revoke(serial string, at time.Time, reason int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.find(serial)
+	if i < 0 {
+		return fmt.Errorf("serial %s not found in cert database", serial)
+	}
+	rec := &s.data.Records[i]
+	if rec.Status == StatusRevoked {
+		return nil
+	}
+	rec.Status = StatusRevoked
+	rec.RevokedAt = &at
+	rec.Reason = reason
+	return s.save()
+}
+
+// NextCRLNumber 取下一个 CRL 序号并持久化
+func (s *Store) NextCRLNumber() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := s.data.CRLNumber
+	s.data.CRLNumber++
+	return n, s.save()
+}
+
+// ImportOpenSSLIndex 导入 openssl ca 的 index.txt（迁移用）：已吊销(R)的条目必须继续出现在
+// 新 CRL 里，否则切换后旧的吊销会失效。已登记的序列号跳过。返回导入条数。
+//
+// 行格式（制表符分隔）：状态 \t 过期时间 \t 吊销时间[,原因] \t 序列号 \t 文件名 \t DN
+func (s *Store) ImportOpenSSLIndex(path string, crlNumberPath string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 6 {
+			continue
+		}
+		serial := strings.ToUpper(strings.TrimSpace(fields[3]))
+		if serial == "" || s.find(serial) >= 0 {
+			continue
+		}
+		rec := Record{Serial: serial, CommonName: cnFromDN(fields[5]), Status: StatusValid}
+		rec.NotAfter, _ = parseOpenSSLTime(fields[1])
+		switch fields[0] {
+		case "R":
+			revoked, reason, _ := strings.Cut(fields[2], ",")
+			at, err := parseOpenSSLTime(revoked)
+			if err != nil {
+				at = time.Now()
+			}
+			rec.Status = StatusRevoked
+			rec.RevokedAt = &at
+			rec.Reason = openSSLReason(reason)
+		case "V":
+		default:
+			// E(过期)等状态不影响 CRL，照常登记为有效记录
+		}
+		s.data.Records = append(s.data.Records, rec)
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return n, err
+	}
+
+	// 延续旧的 CRL 序号，CRL number 必须单调递增
+	if raw, err := os.ReadFile(crlNumberPath); err == nil {
+		if v, err := strconv.ParseInt(strings.TrimSpace(string(raw)), 16, 64); err == nil && v > s.data.CRLNumber {
+			s.data.CRLNumber = v
+		}
+	}
+	return n, s.save()
+}
+
+func (s *Store) find(serial string) int {
+	serial = strings.ToUpper(serial)
+	for i, r := range s.data.Records {
+		if r.Serial == serial {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) save() error {
+	raw, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	return WriteFileAtomic(s.path, raw, 0600)
+}
+
+// parseOpenSSLTime 解析 index.txt 中的 UTCTime(YYMMDDHHMMSSZ) 或 GeneralizedTime(YYYYMMDDHHMMSSZ)
+func parseOpenSSLTime(v string) (time.Time, error) {
+	v = strings.TrimSpace(v)
+	if len(v) == len("060102150405Z") {
+		return time.Parse("060102150405Z", v)
+	}
+	return time.Parse("20060102150405Z", v)
+}
+
+func cnFromDN(dn string) string {
+	for _, part := range strings.Split(dn, "/") {
+		if cn, ok := strings.CutPrefix(part, "CN="); ok {
+			return cn
+		}
+	}
+	return ""
+}
+
+func openSSLReason(name string) int {
+	switch name {
+	case "keyCompromise":
+		return ReasonKeyCompromise
+	case "CACompromise":
+		return ReasonCACompromise
+	case "affiliationChanged":
+		return ReasonAffiliationChanged
+	case "superseded":
+		return ReasonSuperseded
+	case "cessationOfOperation":
+		return ReasonCessationOfOperation
+	}
+	return ReasonUnspecified
+}
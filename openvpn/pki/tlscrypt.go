@@ -0,0 +1,158 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// tls-crypt-v2 密钥格式（与 `openvpn --genkey tls-crypt-v2-server|tls-crypt-v2-client` 兼容）：
+//
+//   - 服务端密钥 = struct key（64 字节 cipher + 64 字节 hmac），只用各自的前 32 字节：
+//     Ke 为 AES-256-CTR 密钥，Ka 为 HMAC-SHA256 密钥。
+//   - 客户端密钥文件 = Kc || WKc。Kc 为 struct key2（2 × 128 字节），即该客户端自己的
+//     tls-crypt 密钥；WKc 为服务端密钥包装后的 Kc 与 metadata：
+//     T = HMAC-SHA256(Ka, len || Kc || metadata)
+//     WKc = T || AES-256-CTR(Ke, IV = T[:16], Kc || metadata) || len
+//     len 为 WKc 总长度（16 位大端）。
+//
+// 服务端收到 WKc 后用自己的密钥解包，客户端之间不共享任何密钥：泄露一份 .ovpn 只暴露
+// 该用户自己的 Kc。metadata 首字节为类型，这里统一用用户自定义类型，内容由调用方决定
+// （用于吊销）。
+const (
+	TLSCryptV2ServerKeyType = "OpenVPN tls-crypt-v2 server key"
+	TLSCryptV2ClientKeyType = "OpenVPN tls-crypt-v2 client key"
+
+	tlsCryptV2ServerKeyLen = 128
+	tlsCryptV2ClientKeyLen = 256
+	tlsCryptV2TagLen       = sha256.Size
+	// tlsCryptV2MaxWKcLen OpenVPN 接受的 WKc 最大长度（TLS_CRYPT_V2_MAX_WKC_LEN）
+	tlsCryptV2MaxWKcLen = 1024
+
+	tlsCryptMetadataTypeUser = 0x00
+)
+
+// NewTLSCryptV2ServerKey 生成 tls-crypt-v2 服务端密钥（PEM）
+func NewTLSCryptV2ServerKey() ([]byte, error) {
+	key := make([]byte, tlsCryptV2ServerKeyLen)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: TLSCryptV2ServerKeyType, Bytes: key}), nil
+}
+
+// NewTLSCryptV2ClientKey 用服务端密钥为一个客户端生成 tls-crypt-v2 密钥（PEM），metadata
+// 以用户自定义类型包进 WKc，服务端在 tls-crypt-v2-verify 脚本中可读到原样内容
+func NewTLSCryptV2ClientKey(serverKeyPEM, metadata []byte) ([]byte, error) {
+	ke, ka, err := parseTLSCryptV2ServerKey(serverKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	kc := make([]byte, tlsCryptV2ClientKeyLen)
+	if _, err := rand.Read(kc); err != nil {
+		return nil, err
+	}
+	out, err := wrapTLSCryptV2ClientKey(ke, ka, kc, append([]byte{tlsCryptMetadataTypeUser}, metadata...))
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: TLSCryptV2ClientKeyType, Bytes: out}), nil
+}
+
+// wrapTLSCryptV2ClientKey 返回客户端密钥文件内容 Kc || WKc，meta 已带类型字节。
+// 与 OpenVPN tls_crypt_v2_wrap_client_key 逐字节一致：相同的 Kc 与 metadata 得到相同的 WKc。
+func wrapTLSCryptV2ClientKey(ke, ka, kc, meta []byte) ([]byte, error) {
+	total := tlsCryptV2TagLen + len(kc) + len(meta) + 2
+	if total > tlsCryptV2MaxWKcLen {
+		return nil, fmt.Errorf("tls-crypt-v2 metadata too long (%d bytes)", len(meta)-1)
+	}
+	length := make([]byte, 2)
+	binary.BigEndian.PutUint16(length, uint16(total))
+
+	mac := hmac.New(sha256.New, ka)
+	mac.Write(length)
+	mac.Write(kc)
+	mac.Write(meta)
+	tag := mac.Sum(nil)
+
+	plain := append(append([]byte{}, kc...), meta...)
+	if err := tlsCryptV2CTR(ke, tag, plain); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(kc)+total)
+	out = append(out, kc...)
+	out = append(out, tag...)
+	out = append(out, plain...)
+	out = append(out, length...)
+	return out, nil
+}
+
+// TLSCryptV2ClientMetadata 用服务端密钥解包客户端密钥，校验后返回其中的用户 metadata
+func TLSCryptV2ClientMetadata(serverKeyPEM, clientKeyPEM []byte) ([]byte, error) {
+	ke, ka, err := parseTLSCryptV2ServerKey(serverKeyPEM)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(clientKeyPEM)
+	if block == nil || block.Type != TLSCryptV2ClientKeyType {
+		return nil, errors.New("no tls-crypt-v2 client key found")
+	}
+	data := block.Bytes
+	if len(data) < tlsCryptV2ClientKeyLen+tlsCryptV2TagLen+tlsCryptV2ClientKeyLen+1+2 {
+		return nil, errors.New("tls-crypt-v2 client key too short")
+	}
+	kc, wkc := data[:tlsCryptV2ClientKeyLen], data[tlsCryptV2ClientKeyLen:]
+	if int(binary.BigEndian.Uint16(wkc[len(wkc)-2:])) != len(wkc) {
+		return nil, errors.New("tls-crypt-v2 wrapped key length mismatch")
+	}
+	tag := wkc[:tlsCryptV2TagLen]
+	plain := append([]byte{}, wkc[tlsCryptV2TagLen:len(wkc)-2]...)
+	if err := tlsCryptV2CTR(ke, tag, plain); err != nil {
+		return nil, err
+	}
+
+	mac := hmac.New(sha256.New, ka)
+	mac.Write(wkc[len(wkc)-2:])
+	mac.Write(plain)
+	if !hmac.Equal(mac.Sum(nil), tag) {
+		return nil, errors.New("tls-crypt-v2 client key was not wrapped by this server key")
+	}
+	if !bytes.Equal(plain[:tlsCryptV2ClientKeyLen], kc) {
+		return nil, errors.New("tls-crypt-v2 client key does not match its wrapped copy")
+	}
+	meta := plain[tlsCryptV2ClientKeyLen:]
+	if meta[0] != tlsCryptMetadataTypeUser {
+		return nil, fmt.Errorf("unsupported tls-crypt-v2 metadata type %d", meta[0])
+	}
+	return meta[1:], nil
+}
+
+// parseTLSCryptV2ServerKey 取出服务端密钥里的 Ke（AES-256）与 Ka（HMAC-SHA256）
+func parseTLSCryptV2ServerKey(serverKeyPEM []byte) (ke, ka []byte, err error) {
+	block, _ := pem.Decode(serverKeyPEM)
+	if block == nil || block.Type != TLSCryptV2ServerKeyType {
+		return nil, nil, errors.New("no tls-crypt-v2 server key found")
+	}
+	if len(block.Bytes) != tlsCryptV2ServerKeyLen {
+		return nil, nil, fmt.Errorf("tls-crypt-v2 server key has %d bytes, want %d", len(block.Bytes), tlsCryptV2ServerKeyLen)
+	}
+	return block.Bytes[:32], block.Bytes[64:96], nil
+}
+
+// tlsCryptV2CTR 以 tag 的前 16 字节为 IV 做 AES-256-CTR（原地加解密）
+func tlsCryptV2CTR(ke, tag, buf []byte) error {
+	c, err := aes.NewCipher(ke)
+	if err != nil {
+		return err
+	}
+	cipher.NewCTR(c, tag[:aes.BlockSize]).XORKeyStream(buf, buf)
+	return nil
+}
@@ -0,0 +1,24 @@
+//go:build linux
+
+package openvpn
+
+import (
+	"os"
+	"syscall"
+)
+
+// flockFile 对 path 加排他 flock（阻塞等待），返回解锁函数。文件不存在时创建。
+func flockFile(path string) (func(), error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() {
+		syscall.Flock(int(f.Fd()), syscall.LOCK_UN)
+		f.Close()
+	}, nil
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package openvpn
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFlockFileExcludesOtherHolders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), pkiLockFile)
+	unlock, err := flockFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// flock 按打开的文件区分持有者：同一进程再打开一次也要等待，与另一个进程的行为相同
+	acquired := make(chan func())
+	go func() {
+		second, err := flockFile(path)
+		if err != nil {
+			t.Error(err)
+			close(acquired)
+			return
+		}
+		acquired <- second
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second holder acquired the lock while it was held")
+	case <-time.After(100 * time.Millisecond):
+	}
+	unlock()
+	select {
+	case second := <-acquired:
+		if second != nil {
+			second()
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second holder never acquired the lock")
+	}
+}
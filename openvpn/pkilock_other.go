@@ -0,0 +1,8 @@
+//go:build !linux
+
+package openvpn
+
+// flockFile 非 Linux 平台占位实现（交叉编译用），只有进程内的 pkiMu 保护。
+func flockFile(path string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,32 @@
+package openvpn
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"openvpn-admin-go/constants"
+)
+
+// EnsureRuntimeGroup 确保 OpenVPN 降权后使用的组（server.conf 的 group）存在，返回其 gid。
+// 脚本要写、vpn-auth 要读的文件归这个组，nobody 下的其他进程碰不到。
+// 容器里 /etc/group 不在持久卷上，每次启动都要检查。
+func EnsureRuntimeGroup() (int, error) {
+	if gid, err := lookupGID(constants.OpenVPNRuntimeGroup); err == nil {
+		return gid, nil
+	}
+	if out, err := exec.Command("groupadd", "--system", constants.OpenVPNRuntimeGroup).CombinedOutput(); err != nil {
+		return -1, fmt.Errorf("创建用户组 %s 失败: %v: %s", constants.OpenVPNRuntimeGroup, err, strings.TrimSpace(string(out)))
+	}
+	return lookupGID(constants.OpenVPNRuntimeGroup)
+}
+
+func lookupGID(name string) (int, error) {
+	g, err := user.LookupGroup(name)
+	if err != nil {
+		return -1, err
+	}
+	return strconv.Atoi(g.Gid)
+}
@@ -69,6 +69,14 @@ func UpdateServerConfig() error {
 	if err := EnsureCRLSetup(); err != nil {
 		return err
 	}
+	// tls-crypt-v2 模式引用服务端密钥与吊销列表，且渲染客户端配置时要用服务端密钥包装用户密钥
+	if err := EnsureTLSKeySetup(cfg); err != nil {
+		return err
+	}
+	// 二次验证的 vpn-auth 子命令从 vpn-auth.env 读取数据库连接参数
+	if err := EnsureVPNAuthSetup(cfg); err != nil {
+		return err
+	}
 
 	// 写入配置文件
 	if err := os.WriteFile(constants.ServerConfigPath, []byte(config), 0644); err != nil {
@@ -0,0 +1,138 @@
+package openvpn
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/constants"
+)
+
+// scriptLogMaxSize 会话事件记录超过此大小时在读完后清空，避免无限增长
+const scriptLogMaxSize = 1 << 20
+
+// SessionEvent session-event.sh 记录的一次客户端事件（client-connect / client-disconnect）
+type SessionEvent struct {
+	Type           string    // OpenVPN 的 script_type，如 "client-disconnect"
+	ConnectedSince time.Time // time_unix：会话建立时间，与 status 里的 Connected Since 一致
+	Duration       int64     // time_duration，秒；仅 client-disconnect 有
+	BytesReceived  int64
+	BytesSent      int64
+	Serial         string // 十进制证书序列号（tls_serial_0）
+	VirtualAddress string
+	RealAddress    string // ip:port，格式同 status 日志
+	CommonName     string
+}
+
+// 会话事件类型（OpenVPN 的 script_type）
+const (
+	SessionEventConnect    = "client-connect"
+	SessionEventDisconnect = "client-disconnect"
+)
+
+// ensureSessionLog 预先创建会话事件记录：OpenVPN 降权后才运行 session-event.sh，自己建不了文件。
+// 属组为 OpenVPN 的运行组、权限 0660，只有 root 与降权后的 OpenVPN 能读写。
+func ensureSessionLog() error {
+	gid, err := EnsureRuntimeGroup()
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(constants.ServerSessionLogPath, os.O_CREATE|os.O_WRONLY, 0660)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	if err := os.Chown(constants.ServerSessionLogPath, -1, gid); err != nil {
+		return err
+	}
+	// umask 会去掉组的写权限；旧版本建的文件是 0666
+	return os.Chmod(constants.ServerSessionLogPath, 0660)
+}
+
+// ParseSessionLog 解析会话事件记录（制表符分隔，字段顺序见 file/session-event.sh），格式不对的行跳过
+func ParseSessionLog(r io.Reader) []SessionEvent {
+	var out []SessionEvent
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		f := strings.Split(scanner.Text(), "\t")
+		if len(f) != 10 {
+			continue
+		}
+		for i := range f {
+			if f[i] == "-" {
+				f[i] = ""
+			}
+		}
+		ts, err := strconv.ParseInt(f[1], 10, 64)
+		if err != nil || f[0] == "" || f[9] == "" {
+			continue
+		}
+		e := SessionEvent{
+			Type:           f[0],
+			ConnectedSince: time.Unix(ts, 0),
+			Serial:         f[5],
+			VirtualAddress: f[6],
+			RealAddress:    f[7],
+			CommonName:     f[9],
+		}
+		e.Duration, _ = strconv.ParseInt(f[2], 10, 64)
+		e.BytesReceived, _ = strconv.ParseInt(f[3], 10, 64)
+		e.BytesSent, _ = strconv.ParseInt(f[4], 10, 64)
+		if !isDecimal(e.Serial) {
+			e.Serial = ""
+		}
+		if e.RealAddress != "" && f[8] != "" {
+			e.RealAddress += ":" + f[8]
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+// ReadSessionLog 从 offset 开始读取新增的会话事件，返回事件与下次读取的偏移。
+// 文件比 offset 短（被清空过）时从头读；读完后文件超过 scriptLogMaxSize 则清空。
+// 清空与脚本追加之间可能丢掉极少数记录。
+func ReadSessionLog(path string, offset int64) ([]SessionEvent, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, err
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, offset, err
+	}
+	// 只消费完整的行，写了一半的行留到下次
+	end := strings.LastIndexByte(string(data), '\n') + 1
+	events := ParseSessionLog(strings.NewReader(string(data[:end])))
+	offset += int64(end)
+	if offset > scriptLogMaxSize && offset == info.Size() {
+		if err := os.Truncate(path, 0); err == nil {
+			offset = 0
+		}
+	}
+	return events, offset, nil
+}
+
+// isDecimal 序列号可能超过 64 位，不能用 ParseUint 判断
+func isDecimal(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,65 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSessionLog(t *testing.T) {
+	log := "client-connect\t1749637756\t-\t-\t-\t340282366920938463463374607431768211455\t10.8.0.6\t203.0.113.5\t41000\talice\n" +
+		"broken line\n" +
+		"client-disconnect\t1749637756\t120\t1500\t3500\t12ab\t10.8.0.6\t203.0.113.5\t41000\talice\n" +
+		"client-disconnect\tnot-a-time\t1\t1\t1\t1\t-\t-\t-\tcarol\n"
+	events := ParseSessionLog(strings.NewReader(log))
+	if len(events) != 2 {
+		t.Fatalf("events = %+v, want 2", events)
+	}
+	if e := events[0]; e.Type != SessionEventConnect || e.CommonName != "alice" || e.ConnectedSince.Unix() != 1749637756 ||
+		e.Serial != "340282366920938463463374607431768211455" || e.Duration != 0 {
+		t.Errorf("events[0] = %+v", e)
+	}
+	e := events[1]
+	if e.Type != SessionEventDisconnect || e.Duration != 120 || e.BytesReceived != 1500 || e.BytesSent != 3500 ||
+		e.VirtualAddress != "10.8.0.6" || e.RealAddress != "203.0.113.5:41000" {
+		t.Errorf("events[1] = %+v", e)
+	}
+	// 序列号不是十进制：丢弃序列号，事件本身保留
+	if e.Serial != "" {
+		t.Errorf("non-decimal serial kept: %q", e.Serial)
+	}
+}
+
+func connectLine(serial int) string {
+	return fmt.Sprintf("client-connect\t1749637756\t-\t-\t-\t%d\t-\t-\t-\talice\n", serial)
+}
+
+func TestReadSessionLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "session-events.log")
+	partial := connectLine(3)
+	if err := os.WriteFile(path, []byte(connectLine(1)+connectLine(2)+partial[:10]), 0644); err != nil {
+		t.Fatal(err)
+	}
+	events, offset, err := ReadSessionLog(path, 0)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("first read = %+v, %v", events, err)
+	}
+
+	// 写了一半的行留到下次读
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(partial[10:] + connectLine(4))
+	f.Close()
+	events, offset, err = ReadSessionLog(path, offset)
+	if err != nil || len(events) != 2 || events[0].Serial != "3" || events[1].Serial != "4" {
+		t.Fatalf("second read = %+v, %v", events, err)
+	}
+
+	// 文件被清空后从头读
+	os.WriteFile(path, []byte(connectLine(5)), 0644)
+	events, _, err = ReadSessionLog(path, offset)
+	if err != nil || len(events) != 1 || events[0].Serial != "5" {
+		t.Fatalf("read after truncate = %+v, %v", events, err)
+	}
+}
@@ -3,6 +3,7 @@ package openvpn
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -49,7 +50,12 @@ func ParseStatusLog(logPath string) ([]OpenVPNClientStatus, time.Time, error) {
 		return nil, time.Time{}, fmt.Errorf("failed to open status log file %s: %w", logPath, err)
 	}
 	defer file.Close()
+	return ParseStatus(file)
+}
 
+// ParseStatus parses status-version 2 output from any reader: the status log file,
+// or the reply of the management interface "status 2" command (same format).
+func ParseStatus(r io.Reader) ([]OpenVPNClientStatus, time.Time, error) {
 	var clients []OpenVPNClientStatus
 	var logUpdateTime time.Time
 	var logUpdateTimeEpoch int64
@@ -63,7 +69,7 @@ func ParseStatusLog(logPath string) ([]OpenVPNClientStatus, time.Time, error) {
 		LastRefTimeT            int64
 	})
 
-	scanner := bufio.NewScanner(file)
+	scanner := bufio.NewScanner(r)
 	var parsingClientList, parsingRoutingTable bool
 
 	for scanner.Scan() {
@@ -8,6 +8,7 @@ import (
 	"text/template"
 
 	"openvpn-admin-go/constants"
+	"openvpn-admin-go/utils"
 )
 
 // RenderServerConfig 渲染服务端配置模板
@@ -25,17 +26,33 @@ func RenderServerConfig(cfg *Config) (string, error) {
 		return "", fmt.Errorf("解析服务端配置模板失败: %v", err)
 	}
 
+	var vpnAuthCmd string
+	if cfg.VPNAuthMode() != VPNAuthOff {
+		if vpnAuthCmd, err = vpnAuthCommand(cfg); err != nil {
+			return "", err
+		}
+	}
+
+	// 动态地址池只占客户端地址的前一半，固定 IP 与部门 IP 范围在后一半
+	poolStart, poolEnd, err := DynamicPoolRange(cfg)
+	if err != nil {
+		return "", err
+	}
+
 	data := map[string]interface{}{
 		"openvpn_port":            cfg.OpenVPNPort,
 		"openvpn_proto":           cfg.OpenVPNProto,
 		"openvpn_server_network":  cfg.OpenVPNServerNetwork,
 		"openvpn_server_netmask":  cfg.OpenVPNServerNetmask,
-		"openvpn_client_to_client": cfg.OpenVPNClientToClient,
+		"openvpn_server_ipv6":     cfg.OpenVPNServerIPv6,
+		"ifconfig_pool_start":     poolStart,
+		"ifconfig_pool_end":       poolEnd,
 		"openvpn_routes":          cfg.OpenVPNRoutes,
+		"openvpn_routes_ipv6":     cfg.OpenVPNRoutesIPv6,
 		"dns_server_ip":           cfg.DNSServerIP,
 		"dns_server_domain":       cfg.DNSServerDomain,
 		"openvpn_tls_version":     cfg.OpenVPNTLSVersion,
-		"ca_cert_path":            constants.ServerCACertPath,
+		"ca_cert_path":            trustBundlePath(),
 		"server_cert_path":        constants.ServerCertPath,
 		"server_key_path":         constants.ServerKeyPath,
 		"dh_path":                 constants.ServerDHPath,
@@ -43,17 +60,30 @@ func RenderServerConfig(cfg *Config) (string, error) {
 		// Use the OpenVPNTLSKeyPath from the Config struct, which would have been loaded
 		// from server.conf, environment variables, or defaults, in that order.
 		"tls_key_path":            cfg.OpenVPNTLSKeyPath,
+		// 控制通道保护：tls-auth / tls-crypt 共用 tls_key_path，tls-crypt-v2 使用单独的服务端密钥
+		"tls_mode":                string(cfg.TLSMode()),
+		"tls_crypt_v2_key_path":   constants.ServerTLSCryptV2KeyPath,
+		"tls_crypt_v2_revoked_path": constants.ServerTLSCryptV2RevokedPath,
 		// Use the values from the Config struct
 		"OpenVPNStatusLogPath":    cfg.OpenVPNStatusLogPath,
 		"OpenVPNLogPath":          cfg.OpenVPNLogPath,
 		"OpenVPNClientConfigDir":  cfg.OpenVPNClientConfigDir,
 		"OpenVPNManagementPort":   cfg.OpenVPNManagementPort,
 		"OpenVPNBlacklistFile":    cfg.OpenVPNBlacklistFile,
+		"session_log_path":        constants.ServerSessionLogPath,
+		"openvpn_group":           constants.OpenVPNRuntimeGroup,
 		"mgmt_password_path":      constants.ServerMgmtPasswordPath,
 		// CRL（删除用户=吊销证书）。crl-verify 行受 openvpn_use_crl 控制；
 		// EnsureCRLSetup 保证渲染出该行前 crl.pem 已存在（初始为空），避免锁死。
 		"openvpn_use_crl":         cfg.OpenVPNUseCRL,
 		"crl_path":                constants.ServerCRLPath,
+		// 椭圆曲线算法（ECDSA / Ed25519）改用 `dh none` + ecdh-curve，不再需要 dh.pem
+		"openvpn_key_algorithm":   string(cfg.KeyAlgorithm()),
+		"ecdh_curve":              cfg.KeyAlgorithm().ECDHCurve(),
+		"dh_none":                 cfg.KeyAlgorithm().IsEC() || !utils.IsExists(constants.ServerDHPath),
+		// VPN 二次验证：auth-user-pass-verify 调用本程序的 vpn-auth 子命令
+		"vpn_auth_enabled":        cfg.VPNAuthMode() != VPNAuthOff,
+		"vpn_auth_command":        vpnAuthCmd,
 	}
 
 	var buf bytes.Buffer
@@ -79,8 +109,8 @@ func RenderClientConfig(username string, cfg *Config) (string, error) {
 		return "", fmt.Errorf("解析客户端配置模板失败: %v", err)
 	}
 
-	// 读取证书文件
-	caCert, err := os.ReadFile(constants.ServerCACertPath)
+	// 读取证书文件（CA 轮换期间 <ca> 同时包含新旧 CA）
+	caCert, err := os.ReadFile(trustBundlePath())
 	if err != nil {
 		return "", fmt.Errorf("读取CA证书失败: %v", err)
 	}
@@ -90,12 +120,19 @@ func RenderClientConfig(username string, cfg *Config) (string, error) {
 		return "", fmt.Errorf("读取客户端证书失败: %v", err)
 	}
 
+	// CSR 签发的证书私钥只在用户设备上，.ovpn 不含 <key>
 	clientKey, err := os.ReadFile(filepath.Join(constants.ClientConfigDir, username+".key"))
-	if err != nil {
+	if err != nil && !os.IsNotExist(err) {
 		return "", fmt.Errorf("读取客户端密钥失败: %v", err)
 	}
 
-	tlsAuthKey, err := os.ReadFile(constants.ServerTLSKeyPath)
+	// tls-auth / tls-crypt 全体共享同一把密钥；tls-crypt-v2 每个用户一把（没有则此时生成）
+	var tlsKey []byte
+	if cfg.TLSMode() == TLSModeCryptV2 {
+		tlsKey, err = clientTLSCryptV2Key(username)
+	} else {
+		tlsKey, err = os.ReadFile(constants.ServerTLSKeyPath)
+	}
 	if err != nil {
 		return "", fmt.Errorf("读取TLS密钥失败: %v", err)
 	}
@@ -121,7 +158,9 @@ func RenderClientConfig(username string, cfg *Config) (string, error) {
 		"ca_cert":                 string(caCert),
 		"client_cert":             string(clientCert),
 		"client_key":              string(clientKey),
-		"tls_auth_key":            string(tlsAuthKey),
+		"tls_mode":                string(cfg.TLSMode()),
+		"tls_key":                 string(tlsKey),
+		"auth_user_pass":          clientAuthUserPass(username, cfg),
 	}
 
 	var buf bytes.Buffer
@@ -0,0 +1,155 @@
+package openvpn
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"openvpn-admin-go/constants"
+	"openvpn-admin-go/openvpn/pki"
+	"openvpn-admin-go/utils"
+)
+
+// TLSMode 控制通道的额外保护方式
+type TLSMode string
+
+const (
+	// TLSModeAuth 全体共享一把 tls-auth 密钥，只做 HMAC 签名
+	TLSModeAuth TLSMode = "tls-auth"
+	// TLSModeCrypt 全体共享一把 tls-crypt 密钥，控制通道加密 + 认证
+	TLSModeCrypt TLSMode = "tls-crypt"
+	// TLSModeCryptV2 每个用户一把独立的 tls-crypt 密钥（由服务端密钥包装），可单独吊销
+	TLSModeCryptV2 TLSMode = "tls-crypt-v2"
+)
+
+// TLSModes 支持的 TLS 模式（配置下拉选项的顺序）
+var TLSModes = []TLSMode{TLSModeAuth, TLSModeCrypt, TLSModeCryptV2}
+
+// ParseTLSMode 解析配置中的 TLS 模式
+func ParseTLSMode(s string) (TLSMode, error) {
+	for _, m := range TLSModes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown TLS mode %q", s)
+}
+
+// clientTLSCryptV2Dir 用户 tls-crypt-v2 密钥所在目录（单独成目录，避免和 <user>.key 等文件重名）
+func clientTLSCryptV2Dir() string {
+	return filepath.Join(constants.ClientConfigDir, "tls-crypt-v2")
+}
+
+func clientTLSCryptV2KeyPath(username string) string {
+	return filepath.Join(clientTLSCryptV2Dir(), username+".key")
+}
+
+// EnsureTLSKeySetup 幂等地保证当前 TLS 模式在 server.conf 中引用的文件存在：
+// tls-crypt-v2 需要服务端密钥、吊销列表与 tls-crypt-v2-verify.sh。
+// tls-auth / tls-crypt 共用初始化时生成的 tls-auth.key，这里不处理。
+func EnsureTLSKeySetup(cfg *Config) error {
+	if cfg.TLSMode() != TLSModeCryptV2 {
+		return nil
+	}
+	if !utils.IsExists(constants.ServerTLSCryptV2KeyPath) {
+		key, err := pki.NewTLSCryptV2ServerKey()
+		if err != nil {
+			return fmt.Errorf("生成 tls-crypt-v2 服务端密钥失败: %v", err)
+		}
+		if err := pki.WriteFileAtomic(constants.ServerTLSCryptV2KeyPath, key, 0600); err != nil {
+			return fmt.Errorf("写入 tls-crypt-v2 服务端密钥失败: %v", err)
+		}
+		fmt.Printf("已生成 tls-crypt-v2 服务端密钥: %s\n", constants.ServerTLSCryptV2KeyPath)
+	}
+	if !utils.IsExists(constants.ServerTLSCryptV2RevokedPath) {
+		// 0644：tls-crypt-v2-verify.sh 以降权后的 nobody 读取
+		if err := os.WriteFile(constants.ServerTLSCryptV2RevokedPath, nil, 0644); err != nil {
+			return fmt.Errorf("创建 tls-crypt-v2 吊销列表失败: %v", err)
+		}
+	}
+	return EnsureServerHelperFiles()
+}
+
+// clientTLSCryptV2Key 读取用户的 tls-crypt-v2 密钥，没有则生成。
+//
+// metadata 为 "<用户名>:<随机 ID>"：同一用户删掉重建后拿到的是新密钥，吊销旧密钥不影响新密钥。
+func clientTLSCryptV2Key(username string) ([]byte, error) {
+	path := clientTLSCryptV2KeyPath(username)
+	if key, err := os.ReadFile(path); err == nil {
+		return key, nil
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取 tls-crypt-v2 客户端密钥失败: %v", err)
+	}
+
+	serverKey, err := os.ReadFile(constants.ServerTLSCryptV2KeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("读取 tls-crypt-v2 服务端密钥失败: %v", err)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	key, err := pki.NewTLSCryptV2ClientKey(serverKey, []byte(username+":"+hex.EncodeToString(id)))
+	if err != nil {
+		return nil, fmt.Errorf("生成 tls-crypt-v2 客户端密钥失败: %v", err)
+	}
+	if err := os.MkdirAll(clientTLSCryptV2Dir(), 0700); err != nil {
+		return nil, fmt.Errorf("创建 tls-crypt-v2 密钥目录失败: %v", err)
+	}
+	if err := pki.WriteFileAtomic(path, key, 0600); err != nil {
+		return nil, fmt.Errorf("写入 tls-crypt-v2 客户端密钥失败: %v", err)
+	}
+	fmt.Printf("已为客户端 %s 生成 tls-crypt-v2 密钥\n", username)
+	return key, nil
+}
+
+// revokeClientTLSCryptV2Key 把用户 tls-crypt-v2 密钥的 metadata 写进吊销列表并删除密钥文件。
+// tls-crypt-v2-verify.sh 在 TLS 握手之前就按吊销列表拒绝该密钥，泄露的 .ovpn 连握手都发不起来。
+// 用户没有 tls-crypt-v2 密钥时什么也不做。
+func revokeClientTLSCryptV2Key(username string) error {
+	path := clientTLSCryptV2KeyPath(username)
+	clientKey, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	serverKey, err := os.ReadFile(constants.ServerTLSCryptV2KeyPath)
+	if err != nil {
+		return fmt.Errorf("读取 tls-crypt-v2 服务端密钥失败: %v", err)
+	}
+	metadata, err := pki.TLSCryptV2ClientMetadata(serverKey, clientKey)
+	if err != nil {
+		return err
+	}
+	if err := appendRevokedTLSCryptV2(constants.ServerTLSCryptV2RevokedPath, string(metadata)); err != nil {
+		return fmt.Errorf("写入 tls-crypt-v2 吊销列表失败: %v", err)
+	}
+	return os.Remove(path)
+}
+
+// appendRevokedTLSCryptV2 向吊销列表追加一行 metadata（已存在则跳过）
+func appendRevokedTLSCryptV2(path, metadata string) error {
+	if strings.ContainsAny(metadata, "\r\n") {
+		return fmt.Errorf("invalid tls-crypt-v2 metadata %q", metadata)
+	}
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	sc := bufio.NewScanner(bytes.NewReader(existing))
+	for sc.Scan() {
+		if sc.Text() == metadata {
+			return nil
+		}
+	}
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		existing = append(existing, '\n')
+	}
+	return pki.WriteFileAtomic(path, append(existing, metadata+"\n"...), 0644)
+}
@@ -0,0 +1,107 @@
+package openvpn
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"openvpn-admin-go/constants"
+	"openvpn-admin-go/openvpn/pki"
+	"openvpn-admin-go/utils"
+)
+
+// VPNAuthMode VPN 连接时（证书之外）的二次验证方式
+type VPNAuthMode string
+
+const (
+	// VPNAuthOff 只做证书认证
+	VPNAuthOff VPNAuthMode = "off"
+	// VPNAuthOTP 开启了部门开关的用户在密码框输入 6 位动态口令
+	VPNAuthOTP VPNAuthMode = "otp"
+	// VPNAuthPasswordOTP 开启了部门开关的用户在密码框输入「登录密码 + 6 位动态口令」
+	VPNAuthPasswordOTP VPNAuthMode = "password+otp"
+)
+
+// VPNAuthModes 支持的二次验证方式（配置下拉选项的顺序）
+var VPNAuthModes = []VPNAuthMode{VPNAuthOff, VPNAuthOTP, VPNAuthPasswordOTP}
+
+// ParseVPNAuthMode 解析配置中的二次验证方式
+func ParseVPNAuthMode(s string) (VPNAuthMode, error) {
+	for _, m := range VPNAuthModes {
+		if string(m) == s {
+			return m, nil
+		}
+	}
+	return "", fmt.Errorf("unknown VPN auth mode %q", s)
+}
+
+// ClientOTPRequired 判断用户连接 VPN 时是否需要输入动态口令（部门开关），决定其 .ovpn 是否带 auth-user-pass。
+// 由 main.go 在数据库初始化后注入；未注入时视为不需要。
+var ClientOTPRequired func(username string) bool
+
+// clientAuthUserPass 用户的 .ovpn 是否渲染 auth-user-pass
+func clientAuthUserPass(username string, cfg *Config) bool {
+	return cfg.VPNAuthMode() != VPNAuthOff && ClientOTPRequired != nil && ClientOTPRequired(username)
+}
+
+// vpnAuthCommand server.conf 中 auth-user-pass-verify 调用的命令：本程序的 vpn-auth 子命令。
+// OpenVPN 会在命令末尾追加保存用户名/密码的临时文件路径（via-file）。
+func vpnAuthCommand(cfg *Config) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("获取程序路径失败: %v", err)
+	}
+	return fmt.Sprintf("%s vpn-auth --mode %s --env %s", exe, cfg.VPNAuthMode(), constants.ServerVPNAuthEnvPath), nil
+}
+
+// parseVPNAuthVerifyLine 从 server.conf 的 auth-user-pass-verify 行中取出 --mode（回退解析用）
+func parseVPNAuthVerifyLine(fields []string) string {
+	for i := 0; i+1 < len(fields); i++ {
+		if fields[i] == "--mode" {
+			return strings.Trim(fields[i+1], `"`)
+		}
+	}
+	return ""
+}
+
+// vpnAuthEnvKeys 写入 vpn-auth.env 的数据库连接参数（与 database.Init 读取的环境变量一致）
+var vpnAuthEnvKeys = []string{"DATABASE_URL", "DB_HOST", "DB_USER", "DB_PASSWORD", "DB_NAME", "DB_PORT"}
+
+// EnsureVPNAuthSetup 开启二次验证时，把当前进程的数据库连接参数写入 vpn-auth.env。
+//
+// 文件含数据库口令：属组设为 OpenVPN 专用的运行组、权限 0640，只有 root 与（随 OpenVPN 降权的）
+// vpn-auth 子命令可读；同样以 nobody/nogroup 运行的其他服务读不到。
+func EnsureVPNAuthSetup(cfg *Config) error {
+	if cfg.VPNAuthMode() == VPNAuthOff {
+		return nil
+	}
+	var b strings.Builder
+	for _, key := range vpnAuthEnvKeys {
+		if v, ok := os.LookupEnv(key); ok {
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("环境变量 %s 含换行符", key)
+			}
+			fmt.Fprintf(&b, "%s=%s\n", key, v)
+		}
+	}
+	gid, err := EnsureRuntimeGroup()
+	if err != nil {
+		return err
+	}
+	if err := pki.WriteFileAtomic(constants.ServerVPNAuthEnvPath, []byte(b.String()), 0640); err != nil {
+		return fmt.Errorf("写入 vpn-auth 数据库配置失败: %v", err)
+	}
+	if err := os.Chown(constants.ServerVPNAuthEnvPath, -1, gid); err != nil {
+		return fmt.Errorf("设置 %s 属组失败: %v", constants.ServerVPNAuthEnvPath, err)
+	}
+	return nil
+}
+
+// RegenerateClientConfig 重新渲染已存在的用户 .ovpn（部门的动态口令开关变化后调用）；没有 .ovpn 时什么也不做
+func RegenerateClientConfig(username string) error {
+	if !utils.IsExists(filepath.Join(constants.ClientConfigDir, username+".ovpn")) {
+		return nil
+	}
+	return generateClientConfigFile(username)
+}
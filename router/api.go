@@ -0,0 +1,21 @@
+package router
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAPIRoutes 注册 /api 下的全部路由
+func SetupAPIRoutes(api *gin.RouterGroup) {
+	SetupHealthRoutes(api)
+	SetupUserRoutes(api)
+	SetupManageRoutes(api)
+	SetupServerRoutes(api)
+	SetupClientRoutes(api)
+	SetupLogRoutes(api)
+	SetupNotificationRoutes(api)
+	SetupQuotaRoutes(api)
+	SetupCARoutes(api)
+	SetupPermissionRoutes(api)
+	SetupAuditRoutes(api)
+	SetupIPAMRoutes(api)
+}
@@ -0,0 +1,47 @@
+package router
+
+import (
+	"net/http"
+	"os"
+	"testing"
+
+	"openvpn-admin-go/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 提供 JWT_SECRET，避免在包目录下生成 data/.jwt_secret
+var _ = os.Setenv("JWT_SECRET", "test-secret")
+
+// 每个写操作路由都要在 middleware/audit.go 的 auditRoutes（或 auditSkipped）中登记，
+// 否则审计记录里的动作只有 "方法 路由模板"；登记表里也不能留下已删除的路由
+func TestAuditRoutesCoverMutatingRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	SetupAPIRoutes(r.Group("/api"))
+
+	registered := map[string]bool{}
+	for _, k := range middleware.AuditRouteKeys() {
+		registered[k] = true
+	}
+	routes := map[string]bool{}
+	for _, rt := range r.Routes() {
+		switch rt.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			continue
+		}
+		key := rt.Method + " " + rt.Path
+		routes[key] = true
+		if !registered[key] {
+			t.Errorf("mutating route %q has no audit action", key)
+		}
+	}
+	if len(routes) == 0 {
+		t.Fatal("no mutating routes registered")
+	}
+	for k := range registered {
+		if !routes[k] {
+			t.Errorf("audit table entry %q matches no route", k)
+		}
+	}
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"openvpn-admin-go/controller"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupAuditRoutes 设置审计日志查询路由
+func SetupAuditRoutes(r *gin.RouterGroup) {
+	ctrl := &controller.AuditController{}
+	g := r.Group("/audit")
+	g.Use(middleware.JWTAuthMiddleware())
+	g.Use(middleware.PermissionRequired(model.PermAuditRead))
+	{
+		g.GET("", ctrl.List)
+		g.GET("/export", ctrl.Export)
+	}
+}
@@ -0,0 +1,23 @@
+package router
+
+import (
+	"openvpn-admin-go/controller"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupCARoutes 设置签发 CA / CA 轮换路由（ca.manage）
+func SetupCARoutes(r *gin.RouterGroup) {
+	ctrl := &controller.CAController{}
+	g := r.Group("/ca")
+	g.Use(middleware.JWTAuthMiddleware())
+	g.Use(middleware.PermissionRequired(model.PermCAManage))
+	{
+		g.GET("", ctrl.GetStatus)
+		g.POST("/csr", ctrl.CreateIntermediateCSR)
+		g.POST("/rotate", ctrl.Rotate)
+		g.POST("/retire", ctrl.Retire)
+	}
+}
@@ -16,27 +16,43 @@ func SetupClientRoutes(r *gin.RouterGroup) {
 	{
 		// User Management Routes (formerly in manage.go)
 		// POST /client -> clientCtrl.CreateUser
-		client.POST("", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.CreateUser)
+		client.POST("", middleware.PermissionRequired(model.PermClientCreate), clientCtrl.CreateUser)
 		// GET /client -> clientCtrl.ListUsers
-		client.GET("", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager), string(model.RoleUser)), clientCtrl.ListUsers)
+		client.GET("", middleware.PermissionRequired(model.PermClientRead), clientCtrl.ListUsers)
 		// GET /client/:id -> clientCtrl.GetUser
-		client.GET("/:id", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager), string(model.RoleUser)), clientCtrl.GetUser)
+		client.GET("/:id", middleware.PermissionRequired(model.PermClientRead), clientCtrl.GetUser)
 		// PUT /client/:id -> clientCtrl.UpdateUser
-		client.PUT("/:id", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.UpdateUser)
+		client.PUT("/:id", middleware.PermissionRequired(model.PermClientUpdate), clientCtrl.UpdateUser)
+		// GET /client/:id/sessions -> clientCtrl.ListSessions (VPN 会话历史，分页 + 时间段过滤)
+		client.GET("/:id/sessions", middleware.PermissionRequired(model.PermClientRead), clientCtrl.ListSessions)
+		// GET /client/:id/certificates -> clientCtrl.ListCertificates (证书序列号、有效期、状态)
+		client.GET("/:id/certificates", middleware.PermissionRequired(model.PermClientRead), clientCtrl.ListCertificates)
+		// GET/PUT /client/:id/ccd -> 客户端专属网络设置（固定 IP、子网、推送的路由与 DNS 等）
+		client.GET("/:id/ccd", middleware.PermissionRequired(model.PermClientNetwork), clientCtrl.GetCCD)
+		client.PUT("/:id/ccd", middleware.PermissionRequired(model.PermClientNetwork), clientCtrl.UpdateCCD)
 		// DELETE /client/:id -> clientCtrl.DeleteUser
-		client.DELETE("/:id", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.DeleteUser)
+		client.DELETE("/:id", middleware.PermissionRequired(model.PermClientDelete), clientCtrl.DeleteUser)
 
 		// Pause and Resume client routes
-		client.POST("/:username/pause", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.PauseClient)
-		client.POST("/:username/resume", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.ResumeClient)
+		client.POST("/:username/pause", middleware.PermissionRequired(model.PermClientPause), clientCtrl.PauseClient)
+		client.POST("/:username/resume", middleware.PermissionRequired(model.PermClientPause), clientCtrl.ResumeClient)
+
+		// 续签证书：吊销旧证书并重新生成 .ovpn
+		client.POST("/:username/renew", middleware.PermissionRequired(model.PermClientRenew), clientCtrl.RenewCertificate)
+
+		// CSR 自助签发：用户上传自己的 CSR，返回不含私钥的 .ovpn
+		client.POST("/enroll", middleware.PermissionRequired(model.PermClientEnroll), clientCtrl.Enroll)
 
 		// 注册审批：批准 / 拒绝（manager 仅本部门）
-		client.POST("/:username/approve", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.ApproveUser)
-		client.POST("/:username/reject", middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)), clientCtrl.RejectUser)
+		client.POST("/:username/approve", middleware.PermissionRequired(model.PermClientApprove), clientCtrl.ApproveUser)
+		client.POST("/:username/reject", middleware.PermissionRequired(model.PermClientApprove), clientCtrl.RejectUser)
+
+		// 解除登录失败锁定
+		client.POST("/:username/unlock", middleware.PermissionRequired(model.PermClientUnlock), clientCtrl.UnlockUser)
 
 		// Client Config Download (accessible by user for their own config, and admins/managers)
 		// Path changed from /config/:username to /:id/config
 		// Note: The GetClientConfig route uses /:username, matching Pause/Resume. The :id param is used for other user operations.
-		client.GET("/config/:username", clientCtrl.GetClientConfig) // Controller logic should enforce user can only get own
+		client.GET("/config/:username", middleware.PermissionRequired(model.PermClientConfig), clientCtrl.GetClientConfig) // Controller logic should enforce user can only get own
 	}
 }
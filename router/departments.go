@@ -16,16 +16,15 @@ import (
 // SetupManageRoutes 设置部门和用户管理路由
 func SetupManageRoutes(r *gin.RouterGroup) {
 	depCtrl := &controller.DepartmentController{}
-	// 部门管理: superadmin, admin
+	// 部门管理: department.read / department.write（列表公开，注册页需要）
 	dep := r.Group("/departments")
 	dep.GET("", depCtrl.ListDepartments)
-	dep.Use(middleware.JWTAuthMiddleware(), middleware.RoleRequired(
-		string(model.RoleSuperAdmin), string(model.RoleAdmin)))
+	dep.Use(middleware.JWTAuthMiddleware())
 	{
-		dep.POST("", depCtrl.CreateDepartment)
-		dep.GET("/:id", depCtrl.GetDepartment)
-		dep.PUT("/:id", depCtrl.UpdateDepartment)
-		dep.DELETE("/:id", depCtrl.DeleteDepartment)
+		dep.POST("", middleware.PermissionRequired(model.PermDepartmentWrite), depCtrl.CreateDepartment)
+		dep.GET("/:id", middleware.PermissionRequired(model.PermDepartmentRead), depCtrl.GetDepartment)
+		dep.PUT("/:id", middleware.PermissionRequired(model.PermDepartmentWrite), depCtrl.UpdateDepartment)
+		dep.DELETE("/:id", middleware.PermissionRequired(model.PermDepartmentWrite), depCtrl.DeleteDepartment)
 	}
 
 }
@@ -0,0 +1,20 @@
+package router
+
+import (
+	"openvpn-admin-go/controller"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupIPAMRoutes 设置隧道地址使用情况路由
+func SetupIPAMRoutes(r *gin.RouterGroup) {
+	ctrl := &controller.IPAMController{}
+	g := r.Group("/ipam")
+	g.Use(middleware.JWTAuthMiddleware())
+	g.Use(middleware.PermissionRequired(model.PermIPAMRead))
+	{
+		g.GET("", ctrl.Get)
+	}
+}
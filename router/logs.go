@@ -3,6 +3,7 @@ package router
 import (
    "openvpn-admin-go/controller"
    "openvpn-admin-go/middleware"
+   "openvpn-admin-go/model"
 
    "github.com/gin-gonic/gin"
 )
@@ -12,7 +13,7 @@ func SetupLogRoutes(r *gin.RouterGroup) {
    logCtrl := &controller.LogController{}
 
    logs := r.Group("/logs")
-   logs.Use(middleware.JWTAuthMiddleware())
+   logs.Use(middleware.JWTAuthMiddleware(), middleware.PermissionRequired(model.PermLogsRead))
    {
        logs.GET("/server", logCtrl.GetServerLogs)
        logs.GET("/client", logCtrl.GetClientLogs)
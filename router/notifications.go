@@ -8,12 +8,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// SetupNotificationRoutes registers notification endpoints (superadmin only)
+// SetupNotificationRoutes registers notification endpoints (notification.read)
 func SetupNotificationRoutes(r *gin.RouterGroup) {
 	ctrl := &controller.NotificationController{}
 	g := r.Group("/notifications")
 	g.Use(middleware.JWTAuthMiddleware())
-	g.Use(middleware.RoleRequired(string(model.RoleSuperAdmin)))
+	g.Use(middleware.PermissionRequired(model.PermNotificationRead))
 	{
 		g.GET("", ctrl.List)
 		g.GET("/unread-count", ctrl.UnreadCount)
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"openvpn-admin-go/controller"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupPermissionRoutes 设置权限注册表与角色权限路由（superadmin）
+func SetupPermissionRoutes(r *gin.RouterGroup) {
+	ctrl := &controller.PermissionController{}
+	g := r.Group("/permissions")
+	g.Use(middleware.JWTAuthMiddleware())
+	g.Use(middleware.PermissionRequired(model.PermPermissionManage))
+	{
+		g.GET("", ctrl.List)
+		g.PUT("/roles/:role", ctrl.UpdateRole)
+	}
+}
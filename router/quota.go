@@ -0,0 +1,24 @@
+package router
+
+import (
+	"openvpn-admin-go/controller"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SetupQuotaRoutes 设置流量配额路由（quota.read / quota.write）
+func SetupQuotaRoutes(r *gin.RouterGroup) {
+	ctrl := &controller.QuotaController{}
+	g := r.Group("/quota")
+	g.Use(middleware.JWTAuthMiddleware())
+	{
+		g.GET("/users", middleware.PermissionRequired(model.PermQuotaRead), ctrl.ListUserQuotas)
+		g.GET("/users/:id", middleware.PermissionRequired(model.PermQuotaRead), ctrl.GetUserQuota)
+		g.PUT("/users/:id", middleware.PermissionRequired(model.PermQuotaWrite), ctrl.SetUserQuota)
+		g.GET("/departments", middleware.PermissionRequired(model.PermQuotaRead), ctrl.ListDepartmentQuotas)
+		g.GET("/departments/:id", middleware.PermissionRequired(model.PermQuotaRead), ctrl.GetDepartmentQuota)
+		g.PUT("/departments/:id", middleware.PermissionRequired(model.PermQuotaWrite), ctrl.SetDepartmentQuota)
+	}
+}
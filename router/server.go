@@ -15,29 +15,26 @@ func SetupServerRoutes(r *gin.RouterGroup) {
 	server := r.Group("/server")
 	server.Use(middleware.JWTAuthMiddleware())
 	{
-		// 列出服务器列表: 所有认证用户
-		server.GET("/list", serverCtrl.ListServers)
-		// 查看服务器状态: 所有认证用户
-		server.GET("/status", serverCtrl.GetServerStatus)
-		// 部署系统状态（服务版本 + 主机 CPU/内存/磁盘/负载）: 所有认证用户
-		server.GET("/system", systemCtrl.GetSystemInfo)
-		// 管理操作: superadmin
-		super := server.Group("")
-		super.Use(middleware.RoleRequired(string(model.RoleSuperAdmin)))
-		{
-			super.PUT("/update", serverCtrl.UpdateServer)
-			super.DELETE("/delete", serverCtrl.DeleteServer)
-			super.POST("/start", serverCtrl.StartServer)
-			super.POST("/stop", serverCtrl.StopServer)
-			super.POST("/restart", serverCtrl.RestartServer)
-			super.GET("/config/raw", serverCtrl.GetRawServerConfig)
-			super.GET("/config/template", serverCtrl.GetServerConfigTemplate)
-			super.PUT("/config", serverCtrl.UpdateServerConfig)
-			super.PUT("/port", serverCtrl.UpdatePort)
-			// 配置项管理
-			super.GET("/config/items", serverCtrl.GetConfigItems)
-			super.PUT("/config/items", serverCtrl.UpdateConfigItems)
-			super.PUT("/config/item/:key", serverCtrl.UpdateConfigItem)
-		}
+		// 列出服务器列表: server.read
+		server.GET("/list", middleware.PermissionRequired(model.PermServerRead), serverCtrl.ListServers)
+		// 查看服务器状态: server.read
+		server.GET("/status", middleware.PermissionRequired(model.PermServerRead), serverCtrl.GetServerStatus)
+		// 部署系统状态（服务版本 + 主机 CPU/内存/磁盘/负载）: server.read
+		server.GET("/system", middleware.PermissionRequired(model.PermServerRead), systemCtrl.GetSystemInfo)
+		// 启停: server.control
+		server.POST("/start", middleware.PermissionRequired(model.PermServerControl), serverCtrl.StartServer)
+		server.POST("/stop", middleware.PermissionRequired(model.PermServerControl), serverCtrl.StopServer)
+		server.POST("/restart", middleware.PermissionRequired(model.PermServerControl), serverCtrl.RestartServer)
+		// 配置查看: server.config.read
+		server.GET("/config/raw", middleware.PermissionRequired(model.PermServerConfigRead), serverCtrl.GetRawServerConfig)
+		server.GET("/config/template", middleware.PermissionRequired(model.PermServerConfigRead), serverCtrl.GetServerConfigTemplate)
+		server.GET("/config/items", middleware.PermissionRequired(model.PermServerConfigRead), serverCtrl.GetConfigItems)
+		// 配置修改: server.config.write
+		server.PUT("/update", middleware.PermissionRequired(model.PermServerConfigWrite), serverCtrl.UpdateServer)
+		server.DELETE("/delete", middleware.PermissionRequired(model.PermServerConfigWrite), serverCtrl.DeleteServer)
+		server.PUT("/config", middleware.PermissionRequired(model.PermServerConfigWrite), serverCtrl.UpdateServerConfig)
+		server.PUT("/port", middleware.PermissionRequired(model.PermServerConfigWrite), serverCtrl.UpdatePort)
+		server.PUT("/config/items", middleware.PermissionRequired(model.PermServerConfigWrite), serverCtrl.UpdateConfigItems)
+		server.PUT("/config/item/:key", middleware.PermissionRequired(model.PermServerConfigWrite), serverCtrl.UpdateConfigItem)
 	}
 }
@@ -16,18 +16,52 @@ func SetupUserRoutes(r *gin.RouterGroup) {
    {
        user.POST("/register", controller.Register)
        user.POST("/login", middleware.RateLimit(10, time.Minute), controller.Login)
-       user.GET("/verify-email/:token", controller.VerifyEmail)
-       user.POST("/forgot-password", controller.ForgotPassword)
-       user.PATCH("/reset-password/:token", controller.ResetPassword)
+       // 两步验证登录：第二步（挑战令牌 + 验证码）与登录中的强制启用
+       user.POST("/login/mfa", middleware.RateLimit(10, time.Minute), controller.LoginMFA)
+       user.POST("/login/mfa/setup", middleware.RateLimit(10, time.Minute), controller.LoginMFASetup)
+       // OIDC 单点登录：跳转身份提供方，前端回调页提交授权码
+       user.GET("/oidc", controller.GetSSOConfig)
+       user.GET("/oidc/login", middleware.RateLimit(10, time.Minute), controller.SSOLogin)
+       user.POST("/oidc/callback", middleware.RateLimit(10, time.Minute), controller.SSOCallback)
+       // 邮件链接：一次性令牌（数据库只存哈希，过期/用过即失效）
+       user.GET("/verify-email/:token", middleware.RateLimit(10, time.Minute), controller.VerifyEmail)
+       user.POST("/verify-email", middleware.RateLimit(10, time.Minute), middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.ResendVerificationEmail)
+       user.POST("/forgot-password", middleware.RateLimit(10, time.Minute), controller.ForgotPassword)
+       user.PATCH("/reset-password/:token", middleware.RateLimit(10, time.Minute), controller.ResetPassword)
        user.GET("/me", middleware.JWTAuthMiddleware(), controller.GetMe)
-       user.PATCH("/me", middleware.JWTAuthMiddleware(), controller.UpdateMe)
-       user.POST("/logout", middleware.JWTAuthMiddleware(), controller.Logout)
-       user.GET("/refresh", middleware.JWTAuthMiddleware(), controller.RefreshToken)
+       user.PATCH("/me", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.UpdateMe)
+       user.POST("/logout", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.Logout)
+       // 刷新令牌换新（访问令牌可能已过期，所以不经过 JWT 中间件）。
+       // 同一出口 IP 后的多个用户、多个标签页都会定期刷新，限额比登录类接口宽松
+       user.POST("/refresh", middleware.RateLimit(60, time.Minute), controller.RefreshToken)
+       // 当前用户的登录会话
+       user.GET("/sessions", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.ListMySessions)
+       user.DELETE("/sessions", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.RevokeOtherSessions)
+       user.DELETE("/sessions/:id", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.RevokeMySession)
+       // 个人 API 令牌（令牌本身不能管理令牌、会话、两步验证和密码）
+       user.GET("/tokens", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.ListAPITokens)
+       user.POST("/tokens", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.CreateAPIToken)
+       user.DELETE("/tokens/:id", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.DeleteAPIToken)
        user.GET("/roles", middleware.JWTAuthMiddleware(), controller.GetRoles)
-       // 查询用户信息: superadmin/admin/manager
+       // 当前用户的有效权限（前端据此隐藏按钮）
+       user.GET("/permissions", middleware.JWTAuthMiddleware(), controller.GetMyPermissions)
+       // 当前用户的两步验证管理
+       user.GET("/mfa", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.GetMFAStatus)
+       user.POST("/mfa/setup", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.SetupMFA)
+       user.POST("/mfa/enable", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.EnableMFA)
+       user.POST("/mfa/disable", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.DisableMFA)
+       user.POST("/mfa/recovery-codes", middleware.JWTAuthMiddleware(), middleware.SessionRequired(), controller.RegenerateRecoveryCodes)
+       // 清除指定用户的两步验证（丢失验证器时）: user.mfa.reset
+       user.DELETE("/mfa/:id",
+           middleware.JWTAuthMiddleware(),
+           middleware.SessionRequired(),
+           middleware.PermissionRequired(model.PermUserMFAReset),
+           controller.ResetUserMFA,
+       )
+       // 查询用户信息: user.read
        user.GET("/info/:id",
            middleware.JWTAuthMiddleware(),
-           middleware.RoleRequired(string(model.RoleSuperAdmin), string(model.RoleAdmin), string(model.RoleManager)),
+           middleware.PermissionRequired(model.PermUserRead),
            controller.GetUserInfo,
        )
    }
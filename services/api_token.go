@@ -0,0 +1,112 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+)
+
+// API 令牌有效期（天）
+const (
+	DefaultAPITokenDays = 90
+	MaxAPITokenDays     = 365
+)
+
+// apiTokenTouchInterval last_used_at 的最小更新间隔，避免每个请求都写库
+const apiTokenTouchInterval = time.Minute
+
+var (
+	// ErrAPITokenInvalid 令牌不存在、已过期或所有者已不可用
+	ErrAPITokenInvalid = errors.New("invalid or expired API token")
+	// ErrAPITokenNotFound 令牌不存在或不属于当前用户
+	ErrAPITokenNotFound = errors.New("API token not found")
+)
+
+// CreateAPIToken 为用户创建 API 令牌，返回记录与明文（只返回这一次）
+func CreateAPIToken(db *gorm.DB, user *model.User, name string, scopes []string, ttl time.Duration) (*model.APIToken, string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, "", err
+	}
+	token := middleware.APITokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+	row := model.APIToken{
+		UserID:    user.ID,
+		Name:      name,
+		Prefix:    token[:len(middleware.APITokenPrefix)+6],
+		TokenHash: hashUserToken(token),
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return nil, "", err
+	}
+	return &row, token, nil
+}
+
+// AuthenticateAPIToken 校验 API 令牌，返回令牌所有者（角色 / 部门以数据库当前值为准）与令牌记录，并记录最近使用时间
+func AuthenticateAPIToken(db *gorm.DB, token, clientIP string) (*model.User, *model.APIToken, error) {
+	var row model.APIToken
+	if err := db.First(&row, "token_hash = ?", hashUserToken(token)).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+	now := time.Now()
+	if now.After(row.ExpiresAt) {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	var user model.User
+	if err := db.First(&user, "id = ?", row.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, ErrAPITokenInvalid
+		}
+		return nil, nil, err
+	}
+	if user.ApprovalStatus != model.ApprovalApproved {
+		return nil, nil, ErrAPITokenInvalid
+	}
+	if row.LastUsedAt == nil || now.Sub(*row.LastUsedAt) >= apiTokenTouchInterval || row.LastUsedIP != clientIP {
+		if err := db.Model(&row).Updates(map[string]interface{}{"last_used_at": now, "last_used_ip": clientIP}).Error; err != nil {
+			logging.Warn("Failed to record use of API token %s: %v", row.ID, err)
+		}
+	}
+	return &user, &row, nil
+}
+
+// ListAPITokens 用户的全部 API 令牌（含已过期），最新的在前
+func ListAPITokens(db *gorm.DB, userID string) ([]model.APIToken, error) {
+	var tokens []model.APIToken
+	err := db.Where("user_id = ?", userID).Order("created_at DESC").Find(&tokens).Error
+	return tokens, err
+}
+
+// DeleteAPIToken 删除（吊销）用户自己的一个 API 令牌
+func DeleteAPIToken(db *gorm.DB, userID, tokenID string) error {
+	res := db.Where("id = ? AND user_id = ?", tokenID, userID).Delete(&model.APIToken{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAPITokenNotFound
+	}
+	return nil
+}
+
+// APITokenClaims 供 middleware.APITokenAuth 使用：校验令牌并生成 Claims 与权限范围
+func APITokenClaims(db *gorm.DB, token, clientIP string) (*middleware.Claims, []string, error) {
+	user, row, err := AuthenticateAPIToken(db, token, clientIP)
+	if err != nil {
+		return nil, nil, err
+	}
+	claims := &middleware.Claims{UserID: user.ID, Role: string(user.Role), DeptID: user.DepartmentID}
+	return claims, strings.Split(row.Scopes, ","), nil
+}
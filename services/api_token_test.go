@@ -0,0 +1,126 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"openvpn-admin-go/middleware"
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+)
+
+func apiTokenLastUsed(t *testing.T, db *gorm.DB, id string) (time.Time, string) {
+	t.Helper()
+	var row model.APIToken
+	if err := db.First(&row, "id = ?", id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if row.LastUsedAt == nil {
+		return time.Time{}, row.LastUsedIP
+	}
+	return *row.LastUsedAt, row.LastUsedIP
+}
+
+func TestAPITokenClaims(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", Role: model.RoleAdmin})
+	scopes := []string{middleware.ScopeRead, middleware.ScopeClientsPause}
+	_, token, err := CreateAPIToken(db, alice, "ci", scopes, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, gotScopes, err := APITokenClaims(db, token, "192.0.2.1")
+	if err != nil {
+		t.Fatalf("APITokenClaims: %v", err)
+	}
+	if claims.UserID != alice.ID || claims.Role != string(model.RoleAdmin) || !reflect.DeepEqual(gotScopes, scopes) {
+		t.Errorf("claims = %+v, scopes = %v", claims, gotScopes)
+	}
+
+	// 角色以数据库当前值为准：令牌创建后被降级，令牌也随之降级
+	db.Model(&model.User{}).Where("id = ?", alice.ID).Updates(map[string]interface{}{"role": model.RoleUser})
+	claims, _, err = APITokenClaims(db, token, "192.0.2.1")
+	if err != nil || claims.Role != string(model.RoleUser) {
+		t.Errorf("after demotion: role = %v, err = %v", claims, err)
+	}
+
+	// 所有者不再是已批准状态
+	db.Model(&model.User{}).Where("id = ?", alice.ID).Update("approval_status", model.ApprovalPending)
+	if _, _, err := APITokenClaims(db, token, "192.0.2.1"); err != ErrAPITokenInvalid {
+		t.Errorf("unapproved owner: err = %v, want ErrAPITokenInvalid", err)
+	}
+	// 所有者已删除
+	db.Delete(&model.User{}, "id = ?", alice.ID)
+	if _, _, err := APITokenClaims(db, token, "192.0.2.1"); err != ErrAPITokenInvalid {
+		t.Errorf("deleted owner: err = %v, want ErrAPITokenInvalid", err)
+	}
+
+	if _, _, err := APITokenClaims(db, middleware.APITokenPrefix+"unknown", "192.0.2.1"); err != ErrAPITokenInvalid {
+		t.Errorf("unknown token: err = %v, want ErrAPITokenInvalid", err)
+	}
+}
+
+func TestAuthenticateAPITokenExpired(t *testing.T) {
+	db := newTestDB(t)
+	bob := createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com"})
+	row, token, err := CreateAPIToken(db, bob, "old", []string{middleware.ScopeRead}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := AuthenticateAPIToken(db, token, "192.0.2.1"); err != ErrAPITokenInvalid {
+		t.Errorf("expired token: err = %v, want ErrAPITokenInvalid", err)
+	}
+	// 被拒绝的请求不记录使用时间
+	if used, _ := apiTokenLastUsed(t, db, row.ID); !used.IsZero() {
+		t.Errorf("expired token recorded as used at %v", used)
+	}
+}
+
+// last_used_at 每分钟最多写一次，来源地址变化时立即更新
+func TestAuthenticateAPITokenTouchThrottle(t *testing.T) {
+	db := newTestDB(t)
+	carol := createTestUser(t, db, &model.User{Name: "carol", Email: "carol@example.com"})
+	row, token, err := CreateAPIToken(db, carol, "ci", []string{middleware.ScopeRead}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := AuthenticateAPIToken(db, token, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	first, ip := apiTokenLastUsed(t, db, row.ID)
+	if first.IsZero() || ip != "192.0.2.1" {
+		t.Fatalf("first use not recorded: %v %q", first, ip)
+	}
+
+	// 间隔内的再次使用不写库
+	recent := time.Now().Add(-apiTokenTouchInterval / 2)
+	db.Model(&model.APIToken{}).Where("id = ?", row.ID).Update("last_used_at", recent)
+	if _, _, err := AuthenticateAPIToken(db, token, "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := apiTokenLastUsed(t, db, row.ID); !used.Equal(recent) {
+		t.Errorf("within interval: last_used_at = %v, want unchanged %v", used, recent)
+	}
+
+	// 换了来源地址：立即更新
+	if _, _, err := AuthenticateAPIToken(db, token, "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if used, ip := apiTokenLastUsed(t, db, row.ID); !used.After(recent) || ip != "198.51.100.7" {
+		t.Errorf("new address: last_used_at = %v, ip = %q", used, ip)
+	}
+
+	// 超过间隔：更新
+	stale := time.Now().Add(-2 * apiTokenTouchInterval)
+	db.Model(&model.APIToken{}).Where("id = ?", row.ID).Update("last_used_at", stale)
+	if _, _, err := AuthenticateAPIToken(db, token, "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if used, _ := apiTokenLastUsed(t, db, row.ID); !used.After(stale.Add(apiTokenTouchInterval)) {
+		t.Errorf("after interval: last_used_at = %v not refreshed", used)
+	}
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+)
+
+// RecordAuditEvent 保存一条审计事件，供 middleware.AuditRecorder 使用。
+// 操作者名称（以及登录等未携带令牌的请求的角色）按 ID 查出后一并保存，用户删除后记录仍可读；
+// 写入失败只记日志，不影响请求。
+func RecordAuditEvent(db *gorm.DB, ev *model.AuditEvent) {
+	if ev.ActorID != "" && (ev.ActorName == "" || ev.ActorRole == "") {
+		var user model.User
+		if err := db.Select("name", "role").First(&user, "id = ?", ev.ActorID).Error; err == nil {
+			ev.ActorName = user.Name
+			if ev.ActorRole == "" {
+				ev.ActorRole = string(user.Role)
+			}
+		}
+	}
+	if err := db.Create(ev).Error; err != nil {
+		logging.Error("Failed to record audit event %s by '%s': %v", ev.Action, ev.ActorName, err)
+	}
+}
+
+// AuditFilter 审计事件查询条件，零值字段不过滤
+type AuditFilter struct {
+	// Actor 操作者 ID 或名称
+	Actor      string
+	Action     string
+	TargetType string
+	TargetID   string
+	Result     string
+	From       time.Time
+	To         time.Time
+	Offset     int
+	Limit      int
+}
+
+func (f AuditFilter) apply(db *gorm.DB) *gorm.DB {
+	db = db.Model(&model.AuditEvent{})
+	if f.Actor != "" {
+		db = db.Where("actor_id = ? OR actor_name = ?", f.Actor, f.Actor)
+	}
+	if f.Action != "" {
+		db = db.Where("action = ?", f.Action)
+	}
+	if f.TargetType != "" {
+		db = db.Where("target_type = ?", f.TargetType)
+	}
+	if f.TargetID != "" {
+		db = db.Where("target_id = ? OR target_name = ?", f.TargetID, f.TargetID)
+	}
+	if f.Result != "" {
+		db = db.Where("result = ?", f.Result)
+	}
+	if !f.From.IsZero() {
+		db = db.Where("created_at >= ?", f.From)
+	}
+	if !f.To.IsZero() {
+		db = db.Where("created_at <= ?", f.To)
+	}
+	return db
+}
+
+// ListAuditEvents 按条件分页查询审计事件（新的在前），同时返回符合条件的总数
+func ListAuditEvents(db *gorm.DB, f AuditFilter) ([]model.AuditEvent, int64, error) {
+	var total int64
+	if err := f.apply(db).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	var events []model.AuditEvent
+	err := f.apply(db).Order("created_at DESC").Offset(f.Offset).Limit(f.Limit).Find(&events).Error
+	return events, total, err
+}
+
+// auditCSVHeader CSV 导出的列
+var auditCSVHeader = []string{
+	"time", "actor_id", "actor_name", "actor_role", "via_api_token", "action",
+	"target_type", "target_id", "target_name", "changes", "source_ip",
+	"method", "path", "status", "result", "error",
+}
+
+func auditCSVRecord(e model.AuditEvent) []string {
+	return []string{
+		e.CreatedAt.Format(time.RFC3339), e.ActorID, csvSafe(e.ActorName), e.ActorRole,
+		strconv.FormatBool(e.ViaAPIToken), e.Action, e.TargetType, csvSafe(e.TargetID), csvSafe(e.TargetName),
+		csvSafe(e.Changes), e.SourceIP, e.Method, csvSafe(e.Path), strconv.Itoa(e.Status), e.Result, csvSafe(e.Error),
+	}
+}
+
+// csvSafe 用户可控的内容以 = + - @ 开头时加单引号，防止在电子表格中被当作公式执行
+func csvSafe(v string) string {
+	if v != "" && strings.ContainsRune("=+-@\t\r", rune(v[0])) {
+		return "'" + v
+	}
+	return v
+}
+
+// ExportAuditCSV 把符合条件的审计事件（忽略分页，新的在前）以 CSV 写入 w，分批读取避免一次载入全部记录
+func ExportAuditCSV(db *gorm.DB, f AuditFilter, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(auditCSVHeader); err != nil {
+		return err
+	}
+	const batchSize = 500
+	for offset := 0; ; offset += batchSize {
+		var batch []model.AuditEvent
+		if err := f.apply(db).Order("created_at DESC, id").Offset(offset).Limit(batchSize).Find(&batch).Error; err != nil {
+			return err
+		}
+		for _, e := range batch {
+			if err := cw.Write(auditCSVRecord(e)); err != nil {
+				return err
+			}
+		}
+		if len(batch) < batchSize {
+			break
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"testing"
+
+	"openvpn-admin-go/model"
+)
+
+func TestAuditCSVRecord(t *testing.T) {
+	rec := auditCSVRecord(model.AuditEvent{
+		ActorName:  "alice",
+		Action:     "client.create",
+		TargetName: "=HYPERLINK(\"http://example.com\")",
+		Status:     200,
+		Result:     model.AuditResultSuccess,
+	})
+	if len(rec) != len(auditCSVHeader) {
+		t.Fatalf("record has %d columns, header %d", len(rec), len(auditCSVHeader))
+	}
+	if rec[2] != "alice" || rec[5] != "client.create" || rec[13] != "200" {
+		t.Errorf("record = %q", rec)
+	}
+	if rec[8] != "'=HYPERLINK(\"http://example.com\")" {
+		t.Errorf("formula not escaped: %q", rec[8])
+	}
+}
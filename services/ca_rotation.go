@@ -0,0 +1,210 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// caRotationInterval CA 轮换后台任务的检查间隔
+const caRotationInterval = time.Minute
+
+// caRotationBatchSize 每轮最多为多少个用户换发证书（RSA 4096 生成密钥较慢，分批避免长时间占满 CPU）
+const caRotationBatchSize = 20
+
+// CARotationProgress CA 轮换进度：Users 为仍持有旧 CA 有效证书的用户数，Reissued 为其中已拿到
+// 新 CA 证书的人数，Reconnected 为已用新证书连接过的人数
+type CARotationProgress struct {
+	Users       int64 `json:"users"`
+	Reissued    int64 `json:"reissued"`
+	Reconnected int64 `json:"reconnected"`
+}
+
+// Done 所有用户都已用新证书连接过，可以退役旧 CA。没有统计到任何用户时（例如证书记录
+// 还没补登记）无法确认，不算完成。
+func (p *CARotationProgress) Done() bool {
+	return p.Users > 0 && p.Reconnected >= p.Users
+}
+
+// rotatingUsers 仍持有旧 CA（ca_id 不是 caID）有效证书的用户
+func rotatingUsers(db *gorm.DB, caID string) *gorm.DB {
+	return db.Model(&model.User{}).Where("name IN (?)",
+		db.Model(&model.Certificate{}).Select("user_name").
+			Where("status = ? AND ca_id <> ?", model.CertificateValid, caID))
+}
+
+// newCACertificates 持有新 CA 有效证书的用户名
+func newCACertificates(db *gorm.DB, caID string) *gorm.DB {
+	return db.Model(&model.Certificate{}).Select("user_name").
+		Where("status = ? AND ca_id = ?", model.CertificateValid, caID)
+}
+
+// GetCARotationProgress 统计以 caID 为新 CA 的轮换进度
+func GetCARotationProgress(db *gorm.DB, caID string) (*CARotationProgress, error) {
+	var p CARotationProgress
+	if err := rotatingUsers(db, caID).Count(&p.Users).Error; err != nil {
+		return nil, err
+	}
+	if err := rotatingUsers(db, caID).Where("name IN (?)", newCACertificates(db, caID)).
+		Count(&p.Reissued).Error; err != nil {
+		return nil, err
+	}
+	if err := rotatingUsers(db, caID).Where("name IN (?)", newCACertificates(db, caID).Where("last_seen_at IS NOT NULL")).
+		Count(&p.Reconnected).Error; err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// reissueForCARotation 为最多 limit 个还没有新 CA 证书的用户签发新证书、重新生成 .ovpn 并发通知，
+// 返回成功人数。旧证书不吊销：用户换上新配置之前照常可连，旧 CA 退役时才失效。
+// 部门要求 CSR 自助签发的用户无法代为换发，每次轮换只通知一次，由用户上传新的 CSR。
+func reissueForCARotation(db *gorm.DB, caID string, since time.Time, limit int) int {
+	var users []model.User
+	if err := rotatingUsers(db, caID).Where("name NOT IN (?)", newCACertificates(db, caID)).
+		Order("name").Find(&users).Error; err != nil {
+		logging.Error("Failed to list users pending CA rotation: %v", err)
+		return 0
+	}
+	n := 0
+	for i := range users {
+		if n >= limit {
+			break
+		}
+		u := &users[i]
+		if RequiresCSR(db, u) {
+			notifyReenroll(db, u, since)
+			continue
+		}
+		if err := IssueUserCertificate(db, u); err != nil {
+			logging.Error("Failed to reissue certificate of user '%s' for CA rotation: %v", u.Name, err)
+			continue
+		}
+		n++
+		note := model.Notification{
+			Type:     model.NotificationTypeCertReissued,
+			UserName: u.Name,
+			Detail:   "certificate reissued by the new CA, download the new .ovpn before the old CA is retired",
+		}
+		if err := db.Create(&note).Error; err != nil {
+			logging.Error("Failed to create notification for user '%s' (%s): %v", u.Name, note.Type, err)
+		}
+	}
+	return n
+}
+
+// notifyReenroll 通知 CSR 自助签发的用户用新的 CSR 重新申请证书；since（轮换开始时间）之后已通知过则跳过
+func notifyReenroll(db *gorm.DB, u *model.User, since time.Time) {
+	var count int64
+	if err := db.Model(&model.Notification{}).
+		Where("user_name = ? AND type = ? AND created_at >= ?", u.Name, model.NotificationTypeCertReenroll, since).
+		Count(&count).Error; err != nil {
+		logging.Error("Failed to check notifications of user '%s': %v", u.Name, err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	note := model.Notification{
+		Type:     model.NotificationTypeCertReenroll,
+		UserName: u.Name,
+		Detail:   "CA rotation in progress, upload a new CSR before the old CA is retired",
+	}
+	if err := db.Create(&note).Error; err != nil {
+		logging.Error("Failed to create notification for user '%s' (%s): %v", u.Name, note.Type, err)
+	}
+}
+
+// RetireCA 结束 CA 轮换：停止信任旧 CA，并把旧 CA 签发的证书记录标为已吊销
+func RetireCA(db *gorm.DB) error {
+	caID, err := openvpn.CurrentCAID()
+	if err != nil {
+		return fmt.Errorf("读取当前CA失败: %v", err)
+	}
+	if err := openvpn.RetireCA(); err != nil {
+		return err
+	}
+	if err := markCertificatesRevoked(db.Where("ca_id <> ?", caID)); err != nil {
+		return fmt.Errorf("旧 CA 已退役，但更新证书记录失败: %v", err)
+	}
+	logging.Info("CA rotation finished, old CA retired")
+	return nil
+}
+
+// 读取磁盘上的 CA 状态、退役旧 CA；测试中替换
+var (
+	caStatus = openvpn.GetCAStatus
+	retireCA = RetireCA
+)
+
+// ProcessCARotation 轮换进行中时执行一轮：分批换发证书；所有用户都用新证书连接过后自动退役旧 CA。
+// 连接记录来自 client-connect（认证全部通过之后），被吊销或拉黑的旧证书握手不会被算作已连接；
+// 等不及的管理员可以用 POST /api/ca/retire 或 ca retire --force 提前退役。
+func ProcessCARotation(db *gorm.DB) {
+	status, err := caStatus()
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			logging.Error("Failed to read CA status: %v", err)
+		}
+		return
+	}
+	if !status.Rotating {
+		return
+	}
+	caID := status.Current.ID
+	var since time.Time
+	if status.StartedAt != nil {
+		since = *status.StartedAt
+	}
+	if n := reissueForCARotation(db, caID, since, caRotationBatchSize); n > 0 {
+		logging.Info("CA rotation: reissued certificates for %d user(s)", n)
+	}
+	progress, err := GetCARotationProgress(db, caID)
+	if err != nil {
+		logging.Error("Failed to compute CA rotation progress: %v", err)
+		return
+	}
+	if !progress.Done() {
+		return
+	}
+	if err := retireCA(db); err != nil {
+		logging.Error("Failed to retire old CA: %v", err)
+		return
+	}
+	note := model.Notification{
+		Type:   model.NotificationTypeCARotationDone,
+		Detail: fmt.Sprintf("all %d user(s) have reconnected with the new CA, the old CA has been retired", progress.Users),
+	}
+	if err := db.Create(&note).Error; err != nil {
+		logging.Error("Failed to create notification (%s): %v", note.Type, err)
+	}
+}
+
+// StartCARotationService 定期推进 CA 轮换，支持 context 取消和 WaitGroup 优雅退出
+func StartCARotationService(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB) {
+	logging.Info("Starting CA Rotation Service: interval %s", caRotationInterval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(caRotationInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logging.Info("CA Rotation Service stopping...")
+				return
+			case <-ticker.C:
+				ProcessCARotation(db)
+			}
+		}
+	}()
+}
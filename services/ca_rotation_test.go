@@ -0,0 +1,103 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+func TestCARotationProgressDone(t *testing.T) {
+	cases := []struct {
+		p    CARotationProgress
+		want bool
+	}{
+		// 没有统计到任何用户：无法确认，不能当作完成
+		{CARotationProgress{}, false},
+		{CARotationProgress{Users: 3, Reissued: 3, Reconnected: 2}, false},
+		{CARotationProgress{Users: 3, Reissued: 3, Reconnected: 3}, true},
+	}
+	for _, tc := range cases {
+		if got := tc.p.Done(); got != tc.want {
+			t.Errorf("%+v.Done() = %v, want %v", tc.p, got, tc.want)
+		}
+	}
+}
+
+func TestCARotationProgressReconnected(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	for _, c := range []model.Certificate{
+		{UserName: "alice", Serial: "A", CAID: "old", NotBefore: now, NotAfter: now.Add(time.Hour), Status: model.CertificateValid},
+		{UserName: "alice", Serial: "B", CAID: "new", NotBefore: now, NotAfter: now.Add(time.Hour), Status: model.CertificateValid},
+		{UserName: "bob", Serial: "C", CAID: "old", NotBefore: now, NotAfter: now.Add(time.Hour), Status: model.CertificateValid},
+	} {
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com"})
+
+	// client-connect 记下的序列号是十进制：0xB = 11
+	markCertificateSeen(db, "11", now)
+	// 更早的记录（例如重读旧日志）不会覆盖更新的时间
+	markCertificateSeen(db, "11", now.Add(-time.Hour))
+	var cert model.Certificate
+	db.First(&cert, "serial = ?", "B")
+	if cert.LastSeenAt == nil || cert.LastSeenAt.Unix() != now.Unix() {
+		t.Errorf("last seen = %v, want %v", cert.LastSeenAt, now)
+	}
+
+	p, err := GetCARotationProgress(db, "new")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Users != 2 || p.Reissued != 1 || p.Reconnected != 1 || p.Done() {
+		t.Errorf("progress = %+v", p)
+	}
+
+}
+
+func TestProcessCARotationRetiresWhenDone(t *testing.T) {
+	db := newTestDB(t)
+	now := time.Now()
+	start := now.Add(-time.Hour)
+	origStatus, origRetire := caStatus, retireCA
+	t.Cleanup(func() { caStatus, retireCA = origStatus, origRetire })
+	caStatus = func() (*openvpn.CAStatus, error) {
+		return &openvpn.CAStatus{Current: openvpn.CAInfo{ID: "new"}, Rotating: true, StartedAt: &start}, nil
+	}
+	retired := 0
+	retireCA = func(*gorm.DB) error { retired++; return nil }
+
+	createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	for _, c := range []model.Certificate{
+		{UserName: "alice", Serial: "A", CAID: "old", NotBefore: now, NotAfter: now.Add(time.Hour), Status: model.CertificateValid},
+		{UserName: "alice", Serial: "B", CAID: "new", NotBefore: now, NotAfter: now.Add(time.Hour), Status: model.CertificateValid},
+	} {
+		if err := db.Create(&c).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// 还没用新证书连接过：不退役
+	ProcessCARotation(db)
+	if retired != 0 {
+		t.Fatalf("old CA retired before anyone reconnected")
+	}
+
+	markCertificateSeen(db, "11", now)
+	ProcessCARotation(db)
+	if retired != 1 {
+		t.Fatalf("retired %d time(s), want 1", retired)
+	}
+	var count int64
+	db.Model(&model.Notification{}).Where("type = ?", model.NotificationTypeCARotationDone).Count(&count)
+	if count != 1 {
+		t.Errorf("rotation done notifications = %d, want 1", count)
+	}
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrInvalidClientCCD CCD 设置未通过校验（路由、DNS、指令格式，固定 IP 不在服务端网段或部门范围内）
+var ErrInvalidClientCCD = errors.New("invalid client config")
+
+// clientCCDSpec 由用户的固定 IP（IPv4 / IPv6）、子网与保存的推送设置组成 CCD 内容（不含部门策略）
+func clientCCDSpec(u *model.User, row *model.ClientCCD) *openvpn.ClientCCD {
+	return &openvpn.ClientCCD{
+		FixedIP:         u.FixedIP,
+		FixedIPv6:       u.FixedIPv6,
+		Subnet:          u.Subnet,
+		PushReset:       row.PushReset,
+		Routes:          row.Routes.Compact(),
+		DNSServers:      row.DNSServers.Compact(),
+		SearchDomains:   row.SearchDomains.Compact(),
+		RedirectGateway: strings.TrimSpace(row.RedirectGateway),
+		Directives:      row.Directives.Compact(),
+	}
+}
+
+func clientCCDRow(userID string, c *openvpn.ClientCCD) *model.ClientCCD {
+	return &model.ClientCCD{
+		UserID:          userID,
+		PushReset:       c.PushReset,
+		Routes:          model.StringList(c.Routes).Compact(),
+		DNSServers:      model.StringList(c.DNSServers).Compact(),
+		SearchDomains:   model.StringList(c.SearchDomains).Compact(),
+		RedirectGateway: strings.Join(strings.Fields(c.RedirectGateway), " "),
+		Directives:      model.StringList(c.Directives).Compact(),
+	}
+}
+
+// loadClientCCDRow 读取用户的推送设置，没有记录时返回空设置
+func loadClientCCDRow(db *gorm.DB, userID string) (*model.ClientCCD, bool, error) {
+	var row model.ClientCCD
+	err := db.First(&row, "user_id = ?", userID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &model.ClientCCD{UserID: userID}, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return &row, true, nil
+}
+
+// GetClientCCD 返回用户自己的 CCD 设置（不含从部门继承的部分）
+func GetClientCCD(db *gorm.DB, u *model.User) (*openvpn.ClientCCD, error) {
+	row, _, err := loadClientCCDRow(db, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	return clientCCDSpec(u, row), nil
+}
+
+// EffectiveClientCCD 返回实际生成到 CCD 文件的设置：用户没有设置的路由、DNS 与搜索域取所在部门的网络策略
+func EffectiveClientCCD(db *gorm.DB, u *model.User) (*openvpn.ClientCCD, *DepartmentNetworkPolicy, error) {
+	spec, err := GetClientCCD(db, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	policy, err := EffectiveNetworkPolicy(db, u.DepartmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(spec.Routes) == 0 {
+		spec.Routes = policy.Routes
+	}
+	if len(spec.DNSServers) == 0 {
+		spec.DNSServers = policy.DNSServers
+	}
+	if len(spec.SearchDomains) == 0 {
+		spec.SearchDomains = policy.SearchDomains
+	}
+	return spec, policy, nil
+}
+
+// ApplyClientCCD 按数据库（用户设置与部门策略）重新生成用户的 CCD 文件。u 的固定 IP、子网与部门可以是尚未保存的新值，
+// 校验失败时返回 ErrInvalidClientCCD，文件保持不变。
+func ApplyClientCCD(db *gorm.DB, u *model.User) error {
+	spec, err := checkClientCCD(db, u)
+	if err != nil {
+		return err
+	}
+	return openvpn.WriteClientCCD(u.Name, spec)
+}
+
+// checkClientCCD 生成用户生效的 CCD 设置并校验，固定 IP 须在部门的 IP 范围内
+func checkClientCCD(db *gorm.DB, u *model.User) (*openvpn.ClientCCD, error) {
+	spec, policy, err := EffectiveClientCCD(db, u)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Empty() {
+		return spec, nil
+	}
+	if spec.FixedIP != "" && !openvpn.IPInPool(spec.FixedIP, policy.IPPoolStart, policy.IPPoolEnd) {
+		return nil, fmt.Errorf("%w: fixed IP %s is outside the department IP pool %s-%s", ErrInvalidClientCCD, spec.FixedIP, policy.IPPoolStart, policy.IPPoolEnd)
+	}
+	cfg, err := openvpn.LoadConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+	}
+	if _, err := openvpn.RenderClientCCD(spec, cfg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidClientCCD, err)
+	}
+	return spec, nil
+}
+
+// SaveClientCCD 校验并保存用户自己的 CCD 设置（含固定 IP、固定 IPv6 与子网），随后重写 CCD 文件；
+// 文件写入失败时数据库修改一并回滚。固定地址变化时查重，IPv4 为 "auto" 时自动分配（见 ResolveFixedIP）。
+// 新设置在客户端下次连接时生效。
+func SaveClientCCD(db *gorm.DB, u *model.User, spec *openvpn.ClientCCD) error {
+	updated := *u
+	updated.FixedIP = strings.TrimSpace(spec.FixedIP)
+	updated.FixedIPv6 = strings.TrimSpace(spec.FixedIPv6)
+	updated.Subnet = strings.TrimSpace(spec.Subnet)
+	ipv4Changed := updated.FixedIP != "" && updated.FixedIP != u.FixedIP
+	ipv6Changed := updated.FixedIPv6 != "" && updated.FixedIPv6 != u.FixedIPv6
+	if ipv4Changed || ipv6Changed {
+		unlock := LockIPAM()
+		defer unlock()
+	}
+	if ipv4Changed {
+		ip, err := ResolveFixedIP(db, u, updated.FixedIP)
+		if err != nil {
+			return err
+		}
+		updated.FixedIP = ip
+	}
+	if ipv6Changed {
+		ip, err := ResolveFixedIPv6(db, u, updated.FixedIPv6)
+		if err != nil {
+			return err
+		}
+		updated.FixedIPv6 = ip
+	}
+	row := clientCCDRow(u.ID, spec)
+	// 先单独校验用户自己的设置，错误信息不会混入部门策略
+	if err := clientCCDSpec(&updated, row).Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidClientCCD, err)
+	}
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.User{}).Where("id = ?", u.ID).Updates(map[string]interface{}{"fixed_ip": updated.FixedIP, "fixed_ipv6": updated.FixedIPv6, "subnet": updated.Subnet}).Error; err != nil {
+			return FixedIPConflict(tx, err)
+		}
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(row).Error; err != nil {
+			return err
+		}
+		return ApplyClientCCD(tx, &updated)
+	})
+	if err == nil {
+		u.FixedIP, u.FixedIPv6, u.Subnet = updated.FixedIP, updated.FixedIPv6, updated.Subnet
+	}
+	return err
+}
+
+// SyncClientCCD 启动时以数据库为准重写用户的 CCD 文件。用户还没有推送设置记录时，
+// 先从现有文件导入手工添加的路由、DNS 等（旧版本只管理固定 IP 与子网），校验不通过的指令记录告警后丢弃。
+func SyncClientCCD(db *gorm.DB, u *model.User) error {
+	if _, found, err := loadClientCCDRow(db, u.ID); err != nil {
+		return err
+	} else if !found {
+		if err := adoptLegacyCCD(db, u); err != nil {
+			logging.Warn("Failed to import existing client config of %s: %v", u.Name, err)
+		}
+	}
+	return ApplyClientCCD(db, u)
+}
+
+func adoptLegacyCCD(db *gorm.DB, u *model.User) error {
+	legacy, err := openvpn.ReadClientCCD(u.Name)
+	if err != nil || legacy == nil {
+		return err
+	}
+	var kept []string
+	for _, d := range legacy.Directives {
+		if err := openvpn.ValidateCCDDirective(d); err != nil {
+			logging.Warn("Dropping directive %q from client config of %s: %v", d, u.Name, err)
+			continue
+		}
+		kept = append(kept, d)
+	}
+	legacy.Directives = kept
+	if legacy.FixedIPv6 != "" && legacy.FixedIPv6 != u.FixedIPv6 {
+		logging.Warn("Dropping ifconfig-ipv6-push %s from client config of %s: set it as the user's fixed IPv6 instead", legacy.FixedIPv6, u.Name)
+	}
+	legacy.FixedIP, legacy.FixedIPv6, legacy.Subnet = "", "", ""
+	if legacy.Empty() {
+		return nil
+	}
+	if err := legacy.Validate(); err != nil {
+		return err
+	}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(clientCCDRow(u.ID, legacy)).Error; err != nil {
+		return err
+	}
+	logging.Info("Imported existing client config options of %s", u.Name)
+	return nil
+}
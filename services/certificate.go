@@ -0,0 +1,249 @@
+package services
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/openvpn/pki"
+	"openvpn-admin-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// certExpiryCheckInterval 证书到期检查间隔
+const certExpiryCheckInterval = time.Hour
+
+// maxDepartmentDepth 沿上级部门查找有效期时的最大层数（防御 parent_id 成环）
+const maxDepartmentDepth = 32
+
+// CertValidity 用户客户端证书的有效期：所在部门（逐级向上取第一个非 0 的 cert_validity_days）
+// > 角色（CERT_VALIDITY_DAYS_<ROLE>）> 全局（CERT_VALIDITY_DAYS）> pki.DefaultClientValidity。
+func CertValidity(db *gorm.DB, user *model.User) time.Duration {
+	deptID := user.DepartmentID
+	for i := 0; deptID != "" && i < maxDepartmentDepth; i++ {
+		var dep model.Department
+		if err := db.Select("id", "parent_id", "cert_validity_days").First(&dep, "id = ?", deptID).Error; err != nil {
+			break
+		}
+		if dep.CertValidityDays > 0 {
+			return time.Duration(dep.CertValidityDays) * 24 * time.Hour
+		}
+		deptID = dep.ParentID
+	}
+	if days := utils.GetCertValidityDays(string(user.Role)); days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+	return pki.DefaultClientValidity
+}
+
+// ErrCSRRequired 用户所在部门要求 CSR 自助签发，服务器不能替用户生成私钥
+var ErrCSRRequired = errors.New("department requires CSR-based enrollment, the user must upload a CSR")
+
+// RequiresCSR 用户所在部门或任一上级部门开启了 csr_only
+func RequiresCSR(db *gorm.DB, user *model.User) bool {
+	deptID := user.DepartmentID
+	for i := 0; deptID != "" && i < maxDepartmentDepth; i++ {
+		var dep model.Department
+		if err := db.Select("id", "parent_id", "csr_only").First(&dep, "id = ?", deptID).Error; err != nil {
+			break
+		}
+		if dep.CSROnly {
+			return true
+		}
+		deptID = dep.ParentID
+	}
+	return false
+}
+
+// recordCertificate 登记一张新签发的证书；序列号已登记时忽略
+func recordCertificate(db *gorm.DB, user *model.User, cert *x509.Certificate, fromCSR bool) (*model.Certificate, error) {
+	row := model.Certificate{
+		FromCSR:   fromCSR,
+		UserID:    user.ID,
+		UserName:  user.Name,
+		Serial:    pki.SerialHex(cert.SerialNumber),
+		NotBefore: cert.NotBefore,
+		NotAfter:  cert.NotAfter,
+		Status:    model.CertificateValid,
+		CAID:      pki.AuthorityID(cert),
+	}
+	if cert.NotAfter.Before(time.Now()) {
+		row.Status = model.CertificateExpired
+	}
+	var existing model.Certificate
+	if err := db.Where("serial = ?", row.Serial).First(&existing).Error; err == nil {
+		return &existing, nil
+	}
+	if err := db.Create(&row).Error; err != nil {
+		return nil, err
+	}
+	return &row, nil
+}
+
+// IssueUserCertificate 按用户适用的有效期签发客户端证书、生成 .ovpn 并登记到 certificates 表。
+// 部门要求 CSR 自助签发时返回 ErrCSRRequired。
+func IssueUserCertificate(db *gorm.DB, user *model.User) error {
+	if RequiresCSR(db, user) {
+		return ErrCSRRequired
+	}
+	cert, err := openvpn.IssueClient(user.Name, CertValidity(db, user))
+	if err != nil {
+		return err
+	}
+	if _, err := recordCertificate(db, user, cert, false); err != nil {
+		return fmt.Errorf("登记证书失败: %v", err)
+	}
+	return nil
+}
+
+// RenewUserCertificate 续签：签发新证书并重新生成 .ovpn，吊销旧证书，更新 certificates 表。
+// 部门要求 CSR 自助签发时返回 ErrCSRRequired，用户需用新的 CSR 重新 EnrollUserCertificate。
+func RenewUserCertificate(db *gorm.DB, user *model.User) (*model.Certificate, error) {
+	if RequiresCSR(db, user) {
+		return nil, ErrCSRRequired
+	}
+	old, renewed, err := openvpn.RenewClient(user.Name, CertValidity(db, user))
+	return recordReplacement(db, user, old, renewed, err, false)
+}
+
+// EnrollUserCertificate 按用户上传的 CSR（PEM，CN 必须是用户名）签发证书并生成不含私钥的 .ovpn，
+// 吊销旧证书，更新 certificates 表
+func EnrollUserCertificate(db *gorm.DB, user *model.User, csrPEM []byte) (*model.Certificate, error) {
+	old, enrolled, err := openvpn.EnrollClient(user.Name, csrPEM, CertValidity(db, user))
+	return recordReplacement(db, user, old, enrolled, err, true)
+}
+
+// recordReplacement 登记换发的新证书 issued 并把旧证书 old 标为已吊销。issued 为 nil 时签发失败，
+// 原样返回 err；issued 不为 nil 而 err 不为 nil 时新证书已生效，只是旧证书吊销失败。
+func recordReplacement(db *gorm.DB, user *model.User, old, issued *x509.Certificate, err error, fromCSR bool) (*model.Certificate, error) {
+	if issued == nil {
+		return nil, err
+	}
+	if err != nil {
+		// 新证书已生效，只是旧证书吊销失败：照常登记，错误交给调用方提示
+		logging.Error("Failed to revoke superseded certificate of user '%s': %v", user.Name, err)
+	}
+	if old != nil && err == nil {
+		if err := markCertificatesRevoked(db.Where("serial = ?", pki.SerialHex(old.SerialNumber))); err != nil {
+			logging.Error("Failed to mark old certificate of user '%s' revoked: %v", user.Name, err)
+		}
+	}
+	row, recErr := recordCertificate(db, user, issued, fromCSR)
+	if recErr != nil {
+		return nil, fmt.Errorf("登记证书失败: %v", recErr)
+	}
+	return row, err
+}
+
+// RevokeUserCertificates 把用户名下所有仍有效的证书记录标为已吊销（删除用户时调用；
+// 证书本身由 openvpn.DeleteClient 吊销）
+func RevokeUserCertificates(db *gorm.DB, userName string) error {
+	return markCertificatesRevoked(db.Where("user_name = ?", userName))
+}
+
+func markCertificatesRevoked(scope *gorm.DB) error {
+	return scope.Model(&model.Certificate{}).
+		Where("status = ?", model.CertificateValid).
+		Updates(map[string]interface{}{"status": model.CertificateRevoked, "revoked_at": time.Now()}).Error
+}
+
+// markCertificateSeen 记录序列号为 serial 的证书在 at 建立了 VPN 连接（只往后更新）。
+// serial 为 OpenVPN 环境变量 tls_serial_0 的十进制形式。
+func markCertificateSeen(db *gorm.DB, serial string, at time.Time) {
+	n, ok := new(big.Int).SetString(serial, 10)
+	if !ok {
+		return
+	}
+	if err := db.Model(&model.Certificate{}).
+		Where("serial = ? AND (last_seen_at IS NULL OR last_seen_at < ?)", pki.SerialHex(n), at).
+		Update("last_seen_at", at).Error; err != nil {
+		logging.Error("Failed to update last seen time of certificate %s: %v", pki.SerialHex(n), err)
+	}
+}
+
+// SyncCertificateRecords 补登记磁盘上已有、但 certificates 表里没有的用户证书（升级前签发的证书）
+func SyncCertificateRecords(db *gorm.DB) {
+	var users []model.User
+	if err := db.Find(&users).Error; err != nil {
+		logging.Error("Failed to list users for certificate sync: %v", err)
+		return
+	}
+	for i := range users {
+		u := &users[i]
+		cert, err := openvpn.ClientCertificate(u.Name)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logging.Warn("Failed to read certificate of user '%s': %v", u.Name, err)
+			}
+			continue
+		}
+		if _, err := recordCertificate(db, u, cert, !openvpn.HasClientKey(u.Name)); err != nil {
+			logging.Error("Failed to record certificate of user '%s': %v", u.Name, err)
+		}
+	}
+}
+
+// CheckCertificateExpiry 把已过期的证书标为 expired，并对 warnBefore 内到期、尚未提醒过的证书发通知
+func CheckCertificateExpiry(db *gorm.DB, now time.Time, warnBefore time.Duration) {
+	if err := db.Model(&model.Certificate{}).
+		Where("status = ? AND not_after <= ?", model.CertificateValid, now).
+		Update("status", model.CertificateExpired).Error; err != nil {
+		logging.Error("Failed to mark expired certificates: %v", err)
+	}
+
+	var expiring []model.Certificate
+	if err := db.Where("status = ? AND not_after <= ? AND expiry_notified_at IS NULL", model.CertificateValid, now.Add(warnBefore)).
+		Find(&expiring).Error; err != nil {
+		logging.Error("Failed to list expiring certificates: %v", err)
+		return
+	}
+	for i := range expiring {
+		c := &expiring[i]
+		days := int(c.NotAfter.Sub(now).Hours() / 24)
+		n := model.Notification{
+			Type:     model.NotificationTypeCertExpiring,
+			UserName: c.UserName,
+			Detail:   fmt.Sprintf("certificate %s expires in %d days (%s)", c.Serial, days, c.NotAfter.Format(time.RFC3339)),
+		}
+		if err := db.Create(&n).Error; err != nil {
+			logging.Error("Failed to create notification for user '%s' (%s): %v", c.UserName, n.Type, err)
+			continue
+		}
+		if err := db.Model(c).Update("expiry_notified_at", now).Error; err != nil {
+			logging.Error("Failed to mark certificate %s as notified: %v", c.Serial, err)
+		}
+		logging.Warn("Certificate %s of user '%s' expires at %s", c.Serial, c.UserName, c.NotAfter.Format(time.RFC3339))
+	}
+}
+
+// StartCertExpiryService 启动时补登记已有证书，之后定期检查证书到期，支持 context 取消和 WaitGroup 优雅退出
+func StartCertExpiryService(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB, warnBefore time.Duration) {
+	logging.Info("Starting Certificate Expiry Service: warn %s before expiry, interval %s", warnBefore, certExpiryCheckInterval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		SyncCertificateRecords(db)
+		CheckCertificateExpiry(db, time.Now(), warnBefore)
+
+		ticker := time.NewTicker(certExpiryCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logging.Info("Certificate Expiry Service stopping...")
+				return
+			case <-ticker.C:
+				CheckCertificateExpiry(db, time.Now(), warnBefore)
+			}
+		}
+	}()
+}
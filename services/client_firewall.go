@@ -0,0 +1,127 @@
+package services
+
+import (
+	"net"
+	"slices"
+	"sort"
+	"sync"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// 读取 OpenVPN 配置、写入客户端互访防火墙规则；测试中替换
+var (
+	loadOpenVPNConfig        = openvpn.LoadConfig
+	applyClientToClientRules = openvpn.ApplyClientToClientRules
+)
+
+// clientFirewall 上次写入成功的放行名单：名单不变时不重复执行 iptables；失败原因不变时不重复记日志
+var clientFirewall struct {
+	sync.Mutex
+	applied map[bool][]string // 键为是否 IPv6
+	lastErr string
+}
+
+// clientToClientAllowList 生效策略允许互访的用户的地址：固定地址（离线也提前放行）、
+// 在线时的隧道地址与客户端子网（iroute）。部门链上都没有设置时取 serverDefault。
+func clientToClientAllowList(db *gorm.DB, serverDefault bool) (v4, v6 []string, err error) {
+	var users []model.User
+	if err := db.Select("id", "department_id", "fixed_ip", "fixed_ipv6", "subnet", "is_online", "virtual_address", "virtual_ipv6_address").
+		Where("fixed_ip <> '' OR fixed_ipv6 <> '' OR subnet <> '' OR is_online = ?", true).
+		Find(&users).Error; err != nil {
+		return nil, nil, err
+	}
+	allowed := map[string]bool{}
+	seen := map[string]bool{}
+	for _, u := range users {
+		allow, ok := allowed[u.DepartmentID]
+		if !ok {
+			policy, err := EffectiveNetworkPolicy(db, u.DepartmentID)
+			if err != nil {
+				return nil, nil, err
+			}
+			allow = serverDefault
+			if policy.ClientToClient != nil {
+				allow = *policy.ClientToClient
+			}
+			allowed[u.DepartmentID] = allow
+		}
+		if !allow {
+			continue
+		}
+		addrs := []string{u.FixedIP, u.FixedIPv6, u.Subnet}
+		if u.IsOnline {
+			addrs = append(addrs, u.VirtualAddress, u.VirtualIPv6Address)
+		}
+		for _, a := range addrs {
+			ip, _, err := net.ParseCIDR(a)
+			if err != nil {
+				ip = net.ParseIP(a)
+			}
+			if ip == nil || seen[a] {
+				continue
+			}
+			seen[a] = true
+			if ip.To4() != nil {
+				v4 = append(v4, a)
+			} else {
+				v6 = append(v6, a)
+			}
+		}
+	}
+	sort.Strings(v4)
+	sort.Strings(v6)
+	return v4, v6, nil
+}
+
+// SyncClientToClientFirewall 按部门的客户端互访策略重建防火墙放行名单（见 openvpn.ApplyClientToClientRules）。
+// 每个状态同步周期与部门策略变化后调用；名单没有变化时不执行 iptables。
+func SyncClientToClientFirewall(db *gorm.DB) error {
+	cfg, err := loadOpenVPNConfig()
+	if err != nil {
+		return err
+	}
+	v4, v6, err := clientToClientAllowList(db, cfg.OpenVPNClientToClient)
+	if err != nil {
+		return err
+	}
+	clientFirewall.Lock()
+	defer clientFirewall.Unlock()
+	if clientFirewall.applied == nil {
+		clientFirewall.applied = map[bool][]string{}
+	}
+	families := map[bool][]string{false: v4}
+	if cfg.OpenVPNServerIPv6 != "" {
+		families[true] = v6
+	}
+	for ipv6, addrs := range families {
+		if prev, ok := clientFirewall.applied[ipv6]; ok && slices.Equal(prev, addrs) {
+			continue
+		}
+		if err := applyClientToClientRules(addrs, ipv6); err != nil {
+			delete(clientFirewall.applied, ipv6)
+			return err
+		}
+		clientFirewall.applied[ipv6] = addrs
+	}
+	return nil
+}
+
+// syncClientFirewall 状态同步周期末尾调用：失败只记日志，同样的错误只记一次
+func syncClientFirewall(db *gorm.DB) {
+	err := SyncClientToClientFirewall(db)
+	clientFirewall.Lock()
+	defer clientFirewall.Unlock()
+	if err == nil {
+		clientFirewall.lastErr = ""
+		return
+	}
+	if err.Error() != clientFirewall.lastErr {
+		clientFirewall.lastErr = err.Error()
+		logging.Error("Failed to update client-to-client firewall rules: %v", err)
+	}
+}
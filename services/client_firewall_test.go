@@ -0,0 +1,111 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+type firewallCall struct {
+	addrs []string
+	ipv6  bool
+}
+
+// stubClientFirewall 替换配置读取与 iptables，返回记录下来的写入
+func stubClientFirewall(t *testing.T, cfg *openvpn.Config) *[]firewallCall {
+	t.Helper()
+	origLoad, origApply := loadOpenVPNConfig, applyClientToClientRules
+	calls := &[]firewallCall{}
+	loadOpenVPNConfig = func() (*openvpn.Config, error) { return cfg, nil }
+	applyClientToClientRules = func(addrs []string, ipv6 bool) error {
+		*calls = append(*calls, firewallCall{addrs, ipv6})
+		return nil
+	}
+	t.Cleanup(func() {
+		loadOpenVPNConfig, applyClientToClientRules = origLoad, origApply
+		clientFirewall.Lock()
+		clientFirewall.applied, clientFirewall.lastErr = nil, ""
+		clientFirewall.Unlock()
+	})
+	return calls
+}
+
+func createTestDept(t *testing.T, db *gorm.DB, d *model.Department) string {
+	t.Helper()
+	if err := db.Create(d).Error; err != nil {
+		t.Fatalf("create department %s: %v", d.Name, err)
+	}
+	return d.ID
+}
+
+func TestSyncClientToClientFirewall(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &openvpn.Config{OpenVPNClientToClient: false, OpenVPNServerIPv6: "fd00::/64"}
+	calls := stubClientFirewall(t, cfg)
+
+	allow, deny := true, false
+	eng := createTestDept(t, db, &model.Department{Name: "eng", ClientToClient: &allow})
+	engDB := createTestDept(t, db, &model.Department{Name: "eng-db", ParentID: eng})
+	sales := createTestDept(t, db, &model.Department{Name: "sales", ClientToClient: &deny})
+
+	// alice 离线但有固定地址：提前放行；bob 在线，隧道地址与子网都放行
+	createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", DepartmentID: engDB, FixedIP: "10.8.0.10"})
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", DepartmentID: eng, Subnet: "10.10.120.0/23",
+		IsOnline: true, VirtualAddress: "10.8.0.20", VirtualIPv6Address: "fd00::20"})
+	// carol 所在部门禁止互访；dave 没有部门，跟随服务端开关（关闭）
+	createTestUser(t, db, &model.User{Name: "carol", Email: "carol@example.com", DepartmentID: sales, IsOnline: true, VirtualAddress: "10.8.0.30"})
+	createTestUser(t, db, &model.User{Name: "dave", Email: "dave@example.com", IsOnline: true, VirtualAddress: "10.8.0.40"})
+
+	if err := SyncClientToClientFirewall(db); err != nil {
+		t.Fatal(err)
+	}
+	got := map[bool][]string{}
+	for _, c := range *calls {
+		got[c.ipv6] = c.addrs
+	}
+	want := map[bool][]string{
+		false: {"10.10.120.0/23", "10.8.0.10", "10.8.0.20"},
+		true:  {"fd00::20"},
+	}
+	if len(*calls) != 2 || !reflect.DeepEqual(got, want) {
+		t.Fatalf("applied %+v, want %v", *calls, want)
+	}
+
+	// 名单没有变化：不再执行 iptables
+	*calls = nil
+	if err := SyncClientToClientFirewall(db); err != nil || len(*calls) != 0 {
+		t.Errorf("unchanged sync: calls %+v, err %v", *calls, err)
+	}
+
+	// 服务端开关打开：没有部门设置的 dave 随之放行，sales 仍然禁止
+	cfg.OpenVPNClientToClient = true
+	if err := SyncClientToClientFirewall(db); err != nil {
+		t.Fatal(err)
+	}
+	if len(*calls) != 1 || (*calls)[0].ipv6 || !reflect.DeepEqual((*calls)[0].addrs, []string{"10.10.120.0/23", "10.8.0.10", "10.8.0.20", "10.8.0.40"}) {
+		t.Errorf("after enabling the server switch: %+v", *calls)
+	}
+}
+
+func TestSyncClientToClientFirewallRetriesAfterFailure(t *testing.T) {
+	db := newTestDB(t)
+	calls := stubClientFirewall(t, &openvpn.Config{OpenVPNClientToClient: true})
+	createTestUser(t, db, &model.User{Name: "erin", Email: "erin@example.com", IsOnline: true, VirtualAddress: "10.8.0.50"})
+
+	applyClientToClientRules = func([]string, bool) error { return errors.New("iptables-restore: not found") }
+	if err := SyncClientToClientFirewall(db); err == nil {
+		t.Fatal("failed apply not reported")
+	}
+	applyClientToClientRules = func(addrs []string, ipv6 bool) error {
+		*calls = append(*calls, firewallCall{addrs, ipv6})
+		return nil
+	}
+	if err := SyncClientToClientFirewall(db); err != nil || len(*calls) != 1 {
+		t.Errorf("retry after failure: calls %+v, err %v", *calls, err)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"errors"
+
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrDepartmentCycle 把部门移到自己或自己的下级部门之下
+	ErrDepartmentCycle = errors.New("a department cannot be moved under itself or one of its sub-departments")
+	// ErrParentDepartmentNotFound 上级部门不存在
+	ErrParentDepartmentNotFound = errors.New("parent department not found")
+)
+
+// DepartmentSubtree 部门及其全部下级部门的 ID（含自身）
+func DepartmentSubtree(db *gorm.DB, deptID string) ([]string, error) {
+	ids := []string{deptID}
+	seen := map[string]bool{deptID: true}
+	for i, frontier := 0, []string{deptID}; len(frontier) > 0 && i < maxDepartmentDepth; i++ {
+		var children []string
+		if err := db.Model(&model.Department{}).Where("parent_id IN ?", frontier).Pluck("id", &children).Error; err != nil {
+			return nil, err
+		}
+		frontier = frontier[:0]
+		for _, id := range children {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+				frontier = append(frontier, id)
+			}
+		}
+	}
+	return ids, nil
+}
+
+// DepartmentInSubtree deptID 是否为 rootID 本身或其下级部门（沿 parent_id 向上查找）
+func DepartmentInSubtree(db *gorm.DB, rootID, deptID string) bool {
+	if deptID == rootID {
+		return true
+	}
+	if rootID == "" {
+		return false
+	}
+	for i := 0; deptID != "" && i < maxDepartmentDepth; i++ {
+		var dep model.Department
+		if err := db.Select("id", "parent_id").First(&dep, "id = ?", deptID).Error; err != nil {
+			return false
+		}
+		if dep.ParentID == rootID {
+			return true
+		}
+		deptID = dep.ParentID
+	}
+	return false
+}
+
+// CheckDepartmentParent 校验把部门 id（新建时为空）挂到 parentID 之下不会成环，且上级部门存在
+func CheckDepartmentParent(db *gorm.DB, id, parentID string) error {
+	if parentID == "" {
+		return nil
+	}
+	if parentID == id {
+		return ErrDepartmentCycle
+	}
+	var n int64
+	if err := db.Model(&model.Department{}).Where("id = ?", parentID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrParentDepartmentNotFound
+	}
+	if id != "" && DepartmentInSubtree(db, id, parentID) {
+		return ErrDepartmentCycle
+	}
+	return nil
+}
+
+// BuildDepartmentTree 把部门平铺列表组装成树（Children 逐级嵌套），返回顶级部门。
+// 上级部门不存在的部门视为顶级；数据中已有的环在第一次重复出现处截断。
+func BuildDepartmentTree(deps []model.Department) []model.Department {
+	byID := make(map[string]bool, len(deps))
+	for _, d := range deps {
+		byID[d.ID] = true
+	}
+	children := make(map[string][]model.Department)
+	var roots []model.Department
+	for _, d := range deps {
+		d.Children = nil
+		d.Parent = nil
+		if d.ParentID == "" || !byID[d.ParentID] {
+			roots = append(roots, d)
+		} else {
+			children[d.ParentID] = append(children[d.ParentID], d)
+		}
+	}
+
+	placed := make(map[string]bool, len(deps))
+	var build func(d model.Department) model.Department
+	build = func(d model.Department) model.Department {
+		placed[d.ID] = true
+		for _, c := range children[d.ID] {
+			if !placed[c.ID] {
+				d.Children = append(d.Children, build(c))
+			}
+		}
+		return d
+	}
+	tree := make([]model.Department, 0, len(roots))
+	for _, r := range roots {
+		tree = append(tree, build(r))
+	}
+	// 只存在于环中的部门没有顶级祖先，作为顶级部门返回以免丢失
+	for _, d := range deps {
+		if !placed[d.ID] {
+			d.Children = nil
+			d.Parent = nil
+			tree = append(tree, build(d))
+		}
+	}
+	return tree
+}
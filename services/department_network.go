@@ -0,0 +1,113 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// ErrInvalidDepartmentNetwork 部门网络策略未通过校验
+var ErrInvalidDepartmentNetwork = errors.New("invalid department network policy")
+
+// DepartmentNetworkPolicy 部门（逐级向上继承后）生效的网络策略
+type DepartmentNetworkPolicy struct {
+	Routes        []string `json:"routes"`
+	DNSServers    []string `json:"dnsServers"`
+	SearchDomains []string `json:"searchDomains"`
+	IPPoolStart   string   `json:"ipPoolStart"`
+	IPPoolEnd     string   `json:"ipPoolEnd"`
+	// ClientToClient 部门链上都没有设置时为 nil，跟随服务端 client-to-client 开关
+	ClientToClient *bool `json:"clientToClient"`
+}
+
+// mergeNetworkPolicy 按部门链（从成员所在部门到顶级部门）合并网络策略：每一项取链上第一个设置了的部门
+func mergeNetworkPolicy(chain []model.Department) *DepartmentNetworkPolicy {
+	p := &DepartmentNetworkPolicy{}
+	for _, d := range chain {
+		if len(p.Routes) == 0 {
+			p.Routes = d.Routes.Compact()
+		}
+		if len(p.DNSServers) == 0 {
+			p.DNSServers = d.DNSServers.Compact()
+		}
+		if len(p.SearchDomains) == 0 {
+			p.SearchDomains = d.SearchDomains.Compact()
+		}
+		if p.IPPoolStart == "" && d.IPPoolStart != "" && d.IPPoolEnd != "" {
+			p.IPPoolStart, p.IPPoolEnd = d.IPPoolStart, d.IPPoolEnd
+		}
+		if p.ClientToClient == nil && d.ClientToClient != nil {
+			v := *d.ClientToClient
+			p.ClientToClient = &v
+		}
+	}
+	return p
+}
+
+// EffectiveNetworkPolicy 部门生效的网络策略（沿上级部门继承），deptID 为空时返回空策略
+func EffectiveNetworkPolicy(db *gorm.DB, deptID string) (*DepartmentNetworkPolicy, error) {
+	var chain []model.Department
+	seen := map[string]bool{}
+	for i := 0; deptID != "" && !seen[deptID] && i < maxDepartmentDepth; i++ {
+		seen[deptID] = true
+		var dep model.Department
+		err := db.Select("id", "parent_id", "routes", "dns_servers", "search_domains", "ip_pool_start", "ip_pool_end", "client_to_client").
+			First(&dep, "id = ?", deptID).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		chain = append(chain, dep)
+		deptID = dep.ParentID
+	}
+	return mergeNetworkPolicy(chain), nil
+}
+
+// ValidateDepartmentNetwork 校验部门自己设置的路由、DNS、搜索域与 IP 范围
+func ValidateDepartmentNetwork(d *model.Department) error {
+	lists := openvpn.ClientCCD{Routes: d.Routes.Compact(), DNSServers: d.DNSServers.Compact(), SearchDomains: d.SearchDomains.Compact()}
+	if err := lists.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDepartmentNetwork, err)
+	}
+	if d.IPPoolStart == "" && d.IPPoolEnd == "" {
+		return nil
+	}
+	cfg, err := openvpn.LoadConfig()
+	if err != nil {
+		return fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+	}
+	if err := openvpn.ValidateIPPool(cfg, d.IPPoolStart, d.IPPoolEnd); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidDepartmentNetwork, err)
+	}
+	return nil
+}
+
+// RefreshDepartmentCCDs 部门网络策略（或上级部门）变化后，重新生成该部门及全部下级部门成员的 CCD 文件。
+// 先全部校验再写入：有成员的固定 IP 不在新的 IP 范围内等情况时返回 ErrInvalidClientCCD，不修改任何文件。
+func RefreshDepartmentCCDs(db *gorm.DB, deptID string) error {
+	ids, err := DepartmentSubtree(db, deptID)
+	if err != nil {
+		return err
+	}
+	var users []model.User
+	if err := db.Where("department_id IN ?", ids).Find(&users).Error; err != nil {
+		return err
+	}
+	specs := make([]*openvpn.ClientCCD, len(users))
+	for i := range users {
+		if specs[i], err = checkClientCCD(db, &users[i]); err != nil {
+			return fmt.Errorf("member %s: %w", users[i].Name, err)
+		}
+	}
+	for i, u := range users {
+		if err := openvpn.WriteClientCCD(u.Name, specs[i]); err != nil {
+			return fmt.Errorf("member %s: %w", u.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+
+	"openvpn-admin-go/model"
+)
+
+func TestBuildDepartmentTree(t *testing.T) {
+	deps := []model.Department{
+		{ID: "eng", Name: "Engineering"},
+		{ID: "backend", Name: "Backend", ParentID: "eng"},
+		{ID: "db", Name: "Databases", ParentID: "backend"},
+		{ID: "frontend", Name: "Frontend", ParentID: "eng"},
+		{ID: "sales", Name: "Sales"},
+		// 上级部门已删除
+		{ID: "orphan", Name: "Orphan", ParentID: "gone"},
+		// 历史数据中的环
+		{ID: "a", Name: "A", ParentID: "b"},
+		{ID: "b", Name: "B", ParentID: "a"},
+	}
+
+	tree := BuildDepartmentTree(deps)
+
+	roots := make(map[string]model.Department)
+	for _, d := range tree {
+		roots[d.ID] = d
+	}
+	for _, id := range []string{"eng", "sales", "orphan"} {
+		if _, ok := roots[id]; !ok {
+			t.Errorf("%s should be a root, got %+v", id, tree)
+		}
+	}
+	eng := roots["eng"]
+	if len(eng.Children) != 2 || eng.Children[0].ID != "backend" || eng.Children[1].ID != "frontend" {
+		t.Fatalf("eng children = %+v", eng.Children)
+	}
+	if c := eng.Children[0].Children; len(c) != 1 || c[0].ID != "db" {
+		t.Errorf("backend children = %+v", c)
+	}
+
+	// 每个部门恰好出现一次
+	count := make(map[string]int)
+	var walk func([]model.Department)
+	walk = func(ds []model.Department) {
+		for _, d := range ds {
+			count[d.ID]++
+			walk(d.Children)
+		}
+	}
+	walk(tree)
+	for _, d := range deps {
+		if count[d.ID] != 1 {
+			t.Errorf("%s appears %d times", d.ID, count[d.ID])
+		}
+	}
+}
+
+func TestMergeNetworkPolicy(t *testing.T) {
+	allow, deny := true, false
+	chain := []model.Department{
+		{ID: "db", DNSServers: model.StringList{"10.20.0.53"}, ClientToClient: &deny},
+		{ID: "backend", Routes: model.StringList{"10.20.0.0/16", " "}, IPPoolStart: "10.8.1.10", IPPoolEnd: "10.8.1.200"},
+		{ID: "eng", Routes: model.StringList{"10.0.0.0/8"}, DNSServers: model.StringList{"10.0.0.53"}, SearchDomains: model.StringList{"eng.example"},
+			IPPoolStart: "10.8.0.10", IPPoolEnd: "10.8.3.250", ClientToClient: &allow},
+	}
+	p := mergeNetworkPolicy(chain)
+	if !reflect.DeepEqual(p.Routes, []string{"10.20.0.0/16"}) {
+		t.Errorf("routes = %v, want the nearest department's", p.Routes)
+	}
+	if !reflect.DeepEqual(p.DNSServers, []string{"10.20.0.53"}) || !reflect.DeepEqual(p.SearchDomains, []string{"eng.example"}) {
+		t.Errorf("dns = %v, search = %v", p.DNSServers, p.SearchDomains)
+	}
+	if p.IPPoolStart != "10.8.1.10" || p.IPPoolEnd != "10.8.1.200" {
+		t.Errorf("pool = %s-%s", p.IPPoolStart, p.IPPoolEnd)
+	}
+	if p.ClientToClient == nil || *p.ClientToClient {
+		t.Errorf("clientToClient = %v, want the sub-department's deny", p.ClientToClient)
+	}
+
+	if p := mergeNetworkPolicy(nil); p.Routes != nil || p.ClientToClient != nil || p.IPPoolStart != "" {
+		t.Errorf("empty chain policy = %+v", p)
+	}
+}
@@ -0,0 +1,403 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/directory"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// ErrDirectoryConflict 目录用户的用户名或邮箱已被本地账号占用（不会自动接管本地账号）
+var ErrDirectoryConflict = errors.New("directory user conflicts with an existing local account")
+
+// directoryChange 已存在的目录用户与目录中对应成员
+type directoryChange struct {
+	User   model.User
+	Member directory.Member
+	// Pause 目录账号已停用，暂停 VPN；Resume 目录账号已恢复，解除同步造成的暂停
+	Pause  bool
+	Resume bool
+}
+
+// directorySyncPlan 一轮同步要做的变更（只做比对，不访问数据库与 OpenVPN）
+type directorySyncPlan struct {
+	Create  []directory.Member
+	Changes []directoryChange
+	Removed []model.User
+	// Skipped 无法开通的目录成员及原因（用户名不合法、没有邮箱、与本地账号冲突）
+	Skipped map[string]string
+	// RemovalsSkipped 目录返回零个成员时不处理移除，避免目录异常时停掉全部用户
+	RemovalsSkipped bool
+}
+
+// directoryRole 映射中的角色，留空为 user
+func directoryRole(m directory.GroupMapping) model.Role {
+	if m.Role == "" {
+		return model.RoleUser
+	}
+	return model.Role(strings.ToLower(m.Role))
+}
+
+// planDirectorySync 比对目录成员 members 与本地全部用户 users。
+// 目录用户按 DN（不区分大小写）对应，DN 变化（改名、移动 OU）时再按用户名对应。
+func planDirectorySync(members []directory.Member, users []model.User) directorySyncPlan {
+	plan := directorySyncPlan{Skipped: make(map[string]string)}
+	byDN := make(map[string]*model.User)
+	byName := make(map[string]*model.User)
+	takenEmail := make(map[string]bool)
+	for i := range users {
+		u := &users[i]
+		byName[strings.ToLower(u.Name)] = u
+		takenEmail[strings.ToLower(u.Email)] = true
+		if u.AuthSource == model.AuthSourceLDAP && u.ExternalID != "" {
+			byDN[strings.ToLower(u.ExternalID)] = u
+		}
+	}
+
+	matched := make(map[string]bool)
+	for _, m := range members {
+		u := byDN[strings.ToLower(m.DN)]
+		if named := byName[strings.ToLower(m.Username)]; u == nil && named != nil && named.AuthSource == model.AuthSourceLDAP {
+			u = named
+		}
+		if u != nil {
+			if matched[u.ID] {
+				continue
+			}
+			matched[u.ID] = true
+			plan.Changes = append(plan.Changes, directoryChange{
+				User:   *u,
+				Member: m,
+				Pause:  m.Disabled && !u.IsPaused,
+				Resume: !m.Disabled && u.DirectoryPaused,
+			})
+			continue
+		}
+		if m.Disabled {
+			continue
+		}
+		switch {
+		case !openvpn.ValidUsername(m.Username):
+			plan.Skipped[m.DN] = fmt.Sprintf("username %q is not a valid certificate name", m.Username)
+		case m.Email == "":
+			plan.Skipped[m.DN] = "no email address"
+		case byName[strings.ToLower(m.Username)] != nil:
+			plan.Skipped[m.DN] = fmt.Sprintf("username %q is taken by a local account", m.Username)
+		case takenEmail[strings.ToLower(m.Email)]:
+			plan.Skipped[m.DN] = fmt.Sprintf("email %q is taken by a local account", m.Email)
+		default:
+			// 同一轮中后出现的同名 / 同邮箱成员视为冲突
+			byName[strings.ToLower(m.Username)] = &model.User{Name: m.Username}
+			takenEmail[strings.ToLower(m.Email)] = true
+			plan.Create = append(plan.Create, m)
+		}
+	}
+
+	for i := range users {
+		u := users[i]
+		if u.AuthSource != model.AuthSourceLDAP || matched[u.ID] {
+			continue
+		}
+		if len(members) == 0 {
+			plan.RemovalsSkipped = true
+			continue
+		}
+		plan.Removed = append(plan.Removed, u)
+	}
+	return plan
+}
+
+// ensureDepartment 按名称查找部门，不存在时创建
+func ensureDepartment(db *gorm.DB, name string) (string, error) {
+	var dep model.Department
+	if err := db.Where(model.Department{Name: name}).FirstOrCreate(&dep).Error; err != nil {
+		return "", fmt.Errorf("ensure department %q: %w", name, err)
+	}
+	return dep.ID, nil
+}
+
+// provisionDirectoryUser 开通目录用户：建账号（本地密码为不可用的随机值）并签发 VPN 证书。
+// 部门要求 CSR 自助签发时只建账号，由用户登录后上传 CSR。
+func provisionDirectoryUser(db *gorm.DB, m directory.Member) (*model.User, error) {
+	deptID, err := ensureDepartment(db, m.Mapping.Department)
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	hash, err := common.HashPassword(hex.EncodeToString(raw))
+	if err != nil {
+		return nil, err
+	}
+	user := model.User{
+		Name:           m.Username,
+		Email:          m.Email,
+		EmailVerified:  true, // 邮箱来自目录
+		PasswordHash:   hash,
+		Role:           directoryRole(m.Mapping),
+		ApprovalStatus: model.ApprovalApproved,
+		DepartmentID:   deptID,
+		AuthSource:     model.AuthSourceLDAP,
+		ExternalID:     m.DN,
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		if err := IssueUserCertificate(tx, &user); err != nil && !errors.Is(err, ErrCSRRequired) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("provision directory user %s: %w", m.Username, err)
+	}
+	if err := ApplyClientCCD(db, &user); err != nil {
+		logging.Warn("Failed to write client config of directory user '%s': %v", user.Name, err)
+	}
+	logging.Info("Directory user '%s' provisioned in department '%s' as %s", user.Name, m.Mapping.Department, user.Role)
+	return &user, nil
+}
+
+// applyDirectoryMember 按目录更新已有用户的角色、部门、邮箱与 DN，并处理停用 / 恢复
+func applyDirectoryMember(db *gorm.DB, ch directoryChange) error {
+	u, m := ch.User, ch.Member
+	deptID, err := ensureDepartment(db, m.Mapping.Department)
+	if err != nil {
+		return err
+	}
+	updates := map[string]interface{}{}
+	if role := directoryRole(m.Mapping); u.Role != role {
+		updates["role"] = role
+	}
+	if u.DepartmentID != deptID {
+		updates["department_id"] = deptID
+	}
+	if m.Email != "" && !strings.EqualFold(u.Email, m.Email) {
+		updates["email"] = m.Email
+	}
+	if u.ExternalID != m.DN {
+		updates["external_id"] = m.DN
+	}
+	if len(updates) > 0 {
+		if err := db.Model(&model.User{}).Where("id = ?", u.ID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("update directory user %s: %w", u.Name, err)
+		}
+		logging.Info("Directory user '%s' updated: %v", u.Name, updates)
+		_, roleChanged := updates["role"]
+		_, deptChanged := updates["department_id"]
+		if roleChanged || deptChanged {
+			RevokeUserSessions(db, u.ID, "", SessionRevokedRoleChanged)
+		}
+	}
+	if _, ok := updates["department_id"]; ok {
+		// 部门相关的 .ovpn 选项（如动态口令）与 CCD（部门网络策略）随部门变化
+		if err := openvpn.RegenerateClientConfig(u.Name); err != nil {
+			logging.Warn("Failed to regenerate profile of directory user '%s': %v", u.Name, err)
+		}
+		u.DepartmentID = deptID
+		if err := ApplyClientCCD(db, &u); err != nil {
+			logging.Warn("Failed to rewrite client config of directory user '%s': %v", u.Name, err)
+		}
+	}
+	switch {
+	case ch.Pause:
+		directoryPause(db, &u, "directory account disabled")
+	case ch.Resume:
+		directoryResume(db, &u)
+	}
+	return nil
+}
+
+// directoryPause 暂停目录用户的 VPN 访问并记录通知
+func directoryPause(db *gorm.DB, u *model.User, reason string) {
+	if err := openvpn.PauseClient(u.Name); err != nil {
+		logging.Error("Failed to pause directory user '%s': %v", u.Name, err)
+		return
+	}
+	if err := db.Model(u).Updates(map[string]interface{}{"is_paused": true, "quota_paused": false, "directory_paused": true}).Error; err != nil {
+		logging.Error("Failed to mark directory user '%s' paused: %v", u.Name, err)
+		return
+	}
+	logging.Warn("Directory user '%s' paused: %s", u.Name, reason)
+	createDirectoryNotification(db, model.NotificationTypeDirectoryPaused, u.Name, reason)
+}
+
+// directoryResume 解除同步造成的暂停
+func directoryResume(db *gorm.DB, u *model.User) {
+	if err := openvpn.ResumeClient(u.Name); err != nil {
+		logging.Error("Failed to resume directory user '%s': %v", u.Name, err)
+		return
+	}
+	if err := db.Model(u).Updates(map[string]interface{}{"is_paused": false, "directory_paused": false}).Error; err != nil {
+		logging.Error("Failed to clear directory pause of user '%s': %v", u.Name, err)
+		return
+	}
+	logging.Info("Directory user '%s' resumed", u.Name)
+}
+
+func createDirectoryNotification(db *gorm.DB, t model.NotificationType, userName, detail string) {
+	n := model.Notification{Type: t, UserName: userName, Detail: detail}
+	if err := db.Create(&n).Error; err != nil {
+		logging.Error("Failed to create notification for user '%s' (%s): %v", userName, t, err)
+	}
+}
+
+// DeleteUserAccount 删除用户：吊销证书、清理 OpenVPN 文件与 CCD，再删除登录会话、CCD 设置与用户记录。
+// OpenVPN 侧的清理 best-effort，失败只告警。
+func DeleteUserAccount(db *gorm.DB, u *model.User) error {
+	if err := openvpn.RemoveClientCCD(u.Name); err != nil {
+		logging.Warn("failed to remove client config for user %s during deletion: %v", u.Name, err)
+	}
+	if err := openvpn.DeleteClient(u.Name); err != nil {
+		logging.Warn("failed to delete OpenVPN client data for user %s during deletion: %v", u.Name, err)
+	}
+	if err := RevokeUserCertificates(db, u.Name); err != nil {
+		logging.Warn("failed to mark certificates of user %s revoked during deletion: %v", u.Name, err)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", u.ID).Delete(&model.LoginSession{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&model.APIToken{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&model.ClientCCD{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&model.User{}, "id = ?", u.ID).Error
+	})
+}
+
+// SyncDirectory 执行一轮目录同步：开通新成员，更新角色 / 部门，暂停停用账号，
+// 按 removed_action 暂停或吊销已移出映射组的用户。目录查询失败时本轮不做任何变更。
+func SyncDirectory(db *gorm.DB, cfg *directory.Config) error {
+	members, err := directory.NewClient(cfg).Members()
+	if err != nil {
+		return err
+	}
+	var users []model.User
+	if err := db.Find(&users).Error; err != nil {
+		return fmt.Errorf("list users: %w", err)
+	}
+	plan := planDirectorySync(members, users)
+
+	for dn, reason := range plan.Skipped {
+		logging.Warn("Directory member '%s' skipped: %s", dn, reason)
+	}
+	for _, m := range plan.Create {
+		if _, err := provisionDirectoryUser(db, m); err != nil {
+			logging.Error("%v", err)
+		}
+	}
+	for _, ch := range plan.Changes {
+		if err := applyDirectoryMember(db, ch); err != nil {
+			logging.Error("%v", err)
+		}
+	}
+	if plan.RemovalsSkipped {
+		logging.Warn("Directory returned no members; skipping removal of existing directory users")
+	}
+	for i := range plan.Removed {
+		u := &plan.Removed[i]
+		switch cfg.RemovedAction {
+		case directory.RemovedRevoke:
+			if err := DeleteUserAccount(db, u); err != nil {
+				logging.Error("Failed to delete removed directory user '%s': %v", u.Name, err)
+				continue
+			}
+			logging.Warn("Directory user '%s' removed from directory; account deleted", u.Name)
+			createDirectoryNotification(db, model.NotificationTypeDirectoryRemoved, u.Name, "removed from directory, certificate revoked")
+		default:
+			if !u.IsPaused {
+				directoryPause(db, u, "removed from directory")
+			}
+		}
+	}
+	logging.Info("Directory sync finished: %d members, %d created, %d removed", len(members), len(plan.Create), len(plan.Removed))
+	return nil
+}
+
+// AuthenticateDirectoryUser 用目录校验登录，并按目录当前的组成员关系开通或更新本地账号。
+// 目录未启用、密码错误或用户不在任何映射组时返回 directory.ErrInvalidCredentials。
+func AuthenticateDirectoryUser(db *gorm.DB, login, password string) (*model.User, error) {
+	cfg := directory.Current()
+	if cfg == nil {
+		return nil, directory.ErrInvalidCredentials
+	}
+	m, err := directory.NewClient(cfg).Authenticate(login, password)
+	if err != nil {
+		return nil, err
+	}
+	if m.Disabled {
+		return nil, directory.ErrInvalidCredentials
+	}
+	var users []model.User
+	if err := db.Where("auth_source = ? AND (LOWER(external_id) = LOWER(?) OR name = ?)", model.AuthSourceLDAP, m.DN, m.Username).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	plan := planDirectorySync([]directory.Member{*m}, users)
+	if len(plan.Changes) > 0 {
+		ch := plan.Changes[0]
+		if err := applyDirectoryMember(db, ch); err != nil {
+			return nil, err
+		}
+		var user model.User
+		if err := db.First(&user, "id = ?", ch.User.ID).Error; err != nil {
+			return nil, err
+		}
+		return &user, nil
+	}
+
+	// 首次登录：与本地账号（任何来源）冲突时不开通
+	var taken int64
+	if err := db.Model(&model.User{}).Where("name = ? OR LOWER(email) = LOWER(?)", m.Username, m.Email).Count(&taken).Error; err != nil {
+		return nil, err
+	}
+	if taken > 0 || !openvpn.ValidUsername(m.Username) || m.Email == "" {
+		return nil, ErrDirectoryConflict
+	}
+	return provisionDirectoryUser(db, *m)
+}
+
+// StartDirectorySyncService 启动时同步一次，之后按配置的周期同步，支持 context 取消和 WaitGroup 优雅退出
+func StartDirectorySyncService(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB, cfg *directory.Config) {
+	interval := cfg.SyncInterval()
+	logging.Info("Starting Directory Sync Service with interval %s", interval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		run := func() {
+			if err := SyncDirectory(db, cfg); err != nil {
+				logging.Error("Directory sync failed: %v", err)
+			}
+		}
+		run()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logging.Info("Directory Sync Service stopping...")
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
@@ -0,0 +1,74 @@
+package services
+
+import (
+	"testing"
+
+	"openvpn-admin-go/directory"
+	"openvpn-admin-go/model"
+)
+
+func TestPlanDirectorySync(t *testing.T) {
+	eng := directory.GroupMapping{GroupDN: "cn=eng", Department: "Engineering"}
+	member := func(dn, name string, disabled bool) directory.Member {
+		return directory.Member{
+			Entry:   directory.Entry{DN: dn, Username: name, Email: name + "@corp.example", Disabled: disabled},
+			Mapping: eng,
+		}
+	}
+	users := []model.User{
+		{ID: "1", Name: "alice", Email: "alice@corp.example", AuthSource: model.AuthSourceLDAP, ExternalID: "CN=alice,OU=people"},
+		{ID: "2", Name: "bob", Email: "bob@corp.example", AuthSource: model.AuthSourceLDAP, ExternalID: "cn=bob,ou=people", DirectoryPaused: true, IsPaused: true},
+		{ID: "3", Name: "carol", Email: "carol@corp.example", AuthSource: model.AuthSourceLDAP, ExternalID: "cn=carol,ou=people"},
+		{ID: "4", Name: "erin", Email: "erin@corp.example", AuthSource: model.AuthSourceLocal},
+		// 移动了 OU，按用户名对应
+		{ID: "5", Name: "frank", Email: "frank@corp.example", AuthSource: model.AuthSourceLDAP, ExternalID: "cn=frank,ou=old"},
+	}
+	members := []directory.Member{
+		member("cn=alice,ou=people", "alice", true),
+		member("cn=bob,ou=people", "bob", false),
+		member("cn=dave,ou=people", "dave", false),
+		member("cn=erin,ou=people", "erin", false),
+		member("cn=frank,ou=new", "frank", false),
+		member("cn=gina,ou=people", "bad/name", false),
+		member("cn=hank,ou=people", "hank", true),
+	}
+
+	plan := planDirectorySync(members, users)
+
+	if len(plan.Create) != 1 || plan.Create[0].Username != "dave" {
+		t.Errorf("Create = %+v, want only dave", plan.Create)
+	}
+	changes := make(map[string]directoryChange)
+	for _, ch := range plan.Changes {
+		changes[ch.User.Name] = ch
+	}
+	if len(changes) != 3 {
+		t.Fatalf("Changes = %+v", plan.Changes)
+	}
+	if !changes["alice"].Pause || changes["alice"].Resume {
+		t.Errorf("disabled alice should be paused: %+v", changes["alice"])
+	}
+	if !changes["bob"].Resume || changes["bob"].Pause {
+		t.Errorf("re-enabled bob should be resumed: %+v", changes["bob"])
+	}
+	if changes["frank"].Member.DN != "cn=frank,ou=new" {
+		t.Errorf("frank should match by username after the DN changed: %+v", changes["frank"])
+	}
+	if len(plan.Removed) != 1 || plan.Removed[0].Name != "carol" {
+		t.Errorf("Removed = %+v, want only carol", plan.Removed)
+	}
+	if _, ok := plan.Skipped["cn=erin,ou=people"]; !ok {
+		t.Error("a directory member must not take over a local account")
+	}
+	if _, ok := plan.Skipped["cn=gina,ou=people"]; !ok {
+		t.Error("invalid usernames must be skipped")
+	}
+}
+
+func TestPlanDirectorySyncEmptyDirectory(t *testing.T) {
+	users := []model.User{{ID: "1", Name: "alice", AuthSource: model.AuthSourceLDAP, ExternalID: "cn=alice"}}
+	plan := planDirectorySync(nil, users)
+	if len(plan.Removed) != 0 || !plan.RemovalsSkipped {
+		t.Fatalf("an empty directory must not remove every user: %+v", plan)
+	}
+}
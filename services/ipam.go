@@ -0,0 +1,372 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"openvpn-admin-go/constants"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// FixedIPAuto 请求固定 IP 时传入 "auto"，由 IPAM 在部门 IP 范围（没有则为服务端网段中动态地址池以外的部分）内分配下一个空闲地址
+const FixedIPAuto = "auto"
+
+var (
+	// ErrIPConflict 请求的固定 IP 已被其他客户端占用
+	ErrIPConflict = errors.New("IP address is already in use")
+	// ErrIPPoolExhausted IP 范围内没有空闲地址
+	ErrIPPoolExhausted = errors.New("no free IP address left in the pool")
+)
+
+// 地址占用的来源
+const (
+	IPSourceServer = "server" // 服务端自身的隧道地址
+	IPSourceFixed  = "fixed"  // 数据库中用户的固定 IP
+	IPSourceCCD    = "ccd"    // CCD 文件中的 ifconfig-push（不由本程序管理或与数据库不一致）
+	IPSourceLease  = "lease"  // ipp.txt 中的动态地址租约
+	IPSourceOnline = "online" // 在线客户端当前使用的地址
+)
+
+// IPAssignment 一个被占用的隧道地址
+type IPAssignment struct {
+	IP     string `json:"ip"`
+	Owner  string `json:"owner"`
+	UserID string `json:"userId,omitempty"`
+	Source string `json:"source"`
+}
+
+// readIPPLeases 读取 ipp.txt 中的动态地址租约；测试中替换
+var readIPPLeases = openvpn.ReadIPPLeases
+
+// ipamMu 串行化固定 IP 的分配与保存，避免并发请求拿到同一个地址（单实例内）。
+// 多实例之间由 users.fixed_ip / fixed_ipv6 的唯一索引兜底，见 FixedIPConflict
+var ipamMu sync.Mutex
+
+// LockIPAM 在检查 / 分配固定 IP 到写入数据库期间持有，返回解锁函数
+func LockIPAM() func() {
+	ipamMu.Lock()
+	return ipamMu.Unlock
+}
+
+// FixedIPConflict 写入用户时违反固定地址唯一索引（另一个实例同时分配了同一地址）则返回 ErrIPConflict，
+// 其他错误原样返回
+func FixedIPConflict(db *gorm.DB, err error) error {
+	if err == nil {
+		return nil
+	}
+	t, ok := db.Dialector.(gorm.ErrorTranslator)
+	if ok && errors.Is(t.Translate(err), gorm.ErrDuplicatedKey) && strings.Contains(err.Error(), "fixed_ip") {
+		return fmt.Errorf("%w: %v", ErrIPConflict, err)
+	}
+	return err
+}
+
+// collectIPAssignments 汇总服务端地址、固定 IP、CCD 文件、ipp.txt 租约与在线客户端占用的地址（IPv4 与 IPv6）
+func collectIPAssignments(db *gorm.DB, cfg *openvpn.Config) ([]IPAssignment, error) {
+	server, _, _, err := openvpn.ServerAddressRange(cfg)
+	if err != nil {
+		return nil, err
+	}
+	out := []IPAssignment{{IP: server, Owner: "server", Source: IPSourceServer}}
+	if _, server6, err := openvpn.ServerIPv6Network(cfg); err == nil {
+		out = append(out, IPAssignment{IP: server6.String(), Owner: "server", Source: IPSourceServer})
+	}
+	seen := map[string]bool{}
+	add := func(a IPAssignment) {
+		if key := a.IP + "|" + a.Owner; !seen[key] {
+			seen[key] = true
+			out = append(out, a)
+		}
+	}
+
+	var users []model.User
+	if err := db.Select("id", "name", "fixed_ip", "fixed_ipv6", "is_online", "virtual_address", "virtual_ipv6_address").
+		Where("fixed_ip <> '' OR fixed_ipv6 <> '' OR (is_online = ? AND (virtual_address <> '' OR virtual_ipv6_address <> ''))", true).
+		Find(&users).Error; err != nil {
+		return nil, err
+	}
+	ids := map[string]string{}
+	for _, u := range users {
+		ids[u.Name] = u.ID
+		for _, ip := range []string{u.FixedIP, u.FixedIPv6} {
+			if ip != "" {
+				add(IPAssignment{IP: ip, Owner: u.Name, UserID: u.ID, Source: IPSourceFixed})
+			}
+		}
+	}
+	ccd, err := openvpn.ReadCCDAssignments(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("read CCD files: %w", err)
+	}
+	for cn, ips := range ccd {
+		for _, ip := range ips {
+			add(IPAssignment{IP: ip, Owner: cn, UserID: ids[cn], Source: IPSourceCCD})
+		}
+	}
+	leases, err := readIPPLeases(constants.ServerIPPPath)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", constants.ServerIPPPath, err)
+	}
+	for cn, ips := range leases {
+		for _, ip := range ips {
+			add(IPAssignment{IP: ip, Owner: cn, UserID: ids[cn], Source: IPSourceLease})
+		}
+	}
+	for _, u := range users {
+		if !u.IsOnline {
+			continue
+		}
+		for _, ip := range []string{u.VirtualAddress, u.VirtualIPv6Address} {
+			if ip != "" {
+				add(IPAssignment{IP: ip, Owner: u.Name, UserID: u.ID, Source: IPSourceOnline})
+			}
+		}
+	}
+	sortIPAssignments(out)
+	return out, nil
+}
+
+func sortIPAssignments(a []IPAssignment) {
+	sort.SliceStable(a, func(i, j int) bool {
+		if c := openvpn.CompareIPs(a[i].IP, a[j].IP); c != 0 {
+			return c < 0
+		}
+		return a[i].Owner < a[j].Owner
+	})
+}
+
+// ipTakenBy ip 被 owner 以外的客户端（或服务端）占用时返回占用记录
+func ipTakenBy(assignments []IPAssignment, ip, owner string) *IPAssignment {
+	for i, a := range assignments {
+		if a.IP == ip && (a.Owner != owner || a.Source == IPSourceServer) {
+			return &assignments[i]
+		}
+	}
+	return nil
+}
+
+// ResolveFixedIP 检查或分配用户 u 的固定 IP（调用方需持有 LockIPAM）。
+// requested 为具体地址时，在 OpenVPN 动态地址池内（u 原有的地址除外）返回 ErrInvalidClientCCD，被其他客户端占用则返回 ErrIPConflict；
+// 为 "auto" 时沿用 u 当前仍可用的固定 IP，否则在所在部门的 IP 范围内（没有则在动态地址池以外、不属于任何部门 IP 范围的地址中
+// 从末尾起）分配空闲地址，没有空闲地址时返回 ErrIPPoolExhausted。动态地址池里的地址一律不分配。
+func ResolveFixedIP(db *gorm.DB, u *model.User, requested string) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		return "", nil
+	}
+	cfg, err := loadOpenVPNConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+	}
+	dynamicStart, dynamicEnd, err := openvpn.DynamicPoolRange(cfg)
+	if err != nil {
+		return "", err
+	}
+	inDynamicPool := func(ip string) bool { return openvpn.IPInPool(ip, dynamicStart, dynamicEnd) }
+	assignments, err := collectIPAssignments(db, cfg)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(requested, FixedIPAuto) {
+		if requested != u.FixedIP && inDynamicPool(requested) {
+			return "", fmt.Errorf("%w: fixed IP %s is inside the dynamic address pool %s-%s", ErrInvalidClientCCD, requested, dynamicStart, dynamicEnd)
+		}
+		return requested, ipConflict(assignments, requested, u.Name)
+	}
+
+	policy, err := EffectiveNetworkPolicy(db, u.DepartmentID)
+	if err != nil {
+		return "", err
+	}
+	start, end, fromEnd := policy.IPPoolStart, policy.IPPoolEnd, false
+	// 没有部门范围时避开所有部门的 IP 范围，从末尾往前分配，尽量把开头留给以后新建的部门范围
+	var deptPools []model.Department
+	if start == "" {
+		if start, end, err = openvpn.StaticAddressRange(cfg); err != nil {
+			return "", err
+		}
+		fromEnd = true
+		if err := db.Select("ip_pool_start", "ip_pool_end").Where("ip_pool_start <> ''").Find(&deptPools).Error; err != nil {
+			return "", err
+		}
+	}
+	// 旧版本保存的部门范围可能与动态地址池重叠，重叠部分同样跳过
+	usable := func(ip string) bool {
+		if !openvpn.IPInPool(ip, start, end) || inDynamicPool(ip) {
+			return false
+		}
+		for _, d := range deptPools {
+			if openvpn.IPInPool(ip, d.IPPoolStart, d.IPPoolEnd) {
+				return false
+			}
+		}
+		return true
+	}
+	if u.FixedIP != "" && usable(u.FixedIP) && ipTakenBy(assignments, u.FixedIP, u.Name) == nil {
+		return u.FixedIP, nil
+	}
+	used := map[string]bool{}
+	for _, a := range assignments {
+		if a.Owner != u.Name || a.Source == IPSourceServer {
+			used[a.IP] = true
+		}
+	}
+	ip, ok := openvpn.NextFreeIPFunc(start, end, func(ip string) bool { return used[ip] || !usable(ip) }, fromEnd)
+	if !ok {
+		return "", fmt.Errorf("%w: %s-%s", ErrIPPoolExhausted, start, end)
+	}
+	return ip, nil
+}
+
+// ResolveFixedIPv6 检查用户 u 的固定 IPv6 地址没有被其他客户端占用（调用方需持有 LockIPAM），返回规范写法的地址。
+// IPv6 前缀的地址空间足够大，不提供自动分配。
+func ResolveFixedIPv6(db *gorm.DB, u *model.User, requested string) (string, error) {
+	requested = strings.TrimSpace(requested)
+	if requested == "" {
+		return "", nil
+	}
+	ip := net.ParseIP(requested)
+	if ip == nil || ip.To4() != nil {
+		return "", fmt.Errorf("%w: invalid fixed IPv6 address %s", ErrInvalidClientCCD, requested)
+	}
+	cfg, err := loadOpenVPNConfig()
+	if err != nil {
+		return "", fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+	}
+	assignments, err := collectIPAssignments(db, cfg)
+	if err != nil {
+		return "", err
+	}
+	return ip.String(), ipConflict(assignments, ip.String(), u.Name)
+}
+
+// ipConflict ip 被其他客户端占用时返回 ErrIPConflict
+func ipConflict(assignments []IPAssignment, ip, owner string) error {
+	if a := ipTakenBy(assignments, ip, owner); a != nil {
+		return fmt.Errorf("%w: %s is taken by %s (%s)", ErrIPConflict, ip, a.Owner, a.Source)
+	}
+	return nil
+}
+
+// IPAMPool 一个地址范围的使用情况
+type IPAMPool struct {
+	DepartmentID   string  `json:"departmentId,omitempty"`
+	DepartmentName string  `json:"departmentName,omitempty"`
+	Start          string  `json:"start"`
+	End            string  `json:"end"`
+	Total          int     `json:"total"`
+	Used           int     `json:"used"`
+	Free           int     `json:"free"`
+	Utilization    float64 `json:"utilization"` // 百分比
+}
+
+// IPConflict 被多个客户端占用的地址
+type IPConflict struct {
+	IP     string   `json:"ip"`
+	Owners []string `json:"owners"`
+}
+
+// IPAMView 隧道地址使用情况
+type IPAMView struct {
+	Network       string         `json:"network"`
+	NetworkIPv6   string         `json:"networkIpv6,omitempty"`
+	ServerAddress string         `json:"serverAddress"`
+	Pool          IPAMPool       `json:"pool"`
+	DynamicPool   IPAMPool       `json:"dynamicPool"` // OpenVPN 动态分配的地址（ifconfig-pool）
+	Departments   []IPAMPool     `json:"departments"`
+	Assignments   []IPAssignment `json:"assignments"`
+	Conflicts     []IPConflict   `json:"conflicts"`
+}
+
+// GetIPAMView 服务端网段与各部门 IP 范围的使用率、全部占用记录以及冲突的地址
+func GetIPAMView(db *gorm.DB) (*IPAMView, error) {
+	cfg, err := loadOpenVPNConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load OpenVPN configuration: %w", err)
+	}
+	server, first, last, err := openvpn.ServerAddressRange(cfg)
+	if err != nil {
+		return nil, err
+	}
+	assignments, err := collectIPAssignments(db, cfg)
+	if err != nil {
+		return nil, err
+	}
+	var deps []model.Department
+	if err := db.Select("id", "name", "ip_pool_start", "ip_pool_end").Where("ip_pool_start <> ''").Order("name").Find(&deps).Error; err != nil {
+		return nil, err
+	}
+	dynamicStart, dynamicEnd, err := openvpn.DynamicPoolRange(cfg)
+	if err != nil {
+		return nil, err
+	}
+	view := buildIPAMView(server, first, last, assignments, deps)
+	view.DynamicPool = ipamPool(dynamicStart, dynamicEnd, assignments)
+	view.Network = cfg.OpenVPNServerNetwork + "/" + cfg.OpenVPNServerNetmask
+	view.NetworkIPv6 = cfg.OpenVPNServerIPv6
+	return view, nil
+}
+
+// buildIPAMView 按占用记录统计各地址范围的使用情况并找出冲突
+func buildIPAMView(server, first, last string, assignments []IPAssignment, deps []model.Department) *IPAMView {
+	view := &IPAMView{
+		ServerAddress: server,
+		Pool:          ipamPool(first, last, assignments),
+		Departments:   []IPAMPool{},
+		Assignments:   assignments,
+		Conflicts:     []IPConflict{},
+	}
+	for _, d := range deps {
+		p := ipamPool(d.IPPoolStart, d.IPPoolEnd, assignments)
+		p.DepartmentID, p.DepartmentName = d.ID, d.Name
+		view.Departments = append(view.Departments, p)
+	}
+
+	owners := map[string][]string{}
+	var order []string
+	for _, a := range assignments {
+		list := owners[a.IP]
+		if len(list) == 0 {
+			order = append(order, a.IP)
+		}
+		dup := false
+		for _, o := range list {
+			dup = dup || o == a.Owner
+		}
+		if !dup {
+			owners[a.IP] = append(list, a.Owner)
+		}
+	}
+	for _, ip := range order {
+		if len(owners[ip]) > 1 {
+			view.Conflicts = append(view.Conflicts, IPConflict{IP: ip, Owners: owners[ip]})
+		}
+	}
+	return view
+}
+
+func ipamPool(start, end string, assignments []IPAssignment) IPAMPool {
+	p := IPAMPool{Start: start, End: end, Total: openvpn.PoolSize(start, end)}
+	used := map[string]bool{}
+	for _, a := range assignments {
+		if a.Source != IPSourceServer && openvpn.IPInPool(a.IP, start, end) {
+			used[a.IP] = true
+		}
+	}
+	p.Used = len(used)
+	p.Free = p.Total - p.Used
+	if p.Free < 0 {
+		p.Free = 0
+	}
+	if p.Total > 0 {
+		p.Utilization = float64(p.Used) * 100 / float64(p.Total)
+	}
+	return p
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+)
+
+func TestBuildIPAMView(t *testing.T) {
+	assignments := []IPAssignment{
+		{IP: "10.8.0.1", Owner: "server", Source: IPSourceServer},
+		{IP: "10.8.0.10", Owner: "alice", Source: IPSourceFixed},
+		{IP: "10.8.0.10", Owner: "alice", Source: IPSourceOnline},
+		{IP: "10.8.0.11", Owner: "bob", Source: IPSourceFixed},
+		{IP: "10.8.0.11", Owner: "carol", Source: IPSourceLease},
+		{IP: "10.8.0.200", Owner: "dave", Source: IPSourceLease},
+		{IP: "fd00:8::10", Owner: "alice", Source: IPSourceFixed},
+		{IP: "fd00:8::10", Owner: "erin", Source: IPSourceCCD},
+	}
+	deps := []model.Department{{ID: "d1", Name: "Engineering", IPPoolStart: "10.8.0.10", IPPoolEnd: "10.8.0.19"}}
+	view := buildIPAMView("10.8.0.1", "10.8.0.2", "10.8.0.254", assignments, deps)
+
+	if p := view.Pool; p.Total != 253 || p.Used != 3 || p.Free != 250 {
+		t.Errorf("server pool = %+v", p)
+	}
+	if len(view.Departments) != 1 {
+		t.Fatalf("departments = %+v", view.Departments)
+	}
+	if p := view.Departments[0]; p.DepartmentName != "Engineering" || p.Total != 10 || p.Used != 2 || p.Utilization != 20 {
+		t.Errorf("department pool = %+v", p)
+	}
+	if len(view.Conflicts) != 2 || view.Conflicts[0].IP != "10.8.0.11" || len(view.Conflicts[0].Owners) != 2 || view.Conflicts[1].IP != "fd00:8::10" {
+		t.Errorf("conflicts = %+v, want 10.8.0.11 (bob, carol) and fd00:8::10 (alice, erin)", view.Conflicts)
+	}
+}
+
+func TestIPTakenBy(t *testing.T) {
+	assignments := []IPAssignment{
+		{IP: "10.8.0.1", Owner: "server", Source: IPSourceServer},
+		{IP: "10.8.0.10", Owner: "alice", Source: IPSourceLease},
+	}
+	if a := ipTakenBy(assignments, "10.8.0.10", "alice"); a != nil {
+		t.Errorf("own lease reported as conflict: %+v", a)
+	}
+	if a := ipTakenBy(assignments, "10.8.0.10", "bob"); a == nil || a.Owner != "alice" {
+		t.Errorf("ipTakenBy(bob) = %+v, want alice", a)
+	}
+	if a := ipTakenBy(assignments, "10.8.0.1", "server"); a == nil {
+		t.Error("server address not reported as taken")
+	}
+}
+
+func TestFixedIPConflict(t *testing.T) {
+	db := newTestDB(t)
+	createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", FixedIP: "10.8.0.10", FixedIPv6: "fd00:8::10"})
+	// 未设置固定地址的用户不受唯一索引约束
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com"})
+	createTestUser(t, db, &model.User{Name: "carol", Email: "carol@example.com"})
+
+	for _, u := range []model.User{
+		{Name: "dave", Email: "dave@example.com", FixedIP: "10.8.0.10"},
+		{Name: "erin", Email: "erin@example.com", FixedIPv6: "fd00:8::10"},
+	} {
+		err := FixedIPConflict(db, db.Create(&u).Error)
+		if !errors.Is(err, ErrIPConflict) {
+			t.Errorf("%s: err = %v, want ErrIPConflict", u.Name, err)
+		}
+	}
+	err := db.Model(&model.User{}).Where("name = ?", "bob").Update("fixed_ip", "10.8.0.10").Error
+	if !errors.Is(FixedIPConflict(db, err), ErrIPConflict) {
+		t.Errorf("update: err = %v, want ErrIPConflict", err)
+	}
+
+	// 其他唯一索引冲突原样返回
+	err = FixedIPConflict(db, db.Create(&model.User{Name: "alice", Email: "alice2@example.com"}).Error)
+	if err == nil || errors.Is(err, ErrIPConflict) {
+		t.Errorf("duplicate name: err = %v, want a non-IP error", err)
+	}
+}
+
+// stubIPAM 替换配置读取与 ipp.txt：/24 网段，动态地址池 10.8.0.2-10.8.0.128，没有 CCD 文件
+func stubIPAM(t *testing.T, leases map[string][]string) {
+	t.Helper()
+	origLoad, origLeases := loadOpenVPNConfig, readIPPLeases
+	cfg := &openvpn.Config{OpenVPNServerNetwork: "10.8.0.0", OpenVPNServerNetmask: "255.255.255.0", OpenVPNClientConfigDir: t.TempDir()}
+	loadOpenVPNConfig = func() (*openvpn.Config, error) { return cfg, nil }
+	readIPPLeases = func(string) (map[string][]string, error) { return leases, nil }
+	t.Cleanup(func() { loadOpenVPNConfig, readIPPLeases = origLoad, origLeases })
+}
+
+func TestResolveFixedIPAuto(t *testing.T) {
+	db := newTestDB(t)
+	stubIPAM(t, map[string][]string{"dave": {"10.8.0.254"}})
+	eng := createTestDept(t, db, &model.Department{Name: "Engineering", IPPoolStart: "10.8.0.250", IPPoolEnd: "10.8.0.252"})
+	// 旧版本保存的部门范围，与动态地址池重叠
+	legacy := createTestDept(t, db, &model.Department{Name: "Legacy", IPPoolStart: "10.8.0.120", IPPoolEnd: "10.8.0.135"})
+	createTestUser(t, db, &model.User{Name: "carol", Email: "carol@example.com", DepartmentID: eng, FixedIP: "10.8.0.251"})
+
+	resolve := func(u *model.User, requested string) string {
+		t.Helper()
+		ip, err := ResolveFixedIP(db, u, requested)
+		if err != nil {
+			t.Fatalf("ResolveFixedIP(%s, %q): %v", u.Name, requested, err)
+		}
+		if err := db.Model(u).Update("fixed_ip", ip).Error; err != nil {
+			t.Fatal(err)
+		}
+		return ip
+	}
+
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", DepartmentID: eng})
+	if ip := resolve(alice, "auto"); ip != "10.8.0.250" {
+		t.Errorf("alice = %s, want 10.8.0.250 (first free in department pool)", ip)
+	}
+	if ip := resolve(alice, "AUTO"); ip != "10.8.0.250" {
+		t.Errorf("alice again = %s, want her current address kept", ip)
+	}
+	bob := createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", DepartmentID: eng})
+	if ip := resolve(bob, "auto"); ip != "10.8.0.252" {
+		t.Errorf("bob = %s, want 10.8.0.252 (10.8.0.251 is carol's)", ip)
+	}
+	erin := createTestUser(t, db, &model.User{Name: "erin", Email: "erin@example.com", DepartmentID: eng})
+	if _, err := ResolveFixedIP(db, erin, "auto"); !errors.Is(err, ErrIPPoolExhausted) {
+		t.Errorf("full department pool: err = %v, want ErrIPPoolExhausted", err)
+	}
+
+	// 没有部门范围：从网段末尾起，跳过租约与所有部门范围
+	frank := createTestUser(t, db, &model.User{Name: "frank", Email: "frank@example.com"})
+	if ip := resolve(frank, "auto"); ip != "10.8.0.253" {
+		t.Errorf("frank = %s, want 10.8.0.253 (10.8.0.254 is leased)", ip)
+	}
+	grace := createTestUser(t, db, &model.User{Name: "grace", Email: "grace@example.com"})
+	if ip := resolve(grace, "auto"); ip != "10.8.0.249" {
+		t.Errorf("grace = %s, want 10.8.0.249 (below the Engineering pool)", ip)
+	}
+
+	// 部门范围与动态地址池重叠的部分不分配；原有地址落在动态地址池里也不沿用
+	heidi := createTestUser(t, db, &model.User{Name: "heidi", Email: "heidi@example.com", DepartmentID: legacy, FixedIP: "10.8.0.120"})
+	if ip := resolve(heidi, "auto"); ip != "10.8.0.129" {
+		t.Errorf("heidi = %s, want 10.8.0.129 (first address after the dynamic pool)", ip)
+	}
+}
+
+func TestResolveFixedIPDynamicPool(t *testing.T) {
+	db := newTestDB(t)
+	stubIPAM(t, nil)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", FixedIP: "10.8.0.50"})
+	bob := createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com"})
+
+	if _, err := ResolveFixedIP(db, bob, "10.8.0.60"); !errors.Is(err, ErrInvalidClientCCD) {
+		t.Errorf("address in dynamic pool: err = %v, want ErrInvalidClientCCD", err)
+	}
+	// 升级前设置的地址可以继续保存
+	if ip, err := ResolveFixedIP(db, alice, "10.8.0.50"); err != nil || ip != "10.8.0.50" {
+		t.Errorf("existing address = %q (%v), want it kept", ip, err)
+	}
+	if ip, err := ResolveFixedIP(db, bob, "10.8.0.200"); err != nil || ip != "10.8.0.200" {
+		t.Errorf("reserved address = %q (%v)", ip, err)
+	}
+	if _, err := ResolveFixedIP(db, bob, "10.8.0.1"); err == nil {
+		t.Error("server address accepted")
+	}
+}
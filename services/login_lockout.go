@@ -0,0 +1,183 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// ErrAccountLocked 连续登录失败次数过多，账号暂时锁定
+var ErrAccountLocked = errors.New("account temporarily locked after too many failed logins")
+
+// failureResetAfter 距上次失败超过这么久，连续失败次数重新计数
+const failureResetAfter = 24 * time.Hour
+
+// lockoutDuration 第 failures 次连续失败后的锁定时长：未达阈值为 0，达到阈值为 base，
+// 之后每多失败一次翻倍，不超过 max。threshold 为 0 表示不锁定。
+func lockoutDuration(failures, threshold int, base, max time.Duration) time.Duration {
+	if threshold <= 0 || failures < threshold {
+		return 0
+	}
+	d := base
+	for i := threshold; i < failures && d < max; i++ {
+		d *= 2
+	}
+	if d > max {
+		d = max
+	}
+	return d
+}
+
+// AccountLockedUntil 账号仍在锁定中时返回解锁时间
+func AccountLockedUntil(user *model.User, now time.Time) (time.Time, bool) {
+	if user.LockedUntil != nil && now.Before(*user.LockedUntil) {
+		return *user.LockedUntil, true
+	}
+	return time.Time{}, false
+}
+
+// RecordLoginFailure 记录一次登录失败（密码或两步验证码错误）。达到阈值时锁定账号，
+// 写安全日志并发送通知。返回本次设置的解锁时间，未锁定时为 nil。
+func RecordLoginFailure(db *gorm.DB, user *model.User, ip string) (*time.Time, error) {
+	now := time.Now()
+	var failures int
+	err := db.Raw(`UPDATE users SET
+			failed_login_count = CASE WHEN last_failed_login_at IS NULL OR last_failed_login_at < ? THEN 1 ELSE failed_login_count + 1 END,
+			last_failed_login_at = ?
+		WHERE id = ? RETURNING failed_login_count`,
+		now.Add(-failureResetAfter), now, user.ID).Scan(&failures).Error
+	if err != nil {
+		return nil, fmt.Errorf("record failed login: %w", err)
+	}
+	base, max := utils.GetLoginLockoutDurations()
+	d := lockoutDuration(failures, utils.GetLoginLockoutThreshold(), base, max)
+	if d == 0 {
+		return nil, nil
+	}
+	until := now.Add(d)
+	if err := db.Model(&model.User{}).Where("id = ?", user.ID).Update("locked_until", until).Error; err != nil {
+		return nil, fmt.Errorf("lock account: %w", err)
+	}
+	detail := fmt.Sprintf("%d consecutive failed logins, locked for %s", failures, d)
+	logging.LogSecurityEvent("account_locked", user.Name, ip, detail)
+	n := model.Notification{Type: model.NotificationTypeAccountLocked, UserName: user.Name, RealIP: ip, Detail: detail}
+	if err := db.Create(&n).Error; err != nil {
+		logging.Error("Failed to create account-locked notification for '%s': %v", user.Name, err)
+	}
+	return &until, nil
+}
+
+// RecordLoginSuccess 身份校验通过后清零连续失败次数
+func RecordLoginSuccess(db *gorm.DB, user *model.User) {
+	if user.FailedLoginCount == 0 && user.LockedUntil == nil {
+		return
+	}
+	if err := clearLoginFailures(db, user.ID); err != nil {
+		logging.Warn("Failed to reset failed-login counter of '%s': %v", user.Name, err)
+	}
+}
+
+// UnlockAccount 管理员解锁账号（同时清零失败次数）
+func UnlockAccount(db *gorm.DB, user *model.User, actor, ip string) error {
+	if err := clearLoginFailures(db, user.ID); err != nil {
+		return err
+	}
+	logging.LogSecurityEvent("account_unlocked", user.Name, ip, "unlocked by "+actor)
+	return nil
+}
+
+func clearLoginFailures(db *gorm.DB, userID string) error {
+	return db.Model(&model.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"failed_login_count":   0,
+		"last_failed_login_at": nil,
+		"locked_until":         nil,
+	}).Error
+}
+
+// maxUnknownLoginBuckets 不存在的邮箱最多跟踪这么多个，超出时先清理过期的
+const maxUnknownLoginBuckets = 10000
+
+// unknownLoginBucket 不存在的邮箱的连续失败记录
+type unknownLoginBucket struct {
+	failures    int
+	lastFailure time.Time
+	lockedUntil time.Time
+}
+
+// unknownLogins 按邮箱记录不存在账号的登录失败，使其与真实账号一样被锁定，
+// 否则只有真实账号会返回 429，锁定本身就暴露了哪些邮箱已注册。只保存在内存中，重启后清零。
+var unknownLogins = struct {
+	sync.Mutex
+	m map[string]*unknownLoginBucket
+}{m: map[string]*unknownLoginBucket{}}
+
+func unknownLoginKey(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// UnknownLoginLockedUntil 不存在的邮箱仍在锁定中时返回解锁时间
+func UnknownLoginLockedUntil(email string, now time.Time) (time.Time, bool) {
+	unknownLogins.Lock()
+	defer unknownLogins.Unlock()
+	b := unknownLogins.m[unknownLoginKey(email)]
+	if b != nil && now.Before(b.lockedUntil) {
+		return b.lockedUntil, true
+	}
+	return time.Time{}, false
+}
+
+// RecordUnknownLoginFailure 记录一次不存在账号的登录失败，计数与锁定时长同 RecordLoginFailure。
+// 返回本次设置的解锁时间，未锁定时为 nil。
+func RecordUnknownLoginFailure(email string, now time.Time) *time.Time {
+	key := unknownLoginKey(email)
+	unknownLogins.Lock()
+	defer unknownLogins.Unlock()
+	b := unknownLogins.m[key]
+	if b == nil {
+		if len(unknownLogins.m) >= maxUnknownLoginBuckets {
+			pruneUnknownLogins(now)
+		}
+		if len(unknownLogins.m) >= maxUnknownLoginBuckets {
+			return nil
+		}
+		b = &unknownLoginBucket{}
+		unknownLogins.m[key] = b
+	}
+	if now.Sub(b.lastFailure) > failureResetAfter {
+		b.failures = 0
+	}
+	b.failures++
+	b.lastFailure = now
+	base, max := utils.GetLoginLockoutDurations()
+	d := lockoutDuration(b.failures, utils.GetLoginLockoutThreshold(), base, max)
+	if d == 0 {
+		return nil
+	}
+	b.lockedUntil = now.Add(d)
+	until := b.lockedUntil
+	return &until
+}
+
+// ForgetUnknownLoginFailures 该邮箱已成为真实账号（目录用户首次登录开通）后丢弃记录
+func ForgetUnknownLoginFailures(email string) {
+	unknownLogins.Lock()
+	delete(unknownLogins.m, unknownLoginKey(email))
+	unknownLogins.Unlock()
+}
+
+// pruneUnknownLogins 丢弃已不再计数也未锁定的记录；调用方持有锁
+func pruneUnknownLogins(now time.Time) {
+	for k, b := range unknownLogins.m {
+		if now.Sub(b.lastFailure) > failureResetAfter && !now.Before(b.lockedUntil) {
+			delete(unknownLogins.m, k)
+		}
+	}
+}
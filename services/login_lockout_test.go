@@ -0,0 +1,78 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	base, max := time.Minute, 10*time.Minute
+	cases := []struct {
+		failures, threshold int
+		want                time.Duration
+	}{
+		{1, 5, 0},
+		{4, 5, 0},
+		{5, 5, time.Minute},
+		{6, 5, 2 * time.Minute},
+		{8, 5, 8 * time.Minute},
+		{9, 5, 10 * time.Minute},
+		{50, 5, 10 * time.Minute},
+		// 0 表示不锁定
+		{50, 0, 0},
+	}
+	for _, tc := range cases {
+		if got := lockoutDuration(tc.failures, tc.threshold, base, max); got != tc.want {
+			t.Errorf("lockoutDuration(%d, %d) = %s, want %s", tc.failures, tc.threshold, got, tc.want)
+		}
+	}
+}
+
+func TestAccountLockedUntil(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Minute), now.Add(time.Minute)
+	if _, locked := AccountLockedUntil(&model.User{}, now); locked {
+		t.Error("never locked user reported locked")
+	}
+	if _, locked := AccountLockedUntil(&model.User{LockedUntil: &past}, now); locked {
+		t.Error("expired lock reported locked")
+	}
+	if until, locked := AccountLockedUntil(&model.User{LockedUntil: &future}, now); !locked || !until.Equal(future) {
+		t.Errorf("active lock: %v %v", until, locked)
+	}
+}
+
+// 不存在的邮箱与真实账号一样计数、锁定
+func TestRecordUnknownLoginFailure(t *testing.T) {
+	t.Setenv("LOGIN_LOCKOUT_THRESHOLD", "3")
+	t.Setenv("LOGIN_LOCKOUT_MINUTES", "1")
+	t.Cleanup(func() { ForgetUnknownLoginFailures("ghost@example.com") })
+	now := time.Now()
+
+	for i := 1; i < 3; i++ {
+		if until := RecordUnknownLoginFailure("ghost@example.com", now); until != nil {
+			t.Fatalf("failure %d locked until %v", i, until)
+		}
+	}
+	// 大小写不同的同一邮箱共用计数
+	until := RecordUnknownLoginFailure(" Ghost@Example.com", now)
+	if until == nil || !until.Equal(now.Add(time.Minute)) {
+		t.Fatalf("third failure: until = %v, want %v", until, now.Add(time.Minute))
+	}
+	if got, locked := UnknownLoginLockedUntil("ghost@example.com", now.Add(30*time.Second)); !locked || !got.Equal(*until) {
+		t.Errorf("during lock: %v %v", got, locked)
+	}
+	if _, locked := UnknownLoginLockedUntil("ghost@example.com", now.Add(2*time.Minute)); locked {
+		t.Error("lock did not expire")
+	}
+	if _, locked := UnknownLoginLockedUntil("other@example.com", now); locked {
+		t.Error("unrelated email locked")
+	}
+
+	// 距上次失败超过 failureResetAfter 重新计数
+	if until := RecordUnknownLoginFailure("ghost@example.com", now.Add(failureResetAfter+time.Minute)); until != nil {
+		t.Errorf("failure after reset window locked until %v", until)
+	}
+}
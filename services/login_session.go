@@ -0,0 +1,196 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// RefreshTokenTTL 刷新令牌有效期：超过这么久没有刷新（没有使用面板）就需要重新登录
+const RefreshTokenTTL = 7 * 24 * time.Hour
+
+// 会话被吊销的原因
+const (
+	SessionRevokedLogout          = "logout"
+	SessionRevokedByUser          = "revoked_by_user"
+	SessionRevokedPasswordChanged = "password_changed"
+	SessionRevokedRoleChanged     = "role_changed"
+	SessionRevokedAccountDisabled = "account_disabled"
+	SessionRevokedTokenReuse      = "refresh_token_reuse"
+)
+
+var (
+	// ErrRefreshTokenInvalid 刷新令牌不存在、已轮换、已过期或会话已吊销
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	// ErrLoginSessionNotFound 会话不存在或不属于当前用户
+	ErrLoginSessionNotFound = errors.New("session not found")
+)
+
+// newRefreshToken 刷新令牌为 "<会话 ID>.<随机串>"，返回令牌与随机串的哈希
+func newRefreshToken(sessionID string) (token, hash string, err error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", "", err
+	}
+	secret := base64.RawURLEncoding.EncodeToString(raw)
+	return sessionID + "." + secret, hashUserToken(secret), nil
+}
+
+// truncateUTF8 按字节截断且不留下半个字符
+func truncateUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return strings.ToValidUTF8(s[:n], "")
+}
+
+// CreateLoginSession 登录成功后新建会话，返回会话与刷新令牌。顺带清理该用户已过期的会话。
+func CreateLoginSession(db *gorm.DB, user *model.User, ip, userAgent string) (*model.LoginSession, string, error) {
+	now := time.Now()
+	if err := db.Where("user_id = ? AND expires_at < ?", user.ID, now).Delete(&model.LoginSession{}).Error; err != nil {
+		logging.Warn("Failed to clean up expired sessions of user '%s': %v", user.Name, err)
+	}
+	s := model.LoginSession{
+		ID:         uuid.NewString(),
+		UserID:     user.ID,
+		UserAgent:  truncateUTF8(userAgent, 255),
+		IP:         ip,
+		LastUsedAt: now,
+		ExpiresAt:  now.Add(RefreshTokenTTL),
+	}
+	token, hash, err := newRefreshToken(s.ID)
+	if err != nil {
+		return nil, "", err
+	}
+	s.RefreshHash = hash
+	if err := db.Create(&s).Error; err != nil {
+		return nil, "", err
+	}
+	return &s, token, nil
+}
+
+// RotateLoginSession 用刷新令牌换新：校验会话有效、用户仍存在且已批准，轮换刷新令牌并顺延有效期。
+// 返回会话、最新的用户记录（新访问令牌按它签发，角色 / 部门以数据库为准）与新的刷新令牌。
+// 已轮换掉的旧刷新令牌再次出现说明令牌泄露，整个会话随即吊销。
+func RotateLoginSession(db *gorm.DB, refreshToken string) (*model.LoginSession, *model.User, string, error) {
+	sessionID, secret, ok := strings.Cut(refreshToken, ".")
+	if !ok || sessionID == "" || secret == "" {
+		return nil, nil, "", ErrRefreshTokenInvalid
+	}
+	var s model.LoginSession
+	if err := db.First(&s, "id = ?", sessionID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, "", ErrRefreshTokenInvalid
+		}
+		return nil, nil, "", err
+	}
+	now := time.Now()
+	if s.RevokedAt != nil || now.After(s.ExpiresAt) {
+		return nil, nil, "", ErrRefreshTokenInvalid
+	}
+	hash := hashUserToken(secret)
+	if s.PrevRefreshHash != "" && hash == s.PrevRefreshHash {
+		logging.Warn("Refresh token of session %s reused; revoking the session", s.ID)
+		revokeSessions(db.Where("id = ?", s.ID), SessionRevokedTokenReuse)
+		return nil, nil, "", ErrRefreshTokenInvalid
+	}
+	if hash != s.RefreshHash {
+		return nil, nil, "", ErrRefreshTokenInvalid
+	}
+
+	var user model.User
+	if err := db.First(&user, "id = ?", s.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			revokeSessions(db.Where("id = ?", s.ID), SessionRevokedAccountDisabled)
+			return nil, nil, "", ErrRefreshTokenInvalid
+		}
+		return nil, nil, "", err
+	}
+	if user.ApprovalStatus != model.ApprovalApproved {
+		revokeSessions(db.Where("id = ?", s.ID), SessionRevokedAccountDisabled)
+		return nil, nil, "", ErrRefreshTokenInvalid
+	}
+
+	token, newHash, err := newRefreshToken(s.ID)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	res := db.Model(&model.LoginSession{}).
+		Where("id = ? AND refresh_hash = ? AND revoked_at IS NULL", s.ID, hash).
+		Updates(map[string]interface{}{
+			"refresh_hash":      newHash,
+			"prev_refresh_hash": hash,
+			"last_used_at":      now,
+			"expires_at":        now.Add(RefreshTokenTTL),
+		})
+	if res.Error != nil {
+		return nil, nil, "", res.Error
+	}
+	if res.RowsAffected == 0 {
+		// 并发的另一次刷新已经轮换
+		return nil, nil, "", ErrRefreshTokenInvalid
+	}
+	return &s, &user, token, nil
+}
+
+// LoginSessionActive 会话存在、属于该用户、未吊销且未过期（JWTAuthMiddleware 每个请求调用）
+func LoginSessionActive(db *gorm.DB, sessionID, userID string) bool {
+	var n int64
+	err := db.Model(&model.LoginSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, userID, time.Now()).
+		Count(&n).Error
+	if err != nil {
+		logging.Error("Failed to check login session %s: %v", sessionID, err)
+		return false
+	}
+	return n > 0
+}
+
+// ListLoginSessions 用户当前有效的会话，最近使用的在前
+func ListLoginSessions(db *gorm.DB, userID string) ([]model.LoginSession, error) {
+	var sessions []model.LoginSession
+	err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").Find(&sessions).Error
+	return sessions, err
+}
+
+func revokeSessions(scope *gorm.DB, reason string) error {
+	err := scope.Model(&model.LoginSession{}).
+		Where("revoked_at IS NULL").
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason}).Error
+	if err != nil {
+		logging.Error("Failed to revoke login sessions (%s): %v", reason, err)
+	}
+	return err
+}
+
+// RevokeLoginSession 吊销用户自己的一个会话
+func RevokeLoginSession(db *gorm.DB, userID, sessionID, reason string) error {
+	res := db.Model(&model.LoginSession{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoke_reason": reason})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLoginSessionNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions 吊销用户的全部会话；exceptID 非空时保留该会话（改密码时保留当前会话）
+func RevokeUserSessions(db *gorm.DB, userID, exceptID, reason string) error {
+	scope := db.Where("user_id = ?", userID)
+	if exceptID != "" {
+		scope = scope.Where("id <> ?", exceptID)
+	}
+	return revokeSessions(scope, reason)
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"testing"
+
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+)
+
+func sessionRevokeReason(t *testing.T, db *gorm.DB, id string) string {
+	t.Helper()
+	var s model.LoginSession
+	if err := db.First(&s, "id = ?", id).Error; err != nil {
+		t.Fatal(err)
+	}
+	if s.RevokedAt == nil {
+		return ""
+	}
+	return s.RevokeReason
+}
+
+func TestRotateLoginSession(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	session, first, err := CreateLoginSession(db, alice, "192.0.2.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 角色按数据库当前值返回，而不是登录时的
+	db.Model(&model.User{}).Where("id = ?", alice.ID).Update("role", model.RoleManager)
+	_, user, second, err := RotateLoginSession(db, first)
+	if err != nil {
+		t.Fatalf("RotateLoginSession: %v", err)
+	}
+	if user.Role != model.RoleManager || second == first {
+		t.Errorf("rotated: role = %s, new token equal to old = %v", user.Role, second == first)
+	}
+	third, err := rotate(db, second)
+	if err != nil {
+		t.Fatalf("second rotation: %v", err)
+	}
+	if !LoginSessionActive(db, session.ID, alice.ID) {
+		t.Fatal("session inactive after rotation")
+	}
+
+	// 已轮换掉的令牌再次出现：吊销整个会话，当前令牌也随之失效
+	if _, err := rotate(db, second); err != ErrRefreshTokenInvalid {
+		t.Errorf("reused token: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if got := sessionRevokeReason(t, db, session.ID); got != SessionRevokedTokenReuse {
+		t.Errorf("revoke reason = %q, want %q", got, SessionRevokedTokenReuse)
+	}
+	if _, err := rotate(db, third); err != ErrRefreshTokenInvalid {
+		t.Errorf("current token after reuse: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+
+	for _, bad := range []string{"", "no-dot", session.ID + ".", session.ID + ".wrong"} {
+		if _, err := rotate(db, bad); err != ErrRefreshTokenInvalid {
+			t.Errorf("token %q: err = %v, want ErrRefreshTokenInvalid", bad, err)
+		}
+	}
+}
+
+func TestRotateLoginSessionRejectsUser(t *testing.T) {
+	db := newTestDB(t)
+	bob := createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com"})
+	carol := createTestUser(t, db, &model.User{Name: "carol", Email: "carol@example.com"})
+	bobSession, bobToken, _ := CreateLoginSession(db, bob, "", "")
+	carolSession, carolToken, _ := CreateLoginSession(db, carol, "", "")
+
+	// 用户被删除
+	db.Delete(&model.User{}, "id = ?", bob.ID)
+	if _, err := rotate(db, bobToken); err != ErrRefreshTokenInvalid {
+		t.Errorf("deleted user: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if got := sessionRevokeReason(t, db, bobSession.ID); got != SessionRevokedAccountDisabled {
+		t.Errorf("deleted user: revoke reason = %q", got)
+	}
+
+	// 用户不再是已批准状态
+	db.Model(&model.User{}).Where("id = ?", carol.ID).Update("approval_status", model.ApprovalRejected)
+	if _, err := rotate(db, carolToken); err != ErrRefreshTokenInvalid {
+		t.Errorf("rejected user: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if got := sessionRevokeReason(t, db, carolSession.ID); got != SessionRevokedAccountDisabled {
+		t.Errorf("rejected user: revoke reason = %q", got)
+	}
+}
+
+// 两个请求拿同一个刷新令牌并发刷新：后写入的一方发现令牌已被轮换，不能再拿到新令牌
+func TestRotateLoginSessionLosesConcurrentRotation(t *testing.T) {
+	db := newTestDB(t)
+	dave := createTestUser(t, db, &model.User{Name: "dave", Email: "dave@example.com"})
+	session, token, _ := CreateLoginSession(db, dave, "", "")
+
+	// 在本次轮换读完会话、写入之前，模拟另一个请求抢先完成轮换
+	raced := false
+	err := db.Callback().Update().Before("gorm:update").Register("test:race", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != "login_sessions" {
+			return
+		}
+		raced = true
+		tx.Session(&gorm.Session{NewDB: true}).Exec(
+			"UPDATE login_sessions SET refresh_hash = ?, prev_refresh_hash = refresh_hash WHERE id = ?", "winner", session.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rotate(db, token); err != ErrRefreshTokenInvalid {
+		t.Fatalf("lost rotation: err = %v, want ErrRefreshTokenInvalid", err)
+	}
+	if !raced {
+		t.Fatal("race hook did not run")
+	}
+	var s model.LoginSession
+	db.First(&s, "id = ?", session.ID)
+	if s.RefreshHash != "winner" || s.RevokedAt != nil {
+		t.Errorf("session after lost rotation: hash = %q, revoked = %v", s.RefreshHash, s.RevokedAt != nil)
+	}
+}
+
+func rotate(db *gorm.DB, token string) (string, error) {
+	_, _, next, err := RotateLoginSession(db, token)
+	return next, err
+}
@@ -2,12 +2,14 @@ package services
 
 import (
 	"context"
+	"strings"
 	"sync"
 	"time"
 
 	"openvpn-admin-go/logging"
 	"openvpn-admin-go/model"
 	"openvpn-admin-go/openvpn"
+	"openvpn-admin-go/openvpn/mgmt"
 
 	"gorm.io/gorm"
 )
@@ -36,6 +38,31 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 		return
 	}
 
+	applyClientStatuses(db, parsedClients)
+	logging.Info("OpenVPN sync cycle finished.")
+}
+
+// RunManagementSyncCycle 与 RunSyncCycle 相同，但状态取自管理接口的 "status 2" 快照，
+// 不受 status.log 刷新间隔的影响。status 失败时返回 false，由调用方退回轮询 status.log。
+func RunManagementSyncCycle(db *gorm.DB, status func() ([]string, error)) bool {
+	lines, err := status()
+	if err != nil {
+		logging.Error("Failed to fetch status from management interface: %v", err)
+		return false
+	}
+	clients, _, err := openvpn.ParseStatus(strings.NewReader(strings.Join(lines, "\n")))
+	if err != nil {
+		logging.Error("Failed to parse management status: %v", err)
+		return false
+	}
+	applyClientStatuses(db, clients)
+	return true
+}
+
+// applyClientStatuses reconciles the DB online state with a full client snapshot
+// (status log or management "status 2"): listed clients are updated, online users
+// missing from the snapshot are marked offline.
+func applyClientStatuses(db *gorm.DB, parsedClients []openvpn.OpenVPNClientStatus) {
 	// Step 1: Fetch users currently marked as online in DB
 	var dbOnlineUsers []model.User
 	if err := db.Where("is_online = ?", true).Find(&dbOnlineUsers).Error; err != nil {
@@ -55,6 +82,8 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 		realIP    string
 		virtualIP string
 	})
+	// onlineSessions are written to the session history after the transaction (best-effort)
+	var onlineSessions []sessionSnapshot
 
 	// Step 2: Process clients from the status log (batch update in transaction)
 	if err := db.Transaction(func(tx *gorm.DB) error {
@@ -76,6 +105,7 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 			user.IsOnline = clientStatus.IsOnline
 			user.RealAddress = clientStatus.RealAddress
 			user.VirtualAddress = clientStatus.VirtualAddress
+			user.VirtualIPv6Address = clientStatus.VirtualIPv6Address
 			user.BytesReceived = clientStatus.BytesReceived
 			user.BytesSent = clientStatus.BytesSent
 			user.OnlineDuration = clientStatus.OnlineDurationSeconds
@@ -92,6 +122,21 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 				logging.Error("Error updating user '%s' status: %v", user.Name, err)
 			}
 
+			if clientStatus.IsOnline {
+				onlineSessions = append(onlineSessions, sessionSnapshot{
+					clientID:       clientStatus.ClientID,
+					userID:         user.ID,
+					userName:       user.Name,
+					realAddress:    clientStatus.RealAddress,
+					virtualAddress: clientStatus.VirtualAddress,
+					cipher:         clientStatus.DataChannelCipher,
+					startedAt:      clientStatus.ConnectedSince,
+					bytesReceived:  clientStatus.BytesReceived,
+					bytesSent:      clientStatus.BytesSent,
+					duration:       clientStatus.OnlineDurationSeconds,
+				})
+			}
+
 			// Record that this user newly connected this cycle (for debounce check in Step 3)
 			if wasOffline && clientStatus.IsOnline {
 				newlyConnectedThisCycle[clientStatus.CommonName] = struct {
@@ -106,6 +151,12 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 		return
 	}
 
+	for _, s := range onlineSessions {
+		touchSession(db, s)
+	}
+	// 仍在线用户的其他会话已结束（两次同步之间重连，或 duplicate-cn 下其中一个会话断开）
+	closeEndedSessions(db, onlineSessions)
+
 	// Emit "connected" notifications OUTSIDE the transaction, best-effort.
 	// Skip users that also disconnected this cycle (flapping debounce).
 	for userName, info := range newlyConnectedThisCycle {
@@ -118,7 +169,9 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 		// contradicts wasOffline check above — this branch is unreachable; left for clarity)
 	}
 
-	// Step 3: Mark disconnected users offline (batch in transaction)
+	// Step 3: Mark disconnected users offline (batch in transaction).
+	// BytesReceived/BytesSent/OnlineDuration keep the last session's totals; the full
+	// history lives in client_logs.
 	if err := db.Transaction(func(tx *gorm.DB) error {
 		for _, dbUser := range dbOnlineUsers {
 			if _, found := processedUserNames[dbUser.Name]; !found {
@@ -126,9 +179,7 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 				dbUser.IsOnline = false
 				dbUser.RealAddress = ""
 				dbUser.VirtualAddress = ""
-				dbUser.BytesReceived = 0
-				dbUser.BytesSent = 0
-				dbUser.OnlineDuration = 0
+				dbUser.VirtualIPv6Address = ""
 				dbUser.ConnectedSince = nil
 				dbUser.LastRef = nil
 
@@ -142,24 +193,40 @@ func RunSyncCycle(db *gorm.DB, statusLogPath string) {
 		logging.Error("Disconnect sync transaction failed: %v", err)
 	}
 
-	// Emit "disconnected" notifications OUTSIDE the transaction, best-effort.
+	// Close session history and emit "disconnected" notifications OUTSIDE the transaction, best-effort.
 	for _, dbUser := range dbOnlineUsers {
 		if _, found := processedUserNames[dbUser.Name]; !found {
+			// 轮询只知道最后一次看到它在线的时间，以此作为会话结束时间
+			endedAt := time.Now()
+			if dbUser.LastRef != nil {
+				endedAt = *dbUser.LastRef
+			}
+			closeUserSessions(db, dbUser.Name, endedAt)
 			createNotification(db, model.NotificationTypeDisconnected, dbUser.Name, dbUser.RealAddress, dbUser.VirtualAddress)
 			logging.Info("Notification: user '%s' disconnected", dbUser.Name)
 		}
 	}
 
-	logging.Info("OpenVPN sync cycle finished.")
+	recordSessionEvents(db)
+	// 在线用户的隧道地址变了：更新客户端互访放行名单
+	syncClientFirewall(db)
 }
 
-// StartOpenVPNSyncService 启动 OpenVPN 状态同步服务，支持 context 取消和 WaitGroup 优雅退出
-func StartOpenVPNSyncService(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB, statusLogPath string, interval time.Duration) {
+// StartOpenVPNSyncService 启动 OpenVPN 状态同步服务，支持 context 取消和 WaitGroup 优雅退出。
+// mc 非空且已连接时每个周期通过管理接口的 "status 2" 对账；
+// 管理接口不可达或 mc 为空时轮询 status.log。
+func StartOpenVPNSyncService(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB, mc *mgmt.Client, statusLogPath string, interval time.Duration) {
 	logging.Info("Starting OpenVPN Sync Service with interval %s. Log path: %s", interval, statusLogPath)
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
-		RunSyncCycle(db, statusLogPath)
+		poll := func() {
+			if mc != nil && mc.Connected() && RunManagementSyncCycle(db, mc.Status) {
+				return
+			}
+			RunSyncCycle(db, statusLogPath)
+		}
+		poll()
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 		for {
@@ -168,7 +235,7 @@ func StartOpenVPNSyncService(ctx context.Context, wg *sync.WaitGroup, db *gorm.D
 				logging.Info("OpenVPN Sync Service stopping...")
 				return
 			case <-ticker.C:
-				RunSyncCycle(db, statusLogPath)
+				poll()
 			}
 		}
 	}()
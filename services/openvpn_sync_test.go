@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+)
+
+const trackerStatusHeader = `TITLE,OpenVPN 2.6.12 x86_64-pc-linux-gnu
+TIME,2025-06-11 13:19:29,1749647969
+HEADER,CLIENT_LIST,Common Name,Real Address,Virtual Address,Virtual IPv6 Address,Bytes Received,Bytes Sent,Connected Since,Connected Since (time_t),Username,Client ID,Peer ID,Data Channel Cipher
+`
+
+const trackerStatusRouting = `HEADER,ROUTING_TABLE,Virtual Address,Common Name,Real Address,Last Ref,Last Ref (time_t)
+`
+
+// fakeStatus serves a "status 2" reply listing the given CLIENT_LIST rows, each with a
+// fresh ROUTING_TABLE entry so it counts as online.
+func fakeStatus(rows ...string) func() ([]string, error) {
+	return func() ([]string, error) {
+		var routes []string
+		for _, row := range rows {
+			f := strings.Split(row, ",")
+			routes = append(routes, strings.Join([]string{"ROUTING_TABLE", f[3], f[1], f[2], "2025-06-11 13:19:27", "1749647967"}, ","))
+		}
+		reply := trackerStatusHeader + strings.Join(rows, "\n") + "\n" + trackerStatusRouting + strings.Join(routes, "\n") + "\nEND"
+		return strings.Split(reply, "\n"), nil
+	}
+}
+
+func TestRunManagementSyncCycle(t *testing.T) {
+	db := newTestDB(t)
+	firewall := stubClientFirewall(t, &openvpn.Config{OpenVPNClientToClient: true})
+	now := time.Now()
+	// bob 不在 "status 2" 里，对账应把他标记为离线
+	createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	bob := createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", IsOnline: true, RealAddress: "198.51.100.1:1194", LastRef: &now})
+	status := fakeStatus(
+		"CLIENT_LIST,alice,203.0.113.5:41000,10.8.0.6,fd00:8::1000,2048,4096,2025-06-11 10:29:16,1749637756,UNDEF,7,0,AES-256-GCM",
+	)
+
+	if !RunManagementSyncCycle(db, status) {
+		t.Fatal("RunManagementSyncCycle() = false, want true")
+	}
+	var alice, gotBob model.User
+	db.First(&alice, "name = ?", "alice")
+	db.First(&gotBob, "id = ?", bob.ID)
+	if !alice.IsOnline || alice.VirtualIPv6Address != "fd00:8::1000" || alice.BytesReceived != 2048 || alice.BytesSent != 4096 {
+		t.Errorf("alice = online %v ipv6 %q bytes %d/%d", alice.IsOnline, alice.VirtualIPv6Address, alice.BytesReceived, alice.BytesSent)
+	}
+	if gotBob.IsOnline || gotBob.RealAddress != "" {
+		t.Errorf("bob still online after reconcile: %+v", gotBob)
+	}
+	var open model.ClientLog
+	if err := db.Where("user_name = ? AND ended_at IS NULL", "alice").First(&open).Error; err != nil {
+		t.Fatalf("no open session row: %v", err)
+	}
+	if open.ClientID != "7" || open.Cipher != "AES-256-GCM" || open.StartedAt == nil || open.StartedAt.Unix() != 1749637756 {
+		t.Errorf("open session row = %+v", open)
+	}
+
+	// 同步后放行名单跟着在线用户更新
+	if n := len(*firewall); n != 1 || !reflect.DeepEqual((*firewall)[n-1].addrs, []string{"10.8.0.6"}) {
+		t.Errorf("client-to-client firewall = %+v, want alice's address", *firewall)
+	}
+
+	if RunManagementSyncCycle(db, func() ([]string, error) { return nil, errors.New("not connected") }) {
+		t.Error("RunManagementSyncCycle() with a failing status = true, want false")
+	}
+}
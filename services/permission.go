@@ -0,0 +1,175 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrRoleNotEditable 角色不存在或不可编辑（superadmin 固定拥有全部权限）
+	ErrRoleNotEditable = errors.New("permissions of this role cannot be edited")
+	// ErrPermissionUnknown 未注册的权限，或只属于 superadmin 的权限
+	ErrPermissionUnknown = errors.New("unknown or reserved permission")
+)
+
+// rolePermissionsTTL 权限缓存的有效期：多个实例共用一个数据库时，
+// 在另一个实例上修改的角色权限最迟在这之后生效
+const rolePermissionsTTL = 30 * time.Second
+
+// rolePermissions role_permissions 的内存缓存，每个请求的权限校验都读它
+var rolePermissions = struct {
+	sync.RWMutex
+	m        map[string]map[string]bool
+	db       *gorm.DB // 缓存过期后从这里重新加载；首次 LoadRolePermissions 之前为空
+	loadedAt time.Time
+}{m: map[string]map[string]bool{}}
+
+// rolePermissionsReload 同一时间只让一个请求重新加载，其他请求继续用旧缓存
+var rolePermissionsReload sync.Mutex
+
+// SyncPermissionRegistry 启动时调用：把新加入注册表的权限按默认值授予一次，然后加载缓存
+func SyncPermissionRegistry(db *gorm.DB) error {
+	var registered []model.RegisteredPermission
+	if err := db.Find(&registered).Error; err != nil {
+		return err
+	}
+	seen := make(map[string]bool, len(registered))
+	for _, r := range registered {
+		seen[r.Key] = true
+	}
+	for _, p := range model.PermissionRegistry {
+		if seen[p.Key] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, role := range p.Defaults {
+				row := model.RolePermission{Role: role, Permission: p.Key}
+				if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&row).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Create(&model.RegisteredPermission{Key: p.Key}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("register permission %s: %w", p.Key, err)
+		}
+		logging.Info("Permission '%s' registered with default roles %v", p.Key, p.Defaults)
+	}
+	return LoadRolePermissions(db)
+}
+
+// LoadRolePermissions 重新加载角色权限缓存
+func LoadRolePermissions(db *gorm.DB) error {
+	var rows []model.RolePermission
+	if err := db.Find(&rows).Error; err != nil {
+		return err
+	}
+	m := make(map[string]map[string]bool)
+	for _, r := range rows {
+		if m[string(r.Role)] == nil {
+			m[string(r.Role)] = make(map[string]bool)
+		}
+		m[string(r.Role)][r.Permission] = true
+	}
+	rolePermissions.Lock()
+	rolePermissions.m = m
+	rolePermissions.db = db
+	rolePermissions.loadedAt = time.Now()
+	rolePermissions.Unlock()
+	return nil
+}
+
+// reloadStaleRolePermissions 缓存超过 rolePermissionsTTL 时重新加载；加载失败保留旧缓存，过一个周期再试
+func reloadStaleRolePermissions() {
+	rolePermissions.RLock()
+	db, stale := rolePermissions.db, time.Since(rolePermissions.loadedAt) > rolePermissionsTTL
+	rolePermissions.RUnlock()
+	if db == nil || !stale || !rolePermissionsReload.TryLock() {
+		return
+	}
+	defer rolePermissionsReload.Unlock()
+	if err := LoadRolePermissions(db); err != nil {
+		logging.Warn("Failed to reload role permissions, keeping the cached ones: %v", err)
+		rolePermissions.Lock()
+		rolePermissions.loadedAt = time.Now()
+		rolePermissions.Unlock()
+	}
+}
+
+// RoleHasPermission 供 middleware.RoleHasPermission 使用
+func RoleHasPermission(role, permission string) bool {
+	reloadStaleRolePermissions()
+	rolePermissions.RLock()
+	defer rolePermissions.RUnlock()
+	return rolePermissions.m[role][permission]
+}
+
+// RolePermissions 角色的有效权限（按注册表顺序）；superadmin 为全部权限
+func RolePermissions(role string) []string {
+	perms := make([]string, 0, len(model.PermissionRegistry))
+	for _, p := range model.PermissionRegistry {
+		if role == string(model.RoleSuperAdmin) || RoleHasPermission(role, p.Key) {
+			perms = append(perms, p.Key)
+		}
+	}
+	return perms
+}
+
+// validateRolePermissions 校验角色可编辑、权限均已注册且不是 superadmin 专属，返回去重后的权限
+func validateRolePermissions(role string, permissions []string) ([]string, error) {
+	editable := false
+	for _, r := range model.EditableRoles {
+		if string(r) == role {
+			editable = true
+		}
+	}
+	if !editable {
+		return nil, ErrRoleNotEditable
+	}
+	seen := make(map[string]bool, len(permissions))
+	out := make([]string, 0, len(permissions))
+	for _, key := range permissions {
+		p, ok := model.LookupPermission(key)
+		if !ok || p.Reserved {
+			return nil, fmt.Errorf("%w: %s", ErrPermissionUnknown, key)
+		}
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, key)
+		}
+	}
+	return out, nil
+}
+
+// SetRolePermissions 用给定的权限集合替换角色的全部权限，并刷新缓存
+// （本实例立即生效，其他实例在缓存过期后生效）
+func SetRolePermissions(db *gorm.DB, role string, permissions []string) error {
+	perms, err := validateRolePermissions(role, permissions)
+	if err != nil {
+		return err
+	}
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("role = ?", role).Delete(&model.RolePermission{}).Error; err != nil {
+			return err
+		}
+		for _, p := range perms {
+			if err := tx.Create(&model.RolePermission{Role: model.Role(role), Permission: p}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	logging.Info("Permissions of role '%s' set to %v", role, perms)
+	return LoadRolePermissions(db)
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+)
+
+func TestValidateRolePermissions(t *testing.T) {
+	got, err := validateRolePermissions("manager", []string{model.PermClientRead, model.PermClientPause, model.PermClientRead})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{model.PermClientRead, model.PermClientPause}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got, err := validateRolePermissions("user", nil); err != nil || len(got) != 0 {
+		t.Errorf("empty set: %v, %v", got, err)
+	}
+	if _, err := validateRolePermissions("superadmin", []string{model.PermClientRead}); !errors.Is(err, ErrRoleNotEditable) {
+		t.Errorf("superadmin: %v", err)
+	}
+	if _, err := validateRolePermissions("auditor", nil); !errors.Is(err, ErrRoleNotEditable) {
+		t.Errorf("unknown role: %v", err)
+	}
+	if _, err := validateRolePermissions("admin", []string{"client.fly"}); !errors.Is(err, ErrPermissionUnknown) {
+		t.Errorf("unknown permission: %v", err)
+	}
+	if _, err := validateRolePermissions("admin", []string{model.PermPermissionManage}); !errors.Is(err, ErrPermissionUnknown) {
+		t.Errorf("reserved permission: %v", err)
+	}
+}
+
+func TestPermissionRegistryDefaults(t *testing.T) {
+	seen := map[string]bool{}
+	for _, p := range model.PermissionRegistry {
+		if seen[p.Key] {
+			t.Errorf("duplicate permission %s", p.Key)
+		}
+		seen[p.Key] = true
+		if p.Reserved && len(p.Defaults) > 0 {
+			t.Errorf("reserved permission %s has default roles", p.Key)
+		}
+		for _, r := range p.Defaults {
+			if r == model.RoleSuperAdmin {
+				t.Errorf("%s lists superadmin as a default", p.Key)
+			}
+		}
+	}
+}
+
+// 其他实例直接改了 role_permissions：缓存过期后重新加载
+func TestRolePermissionsReloadAfterTTL(t *testing.T) {
+	db := newTestDB(t)
+	if err := db.AutoMigrate(&model.RolePermission{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		rolePermissions.Lock()
+		rolePermissions.m, rolePermissions.db = map[string]map[string]bool{}, nil
+		rolePermissions.Unlock()
+	})
+	if err := LoadRolePermissions(db); err != nil {
+		t.Fatal(err)
+	}
+
+	db.Create(&model.RolePermission{Role: model.RoleUser, Permission: model.PermLogsRead})
+	if RoleHasPermission(string(model.RoleUser), model.PermLogsRead) {
+		t.Fatal("fresh cache reloaded before the TTL")
+	}
+	rolePermissions.Lock()
+	rolePermissions.loadedAt = time.Now().Add(-rolePermissionsTTL - time.Second)
+	rolePermissions.Unlock()
+	if !RoleHasPermission(string(model.RoleUser), model.PermLogsRead) {
+		t.Error("stale cache not reloaded")
+	}
+}
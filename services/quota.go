@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	quotaDayLayout = "2006-01-02"
+	// quotaResetCheckInterval 检查配额暂停用户能否恢复的间隔；周期在本地时间 0 点 / 每月 1 日重置
+	quotaResetCheckInterval = time.Minute
+	// quotaCheckInterval 同一用户两次超额检查的最小间隔。流量每 10 秒上报一次，每次都做聚合查询
+	// 太重；代价是超额后最多再多用这段时间的流量才被暂停
+	quotaCheckInterval = 30 * time.Second
+)
+
+// 暂停 / 恢复 VPN 客户端（拉黑并断开），单元测试中替换
+var (
+	pauseVPNClient  = openvpn.PauseClient
+	resumeVPNClient = openvpn.ResumeClient
+)
+
+// quotaChecks 记录每个用户上次做超额检查的时间
+var quotaChecks = struct {
+	sync.Mutex
+	last map[string]time.Time
+}{last: make(map[string]time.Time)}
+
+// quotaCheckDue 距该用户上次超额检查已超过 quotaCheckInterval（到期时记下本次时间）
+func quotaCheckDue(userID string, now time.Time) bool {
+	quotaChecks.Lock()
+	defer quotaChecks.Unlock()
+	if last, ok := quotaChecks.last[userID]; ok && now.Sub(last) < quotaCheckInterval {
+		return false
+	}
+	quotaChecks.last[userID] = now
+	return true
+}
+
+// QuotaPeriod 配额周期起始日（YYYY-MM-DD，与 traffic_usages.day 同格式，可直接按字符串比较）
+func QuotaPeriod(now time.Time) (dayStart, monthStart string) {
+	return now.Format(quotaDayLayout), now.Format("2006-01") + "-01"
+}
+
+// UserUsage 用户当日 / 当月已用流量（字节）
+func UserUsage(db *gorm.DB, userID string, now time.Time) (daily, monthly int64, err error) {
+	day, month := QuotaPeriod(now)
+	err = db.Model(&model.TrafficUsage{}).
+		Select("COALESCE(SUM(CASE WHEN day = ? THEN bytes ELSE 0 END), 0), COALESCE(SUM(bytes), 0)", day).
+		Where("user_id = ? AND day >= ?", userID, month).
+		Row().Scan(&daily, &monthly)
+	return
+}
+
+// DepartmentUsage 部门（含下级部门）全体成员当日 / 当月已用流量合计（字节）
+func DepartmentUsage(db *gorm.DB, departmentID string, now time.Time) (daily, monthly int64, err error) {
+	ids, err := DepartmentSubtree(db, departmentID)
+	if err != nil {
+		return 0, 0, err
+	}
+	day, month := QuotaPeriod(now)
+	err = db.Model(&model.TrafficUsage{}).
+		Select("COALESCE(SUM(CASE WHEN traffic_usages.day = ? THEN traffic_usages.bytes ELSE 0 END), 0), COALESCE(SUM(traffic_usages.bytes), 0)", day).
+		Joins("JOIN users ON users.id = traffic_usages.user_id").
+		Where("users.department_id IN ? AND traffic_usages.day >= ?", ids, month).
+		Row().Scan(&daily, &monthly)
+	return
+}
+
+// addTraffic 把一段会话新增的字节数记入用户当天的用量，并检查配额。
+func addTraffic(db *gorm.DB, userID string, delta int64) {
+	if userID == "" || delta <= 0 {
+		return
+	}
+	now := time.Now()
+	day, _ := QuotaPeriod(now)
+	row := model.TrafficUsage{UserID: userID, Day: day, Bytes: delta}
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"bytes": gorm.Expr("traffic_usages.bytes + ?", delta)}),
+	}).Create(&row).Error; err != nil {
+		logging.Error("Failed to record traffic for user %s: %v", userID, err)
+		return
+	}
+	if quotaCheckDue(userID, now) {
+		enforceQuota(db, userID, now)
+	}
+}
+
+// quotaViolation 一次超额：DepartmentID 非空表示触发的是该部门（含下级部门合计）的配额
+type quotaViolation struct {
+	DepartmentID string
+	Detail       string
+}
+
+// quotaExceeded 返回用户触发的配额（用户自己，或所在部门及各级上级部门的日/月配额），未超额返回 nil。
+func quotaExceeded(db *gorm.DB, user *model.User, now time.Time) (*quotaViolation, error) {
+	if user.DailyQuotaBytes > 0 || user.MonthlyQuotaBytes > 0 {
+		daily, monthly, err := UserUsage(db, user.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		if user.DailyQuotaBytes > 0 && daily >= user.DailyQuotaBytes {
+			return &quotaViolation{Detail: fmt.Sprintf("user daily quota exceeded: %d/%d bytes", daily, user.DailyQuotaBytes)}, nil
+		}
+		if user.MonthlyQuotaBytes > 0 && monthly >= user.MonthlyQuotaBytes {
+			return &quotaViolation{Detail: fmt.Sprintf("user monthly quota exceeded: %d/%d bytes", monthly, user.MonthlyQuotaBytes)}, nil
+		}
+	}
+	// 部门配额按部门及其下级部门的合计用量计算，上级部门的配额同样约束下级部门的成员
+	deptID := user.DepartmentID
+	seen := map[string]bool{}
+	for i := 0; deptID != "" && !seen[deptID] && i < maxDepartmentDepth; i++ {
+		seen[deptID] = true
+		var dep model.Department
+		if err := db.Select("id", "parent_id", "daily_quota_bytes", "monthly_quota_bytes").First(&dep, "id = ?", deptID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return nil, nil
+			}
+			return nil, err
+		}
+		deptID = dep.ParentID
+		if dep.DailyQuotaBytes == 0 && dep.MonthlyQuotaBytes == 0 {
+			continue
+		}
+		daily, monthly, err := DepartmentUsage(db, dep.ID, now)
+		if err != nil {
+			return nil, err
+		}
+		if dep.DailyQuotaBytes > 0 && daily >= dep.DailyQuotaBytes {
+			return &quotaViolation{DepartmentID: dep.ID, Detail: fmt.Sprintf("department daily quota exceeded: %d/%d bytes", daily, dep.DailyQuotaBytes)}, nil
+		}
+		if dep.MonthlyQuotaBytes > 0 && monthly >= dep.MonthlyQuotaBytes {
+			return &quotaViolation{DepartmentID: dep.ID, Detail: fmt.Sprintf("department monthly quota exceeded: %d/%d bytes", monthly, dep.MonthlyQuotaBytes)}, nil
+		}
+	}
+	return nil, nil
+}
+
+// enforceQuota 用户（或其部门）超额时经 openvpn.PauseClient 拉黑并断开。
+// 部门超额时暂停该部门（含下级部门）所有在线成员——离线成员下次连上产生流量时同样会被拦下。
+func enforceQuota(db *gorm.DB, userID string, now time.Time) {
+	var user model.User
+	if err := db.First(&user, "id = ?", userID).Error; err != nil {
+		return
+	}
+	if user.IsPaused {
+		return
+	}
+	v, err := quotaExceeded(db, &user, now)
+	if err != nil {
+		logging.Error("Failed to check quota for user '%s': %v", user.Name, err)
+		return
+	}
+	if v == nil {
+		return
+	}
+
+	targets := []model.User{user}
+	if v.DepartmentID != "" {
+		ids, err := DepartmentSubtree(db, v.DepartmentID)
+		if err == nil {
+			err = db.Where("department_id IN ? AND is_online = ? AND is_paused = ? AND id <> ?", ids, true, false, user.ID).
+				Find(&targets).Error
+		}
+		if err != nil {
+			logging.Error("Failed to list department members of '%s': %v", user.Name, err)
+		}
+		targets = append(targets, user)
+	}
+	for i := range targets {
+		quotaPause(db, &targets[i], v.Detail)
+	}
+}
+
+func quotaPause(db *gorm.DB, user *model.User, reason string) {
+	if err := pauseVPNClient(user.Name); err != nil {
+		logging.Error("Failed to pause user '%s' over quota: %v", user.Name, err)
+		return
+	}
+	if err := db.Model(user).Updates(map[string]interface{}{"is_paused": true, "quota_paused": true}).Error; err != nil {
+		logging.Error("Failed to mark user '%s' as quota paused: %v", user.Name, err)
+		return
+	}
+	logging.Warn("User '%s' paused: %s", user.Name, reason)
+	n := model.Notification{
+		Type:      model.NotificationTypeQuotaExceeded,
+		UserName:  user.Name,
+		RealIP:    user.RealAddress,
+		VirtualIP: user.VirtualAddress,
+		Detail:    reason,
+	}
+	if err := db.Create(&n).Error; err != nil {
+		logging.Error("Failed to create notification for user '%s' (%s): %v", user.Name, n.Type, err)
+	}
+}
+
+// ResumeQuotaPausedUsers 恢复配额已不再超出的自动暂停用户（周期重置或管理员调高配额后）。
+func ResumeQuotaPausedUsers(db *gorm.DB) {
+	resumeQuotaPausedUsers(db, time.Now())
+}
+
+func resumeQuotaPausedUsers(db *gorm.DB, now time.Time) {
+	var users []model.User
+	if err := db.Where("quota_paused = ?", true).Find(&users).Error; err != nil {
+		logging.Error("Failed to list quota paused users: %v", err)
+		return
+	}
+	for i := range users {
+		u := &users[i]
+		v, err := quotaExceeded(db, u, now)
+		if err != nil {
+			logging.Error("Failed to check quota for user '%s': %v", u.Name, err)
+			continue
+		}
+		if v != nil {
+			continue
+		}
+		if err := resumeVPNClient(u.Name); err != nil {
+			logging.Error("Failed to resume quota paused user '%s': %v", u.Name, err)
+			continue
+		}
+		if err := db.Model(u).Updates(map[string]interface{}{"is_paused": false, "quota_paused": false}).Error; err != nil {
+			logging.Error("Failed to clear quota pause for user '%s': %v", u.Name, err)
+			continue
+		}
+		logging.Info("User '%s' resumed: quota period reset", u.Name)
+	}
+}
+
+// StartQuotaService 定期恢复配额周期已重置的用户，支持 context 取消和 WaitGroup 优雅退出
+func StartQuotaService(ctx context.Context, wg *sync.WaitGroup, db *gorm.DB) {
+	logging.Info("Starting Quota Service with interval %s", quotaResetCheckInterval)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		ticker := time.NewTicker(quotaResetCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				logging.Info("Quota Service stopping...")
+				return
+			case <-ticker.C:
+				ResumeQuotaPausedUsers(db)
+			}
+		}
+	}()
+}
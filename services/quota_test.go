@@ -0,0 +1,178 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+
+	"gorm.io/gorm"
+)
+
+// stubVPNClients 替换暂停 / 恢复 VPN 客户端的调用，返回记录下的用户名
+func stubVPNClients(t *testing.T) (paused, resumed *[]string) {
+	t.Helper()
+	paused, resumed = &[]string{}, &[]string{}
+	oldPause, oldResume := pauseVPNClient, resumeVPNClient
+	pauseVPNClient = func(name string) error { *paused = append(*paused, name); return nil }
+	resumeVPNClient = func(name string) error { *resumed = append(*resumed, name); return nil }
+	t.Cleanup(func() { pauseVPNClient, resumeVPNClient = oldPause, oldResume })
+	return
+}
+
+func addUsage(t *testing.T, db *gorm.DB, userID, day string, bytes int64) {
+	t.Helper()
+	if err := db.Create(&model.TrafficUsage{UserID: userID, Day: day, Bytes: bytes}).Error; err != nil {
+		t.Fatalf("create traffic usage: %v", err)
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+	today, yesterday, lastMonth := "2026-03-15", "2026-03-14", "2026-02-28"
+
+	tests := []struct {
+		name        string
+		userDaily   int64
+		userMonthly int64
+		rootDaily   int64
+		rootMonthly int64
+		usage       map[string]int64 // day -> bytes，记在 alice 名下
+		peerUsage   int64            // 下级部门的 bob 今天的用量
+		want        string           // "" 未超额，"user" 用户配额，"root" 上级部门配额
+	}{
+		{name: "no quota", usage: map[string]int64{today: 1 << 30}},
+		{name: "user daily under", userDaily: 100, usage: map[string]int64{today: 99}},
+		{name: "user daily exceeded", userDaily: 100, usage: map[string]int64{today: 100}, want: "user"},
+		{name: "user daily resets next day", userDaily: 100, usage: map[string]int64{yesterday: 500}},
+		{name: "user monthly exceeded", userMonthly: 100, usage: map[string]int64{yesterday: 60, today: 40}, want: "user"},
+		{name: "user monthly resets next month", userMonthly: 100, usage: map[string]int64{lastMonth: 500, today: 10}},
+		{name: "department counts subtree", rootDaily: 100, usage: map[string]int64{today: 50}, peerUsage: 50, want: "root"},
+		{name: "department under", rootMonthly: 200, usage: map[string]int64{yesterday: 50, today: 50}, peerUsage: 50},
+		{name: "department monthly resets next month", rootMonthly: 100, usage: map[string]int64{lastMonth: 500}, peerUsage: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			root := model.Department{Name: "Engineering", DailyQuotaBytes: tt.rootDaily, MonthlyQuotaBytes: tt.rootMonthly}
+			db.Create(&root)
+			child := model.Department{Name: "Backend", ParentID: root.ID}
+			db.Create(&child)
+			alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", DepartmentID: child.ID,
+				DailyQuotaBytes: tt.userDaily, MonthlyQuotaBytes: tt.userMonthly})
+			bob := createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", DepartmentID: root.ID})
+			for day, bytes := range tt.usage {
+				addUsage(t, db, alice.ID, day, bytes)
+			}
+			if tt.peerUsage > 0 {
+				addUsage(t, db, bob.ID, today, tt.peerUsage)
+			}
+
+			v, err := quotaExceeded(db, alice, now)
+			if err != nil {
+				t.Fatalf("quotaExceeded: %v", err)
+			}
+			got := ""
+			if v != nil {
+				got = "user"
+				if v.DepartmentID == root.ID {
+					got = "root"
+				} else if v.DepartmentID != "" {
+					got = v.DepartmentID
+				}
+			}
+			if got != tt.want {
+				t.Errorf("violation = %q (%+v), want %q", got, v, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnforceQuotaPausesDepartmentSubtree(t *testing.T) {
+	paused, _ := stubVPNClients(t)
+	db := newTestDB(t)
+	now := time.Date(2026, 3, 15, 12, 0, 0, 0, time.Local)
+
+	root := model.Department{Name: "Engineering", DailyQuotaBytes: 100}
+	db.Create(&root)
+	child := model.Department{Name: "Backend", ParentID: root.ID}
+	db.Create(&child)
+	other := model.Department{Name: "Sales"}
+	db.Create(&other)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", DepartmentID: child.ID, IsOnline: true})
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", DepartmentID: root.ID, IsOnline: true})
+	createTestUser(t, db, &model.User{Name: "carol", Email: "carol@example.com", DepartmentID: root.ID})
+	createTestUser(t, db, &model.User{Name: "dave", Email: "dave@example.com", DepartmentID: other.ID, IsOnline: true})
+	addUsage(t, db, alice.ID, "2026-03-15", 100)
+
+	enforceQuota(db, alice.ID, now)
+
+	if len(*paused) != 2 {
+		t.Fatalf("paused = %v, want alice and bob", *paused)
+	}
+	for _, name := range []string{"alice", "bob"} {
+		var u model.User
+		db.First(&u, "name = ?", name)
+		if !u.IsPaused || !u.QuotaPaused {
+			t.Errorf("%s: is_paused=%v quota_paused=%v, want both true", name, u.IsPaused, u.QuotaPaused)
+		}
+	}
+	for _, name := range []string{"carol", "dave"} {
+		var u model.User
+		db.First(&u, "name = ?", name)
+		if u.IsPaused {
+			t.Errorf("%s should not be paused", name)
+		}
+	}
+	var n int64
+	db.Model(&model.Notification{}).Where("type = ?", model.NotificationTypeQuotaExceeded).Count(&n)
+	if n != 2 {
+		t.Errorf("quota notifications = %d, want 2", n)
+	}
+
+	// 已暂停的用户不会重复暂停
+	enforceQuota(db, alice.ID, now)
+	if len(*paused) != 2 {
+		t.Errorf("paused again: %v", *paused)
+	}
+}
+
+func TestResumeQuotaPausedUsersOnRollover(t *testing.T) {
+	_, resumed := stubVPNClients(t)
+	db := newTestDB(t)
+
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com", DailyQuotaBytes: 100, IsPaused: true, QuotaPaused: true})
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", IsPaused: true})
+	addUsage(t, db, alice.ID, "2026-03-15", 100)
+
+	// 同一天仍超额，不恢复
+	resumeQuotaPausedUsers(db, time.Date(2026, 3, 15, 23, 59, 0, 0, time.Local))
+	if len(*resumed) != 0 {
+		t.Fatalf("resumed before rollover: %v", *resumed)
+	}
+
+	// 次日配额重置；管理员手动暂停的 bob 不受影响
+	resumeQuotaPausedUsers(db, time.Date(2026, 3, 16, 0, 0, 0, 0, time.Local))
+	if len(*resumed) != 1 || (*resumed)[0] != "alice" {
+		t.Fatalf("resumed = %v, want [alice]", *resumed)
+	}
+	var u model.User
+	db.First(&u, "id = ?", alice.ID)
+	if u.IsPaused || u.QuotaPaused {
+		t.Errorf("alice: is_paused=%v quota_paused=%v, want both false", u.IsPaused, u.QuotaPaused)
+	}
+}
+
+func TestQuotaCheckDue(t *testing.T) {
+	now := time.Now()
+	id := "quota-check-due"
+	if !quotaCheckDue(id, now) {
+		t.Fatal("first check should be due")
+	}
+	if quotaCheckDue(id, now.Add(quotaCheckInterval/2)) {
+		t.Error("check within the interval should be skipped")
+	}
+	if !quotaCheckDue(id, now.Add(quotaCheckInterval)) {
+		t.Error("check after the interval should be due")
+	}
+}
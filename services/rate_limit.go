@@ -0,0 +1,54 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"openvpn-admin-go/logging"
+
+	"gorm.io/gorm"
+)
+
+// rateLimitCleanupInterval 清理过期限流计数的最小间隔
+const rateLimitCleanupInterval = 10 * time.Minute
+
+// DBRateLimitStore 保存在 rate_limit_buckets 表中的限流计数（实现 middleware.RateLimitStore），
+// 多个 API 副本共享同一份计数，重启后仍然有效
+type DBRateLimitStore struct {
+	db          *gorm.DB
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+// NewDBRateLimitStore 使用数据库保存限流计数
+func NewDBRateLimitStore(db *gorm.DB) *DBRateLimitStore {
+	return &DBRateLimitStore{db: db}
+}
+
+// Hit 原子地累加计数：窗口已过期时从 1 重新开始
+func (s *DBRateLimitStore) Hit(key string, window time.Duration) (int, error) {
+	now := time.Now()
+	s.cleanup(now)
+	var count int
+	err := s.db.Raw(`INSERT INTO rate_limit_buckets (key, count, reset_at) VALUES (?, 1, ?)
+		ON CONFLICT (key) DO UPDATE SET
+			count = CASE WHEN rate_limit_buckets.reset_at <= ? THEN 1 ELSE rate_limit_buckets.count + 1 END,
+			reset_at = CASE WHEN rate_limit_buckets.reset_at <= ? THEN EXCLUDED.reset_at ELSE rate_limit_buckets.reset_at END
+		RETURNING count`,
+		key, now.Add(window), now, now).Scan(&count).Error
+	return count, err
+}
+
+// cleanup 定期删除已过期的计数，避免表无限增长
+func (s *DBRateLimitStore) cleanup(now time.Time) {
+	s.mu.Lock()
+	if now.Sub(s.lastCleanup) < rateLimitCleanupInterval {
+		s.mu.Unlock()
+		return
+	}
+	s.lastCleanup = now
+	s.mu.Unlock()
+	if err := s.db.Exec("DELETE FROM rate_limit_buckets WHERE reset_at < ?", now).Error; err != nil {
+		logging.Warn("Failed to clean up expired rate limit buckets: %v", err)
+	}
+}
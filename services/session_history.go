@@ -0,0 +1,259 @@
+package services
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/constants"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// sessionSnapshot is the latest known state of one VPN session, as seen by the status
+// sync ("status 2" or the status log) or by a session-event.sh record.
+type sessionSnapshot struct {
+	clientID       string // OpenVPN CID; empty when the status source does not report it
+	userID         string
+	userName       string
+	realAddress    string
+	virtualAddress string
+	cipher         string
+	startedAt      time.Time
+	bytesReceived  int64
+	bytesSent      int64
+	duration       int64 // seconds
+}
+
+// findOpenSession looks up the open ClientLog row of the session with s's CID. With
+// duplicate-cn one user can have several sessions online, so the user name alone is not a key.
+func findOpenSession(db *gorm.DB, s sessionSnapshot) (model.ClientLog, error) {
+	var open model.ClientLog
+	err := db.Where("user_name = ? AND client_id = ? AND ended_at IS NULL", s.userName, s.clientID).
+		Order("started_at DESC").First(&open).Error
+	return open, err
+}
+
+// touchSession records s into its open ClientLog row (same CID and start time), opening
+// one if needed. A different start time for the same CID means the CID was reused after
+// an OpenVPN restart: that row is closed and a new one opened.
+// Errors are logged only — history is best-effort and must not break the status sync.
+func touchSession(db *gorm.DB, s sessionSnapshot) {
+	open, err := findOpenSession(db, s)
+	switch {
+	case err == nil && sameStart(open.StartedAt, s.startedAt):
+		prevTraffic := open.TrafficUsage
+		now := time.Now()
+		updates := map[string]interface{}{
+			"bytes_received":       s.bytesReceived,
+			"bytes_sent":           s.bytesSent,
+			"traffic_usage":        s.bytesReceived + s.bytesSent,
+			"online_duration":      s.duration,
+			"last_connection_time": now,
+		}
+		if s.cipher != "" {
+			updates["cipher"] = s.cipher
+		}
+		if s.virtualAddress != "" {
+			updates["virtual_address"] = s.virtualAddress
+		}
+		if err := db.Model(&open).Updates(updates).Error; err != nil {
+			logging.Error("Failed to update session log for user '%s': %v", s.userName, err)
+			return
+		}
+		addTraffic(db, open.UserID, s.bytesReceived+s.bytesSent-prevTraffic)
+		return
+	case err == nil:
+		endSessionRow(db, &open, s.startedAt, nil)
+	case err != gorm.ErrRecordNotFound:
+		logging.Error("Failed to look up open session for user '%s': %v", s.userName, err)
+		return
+	}
+	openSession(db, s)
+}
+
+func openSession(db *gorm.DB, s sessionSnapshot) *model.ClientLog {
+	if s.userID == "" {
+		var user model.User
+		if err := db.Select("id").Where("name = ?", s.userName).First(&user).Error; err == nil {
+			s.userID = user.ID
+		}
+	}
+	startedAt := s.startedAt
+	if startedAt.IsZero() {
+		startedAt = time.Now()
+	}
+	now := time.Now()
+	row := model.ClientLog{
+		ClientID:           s.clientID,
+		UserID:             s.userID,
+		UserName:           s.userName,
+		IsOnline:           true,
+		RealAddress:        s.realAddress,
+		VirtualAddress:     s.virtualAddress,
+		Cipher:             s.cipher,
+		BytesReceived:      s.bytesReceived,
+		BytesSent:          s.bytesSent,
+		TrafficUsage:       s.bytesReceived + s.bytesSent,
+		OnlineDuration:     s.duration,
+		StartedAt:          &startedAt,
+		LastConnectionTime: &now,
+	}
+	if err := db.Create(&row).Error; err != nil {
+		logging.Error("Failed to open session log for user '%s': %v", s.userName, err)
+		return nil
+	}
+	// 首次看到会话时计数器可能已有累计值（轮询间隔内产生的流量），一并计入配额
+	addTraffic(db, row.UserID, row.TrafficUsage)
+	return &row
+}
+
+// closeUserSessions closes every open ClientLog row of a user who is no longer online.
+func closeUserSessions(db *gorm.DB, userName string, endedAt time.Time) {
+	var open []model.ClientLog
+	if err := db.Where("user_name = ? AND ended_at IS NULL", userName).Find(&open).Error; err != nil {
+		logging.Error("Failed to look up open sessions for user '%s': %v", userName, err)
+		return
+	}
+	for i := range open {
+		endSessionRow(db, &open[i], endedAt, nil)
+	}
+}
+
+// closeEndedSessions closes the open ClientLog rows of still-online users that match
+// none of the live sessions: the session ended unnoticed between two syncs (a reconnect,
+// or one of several duplicate-cn sessions dropping). The row's last-seen time is the
+// best known end time.
+func closeEndedSessions(db *gorm.DB, live []sessionSnapshot) {
+	if len(live) == 0 {
+		return
+	}
+	names := make([]string, 0, len(live))
+	for _, s := range live {
+		names = append(names, s.userName)
+	}
+	var open []model.ClientLog
+	if err := db.Where("user_name IN ? AND ended_at IS NULL", names).Find(&open).Error; err != nil {
+		logging.Error("Failed to look up open sessions: %v", err)
+		return
+	}
+	for i := range open {
+		row := &open[i]
+		if sessionLive(row, live) {
+			continue
+		}
+		endedAt := time.Now()
+		if row.LastConnectionTime != nil {
+			endedAt = *row.LastConnectionTime
+		}
+		endSessionRow(db, row, endedAt, nil)
+	}
+}
+
+func sessionLive(row *model.ClientLog, live []sessionSnapshot) bool {
+	for _, s := range live {
+		if s.userName == row.UserName && s.clientID == row.ClientID && sameStart(row.StartedAt, s.startedAt) {
+			return true
+		}
+	}
+	return false
+}
+
+func endSessionRow(db *gorm.DB, row *model.ClientLog, endedAt time.Time, final *sessionSnapshot) {
+	prevTraffic := row.TrafficUsage
+	updates := map[string]interface{}{
+		"is_online": false,
+		"ended_at":  endedAt,
+	}
+	if final != nil {
+		updates["bytes_received"] = final.bytesReceived
+		updates["bytes_sent"] = final.bytesSent
+		updates["traffic_usage"] = final.bytesReceived + final.bytesSent
+		if final.duration > 0 {
+			updates["online_duration"] = final.duration
+		}
+	} else if row.StartedAt != nil {
+		updates["online_duration"] = int64(endedAt.Sub(*row.StartedAt).Seconds())
+	}
+	if err := db.Model(row).Updates(updates).Error; err != nil {
+		logging.Error("Failed to close session log for user '%s': %v", row.UserName, err)
+		return
+	}
+	if final != nil {
+		addTraffic(db, row.UserID, final.bytesReceived+final.bytesSent-prevTraffic)
+	}
+}
+
+var (
+	sessionLogMu     sync.Mutex
+	sessionLogOffset int64
+)
+
+// recordSessionEvents 读取 session-event.sh 新记下的会话事件：连接事件更新证书最近使用时间
+// （状态同步里没有证书序列号，CA 轮换的"已用新证书连接"靠它统计）；断开事件用其中的最终
+// 流量与时长关闭（或补记）对应的会话记录，两次状态同步之间开始又结束的会话只能从这里入库。
+func recordSessionEvents(db *gorm.DB) {
+	sessionLogMu.Lock()
+	defer sessionLogMu.Unlock()
+	events, offset, err := openvpn.ReadSessionLog(constants.ServerSessionLogPath, sessionLogOffset)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logging.Warn("Failed to read session event log: %v", err)
+		}
+		return
+	}
+	sessionLogOffset = offset
+	for _, e := range events {
+		switch e.Type {
+		case openvpn.SessionEventConnect:
+			markCertificateSeen(db, e.Serial, e.ConnectedSince)
+		case openvpn.SessionEventDisconnect:
+			recordSessionEnd(db, e)
+		}
+	}
+}
+
+// recordSessionEnd applies a client-disconnect event. The script environment has no CID,
+// so the session is matched by user name and start time (time_unix equals the status
+// Connected Since). A row the status sync already closed gets the authoritative counters
+// and end time; a session the sync never saw is recorded as a complete row.
+func recordSessionEnd(db *gorm.DB, e openvpn.SessionEvent) {
+	final := sessionSnapshot{
+		userName:       e.CommonName,
+		realAddress:    e.RealAddress,
+		virtualAddress: e.VirtualAddress,
+		startedAt:      e.ConnectedSince,
+		bytesReceived:  e.BytesReceived,
+		bytesSent:      e.BytesSent,
+		duration:       e.Duration,
+	}
+	endedAt := e.ConnectedSince.Add(time.Duration(e.Duration) * time.Second)
+
+	// 只比较最近的几条：同一开始时间的会话不会排在更早的位置
+	var recent []model.ClientLog
+	if err := db.Where("user_name = ?", e.CommonName).Order("started_at DESC").Limit(20).Find(&recent).Error; err != nil {
+		logging.Error("Failed to look up sessions for user '%s': %v", e.CommonName, err)
+		return
+	}
+	for i := range recent {
+		if recent[i].StartedAt != nil && sameStart(recent[i].StartedAt, e.ConnectedSince) {
+			endSessionRow(db, &recent[i], endedAt, &final)
+			return
+		}
+	}
+	if row := openSession(db, final); row != nil {
+		endSessionRow(db, row, endedAt, &final)
+	}
+}
+
+// sameStart compares session start times at second precision (status log and
+// management ENV only carry whole seconds).
+func sameStart(a *time.Time, b time.Time) bool {
+	if a == nil || b.IsZero() {
+		return a == nil || b.IsZero()
+	}
+	return a.Unix() == b.Unix()
+}
@@ -0,0 +1,157 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+func openSessionRows(t *testing.T, db *gorm.DB, userName string) []model.ClientLog {
+	t.Helper()
+	var rows []model.ClientLog
+	if err := db.Where("user_name = ? AND ended_at IS NULL", userName).Order("client_id").Find(&rows).Error; err != nil {
+		t.Fatalf("list open sessions: %v", err)
+	}
+	return rows
+}
+
+func TestSessionHistoryDuplicateCN(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// 同一用户的两个会话（duplicate-cn）各占一行
+	s1 := sessionSnapshot{clientID: "1", userID: alice.ID, userName: "alice", startedAt: start, bytesReceived: 100, bytesSent: 50}
+	s2 := sessionSnapshot{clientID: "2", userID: alice.ID, userName: "alice", startedAt: start.Add(time.Minute), bytesReceived: 10}
+	touchSession(db, s1)
+	touchSession(db, s2)
+	rows := openSessionRows(t, db, "alice")
+	if len(rows) != 2 || rows[0].ClientID != "1" || rows[1].ClientID != "2" {
+		t.Fatalf("open sessions = %+v, want CIDs 1 and 2", rows)
+	}
+
+	// 更新只落到同 CID 的行，并把增量计入流量
+	s1.bytesReceived, s1.bytesSent = 300, 150
+	touchSession(db, s1)
+	rows = openSessionRows(t, db, "alice")
+	if len(rows) != 2 || rows[0].TrafficUsage != 450 || rows[1].TrafficUsage != 10 {
+		t.Fatalf("after touch = %+v, want traffic 450 and 10", rows)
+	}
+	daily, _, _ := UserUsage(db, alice.ID, time.Now())
+	if daily != 460 {
+		t.Errorf("daily usage = %d, want 460", daily)
+	}
+
+	// CID 1 的 client-disconnect 事件不影响 CID 2
+	recordSessionEnd(db, openvpn.SessionEvent{
+		Type: openvpn.SessionEventDisconnect, CommonName: "alice", ConnectedSince: start,
+		BytesReceived: 400, BytesSent: 200, Duration: 3600,
+	})
+	rows = openSessionRows(t, db, "alice")
+	if len(rows) != 1 || rows[0].ClientID != "2" {
+		t.Fatalf("open sessions after close = %+v, want only CID 2", rows)
+	}
+	var closed model.ClientLog
+	db.First(&closed, "client_id = ?", "1")
+	if closed.EndedAt == nil || closed.TrafficUsage != 600 || closed.OnlineDuration != 3600 {
+		t.Errorf("closed session = %+v, want ended with traffic 600 and duration 3600", closed)
+	}
+
+	closeUserSessions(db, "alice", time.Now())
+	if rows := openSessionRows(t, db, "alice"); len(rows) != 0 {
+		t.Errorf("open sessions after user disconnect = %+v", rows)
+	}
+}
+
+func TestTouchSessionReusedCID(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	touchSession(db, sessionSnapshot{clientID: "0", userID: alice.ID, userName: "alice", startedAt: start})
+	// OpenVPN 重启后 CID 从 0 重新编号：同 CID 不同连接时间是新会话
+	restart := start.Add(30 * time.Minute)
+	touchSession(db, sessionSnapshot{clientID: "0", userID: alice.ID, userName: "alice", startedAt: restart})
+
+	rows := openSessionRows(t, db, "alice")
+	if len(rows) != 1 || rows[0].StartedAt.Unix() != restart.Unix() {
+		t.Fatalf("open sessions = %+v, want only the one started at %v", rows, restart)
+	}
+	var old model.ClientLog
+	db.Where("ended_at IS NOT NULL").First(&old)
+	if old.EndedAt == nil || old.EndedAt.Unix() != restart.Unix() {
+		t.Errorf("previous session ended at %v, want %v", old.EndedAt, restart)
+	}
+}
+
+func TestCloseEndedSessions(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	s1 := sessionSnapshot{clientID: "1", userID: alice.ID, userName: "alice", startedAt: start}
+	s2 := sessionSnapshot{clientID: "2", userID: alice.ID, userName: "alice", startedAt: start}
+	touchSession(db, s1)
+	touchSession(db, s2)
+	lastSeen := start.Add(10 * time.Minute)
+	db.Model(&model.ClientLog{}).Where("client_id = ?", "1").Update("last_connection_time", lastSeen)
+
+	// 两次同步之间 CID 1 断开，只剩 CID 2
+	closeEndedSessions(db, []sessionSnapshot{s2})
+	rows := openSessionRows(t, db, "alice")
+	if len(rows) != 1 || rows[0].ClientID != "2" {
+		t.Fatalf("open sessions = %+v, want only CID 2", rows)
+	}
+	var ended model.ClientLog
+	db.First(&ended, "client_id = ?", "1")
+	if ended.EndedAt == nil || ended.EndedAt.Unix() != lastSeen.Unix() {
+		t.Errorf("CID 1 ended at %v, want last seen %v", ended.EndedAt, lastSeen)
+	}
+}
+
+func TestRecordSessionEnd(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	// 两次同步之间开始又结束的会话：同步从未见过，按事件补一条完整记录
+	recordSessionEnd(db, openvpn.SessionEvent{
+		Type: openvpn.SessionEventDisconnect, CommonName: "alice", ConnectedSince: start,
+		Duration: 600, BytesReceived: 100, BytesSent: 20, VirtualAddress: "10.8.0.6", RealAddress: "203.0.113.5:41000",
+	})
+	var short model.ClientLog
+	if err := db.Where("user_name = ?", "alice").First(&short).Error; err != nil {
+		t.Fatalf("short session not recorded: %v", err)
+	}
+	if short.UserID != alice.ID || short.IsOnline || short.TrafficUsage != 120 || short.OnlineDuration != 600 ||
+		short.StartedAt == nil || short.StartedAt.Unix() != start.Unix() ||
+		short.EndedAt == nil || short.EndedAt.Unix() != start.Add(10*time.Minute).Unix() ||
+		short.VirtualAddress != "10.8.0.6" || short.RealAddress != "203.0.113.5:41000" {
+		t.Errorf("short session = %+v", short)
+	}
+
+	// 同步已按最后看到的时间关掉的会话：用事件里的最终流量与时长修正
+	later := start.Add(20 * time.Minute)
+	touchSession(db, sessionSnapshot{clientID: "3", userID: alice.ID, userName: "alice", startedAt: later, bytesReceived: 50})
+	closeUserSessions(db, "alice", later.Add(time.Minute))
+	recordSessionEnd(db, openvpn.SessionEvent{
+		Type: openvpn.SessionEventDisconnect, CommonName: "alice", ConnectedSince: later,
+		Duration: 90, BytesReceived: 500, BytesSent: 100,
+	})
+	var rows []model.ClientLog
+	db.Where("user_name = ?", "alice").Order("started_at").Find(&rows)
+	if len(rows) != 2 {
+		t.Fatalf("rows = %+v, want two", rows)
+	}
+	if r := rows[1]; r.ClientID != "3" || r.TrafficUsage != 600 || r.OnlineDuration != 90 || r.EndedAt.Unix() != later.Add(90*time.Second).Unix() {
+		t.Errorf("corrected session = %+v", r)
+	}
+	daily, _, _ := UserUsage(db, alice.ID, time.Now())
+	if daily != 720 {
+		t.Errorf("daily usage = %d, want 720", daily)
+	}
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/logging"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/sso"
+
+	"gorm.io/gorm"
+)
+
+// ErrSSONoAccount 身份没有对应的账号，且未开启自动开通
+var ErrSSONoAccount = errors.New("no account matches this identity")
+
+// ErrSSOLinkRefused 已有同邮箱的账号，但不满足自动关联的条件
+var ErrSSOLinkRefused = errors.New("an account with this email already exists and cannot be linked automatically, ask an administrator")
+
+// unsafeUsernameChars 证书 / 文件名不能使用的字符
+var unsafeUsernameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// ssoUsername 由身份推导用户名：优先 username 声明，其次邮箱 @ 前的部分，只保留证书名安全字符
+func ssoUsername(id *sso.Identity) string {
+	for _, name := range []string{id.Username, id.Email} {
+		if at := strings.Index(name, "@"); at >= 0 {
+			name = name[:at]
+		}
+		name = strings.Trim(unsafeUsernameChars.ReplaceAllString(name, "-"), "-.")
+		if len(name) > 64 {
+			name = name[:64]
+		}
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// ResolveSSOUser 找到 OIDC 身份对应的账号：先按 subject 找此前经 OIDC 开通或关联的账号，
+// 再按邮箱关联已有账号。都没有时按配置自动开通为待审批用户。
+func ResolveSSOUser(db *gorm.DB, cfg *sso.Config, id *sso.Identity) (*model.User, error) {
+	var user model.User
+	err := db.Where("auth_source = ? AND external_id = ?", model.AuthSourceOIDC, id.Subject).First(&user).Error
+	if err == nil {
+		return &user, nil
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	err = db.Where("LOWER(email) = LOWER(?)", id.Email).First(&user).Error
+	if err == nil {
+		return linkSSOUser(db, cfg, id, &user)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	if !cfg.AutoProvision {
+		return nil, ErrSSONoAccount
+	}
+	return provisionSSOUser(db, cfg, id)
+}
+
+// ssoLinkable 按邮箱自动关联的条件：身份提供方与本系统都验证过这个邮箱，且账号是本地账号
+// （LDAP 账号、已关联其他 subject 的账号不能被接管）。允许未验证邮箱时一律不关联，
+// 否则任何人在身份提供方填上别人的邮箱就能登录别人的账号。
+func ssoLinkable(cfg *sso.Config, id *sso.Identity, user *model.User) bool {
+	return !cfg.AllowUnverifiedEmail && id.EmailVerified && user.EmailVerified &&
+		user.AuthSource == model.AuthSourceLocal && user.ExternalID == ""
+}
+
+// linkSSOUser 把本地账号关联到 OIDC subject：之后按 subject 识别，只能经身份提供方登录
+func linkSSOUser(db *gorm.DB, cfg *sso.Config, id *sso.Identity, user *model.User) (*model.User, error) {
+	if !ssoLinkable(cfg, id, user) {
+		logging.Warn("SSO identity %s matches account '%s' by email, but it cannot be linked automatically", id.Subject, user.Name)
+		return nil, ErrSSOLinkRefused
+	}
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"auth_source": model.AuthSourceOIDC,
+		"external_id": id.Subject,
+	}).Error; err != nil {
+		return nil, fmt.Errorf("link SSO identity to %s: %w", user.Name, err)
+	}
+	logging.Info("SSO identity %s linked to account '%s'", id.Subject, user.Name)
+	return user, nil
+}
+
+// provisionSSOUser 自动开通：待审批，部门按组映射；用户名被占用时追加序号。
+// 证书在管理员批准后签发，与自助注册一致。
+func provisionSSOUser(db *gorm.DB, cfg *sso.Config, id *sso.Identity) (*model.User, error) {
+	base := ssoUsername(id)
+	if base == "" {
+		return nil, fmt.Errorf("cannot derive a username from identity %s", id.Subject)
+	}
+	name := base
+	for i := 2; ; i++ {
+		var n int64
+		if err := db.Model(&model.User{}).Where("name = ?", name).Count(&n).Error; err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			break
+		}
+		if i > 99 {
+			return nil, fmt.Errorf("no free username for %q", base)
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	deptID, err := ensureDepartment(db, cfg.Department(id.Groups))
+	if err != nil {
+		return nil, err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	hash, err := common.HashPassword(hex.EncodeToString(raw))
+	if err != nil {
+		return nil, err
+	}
+	user := model.User{
+		Name:           name,
+		Email:          id.Email,
+		EmailVerified:  id.EmailVerified,
+		PasswordHash:   hash,
+		Role:           model.RoleUser,
+		DepartmentID:   deptID,
+		ApprovalStatus: model.ApprovalPending,
+		AuthSource:     model.AuthSourceOIDC,
+		ExternalID:     id.Subject,
+	}
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("creator_id", user.ID).Error
+	}); err != nil {
+		return nil, fmt.Errorf("provision SSO user %s: %w", name, err)
+	}
+	logging.Info("SSO user '%s' provisioned (pending approval)", user.Name)
+	return &user, nil
+}
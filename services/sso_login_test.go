@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/sso"
+)
+
+func TestSSOUsername(t *testing.T) {
+	cases := []struct {
+		id   sso.Identity
+		want string
+	}{
+		{sso.Identity{Username: "alice", Email: "a@corp.example"}, "alice"},
+		{sso.Identity{Username: "bob@corp.example"}, "bob"},
+		{sso.Identity{Email: "carol.smith@corp.example"}, "carol.smith"},
+		{sso.Identity{Username: "Dave O'Brien"}, "Dave-O-Brien"},
+		{sso.Identity{Username: "../etc"}, "etc"},
+		{sso.Identity{Username: "张三", Email: "zhang.san@corp.example"}, "zhang.san"},
+		{sso.Identity{Username: "张三"}, ""},
+	}
+	for _, c := range cases {
+		if got := ssoUsername(&c.id); got != c.want {
+			t.Errorf("ssoUsername(%+v) = %q, want %q", c.id, got, c.want)
+		}
+	}
+}
+
+func TestSSOLinkable(t *testing.T) {
+	verified := &sso.Identity{Subject: "sub-1", Email: "alice@corp.example", EmailVerified: true}
+	unverified := &sso.Identity{Subject: "sub-1", Email: "alice@corp.example"}
+	local := model.User{AuthSource: model.AuthSourceLocal, EmailVerified: true}
+	cases := []struct {
+		name string
+		cfg  sso.Config
+		id   *sso.Identity
+		user model.User
+		want bool
+	}{
+		{"verified local account", sso.Config{}, verified, local, true},
+		{"identity email not verified", sso.Config{}, unverified, local, false},
+		{"allow_unverified_email never links", sso.Config{AllowUnverifiedEmail: true}, verified, local, false},
+		{"local email not verified", sso.Config{}, verified, model.User{AuthSource: model.AuthSourceLocal}, false},
+		{"LDAP account", sso.Config{}, verified, model.User{AuthSource: model.AuthSourceLDAP, EmailVerified: true, ExternalID: "cn=alice"}, false},
+		{"already linked to another subject", sso.Config{}, verified, model.User{AuthSource: model.AuthSourceOIDC, EmailVerified: true, ExternalID: "sub-2"}, false},
+	}
+	for _, c := range cases {
+		if got := ssoLinkable(&c.cfg, c.id, &c.user); got != c.want {
+			t.Errorf("%s: ssoLinkable = %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestResolveSSOUserLinksBySubject(t *testing.T) {
+	db := newTestDB(t)
+	cfg := &sso.Config{}
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "Alice@corp.example", EmailVerified: true, AuthSource: model.AuthSourceLocal})
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@corp.example", AuthSource: model.AuthSourceLocal})
+
+	id := &sso.Identity{Subject: "sub-alice", Email: "alice@corp.example", EmailVerified: true}
+	user, err := ResolveSSOUser(db, cfg, id)
+	if err != nil || user.ID != alice.ID {
+		t.Fatalf("first login = %+v, %v", user, err)
+	}
+	var stored model.User
+	db.First(&stored, "id = ?", alice.ID)
+	if stored.AuthSource != model.AuthSourceOIDC || stored.ExternalID != "sub-alice" {
+		t.Errorf("link not saved: auth_source %q external_id %q", stored.AuthSource, stored.ExternalID)
+	}
+	// 之后按 subject 识别，邮箱变了也是同一个账号
+	if user, err := ResolveSSOUser(db, cfg, &sso.Identity{Subject: "sub-alice", Email: "alice@new.example", EmailVerified: true}); err != nil || user.ID != alice.ID {
+		t.Errorf("login by subject = %+v, %v", user, err)
+	}
+	// 另一个 subject 拿同一个邮箱不能接管
+	if _, err := ResolveSSOUser(db, cfg, &sso.Identity{Subject: "sub-mallory", Email: "alice@corp.example", EmailVerified: true}); !errors.Is(err, ErrSSOLinkRefused) {
+		t.Errorf("other subject with alice's email: err = %v, want ErrSSOLinkRefused", err)
+	}
+	// 本地邮箱未验证的账号不自动关联
+	if _, err := ResolveSSOUser(db, cfg, &sso.Identity{Subject: "sub-bob", Email: "bob@corp.example", EmailVerified: true}); !errors.Is(err, ErrSSOLinkRefused) {
+		t.Errorf("unverified local account: err = %v, want ErrSSOLinkRefused", err)
+	}
+}
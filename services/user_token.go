@@ -0,0 +1,118 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"openvpn-admin-go/mailer"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/utils"
+
+	"gorm.io/gorm"
+)
+
+// 邮件链接令牌的有效期
+const (
+	VerifyEmailTokenTTL   = 24 * time.Hour
+	ResetPasswordTokenTTL = time.Hour
+)
+
+// ErrUserTokenInvalid 令牌不存在、已使用、已过期或用途不符
+var ErrUserTokenInvalid = errors.New("invalid or expired token")
+
+// hashUserToken 令牌的存储形式。令牌本身有 256 位随机熵，SHA-256 即可。
+func hashUserToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueUserToken 为用户签发一次性令牌，返回明文（只出现在邮件里）。
+// 同一用途尚未使用的旧令牌与该用户已过期的令牌一并删除，邮箱里只有最新一封邮件的链接有效。
+func IssueUserToken(db *gorm.DB, user *model.User, purpose model.UserTokenPurpose, ttl time.Duration) (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	now := time.Now()
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND ((purpose = ? AND used_at IS NULL) OR expires_at < ?)", user.ID, purpose, now).
+			Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&model.UserToken{
+			UserID:    user.ID,
+			Purpose:   purpose,
+			TokenHash: hashUserToken(token),
+			Email:     user.Email,
+			ExpiresAt: now.Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ConsumeUserToken 校验并作废令牌（条件更新，并发请求中只有一个能成功），返回令牌记录。
+// 需要和后续修改放在同一事务里时传入 tx。
+func ConsumeUserToken(db *gorm.DB, token string, purpose model.UserTokenPurpose) (*model.UserToken, error) {
+	if token == "" {
+		return nil, ErrUserTokenInvalid
+	}
+	var row model.UserToken
+	if err := db.Where("token_hash = ? AND purpose = ?", hashUserToken(token), purpose).First(&row).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserTokenInvalid
+		}
+		return nil, err
+	}
+	now := time.Now()
+	res := db.Model(&model.UserToken{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", row.ID, now).
+		Update("used_at", now)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 0 {
+		return nil, ErrUserTokenInvalid
+	}
+	row.UsedAt = &now
+	return &row, nil
+}
+
+// SendVerificationEmail 签发邮箱验证令牌并发送验证邮件
+func SendVerificationEmail(db *gorm.DB, user *model.User, lang string) error {
+	return sendTokenEmail(db, user, lang, model.UserTokenVerifyEmail, VerifyEmailTokenTTL,
+		mailer.TemplateVerifyEmail, "/auth/verifyemail/verify")
+}
+
+// SendPasswordResetEmail 签发重置密码令牌并发送重置邮件
+func SendPasswordResetEmail(db *gorm.DB, user *model.User, lang string) error {
+	return sendTokenEmail(db, user, lang, model.UserTokenResetPassword, ResetPasswordTokenTTL,
+		mailer.TemplateResetPassword, "/auth/resetpassword/reset")
+}
+
+// sendTokenEmail 签发令牌，按语言渲染模板，链接指向 Web 控制台对应页面（?code=<令牌>）
+func sendTokenEmail(db *gorm.DB, user *model.User, lang string, purpose model.UserTokenPurpose, ttl time.Duration, tmpl, page string) error {
+	token, err := IssueUserToken(db, user, purpose, ttl)
+	if err != nil {
+		return fmt.Errorf("issue token: %w", err)
+	}
+	subject, body, err := mailer.Render(lang, tmpl, map[string]interface{}{
+		"AppName": utils.GetAppName(),
+		"Name":    user.Name,
+		"Link":    utils.GetAppBaseURL() + page + "?code=" + url.QueryEscape(token),
+		"Hours":   int(ttl / time.Hour),
+	})
+	if err != nil {
+		return err
+	}
+	return mailer.Send(mailer.Message{To: user.Email, Subject: subject, Body: body})
+}
@@ -0,0 +1,44 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"openvpn-admin-go/model"
+)
+
+func TestConsumeUserToken(t *testing.T) {
+	db := newTestDB(t)
+	alice := createTestUser(t, db, &model.User{Name: "alice", Email: "alice@example.com"})
+
+	first, err := IssueUserToken(db, alice, model.UserTokenMFAChallenge, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := IssueUserToken(db, alice, model.UserTokenMFAChallenge, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 新令牌作废同一用途下之前未使用的令牌
+	if _, err := ConsumeUserToken(db, first, model.UserTokenMFAChallenge); err != ErrUserTokenInvalid {
+		t.Errorf("superseded token: err = %v, want ErrUserTokenInvalid", err)
+	}
+	// 用途不符
+	if _, err := ConsumeUserToken(db, second, model.UserTokenResetPassword); err != ErrUserTokenInvalid {
+		t.Errorf("wrong purpose: err = %v, want ErrUserTokenInvalid", err)
+	}
+	row, err := ConsumeUserToken(db, second, model.UserTokenMFAChallenge)
+	if err != nil || row.UserID != alice.ID {
+		t.Fatalf("ConsumeUserToken = %+v, %v", row, err)
+	}
+	// 只能用一次
+	if _, err := ConsumeUserToken(db, second, model.UserTokenMFAChallenge); err != ErrUserTokenInvalid {
+		t.Errorf("replayed token: err = %v, want ErrUserTokenInvalid", err)
+	}
+
+	expired, _ := IssueUserToken(db, alice, model.UserTokenVerifyEmail, -time.Second)
+	if _, err := ConsumeUserToken(db, expired, model.UserTokenVerifyEmail); err != ErrUserTokenInvalid {
+		t.Errorf("expired token: err = %v, want ErrUserTokenInvalid", err)
+	}
+}
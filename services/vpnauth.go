@@ -0,0 +1,127 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+
+	"gorm.io/gorm"
+)
+
+// otpLength VPN 密码框末尾动态口令的位数（与 TOTP 位数一致）
+const otpLength = 6
+
+// VPN 二次验证失败的原因（vpn-auth 子命令写入 OpenVPN 日志）
+var (
+	ErrVPNUserNotFound     = errors.New("no user matches the certificate common name")
+	ErrVPNUsernameMismatch = errors.New("username does not match the certificate common name")
+	ErrVPNUserDisabled     = errors.New("user is not approved")
+	ErrVPNMFANotEnrolled   = errors.New("user has not enrolled an authenticator")
+	ErrVPNPasswordInvalid  = errors.New("invalid password")
+	ErrVPNOTPInvalid       = errors.New("invalid or reused one-time code")
+)
+
+// RequiresVPNOTP 用户所在部门或任一上级部门开启了 vpn_otp_required
+func RequiresVPNOTP(db *gorm.DB, user *model.User) bool {
+	deptID := user.DepartmentID
+	for i := 0; deptID != "" && i < maxDepartmentDepth; i++ {
+		var dep model.Department
+		if err := db.Select("id", "parent_id", "vpn_otp_required").First(&dep, "id = ?", deptID).Error; err != nil {
+			break
+		}
+		if dep.VPNOTPRequired {
+			return true
+		}
+		deptID = dep.ParentID
+	}
+	return false
+}
+
+// RequiresVPNOTPByName 按用户名判断（渲染 .ovpn 时使用）；用户不存在时返回 false
+func RequiresVPNOTPByName(db *gorm.DB, username string) bool {
+	var user model.User
+	if err := db.Select("id", "department_id").First(&user, "name = ?", username).Error; err != nil {
+		return false
+	}
+	return RequiresVPNOTP(db, &user)
+}
+
+// splitVPNPassword 按二次验证方式拆分密码框内容：otp 模式整体即动态口令，
+// password+otp 模式末尾 6 位为动态口令、其余为登录密码
+func splitVPNPassword(mode openvpn.VPNAuthMode, input string) (password, otp string) {
+	if mode != openvpn.VPNAuthPasswordOTP {
+		return "", input
+	}
+	if len(input) <= otpLength {
+		return "", input
+	}
+	return input[:len(input)-otpLength], input[len(input)-otpLength:]
+}
+
+// VerifyVPNLogin 校验一次 VPN 连接的用户名/密码（auth-user-pass-verify）。
+//
+// commonName 为已通过 TLS 校验的证书 CN，用户以它为准：未开启部门开关的用户直接放行；
+// 开启的用户必须提交与 CN 相同的用户名，并给出有效的动态口令（password+otp 模式还要校验登录密码）。
+// 动态口令与 Web 登录共用 mfa_last_step，同一个码只能使用一次。
+func VerifyVPNLogin(db *gorm.DB, mode openvpn.VPNAuthMode, commonName, username, input string, now time.Time) error {
+	var user model.User
+	if err := db.First(&user, "name = ?", commonName).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrVPNUserNotFound
+		}
+		return fmt.Errorf("query user: %w", err)
+	}
+	if mode == openvpn.VPNAuthOff || !RequiresVPNOTP(db, &user) {
+		return nil
+	}
+	if username != commonName {
+		return ErrVPNUsernameMismatch
+	}
+	if user.ApprovalStatus != model.ApprovalApproved {
+		return ErrVPNUserDisabled
+	}
+	if !user.MFAEnabled || user.MFASecret == "" {
+		return ErrVPNMFANotEnrolled
+	}
+
+	password, otp := splitVPNPassword(mode, input)
+	if mode == openvpn.VPNAuthPasswordOTP && !common.CheckPasswordHash(password, user.PasswordHash) {
+		return ErrVPNPasswordInvalid
+	}
+	step, ok := common.ValidateTOTP(user.MFASecret, otp, now, user.MFALastStep)
+	if !ok {
+		return ErrVPNOTPInvalid
+	}
+	res := db.Model(&model.User{}).
+		Where("id = ? AND mfa_last_step < ?", user.ID, step).
+		Update("mfa_last_step", step)
+	if res.Error != nil {
+		return fmt.Errorf("record otp step: %w", res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return ErrVPNOTPInvalid
+	}
+	return nil
+}
+
+// RefreshVPNOTPProfiles 部门的动态口令开关变化后，重新渲染该部门及全部下级部门成员的 .ovpn
+func RefreshVPNOTPProfiles(db *gorm.DB, deptID string) error {
+	ids, err := DepartmentSubtree(db, deptID)
+	if err != nil {
+		return err
+	}
+	var names []string
+	if err := db.Model(&model.User{}).Where("department_id IN ?", ids).Pluck("name", &names).Error; err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := openvpn.RegenerateClientConfig(name); err != nil {
+			return fmt.Errorf("regenerate profile for %s: %w", name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+package services
+
+import (
+	"encoding/base32"
+	"errors"
+	"testing"
+	"time"
+
+	"openvpn-admin-go/common"
+	"openvpn-admin-go/model"
+	"openvpn-admin-go/openvpn"
+)
+
+func TestSplitVPNPassword(t *testing.T) {
+	cases := []struct {
+		mode     openvpn.VPNAuthMode
+		input    string
+		password string
+		otp      string
+	}{
+		{openvpn.VPNAuthOTP, "123456", "", "123456"},
+		{openvpn.VPNAuthOTP, "secret123456", "", "secret123456"},
+		{openvpn.VPNAuthPasswordOTP, "secret123456", "secret", "123456"},
+		{openvpn.VPNAuthPasswordOTP, "p@ss 654321", "p@ss ", "654321"},
+		// 只有口令没有密码：密码为空，bcrypt 校验必然失败
+		{openvpn.VPNAuthPasswordOTP, "123456", "", "123456"},
+	}
+	for _, c := range cases {
+		password, otp := splitVPNPassword(c.mode, c.input)
+		if password != c.password || otp != c.otp {
+			t.Errorf("splitVPNPassword(%s, %q) = %q, %q; want %q, %q", c.mode, c.input, password, otp, c.password, c.otp)
+		}
+	}
+}
+
+func TestVerifyVPNLogin(t *testing.T) {
+	db := newTestDB(t)
+	// RFC 6238 附录 B 的 SHA1 密钥：1111111109 时刻的验证码为 081804
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	const code = "081804"
+	hash, err := common.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// BeforeCreate 会生成新的 ID，按创建顺序取回
+	createDept := func(d model.Department) string {
+		if err := db.Create(&d).Error; err != nil {
+			t.Fatal(err)
+		}
+		return d.ID
+	}
+	otp := createDept(model.Department{Name: "Finance", VPNOTPRequired: true})
+	child := createDept(model.Department{Name: "Payroll", ParentID: otp})
+	plain := createDept(model.Department{Name: "Sales"})
+	enrolled := func(name, dept string) *model.User {
+		return createTestUser(t, db, &model.User{
+			Name: name, Email: name + "@example.com", DepartmentID: dept, PasswordHash: hash,
+			MFAEnabled: true, MFASecret: secret,
+		})
+	}
+	enrolled("alice", otp)
+	enrolled("carol", child)
+	enrolled("dave", plain)
+	enrolled("erin", otp)
+	createTestUser(t, db, &model.User{Name: "bob", Email: "bob@example.com", DepartmentID: otp, ApprovalStatus: model.ApprovalPending, MFAEnabled: true, MFASecret: secret})
+	createTestUser(t, db, &model.User{Name: "frank", Email: "frank@example.com", DepartmentID: otp})
+
+	cases := []struct {
+		name       string
+		mode       openvpn.VPNAuthMode
+		commonName string
+		username   string
+		input      string
+		want       error
+	}{
+		{"unknown CN", openvpn.VPNAuthOTP, "nobody", "nobody", code, ErrVPNUserNotFound},
+		{"auth mode off", openvpn.VPNAuthOff, "alice", "", "", nil},
+		{"department switch off", openvpn.VPNAuthOTP, "dave", "", "", nil},
+		{"username differs from CN", openvpn.VPNAuthOTP, "alice", "bob", code, ErrVPNUsernameMismatch},
+		{"unapproved user", openvpn.VPNAuthOTP, "bob", "bob", code, ErrVPNUserDisabled},
+		{"not enrolled", openvpn.VPNAuthOTP, "frank", "frank", code, ErrVPNMFANotEnrolled},
+		{"wrong password", openvpn.VPNAuthPasswordOTP, "alice", "alice", "wrong" + code, ErrVPNPasswordInvalid},
+		{"wrong code", openvpn.VPNAuthOTP, "alice", "alice", "000000", ErrVPNOTPInvalid},
+		{"password and code", openvpn.VPNAuthPasswordOTP, "alice", "alice", "secret" + code, nil},
+		// 同一个码只能用一次（与 Web 登录共用 mfa_last_step）
+		{"reused code", openvpn.VPNAuthOTP, "alice", "alice", code, ErrVPNOTPInvalid},
+		// 上级部门开启的开关对下级部门同样生效
+		{"inherited switch", openvpn.VPNAuthOTP, "carol", "carol", "", ErrVPNOTPInvalid},
+		{"code only", openvpn.VPNAuthOTP, "erin", "erin", code, nil},
+	}
+	for _, c := range cases {
+		if err := VerifyVPNLogin(db, c.mode, c.commonName, c.username, c.input, now); !errors.Is(err, c.want) {
+			t.Errorf("%s: err = %v, want %v", c.name, err, c.want)
+		}
+	}
+
+	var alice model.User
+	db.First(&alice, "name = ?", "alice")
+	if alice.MFALastStep != now.Unix()/30 {
+		t.Errorf("mfa_last_step = %d, want %d", alice.MFALastStep, now.Unix()/30)
+	}
+}
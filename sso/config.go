@@ -0,0 +1,138 @@
+// Package sso 管理面板的 OpenID Connect 单点登录（授权码 + PKCE）。
+//
+// 配置文件默认为 config/oidc.json（OIDC_CONFIG 可覆盖），文件不存在即不启用。
+package sso
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"openvpn-admin-go/utils"
+)
+
+// DefaultConfigPath 默认配置文件路径（相对工作目录）
+const DefaultConfigPath = "config/oidc.json"
+
+// DepartmentMapping 首次登录自动开通时，groups 声明中的组 → 部门名称。列表中靠前的映射优先。
+type DepartmentMapping struct {
+	Group      string `json:"group"`
+	Department string `json:"department"`
+}
+
+// Config OIDC 客户端参数与声明映射
+type Config struct {
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"` // 为空时读取 OIDC_CLIENT_SECRET；公共客户端可不设
+	// RedirectURL 身份提供方回调的前端页面，默认 APP_BASE_URL + /auth/oidc/callback
+	RedirectURL string   `json:"redirect_url"`
+	Scopes      []string `json:"scopes"`
+	// DisplayName 登录页按钮上显示的名称
+	DisplayName   string `json:"display_name"`
+	EmailClaim    string `json:"email_claim"`
+	UsernameClaim string `json:"username_claim"`
+	GroupsClaim   string `json:"groups_claim"`
+	// AllowUnverifiedEmail 接受 email_verified 不为 true 的身份（默认拒绝：按邮箱关联已有账号前必须确认邮箱归属）
+	AllowUnverifiedEmail bool `json:"allow_unverified_email"`
+	// AllowedGroups 非空时只有属于其中任一组的身份可以登录
+	AllowedGroups []string `json:"allowed_groups"`
+	// AutoProvision 没有对应账号时自动创建（待审批），部门按 DepartmentMappings，都不匹配时为 DefaultDepartment
+	AutoProvision      bool                `json:"auto_provision"`
+	DefaultDepartment  string              `json:"default_department"`
+	DepartmentMappings []DepartmentMapping `json:"department_mappings"`
+}
+
+// LoadConfig 读取配置并补全默认值；文件不存在时返回 nil, nil（不启用）
+func LoadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("parse %s: %v", path, err)
+	}
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+func (c *Config) applyDefaults() {
+	if c.ClientSecret == "" {
+		c.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	}
+	if c.RedirectURL == "" {
+		c.RedirectURL = utils.GetAppBaseURL() + "/auth/oidc/callback"
+	}
+	if len(c.Scopes) == 0 {
+		c.Scopes = []string{"openid", "profile", "email"}
+	}
+	if c.DisplayName == "" {
+		c.DisplayName = "SSO"
+	}
+	if c.EmailClaim == "" {
+		c.EmailClaim = "email"
+	}
+	if c.UsernameClaim == "" {
+		c.UsernameClaim = "preferred_username"
+	}
+	if c.GroupsClaim == "" {
+		c.GroupsClaim = "groups"
+	}
+}
+
+// Validate 检查必填项
+func (c *Config) Validate() error {
+	if c.Issuer == "" || c.ClientID == "" {
+		return fmt.Errorf("issuer and client_id are required")
+	}
+	hasOpenID := false
+	for _, s := range c.Scopes {
+		hasOpenID = hasOpenID || s == "openid"
+	}
+	if !hasOpenID {
+		return fmt.Errorf("scopes must include openid")
+	}
+	if c.AutoProvision && c.DefaultDepartment == "" && len(c.DepartmentMappings) == 0 {
+		return fmt.Errorf("auto_provision requires default_department or department_mappings")
+	}
+	for i, m := range c.DepartmentMappings {
+		if m.Group == "" || m.Department == "" {
+			return fmt.Errorf("department_mappings[%d]: group and department are required", i)
+		}
+	}
+	return nil
+}
+
+// groupAllowed 身份是否满足 allowed_groups
+func (c *Config) groupAllowed(groups []string) bool {
+	if len(c.AllowedGroups) == 0 {
+		return true
+	}
+	for _, g := range groups {
+		for _, allowed := range c.AllowedGroups {
+			if strings.EqualFold(g, allowed) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Department 自动开通时使用的部门名称
+func (c *Config) Department(groups []string) string {
+	for _, m := range c.DepartmentMappings {
+		for _, g := range groups {
+			if strings.EqualFold(g, m.Group) {
+				return m.Department
+			}
+		}
+	}
+	return c.DefaultDepartment
+}
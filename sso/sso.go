@@ -0,0 +1,251 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"openvpn-admin-go/utils"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// 登录失败的原因
+var (
+	ErrInvalidState     = errors.New("unknown or expired login state")
+	ErrEmailNotVerified = errors.New("identity provider has not verified the email address")
+	ErrGroupNotAllowed  = errors.New("identity is not in an allowed group")
+)
+
+// AuthRequestTTL 从跳转到身份提供方到回调的最长时间
+const AuthRequestTTL = 10 * time.Minute
+
+// Identity 从 ID Token 中取出的身份
+type Identity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Groups        []string
+}
+
+// authRequest 一次进行中的登录：PKCE verifier 与 nonce 只保存在服务端
+type authRequest struct {
+	verifier string
+	nonce    string
+	expires  time.Time
+}
+
+// Provider 已完成发现（discovery）的身份提供方
+type Provider struct {
+	cfg      *Config
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+
+	mu      sync.Mutex
+	pending map[string]authRequest
+	now     func() time.Time
+}
+
+// NewProvider 读取 issuer 的 /.well-known/openid-configuration
+func NewProvider(ctx context.Context, cfg *Config) (*Provider, error) {
+	p, err := oidc.NewProvider(ctx, cfg.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("OIDC discovery: %v", err)
+	}
+	return &Provider{
+		cfg: cfg,
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     p.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       cfg.Scopes,
+		},
+		verifier: p.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+		pending:  make(map[string]authRequest),
+		now:      time.Now,
+	}, nil
+}
+
+// Config 当前配置
+func (p *Provider) Config() *Config {
+	return p.cfg
+}
+
+func randomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// AuthCodeURL 开始一次登录，返回身份提供方的授权地址（带 state、nonce 与 S256 code_challenge）
+// 与 state；调用方应把 state 绑定到发起登录的浏览器，回调时核对
+func (p *Provider) AuthCodeURL() (string, string, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	p.mu.Lock()
+	now := p.now()
+	for k, r := range p.pending {
+		if now.After(r.expires) {
+			delete(p.pending, k)
+		}
+	}
+	p.pending[state] = authRequest{verifier: verifier, nonce: nonce, expires: now.Add(AuthRequestTTL)}
+	p.mu.Unlock()
+
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// takeRequest 取出并作废 state 对应的登录（每个 state 只能回调一次）
+func (p *Provider) takeRequest(state string) (authRequest, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r, ok := p.pending[state]
+	delete(p.pending, state)
+	if !ok || p.now().After(r.expires) {
+		return authRequest{}, false
+	}
+	return r, true
+}
+
+// Exchange 处理回调：校验 state，用授权码与 PKCE verifier 换取令牌，验证 ID Token（签名、受众、nonce），
+// 并按配置检查邮箱验证状态与允许的组
+func (p *Provider) Exchange(ctx context.Context, state, code string) (*Identity, error) {
+	req, ok := p.takeRequest(state)
+	if !ok || code == "" {
+		return nil, ErrInvalidState
+	}
+	token, err := p.oauth.Exchange(ctx, code, oauth2.VerifierOption(req.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok || rawIDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %v", err)
+	}
+	if idToken.Nonce != req.nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode id_token claims: %v", err)
+	}
+
+	id := &Identity{
+		Subject:       idToken.Subject,
+		Email:         stringClaim(claims, p.cfg.EmailClaim),
+		EmailVerified: boolClaim(claims, "email_verified"),
+		Username:      stringClaim(claims, p.cfg.UsernameClaim),
+		Groups:        stringsClaim(claims, p.cfg.GroupsClaim),
+	}
+	if id.Email == "" || (!id.EmailVerified && !p.cfg.AllowUnverifiedEmail) {
+		return nil, ErrEmailNotVerified
+	}
+	if !p.cfg.groupAllowed(id.Groups) {
+		return nil, ErrGroupNotAllowed
+	}
+	return id, nil
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	s, _ := claims[name].(string)
+	return strings.TrimSpace(s)
+}
+
+// boolClaim 部分身份提供方把布尔声明编码成字符串 "true"
+func boolClaim(claims map[string]interface{}, name string) bool {
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+// stringsClaim 组声明可能是字符串数组，也可能是单个字符串
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch v := claims[name].(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		out := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+var (
+	mu       sync.Mutex
+	current  *Config
+	provider *Provider
+)
+
+// Init 加载配置文件（OIDC_CONFIG，默认 config/oidc.json）。发现在首次登录时进行，身份提供方暂时不可用不影响启动。
+func Init() error {
+	cfg, err := LoadConfig(utils.GetEnvOrDefault("OIDC_CONFIG", DefaultConfigPath))
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	current, provider = cfg, nil
+	mu.Unlock()
+	return nil
+}
+
+// Enabled 是否启用了 OIDC 登录
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return current != nil
+}
+
+// Current 当前配置；未启用时返回 nil
+func Current() *Config {
+	mu.Lock()
+	defer mu.Unlock()
+	return current
+}
+
+// Default 已完成发现的身份提供方；发现失败时下次调用重试
+func Default(ctx context.Context) (*Provider, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if current == nil {
+		return nil, errors.New("OIDC login is not configured")
+	}
+	if provider == nil {
+		p, err := NewProvider(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		provider = p
+	}
+	return provider, nil
+}
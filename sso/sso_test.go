@@ -0,0 +1,230 @@
+package sso
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// mockProvider 进程内的最小 OIDC 身份提供方：发现文档、JWKS 与支持 PKCE 的令牌端点
+type mockProvider struct {
+	t      *testing.T
+	srv    *httptest.Server
+	key    *rsa.PrivateKey
+	claims map[string]interface{}
+
+	mu    sync.Mutex
+	codes map[string]issuedCode // 授权码 → 授权请求
+}
+
+type issuedCode struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockProvider{t: t, key: key, codes: make(map[string]issuedCode)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                m.srv.URL,
+			"authorization_endpoint":                m.srv.URL + "/authorize",
+			"token_endpoint":                        m.srv.URL + "/token",
+			"jwks_uri":                              m.srv.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "test",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", m.token)
+	m.srv = httptest.NewServer(mux)
+	t.Cleanup(m.srv.Close)
+	return m
+}
+
+// authorize 模拟用户在身份提供方完成登录：记下 code_challenge 与 nonce，返回回调参数
+func (m *mockProvider) authorize(authURL string) (state, code string) {
+	m.t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+		m.t.Fatalf("authorization request without S256 PKCE: %s", authURL)
+	}
+	code = base64.RawURLEncoding.EncodeToString([]byte(q.Get("state")))[:16]
+	m.mu.Lock()
+	m.codes[code] = issuedCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+	return q.Get("state"), code
+}
+
+func (m *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	issued, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != issued.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(`{"error":"invalid_grant"}`))
+		return
+	}
+	claims := jwt.MapClaims{
+		"iss":   m.srv.URL,
+		"aud":   "panel",
+		"sub":   "user-123",
+		"nonce": issued.nonce,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	tok.Header["kid"] = "test"
+	idToken, err := tok.SignedString(m.key)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "at", "token_type": "Bearer", "expires_in": 3600, "id_token": idToken,
+	})
+}
+
+func (m *mockProvider) newProvider(cfg Config) *Provider {
+	m.t.Helper()
+	cfg.Issuer, cfg.ClientID = m.srv.URL, "panel"
+	cfg.RedirectURL = "http://localhost:3000/auth/oidc/callback"
+	cfg.applyDefaults()
+	if err := cfg.Validate(); err != nil {
+		m.t.Fatal(err)
+	}
+	p, err := NewProvider(context.Background(), &cfg)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	return p
+}
+
+func TestExchange(t *testing.T) {
+	m := newMockProvider(t)
+	m.claims = map[string]interface{}{
+		"email": "alice@corp.example", "email_verified": true,
+		"preferred_username": "alice", "groups": []string{"vpn-users", "eng"},
+	}
+	p := m.newProvider(Config{})
+
+	authURL, _, err := p.AuthCodeURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	state, code := m.authorize(authURL)
+	id, err := p.Exchange(context.Background(), state, code)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if id.Subject != "user-123" || id.Email != "alice@corp.example" || id.Username != "alice" || len(id.Groups) != 2 {
+		t.Fatalf("identity = %+v", id)
+	}
+
+	// state 只能使用一次
+	if _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("replayed state err = %v", err)
+	}
+	if _, err := p.Exchange(context.Background(), "forged", code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("forged state err = %v", err)
+	}
+}
+
+func TestExchangeExpiredState(t *testing.T) {
+	m := newMockProvider(t)
+	m.claims = map[string]interface{}{"email": "a@corp.example", "email_verified": true}
+	p := m.newProvider(Config{})
+	authURL, _, _ := p.AuthCodeURL()
+	state, code := m.authorize(authURL)
+	p.now = func() time.Time { return time.Now().Add(AuthRequestTTL + time.Minute) }
+	if _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("expired state err = %v", err)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	m.claims = map[string]interface{}{"email": "a@corp.example", "email_verified": true}
+	p := m.newProvider(Config{})
+	authURL, _, _ := p.AuthCodeURL()
+	state, code := m.authorize(authURL)
+	// 被截获的授权码配上另一次登录的 verifier 换不到令牌
+	p.mu.Lock()
+	r := p.pending[state]
+	r.verifier = "attacker-verifier-attacker-verifier-attacker-verifier"
+	p.pending[state] = r
+	p.mu.Unlock()
+	if _, err := p.Exchange(context.Background(), state, code); err == nil {
+		t.Fatal("exchange with a wrong PKCE verifier succeeded")
+	}
+}
+
+func TestExchangePolicy(t *testing.T) {
+	m := newMockProvider(t)
+
+	m.claims = map[string]interface{}{"email": "a@corp.example", "email_verified": "false"}
+	p := m.newProvider(Config{})
+	authURL, _, _ := p.AuthCodeURL()
+	state, code := m.authorize(authURL)
+	if _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrEmailNotVerified) {
+		t.Fatalf("unverified email err = %v", err)
+	}
+
+	m.claims = map[string]interface{}{"email": "a@corp.example", "email_verified": "true", "groups": "contractors"}
+	p = m.newProvider(Config{AllowedGroups: []string{"vpn-users"}})
+	authURL, _, _ = p.AuthCodeURL()
+	state, code = m.authorize(authURL)
+	if _, err := p.Exchange(context.Background(), state, code); !errors.Is(err, ErrGroupNotAllowed) {
+		t.Fatalf("group policy err = %v", err)
+	}
+}
+
+func TestConfigDepartment(t *testing.T) {
+	cfg := Config{
+		DefaultDepartment: "Staff",
+		DepartmentMappings: []DepartmentMapping{
+			{Group: "eng", Department: "Engineering"},
+			{Group: "ops", Department: "Operations"},
+		},
+	}
+	if got := cfg.Department([]string{"OPS", "eng"}); got != "Engineering" {
+		t.Errorf("Department = %q, want the first matching mapping", got)
+	}
+	if got := cfg.Department(nil); got != "Staff" {
+		t.Errorf("Department = %q, want default", got)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"openvpn-admin-go/logging"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -40,3 +41,101 @@ func GetOpenVPNSyncInterval() time.Duration {
 
 	return time.Duration(intervalSeconds) * time.Second
 }
+
+// GetCertValidityDays 返回客户端证书有效期（天）：role 非空时优先读 CERT_VALIDITY_DAYS_<ROLE>
+// （如 CERT_VALIDITY_DAYS_ADMIN），其次 CERT_VALIDITY_DAYS。都未设置或无效时返回 0，由调用方取默认值。
+func GetCertValidityDays(role string) int {
+	keys := []string{"CERT_VALIDITY_DAYS"}
+	if role != "" {
+		keys = append([]string{"CERT_VALIDITY_DAYS_" + strings.ToUpper(role)}, keys...)
+	}
+	for _, key := range keys {
+		value := os.Getenv(key)
+		if value == "" {
+			continue
+		}
+		days, err := strconv.Atoi(value)
+		if err != nil || days <= 0 {
+			logging.Warn("Ignoring invalid %s value '%s': must be a positive integer", key, value)
+			continue
+		}
+		return days
+	}
+	return 0
+}
+
+// GetCertExpiryWarnDays 证书到期前多少天发出提醒（CERT_EXPIRY_WARN_DAYS，默认 30）
+func GetCertExpiryWarnDays() int {
+	defaultDays := 30
+	days, err := strconv.Atoi(GetEnvOrDefault("CERT_EXPIRY_WARN_DAYS", strconv.Itoa(defaultDays)))
+	if err != nil || days <= 0 {
+		logging.Warn("CERT_EXPIRY_WARN_DAYS must be a positive integer. Using default %d days.", defaultDays)
+		return defaultDays
+	}
+	return days
+}
+
+// GetMFARequiredRoles 必须启用两步验证才能登录的角色（MFA_REQUIRED_ROLES，逗号分隔，
+// 默认 none 即不强制）。Web 控制台还没有登录时的两步验证页面，由运维确认客户端支持后再开启
+func GetMFARequiredRoles() []string {
+	value := GetEnvOrDefault("MFA_REQUIRED_ROLES", "none")
+	if strings.EqualFold(strings.TrimSpace(value), "none") {
+		return nil
+	}
+	var roles []string
+	for _, r := range strings.Split(value, ",") {
+		if r = strings.TrimSpace(r); r != "" {
+			roles = append(roles, strings.ToLower(r))
+		}
+	}
+	return roles
+}
+
+// GetMFAIssuer 验证器 App 中显示的签发方名称（MFA_ISSUER，默认 Aegis）
+func GetMFAIssuer() string {
+	return GetEnvOrDefault("MFA_ISSUER", "Aegis")
+}
+
+// GetAppName 邮件等对外文案中的系统名称（APP_NAME，默认 Aegis）
+func GetAppName() string {
+	return GetEnvOrDefault("APP_NAME", "Aegis")
+}
+
+// GetAppBaseURL Web 控制台的外部访问地址，用于拼接邮件中的链接（APP_BASE_URL，默认 http://localhost:3000）
+func GetAppBaseURL() string {
+	return strings.TrimRight(GetEnvOrDefault("APP_BASE_URL", "http://localhost:3000"), "/")
+}
+
+// GetLoginLockoutThreshold 同一账号连续登录失败多少次后锁定（LOGIN_LOCKOUT_THRESHOLD，默认 5；0 表示不锁定）
+func GetLoginLockoutThreshold() int {
+	defaultThreshold := 5
+	n, err := strconv.Atoi(GetEnvOrDefault("LOGIN_LOCKOUT_THRESHOLD", strconv.Itoa(defaultThreshold)))
+	if err != nil || n < 0 {
+		logging.Warn("LOGIN_LOCKOUT_THRESHOLD must be a non-negative integer. Using default %d.", defaultThreshold)
+		return defaultThreshold
+	}
+	return n
+}
+
+// GetLoginLockoutDurations 首次锁定时长（LOGIN_LOCKOUT_MINUTES，默认 1 分钟）与上限
+// （LOGIN_LOCKOUT_MAX_MINUTES，默认 1440 分钟）；达到阈值后每多失败一次时长翻倍
+func GetLoginLockoutDurations() (base, max time.Duration) {
+	minutes := func(key string, def int) time.Duration {
+		n, err := strconv.Atoi(GetEnvOrDefault(key, strconv.Itoa(def)))
+		if err != nil || n <= 0 {
+			logging.Warn("%s must be a positive integer. Using default %d minutes.", key, def)
+			n = def
+		}
+		return time.Duration(n) * time.Minute
+	}
+	base, max = minutes("LOGIN_LOCKOUT_MINUTES", 1), minutes("LOGIN_LOCKOUT_MAX_MINUTES", 1440)
+	if max < base {
+		max = base
+	}
+	return base, max
+}
+
+// GetRateLimitBackend 限流计数的存储（RATE_LIMIT_BACKEND）：memory（默认，进程内）或 database（多副本共享、重启保留）
+func GetRateLimitBackend() string {
+	return strings.ToLower(strings.TrimSpace(GetEnvOrDefault("RATE_LIMIT_BACKEND", "memory")))
+}